@@ -342,7 +342,7 @@ func main() {
 			return
 		}
 
-		tokens, err := planner.ExecuteRebalanceInternal(gClusterUrl, change, masterId, true, gDetail, true, false, 0, 0, false, nil)
+		tokens, err := planner.ExecuteRebalanceInternal(gClusterUrl, change, masterId, true, gDetail, true, false, 0, 0, false, 0, 0, false, nil)
 		if err != nil {
 			logging.Fatalf("Planner error: %v.", err)
 			return
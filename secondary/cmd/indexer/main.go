@@ -12,6 +12,7 @@ package main
 import (
 	"flag"
 	"os"
+	"path/filepath"
 	"strings"
 
 	"github.com/couchbase/cbauth"
@@ -51,6 +52,7 @@ func main() {
 	keyFile := fset.String("keyFile", "", "Index https cert key file")
 	isEnterprise := fset.Bool("isEnterprise", true, "Enterprise Edition")
 	isIPv6 := fset.Bool("ipv6", false, "IPV6 cluster")
+	metadataDir := fset.String("metadataDir", "", "Local directory for cluster metadata, instead of metakv, and cluster topology in "+common.LocalClusterInfoFile+", instead of ns_server (standalone mode)")
 
 	for i := 1; i < len(os.Args); i++ {
 		if err := fset.Parse(os.Args[i : i+1]); err != nil {
@@ -74,6 +76,17 @@ func main() {
 		}
 	}
 
+	if *metadataDir != "" {
+		store, err := common.NewLocalMetadataStore(*metadataDir)
+		common.CrashOnError(err)
+		common.SetMetadataStore(store)
+		logging.Infof("Using local metadata store %v", *metadataDir)
+
+		info, err := common.LoadLocalClusterInfo(filepath.Join(*metadataDir, common.LocalClusterInfoFile))
+		common.CrashOnError(err)
+		common.SetLocalClusterInfo(info)
+	}
+
 	go common.ExitOnStdinClose()
 
 	config := common.SystemConfig
@@ -18,19 +18,22 @@ func (codec *Codec) ExplodeArray(code []byte, tmp []byte) ([][]byte, error) {
 		return nil, ErrNotAnArray
 	}
 
-	code = code[1:]
-	elemBuf := code
-	for code[0] != Terminator {
-		_, code, err = codec.code2json(code, tmp)
-		if err != nil {
-			break
+	err = codec.decodeCollated(code, func(dec *Codec) (err error) {
+		code = code[1:]
+		elemBuf := code
+		for code[0] != Terminator {
+			_, code, err = dec.code2json(code, tmp)
+			if err != nil {
+				break
+			}
+
+			if size := len(elemBuf) - len(code); size > 0 {
+				array = append(array, elemBuf[:size])
+				elemBuf = code
+			}
 		}
-
-		if size := len(elemBuf) - len(code); size > 0 {
-			array = append(array, elemBuf[:size])
-			elemBuf = code
-		}
-	}
+		return
+	})
 
 	return array, err
 }
@@ -49,28 +52,31 @@ func (codec *Codec) ExplodeArray2(code []byte, tmp, decbuf []byte, cktmp, dktmp
 		return nil, nil, ErrNotAnArray
 	}
 
-	code = code[1:]
-	elemBuf := code
-
-	pos := 0
-	for code[0] != Terminator {
-		text, code, err = codec.code2json(code, tmp)
-		if err != nil {
-			break
+	err = codec.decodeCollated(code, func(dec *Codec) (err error) {
+		code = code[1:]
+		elemBuf := code
+
+		pos := 0
+		for code[0] != Terminator {
+			text, code, err = dec.code2json(code, tmp)
+			if err != nil {
+				break
+			}
+
+			if dktmp != nil {
+				copy(decbuf, text)
+				dktmp[pos] = decbuf[:len(text)]
+				decbuf = decbuf[len(text):]
+			}
+
+			if size := len(elemBuf) - len(code); size > 0 {
+				cktmp[pos] = elemBuf[:size]
+				elemBuf = code
+			}
+			pos++
 		}
-
-		if dktmp != nil {
-			copy(decbuf, text)
-			dktmp[pos] = decbuf[:len(text)]
-			decbuf = decbuf[len(text):]
-		}
-
-		if size := len(elemBuf) - len(code); size > 0 {
-			cktmp[pos] = elemBuf[:size]
-			elemBuf = code
-		}
-		pos++
-	}
+		return
+	})
 
 	return cktmp, dktmp, err
 }
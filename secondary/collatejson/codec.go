@@ -217,7 +217,7 @@ func EncodeFloat(text, code []byte) []byte {
 	if len(text) == 0 { // empty input
 		return code
 	}
-	if val, e := strconv.ParseFloat(string(text), 64); e == nil && val == 0 {
+	if isZeroFloat(text) {
 		code = append(code, ZERO)
 		return code
 	}
@@ -257,6 +257,25 @@ func EncodeFloat(text, code []byte) []byte {
 	return code
 }
 
+// local function that checks whether text in e-notation is zero. Unlike
+// strconv.ParseFloat it does not mistake numbers too small for float64
+// as zero.
+func isZeroFloat(text []byte) bool {
+	zero := false
+	for _, x := range text {
+		switch x {
+		case 'e', 'E':
+			return zero
+		case ZERO:
+			zero = true
+		case PLUS, MINUS, DOT:
+		default:
+			return false
+		}
+	}
+	return zero
+}
+
 var flipmap = map[byte]byte{PLUS: MINUS, MINUS: PLUS}
 
 // DecodeFloat complements EncodeFloat, it returns `exponent` and `mantissa`
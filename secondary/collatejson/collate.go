@@ -16,14 +16,17 @@
 package collatejson
 
 import "bytes"
-import json "github.com/couchbase/indexing/secondary/common/json"
 import "errors"
 import "strings"
 import "sort"
 import "fmt"
+import "math"
 import "strconv"
 import "sync"
+import json "github.com/couchbase/indexing/secondary/common/json"
 import n1ql "github.com/couchbase/query/value"
+import "golang.org/x/text/collate"
+import "golang.org/x/text/language"
 
 var bufPool *sync.Pool
 
@@ -84,15 +87,15 @@ type Codec struct {
 	doMissing         bool        // if true, handle missing values (for N1QL)
 	numberType        interface{} // "float64" | "int64" | "decimal"
 	//-- unicode
-	//backwards        bool
-	//hiraganaQ        bool
-	//caseLevel        bool
-	//numeric          bool
-	//nfkd              bool
-	//utf8              bool
-	//strength          colltab.Level
-	//alternate         collate.AlternateHandling
-	//language          language.Tag
+	nfkd      bool
+	utf8      bool
+	language  language.Tag
+	options   []collate.Option
+	collators *sync.Pool // of *collate.Collator
+	collation string     // name passed to SetCollation
+	tie       Tie
+	ties      []byte // tie-breaks of value being decoded
+	top       []byte // value being decoded, to locate ties
 }
 
 // NewCodec creates a new codec object and returns a reference to it.
@@ -102,6 +105,7 @@ func NewCodec(propSize int) *Codec {
 		propertyLenPrefix: true,
 		doMissing:         true,
 		numberType:        float64(0.0),
+		utf8:              true,
 	}
 }
 
@@ -143,18 +147,20 @@ func (codec *Codec) NumberType(what string) {
 // Encode json documents to order preserving binary representation.
 // `code` is the output buffer for encoding and expected to have
 // enough capacity, atleast 3x of input `text` and > MinBufferSize.
-func (codec *Codec) Encode(text, code []byte) ([]byte, error) {
+func (codec *Codec) Encode(text, code []byte) (bs []byte, err error) {
 	code = code[:0]
 	if cap(code) < (3*len(text)) || cap(code) < MinBufferSize {
 		return nil, ErrorOutputLen
 	} else if len(text) == 0 {
 		return code, nil
 	}
-	var m interface{}
-	if err := json.Unmarshal(text, &m); err != nil {
-		return nil, err
+	if codec.isCollated() {
+		// sort key of collated strings can outgrow 3x of input.
+		defer recoverOutputLen(&err)
 	}
-	return codec.json2code(m, code)
+	return codec.encodeCollated(code, func(code []byte) ([]byte, error) {
+		return codec.encodeStream(text, code)
+	})
 }
 
 // Decode a slice of byte into json string and return them as
@@ -166,7 +172,10 @@ func (codec *Codec) Decode(code, text []byte) ([]byte, error) {
 	if cap(text) < len(code) || cap(text) < MinBufferSize {
 		return nil, ErrorOutputLen
 	}
-	text, _, err := codec.code2json(code, text)
+	err := codec.decodeCollated(code, func(dec *Codec) (err error) {
+		text, _, err = dec.code2json(code, text)
+		return
+	})
 	return text, err
 }
 
@@ -189,23 +198,13 @@ func (codec *Codec) json2code(val interface{}, code []byte) ([]byte, error) {
 		}
 
 	case float64:
-		code = append(code, TypeNumber)
-		cs, err = codec.normalizeFloat(value, code[1:])
-		if err == nil {
-			code = code[:len(code)+len(cs)]
-			code = append(code, Terminator)
-		}
+		code, err = codec.encodeFloat64(value, code)
 
 	case int64:
-		code = append(code, TypeNumber)
-		var intStr string
-		var number Integer
-		intStr, err = number.ConvertToScientificNotation(value)
-		cs = EncodeFloat([]byte(intStr), code[1:])
-		if err == nil {
-			code = code[:len(code)+len(cs)]
-			code = append(code, Terminator)
-		}
+		code, err = codec.encodeInt64(value, code)
+
+	case json.Number:
+		code, err = codec.encodeNumber(value, code)
 
 	case int:
 		code = append(code, TypeNumber)
@@ -214,21 +213,10 @@ func (codec *Codec) json2code(val interface{}, code []byte) ([]byte, error) {
 		code = append(code, Terminator)
 
 	case Length:
-		code = append(code, TypeLength)
-		cs = EncodeInt([]byte(strconv.Itoa(int(value))), code[1:])
-		code = code[:len(code)+len(cs)]
-		code = append(code, Terminator)
+		code = codec.encodeLength(value, code)
 
 	case string:
-		if codec.doMissing && MissingLiteral.Equal(value) {
-			code = append(code, TypeMissing)
-			code = append(code, Terminator)
-		} else {
-			code = append(code, TypeString)
-			cs = suffixEncodeString([]byte(value), code[1:])
-			code = code[:len(code)+len(cs)]
-			code = append(code, Terminator)
-		}
+		code = codec.encodeString([]byte(value), code)
 
 	case []interface{}:
 		code = append(code, TypeArray)
@@ -282,6 +270,69 @@ func (codec *Codec) json2code(val interface{}, code []byte) ([]byte, error) {
 	return code, err
 }
 
+func (codec *Codec) encodeFloat64(value float64, code []byte) ([]byte, error) {
+	code = append(code, TypeNumber)
+	cs, err := codec.normalizeFloat(value, code[1:])
+	if err == nil {
+		code = code[:len(code)+len(cs)]
+		code = append(code, Terminator)
+	}
+	return code, err
+}
+
+func (codec *Codec) encodeInt64(value int64, code []byte) ([]byte, error) {
+	code = append(code, TypeNumber)
+	var number Integer
+	intStr, err := number.ConvertToScientificNotation(value)
+	cs := EncodeFloat([]byte(intStr), code[1:])
+	if err == nil {
+		code = code[:len(code)+len(cs)]
+		code = append(code, Terminator)
+	}
+	return code, err
+}
+
+// encodeNumber encodes JSON number same as streamEncoder encodes its
+// literal.
+func (codec *Codec) encodeNumber(value json.Number, code []byte) ([]byte, error) {
+	if i, err := value.Int64(); err == nil {
+		return codec.encodeInt64(i, code)
+	} else if codec.isExactNumber() {
+		if cs, ok := codec.encodeNumberText([]byte(value), code); ok {
+			return cs, nil
+		}
+	}
+	f, err := value.Float64()
+	if err != nil {
+		return code, err
+	}
+	return codec.encodeFloat64(f, code)
+}
+
+func (codec *Codec) encodeLength(value Length, code []byte) []byte {
+	code = append(code, TypeLength)
+	cs := EncodeInt([]byte(strconv.Itoa(int(value))), code[1:])
+	code = code[:len(code)+len(cs)]
+	return append(code, Terminator)
+}
+
+func (codec *Codec) encodeString(value []byte, code []byte) []byte {
+	if codec.doMissing && string(value) == string(MissingLiteral) {
+		code = append(code, TypeMissing)
+		code = append(code, Terminator)
+	} else if codec.isCollated() {
+		code = append(code, TypeString)
+		code = codec.encodeCollatedString(string(value), code)
+		code = append(code, Terminator)
+	} else {
+		code = append(code, TypeString)
+		cs := suffixEncodeString(value, code[1:])
+		code = code[:len(code)+len(cs)]
+		code = append(code, Terminator)
+	}
+	return code
+}
+
 var null = []byte("null")
 var boolTrue = []byte("true")
 var boolFalse = []byte("false")
@@ -333,7 +384,16 @@ func (codec *Codec) code2json(code, text []byte) ([]byte, []byte, error) {
 	case TypeString:
 		var strb []byte
 		tmp := bufPool.Get().(*[]byte)
-		strb, remaining, err = suffixDecodeString(code[1:], (*tmp)[:0])
+		remaining = code[1:]
+		if len(remaining) > 0 && remaining[0] == collatedMarker {
+			// skip the sort key, original string is its tie-break.
+			_, remaining, err = suffixDecodeString(remaining[1:], (*tmp)[:0])
+			if err == nil {
+				strb, err = codec.nextTie((*tmp)[:0])
+			}
+		} else {
+			strb, remaining, err = suffixDecodeString(remaining, (*tmp)[:0])
+		}
 		if err == nil {
 			text, err = encodeString(strb, text)
 			bufPool.Put(tmp)
@@ -467,6 +527,9 @@ func getDatum(code []byte) (datum []byte, remaining []byte) {
 func (codec *Codec) normalizeFloat(value float64, code []byte) ([]byte, error) {
 	switch codec.numberType.(type) {
 	case float64:
+		if isIntegral(value) {
+			return codec.normalizeIntegral(value, code), nil
+		}
 		cs := EncodeFloat([]byte(strconv.FormatFloat(value, 'e', -1, 64)), code)
 		return cs, nil
 
@@ -474,28 +537,41 @@ func (codec *Codec) normalizeFloat(value float64, code []byte) ([]byte, error) {
 		return EncodeInt([]byte(strconv.Itoa(int(value))), code), nil
 
 	case string:
+		if isIntegral(value) {
+			return codec.normalizeIntegral(value, code), nil
+		}
 		cs := EncodeFloat([]byte(strconv.FormatFloat(value, 'e', -1, 64)), code)
 		return cs, nil
 	}
 	return nil, ErrorNumberType
 }
 
-func (codec *Codec) denormalizeFloat(text []byte) ([]byte, error) {
-	var err error
-	var f float64
+// normalizeIntegral encodes integral value same as int64, so that
+// numbers collate equal irrespective of their type.
+func (codec *Codec) normalizeIntegral(value float64, code []byte) []byte {
+	var number Integer
+	intStr, _ := number.ConvertToScientificNotation(int64(value))
+	return EncodeFloat([]byte(intStr), code)
+}
+
+// isIntegral tells whether value is an integer that fits in int64.
+func isIntegral(value float64) bool {
+	return value == math.Trunc(value) && value >= -(1<<63) && value < (1<<63)
+}
 
+func (codec *Codec) denormalizeFloat(text []byte) ([]byte, error) {
 	switch codec.numberType.(type) {
 	case float64:
 		return text, nil
 
 	case int64:
-		f, err = strconv.ParseFloat(string(text), 64)
+		f, _ := strconv.ParseFloat(string(text), 64)
 		return []byte(strconv.Itoa(int(f))), nil
 
 	case string:
-		f, err = strconv.ParseFloat(string(text), 64)
-		if err == nil {
-			return []byte(strconv.FormatFloat(f, 'f', -1, 64)), nil
+		// convert from text to preserve big integers and decimals.
+		if text, ok := decimalNotation(text); ok {
+			return text, nil
 		}
 
 	default:
@@ -533,6 +609,14 @@ func (codec *Codec) n1ql2code(val n1ql.Value, code []byte) ([]byte, error) {
 		var cs []byte
 		switch act.(type) {
 		case float64:
+			if codec.isInexactFloat(act.(float64)) {
+				// number might have lost precision, encode from its text.
+				if text, e := val.MarshalJSON(); e == nil {
+					if cs, ok := codec.encodeNumberText(text, code[:len(code)-1]); ok {
+						return cs, nil
+					}
+				}
+			}
 			cs, err = codec.normalizeFloat(act.(float64), code[1:])
 		case int64:
 			var intStr string
@@ -547,8 +631,12 @@ func (codec *Codec) n1ql2code(val n1ql.Value, code []byte) ([]byte, error) {
 	case n1ql.STRING:
 		code = append(code, TypeString)
 		act := val.ActualForIndex().(string)
-		cs = suffixEncodeString([]byte(act), code[1:])
-		code = code[:len(code)+len(cs)]
+		if codec.isCollated() {
+			code = codec.encodeCollatedString(act, code)
+		} else {
+			cs = suffixEncodeString([]byte(act), code[1:])
+			code = code[:len(code)+len(cs)]
+		}
 		code = append(code, Terminator)
 	case n1ql.MISSING:
 		code = append(code, TypeMissing)
@@ -610,16 +698,22 @@ func (codec *Codec) n1ql2code(val n1ql.Value, code []byte) ([]byte, error) {
 // Caller is responsible for providing sufficiently sized buffer
 // Otherwise it may panic
 func (codec *Codec) EncodeN1QLValue(val n1ql.Value, buf []byte) (bs []byte, err error) {
-	defer func() {
-		if r := recover(); r != nil {
-			if strings.Contains(fmt.Sprint(r), "slice bounds out of range") {
-				err = ErrorOutputLen
-			} else {
-				err = fmt.Errorf("%v", r)
-			}
+	defer recoverOutputLen(&err)
+	return codec.encodeCollated(buf, func(code []byte) ([]byte, error) {
+		return codec.n1ql2code(val, code)
+	})
+}
+
+// recoverOutputLen shall be deferred by encoders, to convert a panic due
+// to insufficient output buffer into ErrorOutputLen.
+func recoverOutputLen(err *error) {
+	if r := recover(); r != nil {
+		if strings.Contains(fmt.Sprint(r), "slice bounds out of range") {
+			*err = ErrorOutputLen
+		} else {
+			*err = fmt.Errorf("%v", r)
 		}
-	}()
-	return codec.n1ql2code(val, buf)
+	}
 }
 
 type Integer struct{}
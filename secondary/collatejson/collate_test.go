@@ -7,6 +7,7 @@ import "encoding/json"
 import "fmt"
 import "io/ioutil"
 import "log"
+import "math"
 import "path/filepath"
 import "reflect"
 import "sort"
@@ -14,6 +15,7 @@ import "strings"
 import "testing"
 import n1ql "github.com/couchbase/query/value"
 import "github.com/couchbase/indexing/secondary/common"
+import cjson "github.com/couchbase/indexing/secondary/common/json"
 
 var testcases = []struct {
 	text string
@@ -236,6 +238,177 @@ func TestReference(t *testing.T) {
 	}
 }
 
+func TestEncodeStream(t *testing.T) {
+	docs := []string{
+		`{"b":1,"a":2,"b":3}`, `{"z":{"y":[1,{"x":null,"w":true}]},"a":[]}`,
+		`{"\u0061":"\u00e9\n","a":"\ud83d\ude00"}`, `{"":"","\u0000":"\u0000"}`,
+		`[9223372036854775807,-9223372036854775808,9223372036854775808,1e300]`,
+		`[0,-0,0.5,-1.5e-3,100,12345678901234567890]`,
+		`[10,10.0,1e1,-2.5e2,1.25e-7]`, `"~[]{}falsenilNA~"`,
+		` { "a" : [ 1 , 2 ] } `, `12`, `null`, `{}`, `[]`,
+	}
+	for _, tcase := range testcases {
+		docs = append(docs, tcase.text)
+	}
+	fs, err := ioutil.ReadDir(testData)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, f := range fs {
+		if !strings.HasSuffix(f.Name(), "ref") {
+			for _, line := range readLines(filepath.Join(testData, f.Name()), t) {
+				docs = append(docs, string(line))
+			}
+		}
+	}
+
+	codecs := []*Codec{NewCodec(32), NewCodec(32), NewCodec(32), NewCodec(32)}
+	codecs[1].NumberType("decimal")
+	codecs[1].SortbyArrayLen(true)
+	codecs[2].NumberType("int64")
+	codecs[2].SortbyPropertyLen(false)
+	codecs[2].UseMissing(false)
+	if err := codecs[3].SetCollation("en_ci"); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, codec := range codecs {
+		for _, doc := range docs {
+			var m interface{}
+			dec := cjson.NewDecoder(strings.NewReader(doc))
+			if codec.isExactNumber() {
+				dec.UseNumber()
+			}
+			if err := dec.Decode(&m); err != nil {
+				t.Fatalf("Unmarshal %q: %v", doc, err)
+			}
+			ref, err := codec.encodeCollated(make([]byte, 0, 10000), func(code []byte) ([]byte, error) {
+				return codec.json2code(m, code)
+			})
+			if err != nil {
+				t.Fatalf("json2code %q: %v", doc, err)
+			}
+			code, err := codec.Encode([]byte(doc), make([]byte, 0, 10000))
+			if err != nil {
+				t.Fatalf("Encode %q: %v", doc, err)
+			}
+			if !bytes.Equal(code, ref) {
+				t.Errorf("Encode %q: %q != %q", doc, code, ref)
+			}
+		}
+	}
+
+	invalid := []string{`{"a":1`, `[1,]`, `{"a" 1}`, `12x`, `{} x`, `"abc`, `1e400`}
+	for _, doc := range invalid {
+		if _, err := codecs[0].Encode([]byte(doc), make([]byte, 0, 1024)); err == nil {
+			t.Errorf("expected error for %q", doc)
+		}
+	}
+}
+
+func TestExactNumbers(t *testing.T) {
+	// in collation order.
+	numbers := []string{
+		"-1e308", "-100000000000000000000000", "-12345678901234567891",
+		"-12345678901234567890", "-9223372036854775808", "-1.5",
+		"-0.1000000000000000000001", "-0.1", "-1e-400", "0", "1e-400", "0.1",
+		"0.1000000000000000055511151231257827", "0.5", "1", "1.5",
+		"9007199254740993", "9223372036854775807", "9223372036854775808",
+		"12345678901234567890", "12345678901234567891", "1e300", "1e308",
+	}
+	codec := NewCodec(32)
+	var prev []byte
+	for _, number := range numbers {
+		code, err := codec.Encode([]byte(number), make([]byte, 0, 1024))
+		if err != nil {
+			t.Fatalf("Encode %v: %v", number, err)
+		}
+		if prev != nil && bytes.Compare(prev, code) >= 0 {
+			t.Errorf("%v does not collate after previous number", number)
+		}
+		prev = code
+	}
+
+	samples := [][3]string{ // number, float64 decoding, decimal decoding
+		{"12345678901234567890", "0.1234567890123456789e+20", "12345678901234567890"},
+		{"1e1", "10", "10"},
+		{"-9223372036854775809", "-9223372036854775809", "-9223372036854775809"},
+		{"0.1000000000000000055511151231257827",
+			"0.1000000000000000055511151231257827e+0",
+			"0.1000000000000000055511151231257827"},
+		{"-123456789.0123456789012", "-0.1234567890123456789012e+9",
+			"-123456789.0123456789012"},
+		{"1.5e-2000", "0.15e-1999", "0.15e-1999"},
+	}
+	for _, numberType := range []string{"float64", "decimal"} {
+		codec := NewCodec(32)
+		codec.NumberType(numberType)
+		for _, sample := range samples {
+			code, err := codec.Encode([]byte(sample[0]), make([]byte, 0, 1024))
+			if err != nil {
+				t.Fatalf("Encode %v: %v", sample[0], err)
+			}
+			text, err := codec.Decode(code, make([]byte, 0, 1024))
+			if err != nil {
+				t.Fatalf("Decode %v: %v", sample[0], err)
+			}
+			ref := sample[1]
+			if numberType == "decimal" {
+				ref = sample[2]
+			}
+			if string(text) != ref {
+				t.Errorf("%v decoded as %s, expected %v", sample[0], text, ref)
+			}
+		}
+	}
+}
+
+func TestNumberTypes(t *testing.T) {
+	testcases := []struct {
+		text   string
+		values []interface{}
+	}{
+		{"10", []interface{}{int64(10), float64(10)}},
+		{"10.0", []interface{}{int64(10), float64(10)}},
+		{"-2.5e2", []interface{}{int64(-250), float64(-250)}},
+		{"0", []interface{}{int64(0), float64(0), math.Copysign(0, -1)}},
+		{"0.5", []interface{}{0.5}},
+		{"-1.5e-3", []interface{}{-1.5e-3}},
+		{"1e300", []interface{}{1e300}},
+		{"9007199254740992", []interface{}{int64(1 << 53), float64(1 << 53)}},
+		{"9223372036854775807", []interface{}{int64(math.MaxInt64)}},
+		{"-9223372036854775808",
+			[]interface{}{int64(math.MinInt64), float64(math.MinInt64)}},
+		{"9223372036854776000", []interface{}{float64(1 << 63)}},
+	}
+	for _, numberType := range []string{"float64", "decimal"} {
+		codec := NewCodec(32)
+		codec.NumberType(numberType)
+		for _, tcase := range testcases {
+			code, err := codec.Encode([]byte(tcase.text), make([]byte, 0, 1024))
+			if err != nil {
+				t.Fatalf("Encode %v: %v", tcase.text, err)
+			}
+			for _, value := range tcase.values {
+				ref, err := codec.json2code(value, make([]byte, 0, 1024))
+				if err != nil {
+					t.Fatalf("json2code %v: %v", value, err)
+				}
+				if !bytes.Equal(code, ref) {
+					t.Errorf("%v %v: %q != %T %q", numberType, tcase.text, code, value, ref)
+				}
+				ref, err = codec.n1ql2code(n1ql.NewValue(value), make([]byte, 0, 1024))
+				if err != nil {
+					t.Fatalf("n1ql2code %v: %v", value, err)
+				}
+				if !bytes.Equal(code, ref) {
+					t.Errorf("%v %v: %q != n1ql %T %q", numberType, tcase.text, code, value, ref)
+				}
+			}
+		}
+	}
+}
+
 func BenchmarkEncode(b *testing.B) {
 	codec := NewCodec(128)
 	codec.NumberType("decimal")
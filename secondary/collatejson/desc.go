@@ -7,9 +7,31 @@ import "strconv"
 //reversed stream gives back the original stream.
 func (codec *Codec) ReverseCollate(code []byte, desc []bool) []byte {
 
+	var ties []byte
+	located := false
 	for i, d := range desc {
+		field, _, _ := codec.extractEncodedField(code, i+1)
+		if n := collatedStrings(field); n > 0 {
+			// tie-breaks of collated strings follow the value, in the
+			// order of fields.
+			if !located {
+				_, ties, _ = codec.extractEncodedField(code, 0)
+				located = true
+			}
+			flipped, l := field[0] > TypeObj, 0
+			for ; n > 0; n-- {
+				m, err := getEncodedStringLen(ties[l:], flipped)
+				if err != nil {
+					break
+				}
+				l += m
+			}
+			if d {
+				flipBits(ties[:l])
+			}
+			ties = ties[l:]
+		}
 		if d {
-			field, _, _ := codec.extractEncodedField(code, i+1)
 			flipBits(field)
 		}
 	}
@@ -41,23 +63,44 @@ func getEncodedDatum(code []byte) (datum []byte, remaining []byte) {
 }
 
 func getEncodedString(code []byte) ([]byte, []byte, error) {
-	for i := 0; i < len(code); i++ {
-		x := code[i]
-		if x == Terminator || x == ^Terminator {
-			i++
-			switch x = code[i]; x {
-			case Terminator, ^Terminator:
-				if i == (len(code)) {
-					return nil, nil, nil
-				}
-				return code[:i+1], code[i+1:], nil
-			default:
-				return nil, nil, ErrorSuffixDecoding
-			}
+	// strings of descending keys are bit flipped, so is their marker.
+	marker := collatedMarker
+	if code[0] == ^TypeString {
+		marker = ^marker
+	}
+	i := 1
+	if len(code) > 1 && code[1] == marker {
+		// collated string, its tie-break follows the value.
+		i++
+	}
+	n, err := getEncodedStringLen(code[i:], code[0] != TypeString)
+	if err != nil {
+		return nil, nil, err
+	}
+	return code[:i+n], code[i+n:], nil
+}
+
+// getEncodedStringLen returns the length of a suffix encoded string
+// including its Terminator pair.
+func getEncodedStringLen(code []byte, flipped bool) (int, error) {
+	term, escape := Terminator, byte(1)
+	if flipped {
+		term, escape = ^term, ^escape
+	}
+	for i := 0; i < len(code)-1; i++ {
+		if code[i] != term {
+			continue
+		}
+		i++
+		switch code[i] {
+		case term:
+			return i + 1, nil
+		case escape:
 			continue
 		}
+		return 0, ErrorSuffixDecoding
 	}
-	return nil, nil, ErrorSuffixDecoding
+	return 0, ErrorSuffixDecoding
 }
 
 //extracts a given field from the encoded byte stream
@@ -0,0 +1,229 @@
+//  Copyright (c) 2013 Couchbase, Inc.
+
+package collatejson
+
+import "bytes"
+import "math"
+import "strconv"
+
+// float64 can represent any decimal with upto 15 significant digits,
+// decimals with more digits might have been rounded.
+const float64Digits = 15
+
+// exponents beyond this are not encoded from text.
+const maxExponent = 1 << 30
+
+// numbers with exponents beyond this are decoded in e-notation, even
+// for `decimal` number type.
+const maxDecimalExponent = 1 << 10
+
+// isExactNumber tells whether numbers shall be encoded from their
+// text without loss of precision. Except for `int64` number type, where
+// numbers are truncated to integers.
+func (codec *Codec) isExactNumber() bool {
+	_, ok := codec.numberType.(int64)
+	return !ok
+}
+
+// encodeNumberText encodes JSON number literal `text` without going
+// through float64, so that big integers and decimals with more digits
+// than float64 can hold are encoded exactly. Collates with numbers
+// encoded from int64 and float64. Returns false if text could not be
+// converted.
+func (codec *Codec) encodeNumberText(text, code []byte) ([]byte, bool) {
+	x := [128]byte{}
+	sci, ok := scientificNotation(text, x[:0])
+	if !ok {
+		return code, false
+	} else if f, _ := strconv.ParseFloat(string(sci), 64); math.IsInf(f, 0) {
+		// beyond the range of float64, like N1QL numbers.
+		return code, false
+	}
+	code = append(code, TypeNumber)
+	cs := EncodeFloat(sci, code[1:])
+	code = code[:len(code)+len(cs)]
+	return append(code, Terminator), true
+}
+
+// scientificNotation converts JSON number literal `text` into
+// e-notation with a single digit before decimal point, like
+// strconv.FormatFloat(f, 'e', -1, 64), without loss of precision.
+// Integers within int64 keep their trailing zeros, like
+// Integer.ConvertToScientificNotation, so that they are encoded same
+// as int64 and float64 of same value.
+func scientificNotation(text, out []byte) ([]byte, bool) {
+	var neg bool
+	if len(text) > 0 && text[0] == '-' {
+		neg, text = true, text[1:]
+	}
+
+	i := 0
+	for i < len(text) && text[i] >= '0' && text[i] <= '9' {
+		i++
+	}
+	intpart, frac, exp := text[:i], text[i:i], 0
+	if i < len(text) && text[i] == '.' {
+		j := i + 1
+		for j < len(text) && text[j] >= '0' && text[j] <= '9' {
+			j++
+		}
+		frac, i = text[i+1:j], j
+	}
+	if i < len(text) && (text[i] == 'e' || text[i] == 'E') {
+		var err error
+		exp, err = strconv.Atoi(string(text[i+1:]))
+		if err != nil || exp > maxExponent || exp < -maxExponent {
+			return out, false
+		}
+	} else if i < len(text) {
+		return out, false
+	}
+	if len(intpart) == 0 {
+		return out, false
+	}
+
+	// digits of the number without leading zeros, value of the number
+	// is 0.digits x 10^exp
+	x := [128]byte{}
+	digits := append(append(x[:0], intpart...), frac...)
+	exp += len(intpart)
+	for len(digits) > 0 && digits[0] == '0' {
+		digits, exp = digits[1:], exp-1
+	}
+	if len(digits) == 0 {
+		return append(out, '0'), true
+	}
+	for digits[len(digits)-1] == '0' {
+		digits = digits[:len(digits)-1]
+	}
+	if exp > len(digits) && isInt64(digits, exp, neg) {
+		digits = append(digits, bytes.Repeat([]byte{'0'}, exp-len(digits))...)
+	}
+
+	if neg {
+		out = append(out, '-')
+	}
+	out = append(out, digits[0], '.')
+	out = append(out, digits[1:]...)
+	out = append(out, 'e')
+	if exp-1 >= 0 {
+		out = append(out, '+')
+	}
+	return strconv.AppendInt(out, int64(exp-1), 10), true
+}
+
+// isInt64 tells whether integer 0.digits x 10^exp fits in int64.
+func isInt64(digits []byte, exp int, neg bool) bool {
+	if exp < len(digits) {
+		return false
+	} else if exp != 19 {
+		return exp < 19
+	}
+	limit := "9223372036854775807"
+	if neg {
+		limit = "9223372036854775808"
+	}
+	for i := 0; i < len(limit); i++ {
+		d := byte('0')
+		if i < len(digits) {
+			d = digits[i]
+		}
+		if d != limit[i] {
+			return d < limit[i]
+		}
+	}
+	return true
+}
+
+// isInexactFloat tells whether f might be a rounded big integer or
+// decimal, whose text shall be encoded instead.
+func (codec *Codec) isInexactFloat(f float64) bool {
+	if !codec.isExactNumber() {
+		return false
+	} else if f == math.Trunc(f) {
+		// integers within int64 are encoded exactly as int64.
+		return !isIntegral(f) && !math.IsInf(f, 0)
+	}
+	return significantDigits(f) > float64Digits
+}
+
+// significantDigits returns the number of significant digits in the
+// shortest representation of f.
+func significantDigits(f float64) int {
+	x := [32]byte{}
+	n := 0
+	for _, c := range strconv.AppendFloat(x[:0], f, 'e', -1, 64) {
+		if c == 'e' {
+			break
+		} else if c >= '0' && c <= '9' {
+			n++
+		}
+	}
+	return n
+}
+
+// decimalNotation converts text in e-notation, as returned by
+// DecodeFloat, into decimal notation without loss of precision, like
+// strconv.FormatFloat(f, 'f', -1, 64).
+func decimalNotation(text []byte) ([]byte, bool) {
+	e := bytes.IndexByte(text, 'e')
+	if e < 0 {
+		return text, true
+	}
+	exp, err := strconv.Atoi(string(text[e+1:]))
+	if err != nil {
+		return text, false
+	}
+
+	var neg bool
+	mant := text[:e]
+	if len(mant) > 0 && (mant[0] == MINUS || mant[0] == PLUS) {
+		neg, mant = mant[0] == MINUS, mant[1:]
+	}
+	// value of the number is 0.digits x 10^exp
+	var digits []byte
+	if dot := bytes.IndexByte(mant, DOT); dot < 0 {
+		digits, exp = mant, exp+len(mant)
+	} else {
+		digits = append(append(digits, mant[:dot]...), mant[dot+1:]...)
+		exp += dot
+	}
+	for len(digits) > 0 && digits[0] == ZERO {
+		digits, exp = digits[1:], exp-1
+	}
+	if len(digits) == 0 {
+		return []byte{ZERO}, true
+	} else if exp > maxDecimalExponent || exp < -maxDecimalExponent {
+		return text, true
+	}
+
+	out := make([]byte, 0, len(digits)+abs(exp)+3)
+	if neg {
+		out = append(out, MINUS)
+	}
+	switch {
+	case exp >= len(digits):
+		out = append(out, digits...)
+		out = append(out, bytes.Repeat([]byte{ZERO}, exp-len(digits))...)
+		return out, true
+	case exp > 0:
+		out = append(out, digits[:exp]...)
+		digits = digits[exp:]
+	default:
+		out = append(out, ZERO)
+		digits = append(bytes.Repeat([]byte{ZERO}, -exp), digits...)
+	}
+	digits = bytes.TrimRight(digits, "0")
+	if len(digits) > 0 {
+		out = append(out, DOT)
+		out = append(out, digits...)
+	}
+	return out, true
+}
+
+func abs(x int) int {
+	if x < 0 {
+		return -x
+	}
+	return x
+}
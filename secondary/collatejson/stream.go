@@ -0,0 +1,226 @@
+//  Copyright (c) 2013 Couchbase, Inc.
+
+package collatejson
+
+import "bytes"
+import "errors"
+import "sort"
+import "sync"
+
+import json "github.com/couchbase/indexing/secondary/common/json"
+
+// ErrorInvalidJSON means input text could not be tokenized as JSON.
+var ErrorInvalidJSON = errors.New("collatejson.invalidJSON")
+
+var encoderPool = &sync.Pool{
+	New: func() interface{} {
+		return &streamEncoder{}
+	},
+}
+
+// streamEncoder encodes JSON text to binary representation while it is
+// being tokenized, output is same as unmarshaling the text and encoding
+// it with json2code.
+type streamEncoder struct {
+	codec   *Codec
+	tok     json.Tokenizer
+	members []member // properties of objects being encoded, innermost last
+	scratch []byte
+}
+
+// member is a property whose key and value are encoded at
+// code[start:end] of its object.
+type member struct {
+	key        []byte
+	start, end int
+}
+
+type membersByKey []member
+
+func (ms membersByKey) Len() int           { return len(ms) }
+func (ms membersByKey) Less(i, j int) bool { return bytes.Compare(ms[i].key, ms[j].key) < 0 }
+func (ms membersByKey) Swap(i, j int)      { ms[i], ms[j] = ms[j], ms[i] }
+
+// local function that encodes json text to binary representation in a
+// single pass, without unmarshaling it into golang native values.
+func (codec *Codec) encodeStream(text, code []byte) ([]byte, error) {
+	enc := encoderPool.Get().(*streamEncoder)
+	defer func() {
+		for i := range enc.members {
+			enc.members[i] = member{}
+		}
+		enc.codec, enc.members = nil, enc.members[:0]
+		enc.tok.Reset(nil)
+		encoderPool.Put(enc)
+	}()
+
+	enc.codec = codec
+	enc.tok.Reset(text)
+	kind, item, err := enc.tok.Next()
+	if err == nil {
+		code, err = enc.encode(kind, item, code)
+	}
+	if err == nil {
+		// check for trailing text.
+		_, _, err = enc.tok.Next()
+	}
+	if err != nil {
+		return nil, err
+	}
+	return code, nil
+}
+
+func (enc *streamEncoder) encode(
+	kind json.TokenKind, item []byte, code []byte) ([]byte, error) {
+
+	switch kind {
+	case json.TokenLiteral:
+		return enc.literal(item, code)
+	case json.TokenBeginArray:
+		return enc.array(code)
+	case json.TokenBeginObject:
+		return enc.object(code)
+	}
+	return code, ErrorInvalidJSON
+}
+
+func (enc *streamEncoder) literal(item []byte, code []byte) ([]byte, error) {
+	switch item[0] {
+	case 'n':
+		return append(code, TypeNull, Terminator), nil
+	case 't':
+		return append(code, TypeTrue, Terminator), nil
+	case 'f':
+		return append(code, TypeFalse, Terminator), nil
+	case '"':
+		s, ok := json.Unquote(item)
+		if !ok {
+			return code, ErrorInvalidJSON
+		}
+		return enc.codec.encodeString(s, code), nil
+	}
+
+	i, f, isInt, err := enc.tok.Number(item)
+	if err == nil && isInt {
+		return enc.codec.encodeInt64(i, code)
+	} else if enc.codec.isExactNumber() {
+		// big integers and decimals that float64 can't hold.
+		if cs, ok := enc.codec.encodeNumberText(item, code); ok {
+			return cs, nil
+		}
+	}
+	if err != nil {
+		return code, err
+	}
+	return enc.codec.encodeFloat64(f, code)
+}
+
+func (enc *streamEncoder) array(code []byte) ([]byte, error) {
+	code = append(code, TypeArray)
+	start, n := len(code), 0
+	for {
+		kind, item, err := enc.tok.Next()
+		if err != nil {
+			return code, err
+		} else if kind == json.TokenEndArray {
+			break
+		}
+		l := len(code)
+		cs, err := enc.encode(kind, item, code[l:])
+		if err != nil {
+			return code, err
+		}
+		code = code[:l+len(cs)]
+		n++
+	}
+	if enc.codec.arrayLenPrefix {
+		// length is known only after the elements are encoded.
+		code = enc.rewrite(code, start, true, n, nil)
+	}
+	return append(code, Terminator), nil
+}
+
+func (enc *streamEncoder) object(code []byte) ([]byte, error) {
+	code = append(code, TypeObj)
+	start, base, sorted := len(code), len(enc.members), true
+	for {
+		kind, item, err := enc.tok.Next()
+		if err != nil {
+			return code, err
+		} else if kind == json.TokenEndObject {
+			break
+		} else if kind != json.TokenKey {
+			return code, ErrorInvalidJSON
+		}
+		key, ok := json.Unquote(item)
+		if !ok {
+			return code, ErrorInvalidJSON
+		}
+		m := member{key: key, start: len(code)}
+		if n := len(enc.members); n > base {
+			sorted = sorted && bytes.Compare(enc.members[n-1].key, key) < 0
+		}
+		// encode key
+		l := len(code)
+		cs := enc.codec.encodeString(key, code[l:])
+		code = code[:l+len(cs)]
+		// encode value
+		if kind, item, err = enc.tok.Next(); err != nil {
+			return code, err
+		}
+		l = len(code)
+		if cs, err = enc.encode(kind, item, code[l:]); err != nil {
+			return code, err
+		}
+		code = code[:l+len(cs)]
+		m.end = len(code)
+		enc.members = append(enc.members, m)
+	}
+
+	members := enc.members[base:]
+	if !sorted {
+		// same as sortProps, and the last of duplicate keys wins like
+		// json.Unmarshal.
+		sort.Stable(membersByKey(members))
+		n := 0
+		for i := range members {
+			if i+1 < len(members) && bytes.Equal(members[i].key, members[i+1].key) {
+				continue
+			}
+			members[n] = members[i]
+			n++
+		}
+		members = members[:n]
+	}
+	if !sorted || enc.codec.propertyLenPrefix {
+		prefix := enc.codec.propertyLenPrefix
+		code = enc.rewrite(code, start, prefix, len(members), members)
+	}
+
+	for i := range enc.members[base:] {
+		enc.members[base+i] = member{}
+	}
+	enc.members = enc.members[:base]
+	return append(code, Terminator), nil
+}
+
+// rewrite items encoded at code[start:] in the order of members, or
+// all of them in their order if members is nil, prefixed with length
+// `n` if prefix is true.
+func (enc *streamEncoder) rewrite(
+	code []byte, start int, prefix bool, n int, members []member) []byte {
+
+	enc.scratch = append(enc.scratch[:0], code[start:]...)
+	code = code[:start]
+	if prefix {
+		cs := enc.codec.encodeLength(Length(n), code[start:])
+		code = code[:start+len(cs)]
+	}
+	if members == nil {
+		return append(code, enc.scratch...)
+	}
+	for _, m := range members {
+		code = append(code, enc.scratch[m.start-start:m.end-start]...)
+	}
+	return code
+}
@@ -1,52 +1,102 @@
 //  Copyright (c) 2013 Couchbase, Inc.
 
-// +build ignore
-
 package collatejson
 
-//import "code.google.com/p/go.text/collate"
-//import "code.google.com/p/go.text/collate/colltab"
-//import "code.google.com/p/go.text/language"
-//import "code.google.com/p/go.text/unicode/norm"
+import "errors"
+import "strings"
+import "sync"
+
+import "golang.org/x/text/collate"
+import "golang.org/x/text/language"
+import "golang.org/x/text/unicode/norm"
+
+// CollationBinary sorts strings by their UTF-8 bytes, this is the default.
+const CollationBinary = "binary"
+
+// collationCISuffix on a collation name ignores case while sorting.
+const collationCISuffix = "_ci"
+
+// collatedMarker follows TypeString for a string encoded with a collation,
+// it never starts an UTF-8 string hence a decoder can identify such strings
+// without knowing the collation.
+const collatedMarker byte = 0xff
+
+// ErrorCollation means collation name is not understood by codec.
+var ErrorCollation = errors.New("collatejson.collation")
+
+// Tie selects whether tie-breaks are encoded for collated strings.
+// Strings differing only in case, for a case-insensitive collation,
+// share the sort key and are ordered by tie-break. Tie-breaks of all
+// collated strings follow the encoded value, so that a composite key
+// is ordered by the sort keys of all its fields before tie-breaks.
+type Tie byte
 
-// UnicodeCollationPriority sets collate.Collator properties for unicode
+const (
+	// TieValue encodes the strings as tie-breaks, used for index entries.
+	TieValue Tie = iota
+	// TieNone omits tie-breaks, used for scan bounds, which shall
+	// match every string with the same sort key.
+	TieNone
+)
+
+// UnicodeCollationPriority sets collate.Collator options for unicode
 // collation.
-func (codec *Codec) UnicodeCollationPriority(
-	strength colltab.Level, alternate collate.AlternateHandling,
-	backwards, hiraganaQ, caseLevel, numeric bool) {
-	codec.strength = strength
-	codec.alternate = alternate
-	codec.backwards = backwards
-	codec.hiraganaQ = hiraganaQ
-	codec.caseLevel = caseLevel
-	codec.numeric = numeric
+func (codec *Codec) UnicodeCollationPriority(options ...collate.Option) {
+	codec.options = options
+	codec.setCollators()
 }
 
 // SetLanguage uses language tag while doing unicode collation.
 func (codec *Codec) SetLanguage(l language.Tag) {
 	codec.language = l
+	codec.utf8, codec.nfkd = false, false
+	codec.setCollators()
+}
+
+// SetCollation configures string collation by name, which is either
+// "binary" or a BCP 47 language tag like "en" or "de_AT", optionally
+// suffixed with "_ci" to ignore case.
+func (codec *Codec) SetCollation(name string) error {
+	if name == "" || name == CollationBinary {
+		codec.SortbyUTF8(true)
+		codec.collation = ""
+		return nil
+	}
+
+	tag, options := name, []collate.Option(nil)
+	if strings.HasSuffix(name, collationCISuffix) {
+		tag = strings.TrimSuffix(name, collationCISuffix)
+		options = append(options, collate.IgnoreCase)
+	}
+	l, err := language.Parse(tag)
+	if err != nil {
+		return ErrorCollation
+	}
+	codec.options = options
+	codec.SetLanguage(l)
+	codec.collation = name
+	return nil
+}
+
+// Collation returns the name of collation set on codec, empty string
+// for binary collation.
+func (codec *Codec) Collation() string {
+	return codec.collation
 }
 
 // EncodeUnicodeString encodes string in utf8 encoding to binary sequence based
 // on UTF8, NFKD or go.text/collate algorithms.
 func (codec *Codec) EncodeUnicodeString(value string) (code []byte) {
 	bs := []byte(value)
-	if codec.utf8 {
-		code = []byte(bs)
-	} else if codec.nfkd {
+	if codec.nfkd {
 		code = norm.NFKD.Bytes([]byte(bs)) // canonical decomposed
+	} else if codec.utf8 || codec.collators == nil {
+		code = []byte(bs)
 	} else {
-		// TODO: Try to understand the performance implication of collate.Buffer
-		// object
-		buf := &collate.Buffer{}
-		c := collate.New(codec.language)
-		c.Strength = codec.strength
-		c.Alternate = codec.alternate
-		c.Backwards = codec.backwards
-		c.HiraganaQuaternary = codec.hiraganaQ
-		c.CaseLevel = codec.caseLevel
-		c.Numeric = codec.numeric
-		code = c.Key(buf, []byte(bs))
+		// collators are not safe for concurrent use, hence pooled.
+		c := codec.collators.Get().(*collate.Collator)
+		code = c.Key(&collate.Buffer{}, bs)
+		codec.collators.Put(c)
 	}
 	return code
 }
@@ -54,9 +104,169 @@ func (codec *Codec) EncodeUnicodeString(value string) (code []byte) {
 // SortbyNFKD will enable an alternate collation using NFKD unicode standard.
 func (codec *Codec) SortbyNFKD(what bool) {
 	codec.nfkd = what
+	if what {
+		codec.utf8 = false
+	}
 }
 
 // SortbyUTF8 will do plain binary comparision for strings.
 func (codec *Codec) SortbyUTF8(what bool) {
 	codec.utf8 = what
+	if what {
+		codec.nfkd = false
+	}
+}
+
+// isCollated returns whether strings are encoded with a sort key.
+func (codec *Codec) isCollated() bool {
+	return !codec.utf8
+}
+
+func (codec *Codec) setCollators() {
+	l, options := codec.language, codec.options
+	codec.collators = &sync.Pool{
+		New: func() interface{} {
+			return collate.New(l, options...)
+		},
+	}
+}
+
+// encodeCollatedString appends marker, suffix encoded sort key and
+// tie-break of value to code. Like suffixEncodeString the caller shall
+// terminate it, tie-breaks are moved after the value by hoistTies.
+func (codec *Codec) encodeCollatedString(value string, code []byte) []byte {
+	code = append(code, collatedMarker)
+	code = suffixEncodeString(codec.EncodeUnicodeString(value), code)
+	if codec.tie == TieValue {
+		code = append(code, Terminator)
+		code = suffixEncodeString([]byte(value), code)
+	}
+	return code
+}
+
+// encodeCollated calls encode and moves tie-breaks of collated strings
+// after the encoded value.
+func (codec *Codec) encodeCollated(
+	code []byte, encode func([]byte) ([]byte, error)) ([]byte, error) {
+
+	code, err := encode(code)
+	if err == nil && codec.isCollated() && codec.tie == TieValue {
+		code, err = hoistTies(code)
+	}
+	return code, err
+}
+
+// hoistTies moves tie-breaks of collated strings, in the order of
+// strings, after the encoded value.
+func hoistTies(code []byte) ([]byte, error) {
+	tmp := bufPool.Get().(*[]byte)
+	defer bufPool.Put(tmp)
+
+	ties, n := (*tmp)[:0], 0
+	for i := 0; i < len(code); {
+		switch code[i] {
+		case Terminator, TypeArray, TypeObj:
+			code[n], i, n = code[i], i+1, n+1
+		case TypeString:
+			j := i + 1
+			collated := j < len(code) && code[j] == collatedMarker
+			if collated {
+				j++
+			}
+			l, err := getEncodedStringLen(code[j:], false)
+			if err != nil {
+				return nil, err
+			}
+			j += l
+			n += copy(code[n:], code[i:j])
+			if i = j; collated {
+				if l, err = getEncodedStringLen(code[i:], false); err != nil {
+					return nil, err
+				}
+				ties = append(ties, code[i:i+l]...)
+				i += l
+			}
+		default:
+			j := i
+			for j < len(code) && code[j] != Terminator {
+				j++
+			}
+			if j < len(code) {
+				j++
+			}
+			n += copy(code[n:], code[i:j])
+			i = j
+		}
+	}
+	code = append(code[:n], ties...)
+	*tmp = ties
+	return code, nil
+}
+
+// decodeCollated calls decode with a copy of codec, which locates the
+// tie-breaks following code on its first collated string.
+func (codec *Codec) decodeCollated(code []byte, decode func(*Codec) error) error {
+	dec := *codec
+	dec.ties, dec.top = nil, code
+	return decode(&dec)
+}
+
+// nextTie returns the tie-break of next collated string being decoded.
+func (codec *Codec) nextTie(text []byte) ([]byte, error) {
+	if codec.top != nil {
+		_, ties, err := codec.extractEncodedField(codec.top, 0)
+		if err != nil {
+			return nil, err
+		}
+		codec.ties, codec.top = ties, nil
+	}
+	if len(codec.ties) == 0 {
+		// scan bounds do not carry tie-breaks.
+		return nil, ErrorSuffixDecoding
+	}
+	text, ties, err := suffixDecodeString(codec.ties, text)
+	codec.ties = ties
+	return text, err
+}
+
+// collatedStrings returns the number of collated strings in encoded
+// value, which is bit flipped for descending collation.
+func collatedStrings(code []byte) (n int) {
+	var flip byte
+	if len(code) > 0 && code[0] > TypeObj {
+		flip = 0xff
+	}
+	for i := 0; i < len(code); {
+		switch code[i] ^ flip {
+		case Terminator, TypeArray, TypeObj:
+			i++
+		case TypeString:
+			if i++; i < len(code) && code[i]^flip == collatedMarker {
+				n, i = n+1, i+1
+			}
+			l, err := getEncodedStringLen(code[i:], flip != 0)
+			if err != nil {
+				return n
+			}
+			i += l
+		default:
+			for i < len(code) && code[i]^flip != Terminator {
+				i++
+			}
+			i++
+		}
+	}
+	return n
+}
+
+// EncodeBound encodes json documents like Encode, using tie as the
+// tie-break of collated strings. For binary collation it is same as
+// Encode.
+func (codec *Codec) EncodeBound(text, code []byte, tie Tie) ([]byte, error) {
+	if !codec.isCollated() {
+		return codec.Encode(text, code)
+	}
+	bound := *codec
+	bound.tie = tie
+	return bound.Encode(text, code)
 }
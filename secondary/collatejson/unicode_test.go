@@ -1,12 +1,159 @@
 //  Copyright (c) 2013 Couchbase, Inc.
 
-// +build ignore
-
 package collatejson
 
+import "bytes"
+import "sort"
+import "testing"
+
+func collatedCodec(t testing.TB, name string) *Codec {
+	codec := NewCodec(16)
+	if err := codec.SetCollation(name); err != nil {
+		t.Fatalf("SetCollation(%q): %v", name, err)
+	}
+	return codec
+}
+
+func encodeText(t testing.TB, codec *Codec, text string, tie Tie) []byte {
+	code, err := codec.EncodeBound([]byte(text), make([]byte, 0, 1024), tie)
+	if err != nil {
+		t.Fatalf("encode %s: %v", text, err)
+	}
+	return append([]byte(nil), code...)
+}
+
+func TestSetCollation(t *testing.T) {
+	for _, name := range []string{"", "binary", "en", "en_ci", "de_AT", "und_ci"} {
+		codec := collatedCodec(t, name)
+		if name == "binary" {
+			name = ""
+		}
+		if codec.Collation() != name {
+			t.Errorf("expected %q, got %q", name, codec.Collation())
+		}
+	}
+	if err := NewCodec(16).SetCollation("not a language!"); err != ErrorCollation {
+		t.Errorf("expected ErrorCollation, got %v", err)
+	}
+}
+
+func TestCollatedRoundtrip(t *testing.T) {
+	codec := collatedCodec(t, "en_ci")
+	texts := []string{
+		`["Bob"]`, `[""]`, `["a\u0000b",10]`, `[["Alice","bob"],{"x":"Y"}]`,
+	}
+	for _, text := range texts {
+		code := encodeText(t, codec, text, TieValue)
+		out, err := codec.Decode(code, make([]byte, 0, 1024))
+		if err != nil {
+			t.Fatal(err)
+		}
+		// collated strings are decoded by any codec.
+		plain, err := NewCodec(16).Decode(code, make([]byte, 0, 1024))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if string(out) != text || string(plain) != text {
+			t.Errorf("expected %s, got %s %s", text, out, plain)
+		}
+	}
+}
+
+func TestCollatedOrder(t *testing.T) {
+	codec := collatedCodec(t, "en_ci")
+	texts := []string{`["bob"]`, `["Alice"]`, `["BOB"]`, `["carol"]`, `["alice"]`}
+	codes := make([][]byte, 0, len(texts))
+	for _, text := range texts {
+		codes = append(codes, encodeText(t, codec, text, TieValue))
+	}
+	sort.Slice(codes, func(i, j int) bool {
+		return bytes.Compare(codes[i], codes[j]) < 0
+	})
+	out := make([]string, 0, len(codes))
+	for _, code := range codes {
+		text, err := codec.Decode(code, make([]byte, 0, 1024))
+		if err != nil {
+			t.Fatal(err)
+		}
+		out = append(out, string(text))
+	}
+	ref := []string{`["Alice"]`, `["alice"]`, `["BOB"]`, `["bob"]`, `["carol"]`}
+	for i := range ref {
+		if out[i] != ref[i] {
+			t.Fatalf("expected %v, got %v", ref, out)
+		}
+	}
+
+	// bounds match every string with same sort key as prefix.
+	bound := encodeText(t, codec, `["bOb"]`, TieNone)
+	bound = bound[:len(bound)-1]
+	for _, text := range []string{`["bob"]`, `["BOB"]`} {
+		if code := encodeText(t, codec, text, TieValue); !bytes.HasPrefix(code, bound) {
+			t.Errorf("%s does not match bound", text)
+		}
+	}
+	for _, text := range []string{`["alice"]`, `["carol"]`, `["bo"]`} {
+		if code := encodeText(t, codec, text, TieValue); bytes.HasPrefix(code, bound) {
+			t.Errorf("%s unexpected match of bound", text)
+		}
+	}
+}
+
+func TestCollatedCompositeOrder(t *testing.T) {
+	codec := collatedCodec(t, "en_ci")
+	// composite keys are ordered by all sort keys before tie-breaks.
+	texts := []string{`["Bob",20]`, `["bob",10]`, `["BOB",10]`, `["bob","x",5]`}
+	ref := []string{`["BOB",10]`, `["bob",10]`, `["Bob",20]`, `["bob","x",5]`}
+	codes := make([][]byte, 0, len(texts))
+	for _, text := range texts {
+		codes = append(codes, encodeText(t, codec, text, TieValue))
+	}
+	sort.Slice(codes, func(i, j int) bool {
+		return bytes.Compare(codes[i], codes[j]) < 0
+	})
+	for i, code := range codes {
+		text, err := codec.Decode(code, make([]byte, 0, 1024))
+		if err != nil {
+			t.Fatal(err)
+		} else if string(text) != ref[i] {
+			t.Errorf("expected %s at %v, got %s", ref[i], i, text)
+		}
+	}
+
+	// tie-breaks of descending fields are reversed as well.
+	desc := []bool{true, false}
+	code1 := codec.ReverseCollate(encodeText(t, codec, `["Bob",10]`, TieValue), desc)
+	code2 := codec.ReverseCollate(encodeText(t, codec, `["bob",10]`, TieValue), desc)
+	if bytes.Compare(code2, code1) >= 0 {
+		t.Errorf("expected bob before Bob for descending key")
+	}
+}
+
+func TestCollatedReverse(t *testing.T) {
+	codec := collatedCodec(t, "en_ci")
+	code := encodeText(t, codec, `["Bob","alice",10]`, TieValue)
+	ref := append([]byte(nil), code...)
+	desc := []bool{true, false, true}
+	codec.ReverseCollate(code, desc)
+	if bytes.Equal(code, ref) {
+		t.Fatalf("expected reversed code")
+	}
+	codec.ReverseCollate(code, desc)
+	if !bytes.Equal(code, ref) {
+		t.Fatalf("expected %v, got %v", ref, code)
+	}
+
+	elems, err := codec.ExplodeArray(code, make([]byte, 0, 1024))
+	if err != nil {
+		t.Fatal(err)
+	} else if len(elems) != 3 {
+		t.Fatalf("expected 3 elements, got %v", len(elems))
+	}
+}
+
 func BenchmarkUtf8(b *testing.B) {
 	s := "prográmming"
-	codec := NewCodec()
+	codec := NewCodec(16)
 	codec.SortbyUTF8(true)
 	for i := 0; i < b.N; i++ {
 		codec.EncodeUnicodeString(s)
@@ -15,7 +162,7 @@ func BenchmarkUtf8(b *testing.B) {
 
 func BenchmarkNFKD(b *testing.B) {
 	s := "prográmming"
-	codec := NewCodec()
+	codec := NewCodec(16)
 	codec.SortbyNFKD(true)
 	for i := 0; i < b.N; i++ {
 		codec.EncodeUnicodeString(s)
@@ -24,7 +171,7 @@ func BenchmarkNFKD(b *testing.B) {
 
 func BenchmarkStringCollate(b *testing.B) {
 	s := "prográmming"
-	codec := NewCodec()
+	codec := collatedCodec(b, "en_ci")
 	for i := 0; i < b.N; i++ {
 		codec.EncodeUnicodeString(s)
 	}
@@ -57,6 +57,8 @@ type ClusterInfoCache struct {
 	addNodes     []couchbase.Node
 	version      uint32
 	minorVersion uint32
+
+	local *LocalClusterInfo // standalone deployment, without ns_server
 }
 
 // Helper object that keeps an instance of ClusterInfoCache cached
@@ -85,7 +87,7 @@ func NewClusterInfoCache(clusterUrl string, pool string) (*ClusterInfoCache, err
 
 func FetchNewClusterInfoCache(clusterUrl string, pool string) (*ClusterInfoCache, error) {
 
-	url, err := ClusterAuthUrl(clusterUrl)
+	url, err := ClusterInfoUrl(clusterUrl)
 	if err != nil {
 		return nil, err
 	}
@@ -106,6 +108,16 @@ func FetchNewClusterInfoCache(clusterUrl string, pool string) (*ClusterInfoCache
 	return c, nil
 }
 
+// ClusterInfoUrl returns the url to populate ClusterInfoCache from,
+// authenticated ns_server url or, for standalone deployments, plain url
+// of the cluster.
+func ClusterInfoUrl(cluster string) (string, error) {
+	if GetLocalClusterInfo() != nil {
+		return ClusterUrl(cluster), nil
+	}
+	return ClusterAuthUrl(cluster)
+}
+
 func SetServicePorts(portMap map[string]string) {
 	ServiceAddrMap = portMap
 }
@@ -127,6 +139,10 @@ func (c *ClusterInfoCache) SetServicePorts(portMap map[string]string) {
 
 func (c *ClusterInfoCache) Fetch() error {
 
+	if local := GetLocalClusterInfo(); local != nil {
+		return c.fetchLocal(local)
+	}
+
 	fn := func(r int, err error) error {
 		if r > 0 {
 			logging.Infof("%vError occured during cluster info update (%v) .. Retrying(%d)",
@@ -145,51 +161,8 @@ func (c *ClusterInfoCache) Fetch() error {
 			return err
 		}
 
-		var nodes []couchbase.Node
-		var failedNodes []couchbase.Node
-		var addNodes []couchbase.Node
-		version := uint32(math.MaxUint32)
-		minorVersion := uint32(math.MaxUint32)
-		for _, n := range c.pool.Nodes {
-			if n.ClusterMembership == "active" {
-				nodes = append(nodes, n)
-			} else if n.ClusterMembership == "inactiveFailed" {
-				// node being failed over
-				failedNodes = append(failedNodes, n)
-			} else if n.ClusterMembership == "inactiveAdded" {
-				// node being added (but not yet rebalanced in)
-				addNodes = append(addNodes, n)
-			} else {
-				logging.Warnf("ClusterInfoCache: unrecognized node membership %v", n.ClusterMembership)
-			}
-
-			// Find the minimum cluster compatibility
-			v := uint32(n.ClusterCompatibility / 65536)
-			minorv := uint32(n.ClusterCompatibility) - (v * 65536)
-			if v < version || (v == version && minorv < minorVersion) {
-				version = v
-				minorVersion = minorv
-			}
-		}
-		c.nodes = nodes
-		c.failedNodes = failedNodes
-		c.addNodes = addNodes
-
-		c.version = version
-		c.minorVersion = minorVersion
-		if c.version == math.MaxUint32 {
-			c.version = 0
-		}
-
-		found := false
-		for _, node := range c.nodes {
-			if node.ThisNode {
-				found = true
-			}
-		}
-
-		if !found {
-			return errors.New("Current node's cluster membership is not active")
+		if err := c.setNodes(c.pool.Nodes); err != nil {
+			return err
 		}
 
 		var poolServs couchbase.PoolServices
@@ -223,6 +196,81 @@ func (c *ClusterInfoCache) Fetch() error {
 	return rh.Run()
 }
 
+// fetchLocal populates cache from cluster topology of a standalone
+// deployment.
+func (c *ClusterInfoCache) fetchLocal(local *LocalClusterInfo) error {
+	c.local = local
+	if err := c.setNodes(local.Nodes); err != nil {
+		return err
+	}
+	c.nodesvs = local.NodeServices
+
+	result := make(map[NodeId]string)
+	for nid, node := range c.nodes {
+		if group, ok := local.ServerGroups[node.Hostname]; ok {
+			result[NodeId(nid)] = group
+		}
+	}
+	c.node2group = result
+
+	if !c.validateCache(local.IsIPv6) {
+		logging.Infof("%vValidation Failed for cluster info.. %v", c.logPrefix, c)
+		return ErrValidationFailed
+	}
+	return nil
+}
+
+// setNodes of the cluster by their membership, and cluster version.
+func (c *ClusterInfoCache) setNodes(poolNodes []couchbase.Node) error {
+	var nodes []couchbase.Node
+	var failedNodes []couchbase.Node
+	var addNodes []couchbase.Node
+	version := uint32(math.MaxUint32)
+	minorVersion := uint32(math.MaxUint32)
+	for _, n := range poolNodes {
+		if n.ClusterMembership == "active" {
+			nodes = append(nodes, n)
+		} else if n.ClusterMembership == "inactiveFailed" {
+			// node being failed over
+			failedNodes = append(failedNodes, n)
+		} else if n.ClusterMembership == "inactiveAdded" {
+			// node being added (but not yet rebalanced in)
+			addNodes = append(addNodes, n)
+		} else {
+			logging.Warnf("ClusterInfoCache: unrecognized node membership %v", n.ClusterMembership)
+		}
+
+		// Find the minimum cluster compatibility
+		v := uint32(n.ClusterCompatibility / 65536)
+		minorv := uint32(n.ClusterCompatibility) - (v * 65536)
+		if v < version || (v == version && minorv < minorVersion) {
+			version = v
+			minorVersion = minorv
+		}
+	}
+	c.nodes = nodes
+	c.failedNodes = failedNodes
+	c.addNodes = addNodes
+
+	c.version = version
+	c.minorVersion = minorVersion
+	if c.version == math.MaxUint32 {
+		c.version = 0
+	}
+
+	found := false
+	for _, node := range c.nodes {
+		if node.ThisNode {
+			found = true
+		}
+	}
+
+	if !found {
+		return errors.New("Current node's cluster membership is not active")
+	}
+	return nil
+}
+
 func (c *ClusterInfoCache) FetchWithLock() error {
 	c.Lock()
 	defer c.Unlock()
@@ -324,6 +372,10 @@ func (c *ClusterInfoCache) GetNewIndexerNodes() (nodes []couchbase.Node) {
 }
 
 func (c *ClusterInfoCache) GetNodesByBucket(bucket string) (nids []NodeId, err error) {
+	if c.local != nil {
+		return c.getLocalNodesByBucket(bucket)
+	}
+
 	b, berr := c.pool.GetBucket(bucket)
 	if berr != nil {
 		err = berr
@@ -346,6 +398,14 @@ func (c *ClusterInfoCache) GetNodesByBucket(bucket string) (nids []NodeId, err e
 //
 func (c *ClusterInfoCache) GetBucketUUID(bucket string) (uuid string) {
 
+	if c.local != nil {
+		if nids, err := c.getLocalNodesByBucket(bucket); err == nil && len(nids) > 0 {
+			b, _ := c.local.getBucket(bucket)
+			return b.UUID
+		}
+		return BUCKET_UUID_NIL
+	}
+
 	// This function retuns an error if bucket not found
 	b, err := c.pool.GetBucket(bucket)
 	if err != nil {
@@ -367,6 +427,14 @@ func (c *ClusterInfoCache) GetBucketUUID(bucket string) (uuid string) {
 }
 
 func (c *ClusterInfoCache) IsEphemeral(bucket string) (bool, error) {
+	if c.local != nil {
+		b, err := c.local.getBucket(bucket)
+		if err != nil {
+			return false, err
+		}
+		return b.isEphemeral(), nil
+	}
+
 	b, err := c.pool.GetBucket(bucket)
 	if err != nil {
 		return false, err
@@ -434,6 +502,10 @@ func (c *ClusterInfoCache) GetServiceAddress(nid NodeId, srvc string) (addr stri
 }
 
 func (c *ClusterInfoCache) GetVBuckets(nid NodeId, bucket string) (vbs []uint32, err error) {
+	if c.local != nil {
+		return c.getLocalVBuckets(nid, bucket)
+	}
+
 	b, berr := c.pool.GetBucket(bucket)
 	if berr != nil {
 		err = berr
@@ -458,6 +530,35 @@ func (c *ClusterInfoCache) GetVBuckets(nid NodeId, bucket string) (vbs []uint32,
 	return
 }
 
+func (c *ClusterInfoCache) getLocalNodesByBucket(bucket string) (nids []NodeId, err error) {
+	b, err := c.local.getBucket(bucket)
+	if err != nil {
+		return nil, err
+	}
+
+	for i, node := range c.nodes {
+		if _, ok := b.VBuckets[node.Hostname]; ok {
+			nids = append(nids, NodeId(i))
+		}
+	}
+	return nids, nil
+}
+
+func (c *ClusterInfoCache) getLocalVBuckets(nid NodeId, bucket string) ([]uint32, error) {
+	b, err := c.local.getBucket(bucket)
+	if err != nil {
+		return nil, err
+	} else if int(nid) >= len(c.nodes) {
+		return nil, ErrInvalidNodeId
+	}
+
+	vbs, ok := b.VBuckets[c.nodes[nid].Hostname]
+	if !ok {
+		return nil, errors.New(ErrNodeNotBucketMember.Error() + fmt.Sprintf(": %v", c.nodes[nid].Hostname))
+	}
+	return vbs, nil
+}
+
 func (c *ClusterInfoCache) findVBServerIndex(b *couchbase.Bucket, nid NodeId) (int, bool) {
 	bnodes := b.Nodes()
 
@@ -655,6 +756,12 @@ func (c *ClusterInfoClient) GetClusterInfoCache() *ClusterInfoCache {
 }
 
 func (c *ClusterInfoClient) watchClusterChanges() {
+	if GetLocalClusterInfo() != nil {
+		// topology of standalone deployment does not change.
+		<-c.finch
+		return
+	}
+
 	selfRestart := func() {
 		time.Sleep(time.Duration(c.servicesNotifierRetryTm) * time.Millisecond)
 		go c.watchClusterChanges()
@@ -149,6 +149,16 @@ var SystemConfig = Config{
 		false, // mutable
 		false, // case-insensitive
 	},
+	"projector.keyCacheSize": ConfigValue{
+		256,
+		"number of documents, per vbucket, for which a hash of the last " +
+			"published secondary key is remembered, upserts with unchanged " +
+			"key are published as no-op. Zero disables the cache, " +
+			"changing this value does not affect existing feeds.",
+		256,
+		false, // mutable
+		false, // case-insensitive
+	},
 	"projector.feedChanSize": ConfigValue{
 		100,
 		"channel size for feed's control path, " +
@@ -269,6 +279,41 @@ var SystemConfig = Config{
 		false, // mutable
 		false, // case-insensitive
 	},
+	// projector javascript index functions
+	"projector.javascript.timeout": ConfigValue{
+		100,
+		"timeout, in milliseconds, for a javascript index function " +
+			"to evaluate a document, document is skipped on timeout. " +
+			"Also bounds the memory a function can allocate, there is " +
+			"no separate memory limit.",
+		100,
+		false, // mutable
+		false, // case-insensitive
+	},
+	"projector.javascript.maxStackDepth": ConfigValue{
+		1000,
+		"maximum call stack depth for a javascript index function, " +
+			"zero for no limit.",
+		1000,
+		false, // mutable
+		false, // case-insensitive
+	},
+	"projector.javascript.maxDocSize": ConfigValue{
+		1024 * 1024,
+		"documents larger than this, in bytes, are not passed to " +
+			"javascript index functions and are skipped.",
+		1024 * 1024,
+		false, // mutable
+		false, // case-insensitive
+	},
+	"projector.javascript.maxKeySize": ConfigValue{
+		4608,
+		"maximum size, in bytes, of the JSON value returned by " +
+			"a javascript index function.",
+		4608,
+		false, // mutable
+		false, // case-insensitive
+	},
 	// projector adminport parameters
 	"projector.adminport.name": ConfigValue{
 		"projector.adminport",
@@ -325,8 +370,9 @@ var SystemConfig = Config{
 	},
 	"projector.dataport.keyChanSize": ConfigValue{
 		100000,
-		"channel size of dataport endpoints data input, " +
-			"does not affect existing feeds.",
+		"channel size of dataport endpoints data input, also the " +
+			"number of mutations an endpoint can buffer while waiting " +
+			"for credits, does not affect existing feeds.",
 		100000,
 		true,  // immutable
 		false, // case-insensitive
@@ -366,6 +412,15 @@ var SystemConfig = Config{
 		true,        // immutable
 		false,       // case-insensitive
 	},
+	"projector.dataport.flowControl": ConfigValue{
+		true,
+		"use credit based flow control with downstream, when it is " +
+			"supported by indexer, instead of blocking on the socket, " +
+			"does not affect existing feeds.",
+		true,
+		false, // mutable
+		false, // case-insensitive
+	},
 	"projector.dataport.statTick": ConfigValue{
 		5 * 60 * 1000, // 5 minutes
 		"tick, in milliseconds, to log endpoint statistics",
@@ -440,6 +495,15 @@ var SystemConfig = Config{
 		false,      // mutable
 		false,      // case-insensitive
 	},
+	"indexer.dataport.creditWindow": ConfigValue{
+		16 * 1024 * 1024,
+		"credits, in bytes, granted to each projector endpoint for flow " +
+			"control, endpoint can have that much data outstanding before " +
+			"indexer consumes them, 0 disables flow control.",
+		16 * 1024 * 1024, // 16MB
+		true,             // immutable
+		false,            // case-insensitive
+	},
 	// indexer queryport configuration
 	"indexer.queryport.maxPayload": ConfigValue{
 		64 * 1024,
@@ -624,6 +688,21 @@ var SystemConfig = Config{
 		false, // mutable
 		false, // case-insensitive
 	},
+	"queryport.client.log_format": ConfigValue{
+		"text",
+		"GsiClient log line format, one of text, json or logfmt",
+		"text",
+		false, // mutable
+		false, // case-insensitive
+	},
+	"queryport.client.log_component_levels": ConfigValue{
+		"",
+		"GsiClient per component log levels overriding log_level, " +
+			"specified as component:level,component:level",
+		"",
+		false, // mutable
+		false, // case-insensitive
+	},
 	"queryport.client.scan.max_concurrency": ConfigValue{
 		16,
 		"When performing query on partitioned index, specify maximum concurrency allowed. Use 0 to disable.",
@@ -631,6 +710,36 @@ var SystemConfig = Config{
 		false, // mutable
 		false, // case-insensitive
 	},
+	"queryport.client.scan.hedge.enable": ConfigValue{
+		false,
+		"When first response for a scan is delayed, issue the same scan " +
+			"to another replica and use whichever responds first.",
+		false,
+		false, // mutable
+		false, // case-insensitive
+	},
+	"queryport.client.scan.hedge.percentile": ConfigValue{
+		95,
+		"Hedge a scan when its first response is slower than this " +
+			"percentile of recent scan response times.",
+		95,
+		false, // mutable
+		false, // case-insensitive
+	},
+	"queryport.client.scan.hedge.min_delay": ConfigValue{
+		10,
+		"Minimum delay, in milliseconds, before hedging a scan.",
+		10,
+		false, // mutable
+		false, // case-insensitive
+	},
+	"queryport.client.scan.hedge.max_rate": ConfigValue{
+		0.05,
+		"Maximum fraction of scans that can be hedged.",
+		0.05,
+		false, // mutable
+		false, // case-insensitive
+	},
 	// projector's adminport client, can be used by indexer.
 	"indexer.projectorclient.retryInterval": ConfigValue{
 		16,
@@ -1514,6 +1623,21 @@ var SystemConfig = Config{
 		false, // mutable
 		false, // case-insensitive
 	},
+	"indexer.settings.log_format": ConfigValue{
+		"text",
+		"Indexer log line format, one of text, json or logfmt",
+		"text",
+		false, // mutable
+		false, // case-insensitive
+	},
+	"indexer.settings.log_component_levels": ConfigValue{
+		"",
+		"Indexer per component log levels overriding log_level, " +
+			"specified as component:level,component:level",
+		"",
+		false, // mutable
+		false, // case-insensitive
+	},
 	"indexer.settings.scan_timeout": ConfigValue{
 		120000,
 		"timeout, in milliseconds, timeout for index scan processing",
@@ -1521,6 +1645,22 @@ var SystemConfig = Config{
 		true,  // immutable
 		false, // case-insensitive
 	},
+	"indexer.settings.verify_timeout": ConfigValue{
+		1800000,
+		"timeout, in milliseconds, for replaying bucket documents " +
+			"while verifying an index against KV",
+		1800000,
+		false, // mutable
+		false, // case-insensitive
+	},
+	"indexer.settings.import_timeout": ConfigValue{
+		300000,
+		"timeout, in milliseconds, for the snapshot of an imported index " +
+			"to be persisted",
+		300000,
+		false, // mutable
+		false, // case-insensitive
+	},
 	"indexer.settings.max_array_seckey_size": ConfigValue{
 		10240,
 		"Maximum size of secondary index key size for array index",
@@ -1720,6 +1860,31 @@ var SystemConfig = Config{
 		false, // mutable
 		false, // case-insensitive
 	},
+	"indexer.settings.moi.scan_shards": ConfigValue{
+		0,
+		"Number of key range shards scanned in parallel for a single " +
+			"range scan on memory_optimized index, 0 picks a value based " +
+			"on number of cores, 1 disables parallel scans",
+		0,
+		false, // mutable
+		false, // case-insensitive
+	},
+	"indexer.settings.moi.scan_workers": ConfigValue{
+		0,
+		"Number of workers shared by all parallel range scans on " +
+			"memory_optimized indexes of the node, 0 picks the number of cores",
+		0,
+		false, // mutable
+		false, // case-insensitive
+	},
+	"indexer.settings.moi.scan_shard_min_items": ConfigValue{
+		100000,
+		"Minimum number of items in index snapshot for range scans to be " +
+			"split into shards",
+		100000,
+		false, // mutable
+		false, // case-insensitive
+	},
 	"indexer.settings.storage_mode": ConfigValue{
 		"",
 		"Storage Type e.g. forestdb, memory_optimized",
@@ -1748,6 +1913,21 @@ var SystemConfig = Config{
 		false, // mutable
 		false, // case-insensitive
 	},
+	"projector.settings.log_format": ConfigValue{
+		"text",
+		"Projector log line format, one of text, json or logfmt",
+		"text",
+		false, // mutable
+		false, // case-insensitive
+	},
+	"projector.settings.log_component_levels": ConfigValue{
+		"",
+		"Projector per component log levels overriding log_level, " +
+			"specified as component:level,component:level",
+		"",
+		false, // mutable
+		false, // case-insensitive
+	},
 	"projector.diagnostics_dir": ConfigValue{
 		"./",
 		"Projector diagnostics information directory",
@@ -1837,6 +2017,23 @@ var SystemConfig = Config{
 		false, // mutable
 		false, // case-insensitive
 	},
+	"indexer.settings.build.max_concurrent": ConfigValue{
+		0,
+		"Maximum number of buckets that can build indexes in INIT_STREAM at the same time on this node.  " +
+			"Builds beyond that are queued and started by build_priority as other builds complete.  " +
+			"Use 0 for no limit.",
+		0,
+		false, // mutable
+		false, // case-insensitive
+	},
+	"indexer.settings.build.mutation_rate": ConfigValue{
+		0,
+		"Maximum number of mutations per second processed by INIT_STREAM on this node, so that " +
+			"MAINT_STREAM can keep up while large indexes are being built.  Use 0 for no limit.",
+		0,
+		false, // mutable
+		false, // case-insensitive
+	},
 	"indexer.build.background.disable": ConfigValue{
 		false,
 		"Disable background index build, except during upgrade",
@@ -1886,6 +2083,27 @@ var SystemConfig = Config{
 		false, // mutable
 		false, // case-insensitive
 	},
+	"indexer.planner.moveCostWeight": ConfigValue{
+		0.0,
+		"weight of cost on bytes and docs moved during rebalance, regardless of resource variation. 0 to disable.",
+		0.0,
+		false, // mutable
+		false, // case-insensitive
+	},
+	"indexer.planner.diskCostWeight": ConfigValue{
+		0.0,
+		"weight of cost on variation of disk usage and disk write rate across indexer nodes. 0 to disable.",
+		0.0,
+		false, // mutable
+		false, // case-insensitive
+	},
+	"indexer.planner.minimizeMove": ConfigValue{
+		false,
+		"stop rebalance planning with the least index movement once resource variation is under variationThreshold",
+		false,
+		false, // mutable
+		false, // case-insensitive
+	},
 	"indexer.stream_reader.markFirstSnap": ConfigValue{
 		true,
 		"Identify mutations from first DCP snapshot. Used for back index lookup optimization.",
@@ -0,0 +1,63 @@
+// Copyright (c) 2014 Couchbase, Inc.
+// Licensed under the Apache License, Version 2.0 (the "License"); you may not use this file
+// except in compliance with the License. You may obtain a copy of the License at
+//   http://www.apache.org/licenses/LICENSE-2.0
+// Unless required by applicable law or agreed to in writing, software distributed under the
+// License is distributed on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND,
+// either express or implied. See the License for the specific language governing permissions
+// and limitations under the License.
+
+package common
+
+import (
+	"bytes"
+	"regexp"
+)
+
+// DocKeyFilter restricts the documents seen by an index by their key,
+// without looking into the document. A key shall start with one of the
+// prefixes, if any, and match the RE2 pattern, if any.
+type DocKeyFilter struct {
+	prefixes [][]byte
+	pattern  *regexp.Regexp
+}
+
+// NewDocKeyFilter returns nil if neither prefixes nor pattern is
+// specified, that is, every document matches.
+func NewDocKeyFilter(prefixes []string, pattern string) (*DocKeyFilter, error) {
+	if len(prefixes) == 0 && pattern == "" {
+		return nil, nil
+	}
+	f := &DocKeyFilter{prefixes: make([][]byte, 0, len(prefixes))}
+	for _, prefix := range prefixes {
+		f.prefixes = append(f.prefixes, []byte(prefix))
+	}
+	if pattern != "" {
+		re, err := regexp.Compile(pattern)
+		if err != nil {
+			return nil, err
+		}
+		f.pattern = re
+	}
+	return f, nil
+}
+
+// Match docid against the filter, a nil filter matches every docid.
+func (f *DocKeyFilter) Match(docid []byte) bool {
+	if f == nil {
+		return true
+	}
+	if len(f.prefixes) > 0 {
+		matched := false
+		for _, prefix := range f.prefixes {
+			if bytes.HasPrefix(docid, prefix) {
+				matched = true
+				break
+			}
+		}
+		if !matched {
+			return false
+		}
+	}
+	return f.pattern == nil || f.pattern.Match(docid)
+}
@@ -0,0 +1,33 @@
+package common
+
+import "testing"
+
+func TestDocKeyFilter(t *testing.T) {
+	if f, err := NewDocKeyFilter(nil, ""); err != nil || f != nil || !f.Match([]byte("any")) {
+		t.Fatalf("expected nil filter to match, got %v %v", f, err)
+	}
+	if _, err := NewDocKeyFilter(nil, "user::("); err == nil {
+		t.Fatalf("expected error for invalid pattern")
+	}
+
+	f, err := NewDocKeyFilter([]string{"user::", "order::"}, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	for docid, match := range map[string]bool{
+		"user::10": true, "order::10": true, "product::10": false, "use": false,
+	} {
+		if f.Match([]byte(docid)) != match {
+			t.Errorf("expected %v for %v", match, docid)
+		}
+	}
+
+	f, _ = NewDocKeyFilter([]string{"user::"}, `::[0-9]+$`)
+	for docid, match := range map[string]bool{
+		"user::10": true, "user::abc": false, "order::10": false,
+	} {
+		if f.Match([]byte(docid)) != match {
+			t.Errorf("expected %v for %v", match, docid)
+		}
+	}
+}
@@ -23,4 +23,12 @@ type Evaluator interface {
 	// TransformRoute will transform document consumable by
 	// downstream, returns data to be published to endpoints.
 	TransformRoute(vbuuid uint64, m *mc.DcpEvent, data map[string]interface{}, encodeBuf []byte) ([]byte, error)
+
+	// MatchDocid returns false if documents with key `docid` shall
+	// not be evaluated, neither for upsert nor for deletion.
+	MatchDocid(docid []byte) bool
+
+	// Errors return the number of documents that could not be
+	// evaluated and hence skipped.
+	Errors() uint64
 }
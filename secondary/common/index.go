@@ -195,6 +195,8 @@ type IndexDefn struct {
 	BucketUUID      string          `json:"bucketUUID,omitempty"`
 	IsPrimary       bool            `json:"isPrimary,omitempty"`
 	SecExprs        []string        `json:"secExprs,omitempty"`
+	Include         []string        `json:"include,omitempty"`
+	Collation       string          `json:"collation,omitempty"`
 	ExprType        ExprType        `json:"exprType,omitempty"`
 	PartitionScheme PartitionScheme `json:"partitionScheme,omitempty"`
 	//PartitionKey is obsolete
@@ -209,6 +211,9 @@ type IndexDefn struct {
 	PartitionKeys      []string   `json:"partitionKeys,omitempty"`
 	RetainDeletedXATTR bool       `json:"retainDeletedXATTR,omitempty"`
 	HashScheme         HashScheme `json:"hashScheme,omitempty"`
+	DocKeyPrefixes     []string   `json:"docKeyPrefixes,omitempty"`
+	DocKeyPattern      string     `json:"docKeyPattern,omitempty"`
+	BuildPriority      int        `json:"buildPriority,omitempty"`
 
 	// Sizing info
 	NumDoc        uint64  `json:"numDoc,omitempty"`
@@ -259,12 +264,17 @@ func (idx IndexDefn) String() string {
 	str += fmt.Sprintf("NumReplica: %v ", idx.NumReplica)
 	str += fmt.Sprintf("InstVersion: %v ", idx.InstVersion)
 	str += fmt.Sprintf("\n\t\tSecExprs: %v ", logging.TagUD(idx.SecExprs))
+	str += fmt.Sprintf("\n\t\tInclude: %v ", logging.TagUD(idx.Include))
+	str += fmt.Sprintf("\n\t\tCollation: %v ", idx.Collation)
 	str += fmt.Sprintf("\n\t\tDesc: %v", idx.Desc)
 	str += fmt.Sprintf("\n\t\tPartitionScheme: %v ", idx.PartitionScheme)
 	str += fmt.Sprintf("\n\t\tHashScheme: %v ", idx.HashScheme.String())
 	str += fmt.Sprintf("PartitionKeys: %v ", idx.PartitionKeys)
 	str += fmt.Sprintf("WhereExpr: %v ", logging.TagUD(idx.WhereExpr))
 	str += fmt.Sprintf("RetainDeletedXATTR: %v ", idx.RetainDeletedXATTR)
+	str += fmt.Sprintf("DocKeyPrefixes: %v ", logging.TagUD(idx.DocKeyPrefixes))
+	str += fmt.Sprintf("DocKeyPattern: %v ", logging.TagUD(idx.DocKeyPattern))
+	str += fmt.Sprintf("BuildPriority: %v ", idx.BuildPriority)
 	return str
 
 }
@@ -280,6 +290,8 @@ func (idx IndexDefn) Clone() *IndexDefn {
 		BucketUUID:         idx.BucketUUID,
 		IsPrimary:          idx.IsPrimary,
 		SecExprs:           idx.SecExprs,
+		Include:            idx.Include,
+		Collation:          idx.Collation,
 		Desc:               idx.Desc,
 		ExprType:           idx.ExprType,
 		PartitionScheme:    idx.PartitionScheme,
@@ -292,6 +304,9 @@ func (idx IndexDefn) Clone() *IndexDefn {
 		IsArrayIndex:       idx.IsArrayIndex,
 		NumReplica:         idx.NumReplica,
 		RetainDeletedXATTR: idx.RetainDeletedXATTR,
+		DocKeyPrefixes:     idx.DocKeyPrefixes,
+		DocKeyPattern:      idx.DocKeyPattern,
+		BuildPriority:      idx.BuildPriority,
 		NumDoc:             idx.NumDoc,
 		SecKeySize:         idx.SecKeySize,
 		DocKeySize:         idx.DocKeySize,
@@ -566,6 +581,34 @@ func IsEquivalentIndex(d1, d2 *IndexDefn) bool {
 		}
 	}
 
+	if len(d1.Include) != len(d2.Include) {
+		return false
+	}
+
+	for i, s1 := range d1.Include {
+		if s1 != d2.Include[i] {
+			return false
+		}
+	}
+
+	if d1.Collation != d2.Collation {
+		return false
+	}
+
+	if len(d1.DocKeyPrefixes) != len(d2.DocKeyPrefixes) {
+		return false
+	}
+
+	for i, s1 := range d1.DocKeyPrefixes {
+		if s1 != d2.DocKeyPrefixes[i] {
+			return false
+		}
+	}
+
+	if d1.DocKeyPattern != d2.DocKeyPattern {
+		return false
+	}
+
 	if len(d1.PartitionKeys) != len(d2.PartitionKeys) {
 		return false
 	}
@@ -789,18 +789,32 @@ func (d *decodeState) convertNumber(s string) (interface{}, error) {
 	// truncation.
 	//
 	// If there is overflow, we revert to float64.
+	if i, ok := parseInt64(s); ok {
+		return i, nil
+	}
+
+	f, ok := parseFloat64(s)
+	if !ok {
+		return nil, &UnmarshalTypeError{"number " + s, reflect.TypeOf(0.0), int64(d.off)}
+	}
+	return f, nil
+}
+
+// parseInt64 parses s as an int64, fails if s is not an integer or
+// overflows int64, see convertNumber.
+func parseInt64(s string) (int64, bool) {
 	i, err := strconv.ParseInt(s, 10, 64)
 	if err == nil &&
 		((i > math.MinInt64 && i < math.MaxInt64) ||
 			strconv.FormatInt(i, 10) == s) {
-		return i, nil
+		return i, true
 	}
+	return 0, false
+}
 
+func parseFloat64(s string) (float64, bool) {
 	f, err := strconv.ParseFloat(s, 64)
-	if err != nil {
-		return nil, &UnmarshalTypeError{"number " + s, reflect.TypeOf(0.0), int64(d.off)}
-	}
-	return f, nil
+	return f, err == nil
 }
 
 var numberType = reflect.TypeOf(Number(""))
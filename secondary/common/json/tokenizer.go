@@ -0,0 +1,141 @@
+// Copyright (c) 2014 Couchbase, Inc.
+// Licensed under the Apache License, Version 2.0 (the "License"); you may not use this file
+// except in compliance with the License. You may obtain a copy of the License at
+//   http://www.apache.org/licenses/LICENSE-2.0
+// Unless required by applicable law or agreed to in writing, software distributed under the
+// License is distributed on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND,
+// either express or implied. See the License for the specific language governing permissions
+// and limitations under the License.
+
+package json
+
+import "reflect"
+
+// TokenKind identifies a token returned by Tokenizer.Next.
+type TokenKind int
+
+const (
+	TokenBeginObject TokenKind = iota + 1
+	TokenEndObject
+	TokenBeginArray
+	TokenEndArray
+	// TokenKey is a quoted property name.
+	TokenKey
+	// TokenLiteral is a null, true, false, number or quoted string value.
+	TokenLiteral
+	// TokenEnd is returned after the top-level value and for every call
+	// thereafter.
+	TokenEnd
+)
+
+// Tokenizer splits a single JSON value into tokens, in one pass and
+// without decoding them into Go values. Syntax is checked as the input
+// is consumed, hence tokens returned before an error were part of an
+// invalid document.
+//
+// A Tokenizer can be reused with Reset, it does not allocate except for
+// growing the stack of nested composite values.
+type Tokenizer struct {
+	data    []byte
+	off     int // next byte to scan
+	scan    scanner
+	literal int  // start of literal being scanned, -1 if none
+	key     bool // literal being scanned is a property name
+	pending int  // scan code seen past the end of a literal, -1 if none
+	done    bool
+}
+
+// NewTokenizer returns a tokenizer for data.
+func NewTokenizer(data []byte) *Tokenizer {
+	t := &Tokenizer{}
+	t.Reset(data)
+	return t
+}
+
+// Reset the tokenizer to start scanning data.
+func (t *Tokenizer) Reset(data []byte) {
+	t.data, t.off = data, 0
+	t.scan.reset()
+	t.scan.bytes = 0
+	t.literal, t.pending, t.done = -1, -1, false
+}
+
+// Next returns the next token. For TokenKey and TokenLiteral, item is
+// the raw text of the token, sliced from the input. Returned error is
+// a *SyntaxError same as Unmarshal would return for the input.
+func (t *Tokenizer) Next() (kind TokenKind, item []byte, err error) {
+	for {
+		var op, end int
+		if t.pending >= 0 {
+			op, t.pending = t.pending, -1
+		} else if t.off < len(t.data) {
+			end = t.off
+			t.scan.bytes++
+			op = t.scan.step(&t.scan, t.data[t.off])
+			t.off++
+		} else if t.done {
+			return TokenEnd, nil, nil
+		} else {
+			end = len(t.data)
+			op = t.scan.eof()
+		}
+
+		// a literal is terminated by the first code that is not
+		// scanContinue, which is handled after the literal is returned.
+		if t.literal >= 0 && op != scanContinue && op != scanError {
+			item, t.literal, t.pending = t.data[t.literal:end], -1, op
+			if t.key {
+				return TokenKey, item, nil
+			}
+			return TokenLiteral, item, nil
+		}
+
+		switch op {
+		case scanBeginLiteral:
+			t.literal = t.off - 1
+			n := len(t.scan.parseState)
+			t.key = n > 0 && t.scan.parseState[n-1] == parseObjectKey
+		case scanBeginObject:
+			return TokenBeginObject, nil, nil
+		case scanEndObject:
+			return TokenEndObject, nil, nil
+		case scanBeginArray:
+			return TokenBeginArray, nil, nil
+		case scanEndArray:
+			return TokenEndArray, nil, nil
+		case scanEnd:
+			// trailing bytes shall be only spaces.
+			if t.scan.err != nil {
+				return 0, nil, t.scan.err
+			} else if t.off >= len(t.data) {
+				t.done = true
+				return TokenEnd, nil, nil
+			}
+		case scanError:
+			return 0, nil, t.scan.err
+		}
+	}
+}
+
+// Number converts a number literal returned by Next into an int64 or a
+// float64, the same way Unmarshal would decode it into an interface{}.
+// isInt tells which of the two is valid.
+func (t *Tokenizer) Number(item []byte) (i int64, f float64, isInt bool, err error) {
+	s := string(item)
+	if i, isInt = parseInt64(s); isInt {
+		return i, 0, true, nil
+	}
+	var ok bool
+	if f, ok = parseFloat64(s); !ok {
+		err = &UnmarshalTypeError{"number " + s, reflect.TypeOf(0.0), int64(t.off)}
+		return 0, 0, false, err
+	}
+	return 0, f, false, nil
+}
+
+// Unquote converts a quoted string literal returned by Next into its
+// text, same as Unmarshal. When there is nothing to unescape, returned
+// slice shares the input.
+func Unquote(item []byte) (text []byte, ok bool) {
+	return unquoteBytes(item)
+}
@@ -0,0 +1,89 @@
+// Copyright (c) 2014 Couchbase, Inc.
+// Licensed under the Apache License, Version 2.0 (the "License"); you may not use this file
+// except in compliance with the License. You may obtain a copy of the License at
+//   http://www.apache.org/licenses/LICENSE-2.0
+// Unless required by applicable law or agreed to in writing, software distributed under the
+// License is distributed on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND,
+// either express or implied. See the License for the specific language governing permissions
+// and limitations under the License.
+
+package json
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+)
+
+func TestTokenizer(t *testing.T) {
+	var tokenizerTests = []struct {
+		in  string
+		out string
+	}{
+		{`1`, `1 .`},
+		{` "x" `, `"x" .`},
+		{`{}`, `{ } .`},
+		{`{"a" : [1, -2.5e3,true], "b":{"c":null}}`,
+			`{ k:"a" [ 1 -2.5e3 true ] k:"b" { k:"c" null } } .`},
+		{`[{"a":"b"},[],"c"]`, `[ { k:"a" "b" } [ ] "c" ] .`},
+	}
+
+	tok := &Tokenizer{}
+	for _, tt := range tokenizerTests {
+		tok.Reset([]byte(tt.in))
+		var out []string
+		for {
+			kind, item, err := tok.Next()
+			if err != nil {
+				t.Fatalf("Next(%q): %v", tt.in, err)
+			}
+			switch kind {
+			case TokenBeginObject:
+				out = append(out, "{")
+			case TokenEndObject:
+				out = append(out, "}")
+			case TokenBeginArray:
+				out = append(out, "[")
+			case TokenEndArray:
+				out = append(out, "]")
+			case TokenKey:
+				out = append(out, "k:"+string(item))
+			case TokenLiteral:
+				out = append(out, string(item))
+			case TokenEnd:
+				out = append(out, ".")
+			}
+			if kind == TokenEnd {
+				break
+			}
+		}
+		if s := strings.Join(out, " "); s != tt.out {
+			t.Errorf("tokens of %q: %v, expected %v", tt.in, s, tt.out)
+		}
+	}
+
+	for _, in := range []string{``, `{"a":1`, `[1,]`, `12x`, `{} x`, `"a`} {
+		tok.Reset([]byte(in))
+		var err error
+		for kind := TokenKind(0); err == nil && kind != TokenEnd; {
+			kind, _, err = tok.Next()
+		}
+		expected := checkValid([]byte(in), &scanner{})
+		if fmt.Sprint(err) != fmt.Sprint(expected) {
+			t.Errorf("error for %q: %v, expected %v", in, err, expected)
+		}
+	}
+}
+
+func TestTokenizerNumber(t *testing.T) {
+	tok := NewTokenizer(nil)
+	if i, _, isInt, err := tok.Number([]byte("-9223372036854775808")); err != nil || !isInt || i != -9223372036854775808 {
+		t.Errorf("unexpected %v %v %v", i, isInt, err)
+	}
+	if _, f, isInt, err := tok.Number([]byte("9223372036854775808")); err != nil || isInt || f != 9223372036854775808 {
+		t.Errorf("unexpected %v %v %v", f, isInt, err)
+	}
+	if _, _, _, err := tok.Number([]byte("1e400")); err == nil {
+		t.Errorf("expected error for out of range number")
+	}
+}
@@ -0,0 +1,93 @@
+// Copyright (c) 2015 Couchbase, Inc.
+// Licensed under the Apache License, Version 2.0 (the "License"); you may not use this file
+// except in compliance with the License. You may obtain a copy of the License at
+//   http://www.apache.org/licenses/LICENSE-2.0
+// Unless required by applicable law or agreed to in writing, software distributed under the
+// License is distributed on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND,
+// either express or implied. See the License for the specific language governing permissions
+// and limitations under the License.
+
+package common
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"strings"
+	"sync"
+
+	"github.com/couchbase/indexing/secondary/dcp"
+)
+
+// LocalClusterInfoFile is the file, in the directory of a local metadata
+// store, holding LocalClusterInfo for standalone deployments.
+const LocalClusterInfoFile = "cluster_info.json"
+
+// LocalClusterInfo is the cluster topology for standalone deployments
+// that don't run with ns_server. ClusterInfoCache is populated from it
+// instead of ns_server REST. Nodes and NodeServices have the same
+// format as ns_server's pool and nodeServices responses.
+type LocalClusterInfo struct {
+	Nodes        []couchbase.Node         `json:"nodes"`
+	NodeServices []couchbase.NodeServices `json:"nodesExt"`
+	ServerGroups map[string]string        `json:"serverGroups"` // hostname -> server group
+	Buckets      []LocalBucketInfo        `json:"buckets"`
+	IsIPv6       bool                     `json:"isIPv6"`
+}
+
+// LocalBucketInfo describes a bucket of LocalClusterInfo.
+type LocalBucketInfo struct {
+	Name     string              `json:"name"`
+	UUID     string              `json:"uuid"`
+	Type     string              `json:"bucketType"`
+	VBuckets map[string][]uint32 `json:"vbuckets"` // hostname -> active vbuckets
+}
+
+var localClusterInfoLock sync.RWMutex
+var localClusterInfo *LocalClusterInfo
+
+// GetLocalClusterInfo returns the cluster topology of a standalone
+// deployment, nil if this process runs with ns_server.
+func GetLocalClusterInfo() *LocalClusterInfo {
+	localClusterInfoLock.RLock()
+	defer localClusterInfoLock.RUnlock()
+	return localClusterInfo
+}
+
+// SetLocalClusterInfo to be used by ClusterInfoCache instead of
+// ns_server, shall be called before any of the services are started.
+func SetLocalClusterInfo(info *LocalClusterInfo) {
+	localClusterInfoLock.Lock()
+	defer localClusterInfoLock.Unlock()
+	localClusterInfo = info
+}
+
+// LoadLocalClusterInfo reads LocalClusterInfo from JSON file.
+func LoadLocalClusterInfo(file string) (*LocalClusterInfo, error) {
+	data, err := ioutil.ReadFile(file)
+	if err != nil {
+		return nil, err
+	}
+	info := &LocalClusterInfo{}
+	if err := json.Unmarshal(data, info); err != nil {
+		return nil, fmt.Errorf("Invalid cluster info %v: %v", file, err)
+	}
+	if len(info.Nodes) == 0 {
+		return nil, errors.New("Cluster info has no nodes")
+	}
+	return info, nil
+}
+
+func (info *LocalClusterInfo) getBucket(bucket string) (*LocalBucketInfo, error) {
+	for i := range info.Buckets {
+		if info.Buckets[i].Name == bucket {
+			return &info.Buckets[i], nil
+		}
+	}
+	return nil, fmt.Errorf("No bucket named %v", bucket)
+}
+
+func (b *LocalBucketInfo) isEphemeral() bool {
+	return strings.EqualFold(b.Type, "ephemeral")
+}
@@ -0,0 +1,85 @@
+package common
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+var testClusterInfo = `{
+  "nodes": [
+    {"hostname": "127.0.0.1:9000", "clusterMembership": "active", "status": "healthy",
+     "clusterCompatibility": 327685, "thisNode": true},
+    {"hostname": "127.0.0.1:9001", "clusterMembership": "active", "status": "healthy",
+     "clusterCompatibility": 327685}
+  ],
+  "nodesExt": [
+    {"hostname": "127.0.0.1", "thisNode": true,
+     "services": {"mgmt": 9000, "indexAdmin": 9100, "kv": 12000}},
+    {"hostname": "127.0.0.1", "services": {"mgmt": 9001, "indexAdmin": 9200, "kv": 12002}}
+  ],
+  "serverGroups": {"127.0.0.1:9000": "Group 1", "127.0.0.1:9001": "Group 2"},
+  "buckets": [
+    {"name": "default", "uuid": "abcd", "bucketType": "membase",
+     "vbuckets": {"127.0.0.1:9000": [0, 1], "127.0.0.1:9001": [2, 3]}},
+    {"name": "eph", "uuid": "efgh", "bucketType": "ephemeral",
+     "vbuckets": {"127.0.0.1:9001": [0, 1, 2, 3]}}
+  ]
+}`
+
+func TestLocalClusterInfo(t *testing.T) {
+	dir, err := ioutil.TempDir("", "metadata")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	file := filepath.Join(dir, LocalClusterInfoFile)
+	if err := ioutil.WriteFile(file, []byte(testClusterInfo), 0644); err != nil {
+		t.Fatal(err)
+	}
+	info, err := LoadLocalClusterInfo(file)
+	if err != nil {
+		t.Fatal(err)
+	}
+	SetLocalClusterInfo(info)
+	defer SetLocalClusterInfo(nil)
+
+	cinfo, err := FetchNewClusterInfoCache("http://127.0.0.1:9000", "default")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	nid := cinfo.GetCurrentNode()
+	if nid != 0 {
+		t.Fatalf("expected current node 0, got %v", nid)
+	}
+	if group := cinfo.GetServerGroup(1); group != "Group 2" {
+		t.Errorf("unexpected server group %v", group)
+	}
+	if addr, err := cinfo.GetServiceAddress(1, INDEX_ADMIN_SERVICE); err != nil || addr != "127.0.0.1:9200" {
+		t.Errorf("unexpected address %v %v", addr, err)
+	}
+
+	if vbs, err := cinfo.GetVBuckets(1, "default"); err != nil || !reflect.DeepEqual(vbs, []uint32{2, 3}) {
+		t.Errorf("unexpected vbuckets %v %v", vbs, err)
+	}
+	if _, err := cinfo.GetVBuckets(0, "eph"); err == nil {
+		t.Errorf("expected node not to be a bucket member")
+	}
+	if nids, err := cinfo.GetNodesByBucket("eph"); err != nil || !reflect.DeepEqual(nids, []NodeId{1}) {
+		t.Errorf("unexpected nodes %v %v", nids, err)
+	}
+
+	if uuid := cinfo.GetBucketUUID("default"); uuid != "abcd" {
+		t.Errorf("unexpected bucket uuid %v", uuid)
+	}
+	if uuid := cinfo.GetBucketUUID("missing"); uuid != BUCKET_UUID_NIL {
+		t.Errorf("unexpected bucket uuid %v", uuid)
+	}
+	if ephemeral, err := cinfo.IsEphemeral("eph"); err != nil || !ephemeral {
+		t.Errorf("expected ephemeral bucket, got %v %v", ephemeral, err)
+	}
+}
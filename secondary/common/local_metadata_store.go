@@ -0,0 +1,362 @@
+// Copyright (c) 2015 Couchbase, Inc.
+// Licensed under the Apache License, Version 2.0 (the "License"); you may not use this file
+// except in compliance with the License. You may obtain a copy of the License at
+//   http://www.apache.org/licenses/LICENSE-2.0
+// Unless required by applicable law or agreed to in writing, software distributed under the
+// License is distributed on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND,
+// either express or implied. See the License for the specific language governing permissions
+// and limitations under the License.
+
+package common
+
+import (
+	"encoding/binary"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// suffix of files holding a value, so that a path can be both a value
+// and a directory.
+const localMetaSuffix = ".meta"
+
+// file holding the last revision handed out, so that revisions of
+// deleted paths are not reused after restart.
+const localMetaRevFile = "revision"
+
+// LocalMetadataStore is a MetadataStore backed by a local directory,
+// for standalone deployments and tests. Every path is a file holding
+// its revision followed by its value, files are replaced atomically.
+// Revisions are increasing integers, never reused. Changes made by
+// other processes
+// sharing the directory are not notified to observers.
+type LocalMetadataStore struct {
+	dir string
+
+	mu       sync.Mutex
+	rev      uint64
+	watchers map[*localMetaWatcher]bool
+}
+
+type localMetaWatcher struct {
+	dirpath string
+	mu      sync.Mutex
+	events  []MetadataEntry
+	notify  chan bool
+}
+
+// NewLocalMetadataStore opens the store in dir, creating it if it does
+// not exist.
+func NewLocalMetadataStore(dir string) (*LocalMetadataStore, error) {
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return nil, err
+	}
+	s := &LocalMetadataStore{
+		dir:      dir,
+		watchers: make(map[*localMetaWatcher]bool),
+	}
+	if buf, err := ioutil.ReadFile(s.revFile()); err == nil && len(buf) == 8 {
+		s.rev = binary.BigEndian.Uint64(buf)
+	} else if err != nil && !os.IsNotExist(err) {
+		return nil, err
+	}
+	// in case revision file was lost.
+	entries, err := s.list("/")
+	if err != nil {
+		return nil, err
+	}
+	for _, entry := range entries {
+		if rev := entry.Rev.(uint64); rev > s.rev {
+			s.rev = rev
+		}
+	}
+	return s, nil
+}
+
+func (s *LocalMetadataStore) Get(path string) ([]byte, interface{}, error) {
+	file, err := s.file(path)
+	if err != nil {
+		return nil, nil, err
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	value, rev, err := s.read(file)
+	if err != nil || value == nil {
+		return nil, nil, err
+	}
+	return value, rev, nil
+}
+
+func (s *LocalMetadataStore) Set(path string, value []byte, rev interface{}) error {
+	return s.update(path, value, rev, false)
+}
+
+func (s *LocalMetadataStore) Add(path string, value []byte) error {
+	return s.update(path, value, nil, true)
+}
+
+func (s *LocalMetadataStore) Delete(path string, rev interface{}) error {
+	file, err := s.file(path)
+	if err != nil {
+		return err
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	current, currRev, err := s.read(file)
+	if err != nil {
+		return err
+	} else if current == nil {
+		if rev != nil {
+			return ErrMetadataRevMismatch
+		}
+		return nil
+	} else if rev != nil && rev != currRev {
+		return ErrMetadataRevMismatch
+	}
+	if err := os.Remove(file); err != nil {
+		return err
+	}
+	s.notifyLocked(path, nil, nil)
+	return nil
+}
+
+func (s *LocalMetadataStore) RecursiveDelete(dirpath string) error {
+	if _, err := s.file(dirpath); err != nil {
+		return err
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	entries, err := s.list(dirpath)
+	if err != nil {
+		return err
+	}
+	for _, entry := range entries {
+		file, _ := s.file(entry.Path)
+		if err := os.Remove(file); err != nil && !os.IsNotExist(err) {
+			return err
+		}
+		s.notifyLocked(entry.Path, nil, nil)
+	}
+	return s.removeEmptyDirs(filepath.Join(s.dir, filepath.FromSlash(dirpath)))
+}
+
+func (s *LocalMetadataStore) ListAllChildren(dirpath string) ([]MetadataEntry, error) {
+	if _, err := s.file(dirpath); err != nil {
+		return nil, err
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.list(dirpath)
+}
+
+func (s *LocalMetadataStore) RunObserveChildren(
+	dirpath string, callb MetadataCallback, cancel <-chan struct{}) error {
+
+	if _, err := s.file(dirpath); err != nil {
+		return err
+	}
+
+	// register before listing, so that no change is missed.
+	w := &localMetaWatcher{dirpath: dirpath, notify: make(chan bool, 1)}
+	s.mu.Lock()
+	entries, err := s.list(dirpath)
+	if err == nil {
+		s.watchers[w] = true
+	}
+	s.mu.Unlock()
+	if err != nil {
+		return err
+	}
+	defer func() {
+		s.mu.Lock()
+		delete(s.watchers, w)
+		s.mu.Unlock()
+	}()
+
+	for {
+		for _, entry := range entries {
+			if err := callb(entry.Path, entry.Value, entry.Rev); err != nil {
+				return err
+			}
+		}
+		select {
+		case <-cancel:
+			return nil
+		case <-w.notify:
+		}
+		w.mu.Lock()
+		entries, w.events = w.events, nil
+		w.mu.Unlock()
+	}
+}
+
+func (s *LocalMetadataStore) update(path string, value []byte, rev interface{}, add bool) error {
+	file, err := s.file(path)
+	if err != nil {
+		return err
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	current, currRev, err := s.read(file)
+	if err != nil {
+		return err
+	} else if add && current != nil {
+		return ErrMetadataRevMismatch
+	} else if rev != nil && (current == nil || rev != currRev) {
+		return ErrMetadataRevMismatch
+	}
+
+	if err := os.MkdirAll(filepath.Dir(file), 0755); err != nil {
+		return err
+	}
+	// persist revision before using it.
+	revbuf := make([]byte, 8)
+	binary.BigEndian.PutUint64(revbuf, s.rev+1)
+	if err := writeFileAtomic(s.revFile(), revbuf); err != nil {
+		return err
+	}
+	s.rev++
+
+	buf := make([]byte, 8+len(value))
+	binary.BigEndian.PutUint64(buf, s.rev)
+	copy(buf[8:], value)
+	if err := writeFileAtomic(file, buf); err != nil {
+		return err
+	}
+	s.notifyLocked(path, value, s.rev)
+	return nil
+}
+
+func (s *LocalMetadataStore) revFile() string {
+	return filepath.Join(s.dir, localMetaRevFile)
+}
+
+// removeEmptyDirs under root, including root, but not the store's
+// directory.
+func (s *LocalMetadataStore) removeEmptyDirs(root string) error {
+	var dirs []string
+	err := filepath.Walk(root, func(file string, info os.FileInfo, err error) error {
+		if err != nil {
+			if os.IsNotExist(err) {
+				return nil
+			}
+			return err
+		} else if info.IsDir() && file != filepath.Clean(s.dir) {
+			dirs = append(dirs, file)
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	// children before their parents.
+	for i := len(dirs) - 1; i >= 0; i-- {
+		if entries, err := ioutil.ReadDir(dirs[i]); err == nil && len(entries) == 0 {
+			if err := os.Remove(dirs[i]); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// writeFileAtomic replaces file with buf.
+func writeFileAtomic(file string, buf []byte) error {
+	tmpfile := file + ".tmp"
+	if err := ioutil.WriteFile(tmpfile, buf, 0644); err != nil {
+		return err
+	}
+	if err := os.Rename(tmpfile, file); err != nil {
+		os.Remove(tmpfile)
+		return err
+	}
+	return nil
+}
+
+// file returns local file for metadata path.
+func (s *LocalMetadataStore) file(path string) (string, error) {
+	if !strings.HasPrefix(path, "/") {
+		return "", fmt.Errorf("Invalid metadata path %v", path)
+	}
+	for _, elem := range strings.Split(path, "/") {
+		if elem == "." || elem == ".." {
+			return "", fmt.Errorf("Invalid metadata path %v", path)
+		}
+	}
+	file := filepath.Join(s.dir, filepath.FromSlash(path))
+	if !strings.HasSuffix(path, "/") {
+		file += localMetaSuffix
+	}
+	return file, nil
+}
+
+// read value and revision from file, nil value if file does not exist.
+func (s *LocalMetadataStore) read(file string) ([]byte, interface{}, error) {
+	buf, err := ioutil.ReadFile(file)
+	if os.IsNotExist(err) {
+		return nil, nil, nil
+	} else if err != nil {
+		return nil, nil, err
+	} else if len(buf) < 8 {
+		return nil, nil, fmt.Errorf("Corrupted metadata file %v", file)
+	}
+	return buf[8:], binary.BigEndian.Uint64(buf[:8]), nil
+}
+
+// list all paths under dirpath, sorted by path.
+func (s *LocalMetadataStore) list(dirpath string) ([]MetadataEntry, error) {
+	root := filepath.Join(s.dir, filepath.FromSlash(dirpath))
+	entries := make([]MetadataEntry, 0)
+	err := filepath.Walk(root, func(file string, info os.FileInfo, err error) error {
+		if err != nil {
+			if os.IsNotExist(err) {
+				return nil
+			}
+			return err
+		} else if info.IsDir() || !strings.HasSuffix(file, localMetaSuffix) {
+			return nil
+		}
+		rel, err := filepath.Rel(s.dir, strings.TrimSuffix(file, localMetaSuffix))
+		if err != nil {
+			return err
+		}
+		path := "/" + filepath.ToSlash(rel)
+		if !strings.HasPrefix(path, dirpath) {
+			return nil
+		}
+		value, rev, err := s.read(file)
+		if err != nil {
+			return err
+		} else if value != nil {
+			entries = append(entries, MetadataEntry{Path: path, Value: value, Rev: rev})
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	sort.Slice(entries, func(i, j int) bool { return entries[i].Path < entries[j].Path })
+	return entries, nil
+}
+
+func (s *LocalMetadataStore) notifyLocked(path string, value []byte, rev interface{}) {
+	for w := range s.watchers {
+		if !strings.HasPrefix(path, w.dirpath) {
+			continue
+		}
+		w.mu.Lock()
+		w.events = append(w.events, MetadataEntry{Path: path, Value: value, Rev: rev})
+		w.mu.Unlock()
+		select {
+		case w.notify <- true:
+		default:
+		}
+	}
+}
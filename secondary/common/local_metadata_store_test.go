@@ -0,0 +1,171 @@
+package common
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func newTestMetadataStore(t *testing.T) (*LocalMetadataStore, string) {
+	dir, err := ioutil.TempDir("", "metadata")
+	if err != nil {
+		t.Fatal(err)
+	}
+	s, err := NewLocalMetadataStore(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return s, dir
+}
+
+func TestLocalMetadataStore(t *testing.T) {
+	s, dir := newTestMetadataStore(t)
+	defer os.RemoveAll(dir)
+
+	if value, rev, err := s.Get("/indexing/settings/config"); err != nil || value != nil || rev != nil {
+		t.Fatalf("unexpected %s %v %v", value, rev, err)
+	}
+	if err := s.Set("/indexing/settings/config", []byte("v1"), nil); err != nil {
+		t.Fatal(err)
+	}
+	value, rev, err := s.Get("/indexing/settings/config")
+	if err != nil || string(value) != "v1" {
+		t.Fatalf("unexpected %s %v", value, err)
+	}
+
+	// compare and swap
+	if err := s.Set("/indexing/settings/config", []byte("v2"), rev); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.Set("/indexing/settings/config", []byte("v3"), rev); err != ErrMetadataRevMismatch {
+		t.Fatalf("expected rev mismatch, got %v", err)
+	}
+	if err := s.Add("/indexing/settings/config", []byte("v3")); err != ErrMetadataRevMismatch {
+		t.Fatalf("expected rev mismatch, got %v", err)
+	}
+	if err := s.Delete("/indexing/settings/config", rev); err != ErrMetadataRevMismatch {
+		t.Fatalf("expected rev mismatch, got %v", err)
+	}
+
+	// path can be both a value and a directory
+	s.Set("/indexing/rebalance/token", []byte("t"), nil)
+	s.Set("/indexing/rebalance/token/a", []byte("a"), nil)
+	s.Set("/indexing/rebalance/token/b/c", []byte("c"), nil)
+	entries, err := s.ListAllChildren("/indexing/rebalance/")
+	if err != nil || len(entries) != 3 {
+		t.Fatalf("unexpected %v %v", entries, err)
+	}
+	paths := []string{"/indexing/rebalance/token", "/indexing/rebalance/token/a", "/indexing/rebalance/token/b/c"}
+	for i, entry := range entries {
+		if entry.Path != paths[i] {
+			t.Errorf("expected %v, got %v", paths[i], entry.Path)
+		}
+	}
+
+	if err := s.RecursiveDelete("/indexing/rebalance/token/"); err != nil {
+		t.Fatal(err)
+	}
+	if entries, _ = s.ListAllChildren("/indexing/rebalance/"); len(entries) != 1 {
+		t.Fatalf("unexpected %v", entries)
+	}
+	if _, err := os.Stat(filepath.Join(dir, "indexing", "rebalance", "token")); !os.IsNotExist(err) {
+		t.Errorf("expected directory to be removed, got %v", err)
+	}
+
+	if _, _, err := s.Get("indexing/../x"); err == nil {
+		t.Errorf("expected error for invalid path")
+	}
+
+	// revisions continue after reopen, even if the latest revision
+	// was deleted.
+	s.Set("/indexing/y", []byte("y"), nil)
+	_, rev, _ = s.Get("/indexing/y")
+	if err := s.Delete("/indexing/y", rev); err != nil {
+		t.Fatal(err)
+	}
+	s2, err := NewLocalMetadataStore(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	s2.Set("/indexing/x", []byte("x"), nil)
+	if _, rev2, _ := s2.Get("/indexing/x"); rev2.(uint64) <= rev.(uint64) {
+		t.Errorf("expected revision after %v, got %v", rev, rev2)
+	}
+}
+
+func TestLocalMetadataStoreObserve(t *testing.T) {
+	s, dir := newTestMetadataStore(t)
+	defer os.RemoveAll(dir)
+
+	s.Set("/indexing/settings/config", []byte("v1"), nil)
+
+	type event struct {
+		path  string
+		value string
+	}
+	eventch := make(chan event, 10)
+	cancel := make(chan struct{})
+	donech := make(chan error)
+	go func() {
+		donech <- s.RunObserveChildren("/indexing/settings/", func(path string, value []byte, rev interface{}) error {
+			eventch <- event{path, string(value)}
+			return nil
+		}, cancel)
+	}()
+
+	expect := func(path, value string) {
+		select {
+		case e := <-eventch:
+			if e.path != path || e.value != value {
+				t.Fatalf("expected %v=%v, got %v", path, value, e)
+			}
+		case <-time.After(5 * time.Second):
+			t.Fatalf("timeout waiting for %v", path)
+		}
+	}
+	expect("/indexing/settings/config", "v1")
+	s.Set("/indexing/other", []byte("x"), nil)
+	s.Set("/indexing/settings/config", []byte("v2"), nil)
+	expect("/indexing/settings/config", "v2")
+	s.Delete("/indexing/settings/config", nil)
+	expect("/indexing/settings/config", "")
+
+	close(cancel)
+	if err := <-donech; err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestMetakvBigValue(t *testing.T) {
+	s, dir := newTestMetadataStore(t)
+	defer os.RemoveAll(dir)
+	defer SetMetadataStore(GetMetadataStore())
+	SetMetadataStore(s)
+
+	value := make([]string, 0)
+	for i := 0; i < 1000; i++ {
+		value = append(value, "bigvalue")
+	}
+	if err := MetakvBigValueSet("/indexing/big/value", value); err != nil {
+		t.Fatal(err)
+	}
+	out := make([]string, 0)
+	if ok, err := MetakvBigValueGet("/indexing/big/value", &out); err != nil || !ok {
+		t.Fatalf("unexpected %v %v", ok, err)
+	}
+	if data1, _ := json.Marshal(value); len(data1) <= METAKV_SIZE_LIMIT || len(out) != len(value) {
+		t.Fatalf("expected %v chunked values, got %v", len(value), len(out))
+	}
+	if paths, err := MetakvBigValueList("/indexing/big/"); err != nil || len(paths) != 1 || paths[0] != "/indexing/big/value" {
+		t.Fatalf("unexpected %v %v", paths, err)
+	}
+	if err := MetakvBigValueDel("/indexing/big/value"); err != nil {
+		t.Fatal(err)
+	}
+	if ok, _ := MetakvBigValueGet("/indexing/big/value", &out); ok {
+		t.Fatalf("expected value to be deleted")
+	}
+}
@@ -0,0 +1,138 @@
+// Copyright (c) 2015 Couchbase, Inc.
+// Licensed under the Apache License, Version 2.0 (the "License"); you may not use this file
+// except in compliance with the License. You may obtain a copy of the License at
+//   http://www.apache.org/licenses/LICENSE-2.0
+// Unless required by applicable law or agreed to in writing, software distributed under the
+// License is distributed on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND,
+// either express or implied. See the License for the specific language governing permissions
+// and limitations under the License.
+
+package common
+
+import (
+	"errors"
+	"sync"
+
+	"github.com/couchbase/cbauth/metakv"
+)
+
+// ErrMetadataRevMismatch is returned when the revision passed to Set,
+// Add or Delete does not match the current revision of the path.
+var ErrMetadataRevMismatch = errors.New("Metadata revision mismatch")
+
+// MetadataEntry is a path, its value and revision, returned by
+// MetadataStore.ListAllChildren.
+type MetadataEntry struct {
+	Path  string
+	Value []byte
+	Rev   interface{}
+}
+
+// MetadataCallback is called by MetadataStore.RunObserveChildren for
+// every child of the observed directory and for every change there
+// after, value is nil if path is deleted. Returning an error stops
+// the observer.
+type MetadataCallback func(path string, value []byte, rev interface{}) error
+
+// MetadataStore is the store for cluster wide metadata like settings,
+// DDL and rebalance tokens. Paths are slash separated, directories
+// end with slash. Revisions are opaque, a nil revision always matches.
+type MetadataStore interface {
+	// Get returns value and revision of path, nil value if path does
+	// not exist.
+	Get(path string) ([]byte, interface{}, error)
+
+	// Set value of path if rev matches its current revision.
+	Set(path string, value []byte, rev interface{}) error
+
+	// Add value for path only if it does not exist, returns
+	// ErrMetadataRevMismatch otherwise.
+	Add(path string, value []byte) error
+
+	// Delete path if rev matches its current revision.
+	Delete(path string, rev interface{}) error
+
+	// RecursiveDelete deletes all paths under dirpath.
+	RecursiveDelete(dirpath string) error
+
+	// ListAllChildren returns all paths under dirpath, recursively.
+	ListAllChildren(dirpath string) ([]MetadataEntry, error)
+
+	// RunObserveChildren calls callb for all paths under dirpath,
+	// and then for every change to them, until cancel is closed or
+	// callb returns an error. Blocks until then.
+	RunObserveChildren(dirpath string, callb MetadataCallback, cancel <-chan struct{}) error
+}
+
+var metadataStoreLock sync.RWMutex
+var metadataStore MetadataStore = &MetakvStore{}
+
+// GetMetadataStore returns the metadata store used by this process,
+// default is metakv.
+func GetMetadataStore() MetadataStore {
+	metadataStoreLock.RLock()
+	defer metadataStoreLock.RUnlock()
+	return metadataStore
+}
+
+// SetMetadataStore to be used by this process, shall be called before
+// any of the services are started, like standalone indexers and tests
+// that don't run with ns_server.
+func SetMetadataStore(store MetadataStore) {
+	metadataStoreLock.Lock()
+	defer metadataStoreLock.Unlock()
+	metadataStore = store
+}
+
+//-----------------------
+// metakv backed store
+//-----------------------
+
+// MetakvStore is the MetadataStore backed by ns_server's metakv
+// service.
+type MetakvStore struct{}
+
+func (s *MetakvStore) Get(path string) ([]byte, interface{}, error) {
+	return metakv.Get(path)
+}
+
+func (s *MetakvStore) Set(path string, value []byte, rev interface{}) error {
+	return metakvError(metakv.Set(path, value, rev))
+}
+
+func (s *MetakvStore) Add(path string, value []byte) error {
+	return metakvError(metakv.Add(path, value))
+}
+
+func (s *MetakvStore) Delete(path string, rev interface{}) error {
+	return metakvError(metakv.Delete(path, rev))
+}
+
+func (s *MetakvStore) RecursiveDelete(dirpath string) error {
+	return metakv.RecursiveDelete(dirpath)
+}
+
+func (s *MetakvStore) ListAllChildren(dirpath string) ([]MetadataEntry, error) {
+	kvs, err := metakv.ListAllChildren(dirpath)
+	if err != nil {
+		return nil, err
+	}
+	entries := make([]MetadataEntry, 0, len(kvs))
+	for _, kv := range kvs {
+		entries = append(entries, MetadataEntry{Path: kv.Path, Value: kv.Value, Rev: kv.Rev})
+	}
+	return entries, nil
+}
+
+func (s *MetakvStore) RunObserveChildren(
+	dirpath string, callb MetadataCallback, cancel <-chan struct{}) error {
+
+	return metakv.RunObserveChildren(dirpath, metakv.Callback(callb), cancel)
+}
+
+func metakvError(err error) error {
+	if err == metakv.ErrRevMismatch {
+		return ErrMetadataRevMismatch
+	}
+	return err
+}
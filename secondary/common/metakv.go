@@ -17,7 +17,6 @@ package common
 import (
 	"encoding/json"
 	"fmt"
-	"github.com/couchbase/cbauth/metakv"
 	"github.com/couchbase/indexing/secondary/logging"
 	"strconv"
 	"strings"
@@ -28,7 +27,7 @@ const (
 )
 
 func MetakvGet(path string, v interface{}) (bool, error) {
-	raw, _, err := metakv.Get(path)
+	raw, _, err := GetMetadataStore().Get(path)
 	if err != nil {
 		logging.Fatalf("MetakvGet: Failed to fetch %s from metakv: %s", path, err.Error())
 	}
@@ -55,7 +54,7 @@ func MetakvSet(path string, v interface{}) error {
 		return err
 	}
 
-	err = metakv.Set(path, raw, nil)
+	err = GetMetadataStore().Set(path, raw, nil)
 	if err != nil {
 		logging.Fatalf("MetakvSet Failed to set %s: %s", path, err.Error())
 	}
@@ -64,7 +63,7 @@ func MetakvSet(path string, v interface{}) error {
 
 func MetakvDel(path string) error {
 
-	err := metakv.Delete(path, nil)
+	err := GetMetadataStore().Delete(path, nil)
 	if err != nil {
 		logging.Fatalf("MetakvDel: Failed to delete %s: %s", path, err.Error())
 	}
@@ -73,7 +72,7 @@ func MetakvDel(path string) error {
 
 func MetakvRecurciveDel(dirpath string) error {
 
-	err := metakv.RecursiveDelete(dirpath)
+	err := GetMetadataStore().RecursiveDelete(dirpath)
 	if err != nil {
 		logging.Fatalf("MetakvRecurciveDel: Failed to delete %s: %s", dirpath, err.Error())
 	}
@@ -106,7 +105,7 @@ func MetakvBigValueSet(path string, v interface{}) error {
 			size = METAKV_SIZE_LIMIT
 		}
 
-		if err = metakv.Set(path2, buf[:size], nil); err != nil {
+		if err = GetMetadataStore().Set(path2, buf[:size], nil); err != nil {
 			MetakvBigValueDel(path)
 			return err
 		}
@@ -144,7 +143,7 @@ func MetakvBigValueGet(path string, value interface{}) (bool, error) {
 		path = fmt.Sprintf("%v/", path)
 	}
 
-	entries, err := metakv.ListAllChildren(path)
+	entries, err := GetMetadataStore().ListAllChildren(path)
 	if err != nil {
 		return false, err
 	}
@@ -200,7 +199,7 @@ func MetakvBigValueList(dirpath string) ([]string, error) {
 		dirpath = fmt.Sprintf("%v/", dirpath)
 	}
 
-	entries, err := metakv.ListAllChildren(dirpath)
+	entries, err := GetMetadataStore().ListAllChildren(dirpath)
 	if err != nil {
 		return nil, err
 	}
@@ -29,6 +29,7 @@ const (
 	StreamBegin                    // control command
 	StreamEnd                      // control command
 	Snapshot                       // control command
+	UpsertNoop                     // data command, secondary key unchanged
 )
 
 // Payload either carries `vbmap` or `vbs`.
@@ -185,6 +186,7 @@ type KeyVersions struct {
 	Keys      [][]byte // list of key-versions for each index
 	Oldkeys   [][]byte // previous key-versions, if available
 	Partnkeys [][]byte // partition key for each key-version
+	Exits     []uint64 // uuids for which UpsertDeletion is a WHERE exit
 	Ctime     int64
 }
 
@@ -231,6 +233,14 @@ func (kv *KeyVersions) Equal(other *KeyVersions) bool {
 			return false
 		}
 	}
+	if len(kv.Exits) != len(other.Exits) {
+		return false
+	}
+	for i, uuid := range kv.Exits {
+		if uuid != other.Exits[i] {
+			return false
+		}
+	}
 	return true
 }
 
@@ -259,6 +269,22 @@ func (kv *KeyVersions) AddUpsertDeletion(uuid uint64, oldkey, pkey []byte) {
 	kv.addKey(uuid, UpsertDeletion, nil, oldkey, pkey)
 }
 
+// AddPredicateExit add a keyversion command to delete old entry, for a
+// document that satisfied the WHERE predicate of a partial index before
+// this mutation and no longer does.
+func (kv *KeyVersions) AddPredicateExit(uuid uint64, oldkey, pkey []byte) {
+	kv.addKey(uuid, UpsertDeletion, nil, oldkey, pkey)
+	kv.Exits = append(kv.Exits, uuid)
+}
+
+// SetUpsertNoop turns the i-th Upsert into UpsertNoop, when the
+// document's secondary key is same as the one last published. Keys are
+// not carried downstream.
+func (kv *KeyVersions) SetUpsertNoop(i int) {
+	kv.Commands[i] = UpsertNoop
+	kv.Keys[i], kv.Oldkeys[i], kv.Partnkeys[i] = nil, nil, nil
+}
+
 // AddSync add Sync command for vbucket heartbeat.
 func (kv *KeyVersions) AddSync() {
 	kv.addKey(0, Sync, nil, nil, nil)
@@ -27,8 +27,9 @@ type Router interface {
 	//   * `oldKey` == nil, implies old document is not available
 	//   * `oldPartKey` == nil, implies old document is not available
 	//   * m.VBucket, m.Seqno, m.Key - carry {vbno, seqno, docid}
-	// TODO: differentiate between, missing old document and missing
-	//       secondary-key
+	// The UpsertDeletion message carries the old secondary-key only when
+	// the old document is known to have left the WHERE predicate, for
+	// all other cases it is nil.
 	UpsertDeletionEndpoints(m *mc.DcpEvent, oldPartKey, key, oldKey []byte) []string
 
 	// DeletionEndpoints return a list of endpoints
@@ -59,6 +60,10 @@ type RouterEndpoint interface {
 	// Send will post data to endpoint client, asynchronous call.
 	Send(data interface{}) error
 
+	// Blocked will check whether endpoint is waiting on downstream
+	// to grant credits, can be called concurrently.
+	Blocked() bool
+
 	// GetStatistics to gather statistics information from endpoint,
 	// synchronous call.
 	GetStatistics() map[string]interface{}
@@ -681,6 +681,59 @@ func IndexStatement(def IndexDefn, printNodes bool) string {
 		withExpr += fmt.Sprintf(" \"num_replica\":%v", def.NumReplica)
 	}
 
+	if len(def.Include) != 0 {
+		if len(withExpr) != 0 {
+			withExpr += ","
+		}
+		withExpr += " \"include\":[ "
+
+		for i, exp := range def.Include {
+			withExpr += fmt.Sprintf("%q", exp)
+			if i < len(def.Include)-1 {
+				withExpr += ","
+			}
+		}
+
+		withExpr += " ]"
+	}
+
+	if len(def.Collation) != 0 {
+		if len(withExpr) != 0 {
+			withExpr += ","
+		}
+		withExpr += fmt.Sprintf(" \"collation\":%q", def.Collation)
+	}
+
+	if len(def.DocKeyPrefixes) != 0 {
+		if len(withExpr) != 0 {
+			withExpr += ","
+		}
+		withExpr += " \"doc_key_prefixes\":[ "
+
+		for i, prefix := range def.DocKeyPrefixes {
+			withExpr += fmt.Sprintf("%q", prefix)
+			if i < len(def.DocKeyPrefixes)-1 {
+				withExpr += ","
+			}
+		}
+
+		withExpr += " ]"
+	}
+
+	if len(def.DocKeyPattern) != 0 {
+		if len(withExpr) != 0 {
+			withExpr += ","
+		}
+		withExpr += fmt.Sprintf(" \"doc_key_pattern\":%q", def.DocKeyPattern)
+	}
+
+	if def.BuildPriority != 0 {
+		if len(withExpr) != 0 {
+			withExpr += ","
+		}
+		withExpr += fmt.Sprintf(" \"build_priority\":%d", def.BuildPriority)
+	}
+
 	if len(withExpr) != 0 {
 		stmt += fmt.Sprintf(" WITH { %s }", withExpr)
 	}
@@ -20,6 +20,7 @@ var commandNames = map[byte]string{
 	c.StreamBegin:    "StreamBegin",
 	c.StreamEnd:      "StreamEnd",
 	c.Snapshot:       "Snapshot",
+	c.UpsertNoop:     "UpsertNoop",
 }
 
 // Application starts a new dataport application to receive mutations from the
@@ -15,19 +15,34 @@
 //                            |
 //                            V
 //                          buffers
+//
+// when flow control is negotiated with downstream, endpoint spawns a
+// reader routine to receive credits from dataport-server. Buffers are
+// flushed only while there are credits left, otherwise endpoint is marked
+// as blocked and continues to buffer messages until more credits arrive,
+// upstream is expected to check Blocked() and slow down. If the backlog
+// grows beyond keyChanSize messages while blocked, endpoint gives up and
+// closes the connection, leaving downstream to repair its streams.
 
 package dataport
 
 import "fmt"
+import "errors"
 import "net"
 import "time"
 import "strconv"
 import "strings"
+import "sync/atomic"
 
 import c "github.com/couchbase/indexing/secondary/common"
+import protobuf "github.com/couchbase/indexing/secondary/protobuf/data"
 import "github.com/couchbase/indexing/secondary/transport"
 import "github.com/couchbase/indexing/secondary/logging"
 
+// ErrorEndpointBacklog is returned when a blocked endpoint has buffered
+// more messages than it is allowed to.
+var ErrorEndpointBacklog = errors.New("dataport.endpointBacklog")
+
 // RouterEndpoint structure, per topic, to gather key-versions / mutations
 // from one or more vbuckets and push them downstream to a
 // specific node.
@@ -50,6 +65,12 @@ type RouterEndpoint struct {
 	// downstream
 	pkt  *transport.TransportPacket
 	conn net.Conn
+	// flow control
+	creditch     chan int64 // nil, if flow control is not requested
+	flowctrl     bool       // downstream has granted credits
+	credits      int64      // bytes that can be sent downstream
+	blocked      int32      // atomic, waiting for credits
+	blockedSince time.Time  // valid only while blocked
 	// statistics
 	mutCount    int64
 	upsertCount int64
@@ -59,8 +80,11 @@ type RouterEndpoint struct {
 	beginCount  int64
 	endCount    int64
 	snapCount   int64
+	noopCount   int64
 	flushCount  int64
 	prjLatency  *Average
+	blockCount  int64
+	blockedTm   time.Duration // total time spent waiting for credits
 }
 
 // NewRouterEndpoint instantiate a new RouterEndpoint
@@ -95,6 +119,14 @@ func NewRouterEndpoint(
 	endpoint.pkt = transport.NewTransportPacket(maxPayload, flags)
 	endpoint.pkt.SetEncoder(transport.EncodingProtobuf, protobufEncode)
 	endpoint.pkt.SetDecoder(transport.EncodingProtobuf, protobufDecode)
+	if cv, ok := config["flowControl"]; ok && cv.Bool() {
+		// ask downstream for credits, zero credits is the request.
+		if err := endpoint.pkt.Send(conn, flowCredits(0)); err != nil {
+			conn.Close()
+			return nil, err
+		}
+		endpoint.creditch = make(chan int64, 16)
+	}
 
 	endpoint.statTick *= time.Millisecond
 	endpoint.bufferTm *= time.Millisecond
@@ -105,6 +137,9 @@ func NewRouterEndpoint(
 		endpoint.raddr, uint16(endpoint.timestamp), cluster, topic)
 
 	go endpoint.run(endpoint.ch)
+	if endpoint.creditch != nil {
+		go endpoint.receiveCredits(endpoint.creditch)
+	}
 	logging.Infof("%v started ...\n", endpoint.logPrefix)
 	return endpoint, nil
 }
@@ -147,6 +182,12 @@ func (endpoint *RouterEndpoint) Send(data interface{}) error {
 	return c.FailsafeOpNoblock(endpoint.ch, cmd, endpoint.finch)
 }
 
+// Blocked return whether endpoint is waiting for credits from downstream,
+// can be called concurrently with other APIs.
+func (endpoint *RouterEndpoint) Blocked() bool {
+	return atomic.LoadInt32(&endpoint.blocked) == 1
+}
+
 // GetStatistics for this endpoint, synchronous call.
 func (endpoint *RouterEndpoint) GetStatistics() map[string]interface{} {
 	respch := make(chan []interface{}, 1)
@@ -184,6 +225,8 @@ func (endpoint *RouterEndpoint) run(ch chan []interface{}) {
 		if harakiri != nil {
 			harakiri.Stop()
 		}
+		// don't leave upstream waiting on this endpoint.
+		atomic.StoreInt32(&endpoint.blocked, 0)
 		// close the connection
 		endpoint.conn.Close()
 		// close this endpoint
@@ -192,7 +235,7 @@ func (endpoint *RouterEndpoint) run(ch chan []interface{}) {
 	}()
 
 	statSince := time.Now()
-	var stitems [14]string
+	var stitems [18]string
 	logstats := func() {
 		prjLatency := endpoint.prjLatency
 		stitems[0] = `"topic":"` + endpoint.topic + `"`
@@ -206,9 +249,14 @@ func (endpoint *RouterEndpoint) run(ch chan []interface{}) {
 		stitems[8] = `"endCount":` + strconv.Itoa(int(endpoint.endCount))
 		stitems[9] = `"snapCount":` + strconv.Itoa(int(endpoint.snapCount))
 		stitems[10] = `"flushCount":` + strconv.Itoa(int(endpoint.flushCount))
-		stitems[11] = `"latency.min":` + strconv.Itoa(int(prjLatency.Min()))
-		stitems[12] = `"latency.max":` + strconv.Itoa(int(prjLatency.Max()))
-		stitems[13] = `"latency.avg":` + strconv.Itoa(int(prjLatency.Mean()))
+		stitems[11] = `"noopCount":` + strconv.Itoa(int(endpoint.noopCount))
+		stitems[12] = `"latency.min":` + strconv.Itoa(int(prjLatency.Min()))
+		stitems[13] = `"latency.max":` + strconv.Itoa(int(prjLatency.Max()))
+		stitems[14] = `"latency.avg":` + strconv.Itoa(int(prjLatency.Mean()))
+		stitems[15] = `"credits":` + strconv.Itoa(int(endpoint.credits))
+		stitems[16] = `"blockCount":` + strconv.Itoa(int(endpoint.blockCount))
+		blockedMs := int(endpoint.blockedTime() / time.Millisecond)
+		stitems[17] = `"blockedTime":` + strconv.Itoa(blockedMs)
 		statjson := strings.Join(stitems[:], ",")
 		fmsg := "%v stats {%v}\n"
 		logging.Infof(fmsg, endpoint.logPrefix, statjson)
@@ -220,16 +268,33 @@ func (endpoint *RouterEndpoint) run(ch chan []interface{}) {
 
 	messageCount := 0
 	flushBuffers := func() (err error) {
-		fmsg := "%v sent %v mutations to %q\n"
-		logging.Tracef(fmsg, endpoint.logPrefix, messageCount, raddr)
-		if messageCount > 0 {
-			err = buffers.flushBuffers(endpoint, endpoint.conn, endpoint.pkt)
-			if err != nil {
-				logging.Errorf("%v flushBuffers() %v\n", endpoint.logPrefix, err)
+		if messageCount > 0 && endpoint.flowctrl && endpoint.credits <= 0 {
+			// hold on to the buffers till downstream grants more credits.
+			if !endpoint.Blocked() {
+				endpoint.blockedSince = time.Now()
+				atomic.StoreInt32(&endpoint.blocked, 1)
+				endpoint.blockCount++
 			}
-			endpoint.flushCount++
+			if messageCount > endpoint.keyChSize {
+				fmsg := "%v blocked for %v with %v messages, giving up\n"
+				logging.Errorf(fmsg, endpoint.logPrefix,
+					time.Since(endpoint.blockedSince), messageCount)
+				return ErrorEndpointBacklog
+			}
+
+		} else {
+			fmsg := "%v sent %v mutations to %q\n"
+			logging.Tracef(fmsg, endpoint.logPrefix, messageCount, raddr)
+			if messageCount > 0 {
+				err = buffers.flushBuffers(endpoint, endpoint.conn, endpoint.pkt)
+				if err != nil {
+					logging.Errorf("%v flushBuffers() %v\n", endpoint.logPrefix, err)
+				}
+				endpoint.credits -= int64(endpoint.pkt.Size())
+				endpoint.flushCount++
+			}
+			messageCount = 0
 		}
-		messageCount = 0
 		if time.Since(statSince) > endpoint.statTick {
 			logstats()
 			statSince = time.Now()
@@ -299,7 +364,7 @@ loop:
 				respch := msg[2].(chan []interface{})
 				respch <- []interface{}{nil}
 
-			case endpCmdGetStatistics: // TODO: this is defunct now.
+			case endpCmdGetStatistics:
 				respch := msg[1].(chan []interface{})
 				stats := endpoint.newStats()
 				respch <- []interface{}{map[string]interface{}(stats)}
@@ -311,6 +376,20 @@ loop:
 				break loop
 			}
 
+		case credits := <-endpoint.creditch:
+			endpoint.credits += credits
+			if !endpoint.flowctrl {
+				endpoint.flowctrl = true
+				logging.Infof("%v flow control started\n", endpoint.logPrefix)
+			}
+			if endpoint.credits > 0 && endpoint.Blocked() {
+				endpoint.blockedTm += time.Since(endpoint.blockedSince)
+				atomic.StoreInt32(&endpoint.blocked, 0)
+				if err := flushBuffers(); err != nil {
+					break loop
+				}
+			}
+
 		case <-flushTick.C:
 			if err := flushBuffers(); err != nil {
 				break loop
@@ -334,8 +413,46 @@ loop:
 	logstats()
 }
 
+// receiveCredits granted by downstream and pass them on to run().
+func (endpoint *RouterEndpoint) receiveCredits(creditch chan<- int64) {
+	pkt := transport.NewTransportPacket(1024, transport.TransportFlag(0))
+	pkt.SetDecoder(transport.EncodingProtobuf, protobufDecode)
+	for {
+		payload, err := pkt.Receive(endpoint.conn)
+		if err != nil { // also when run() closes the connection.
+			fmsg := "%v receiveCredits() exit: %v\n"
+			logging.Infof(fmsg, endpoint.logPrefix, err)
+			return
+		}
+		fc, ok := payload.(*protobuf.FlowControl)
+		if !ok {
+			fmsg := "%v receiveCredits() unexpected payload %T\n"
+			logging.Errorf(fmsg, endpoint.logPrefix, payload)
+			continue
+		}
+		select {
+		case creditch <- int64(fc.GetCredits()):
+		case <-endpoint.finch:
+			return
+		}
+	}
+}
+
 func (endpoint *RouterEndpoint) newStats() c.Statistics {
-	m := map[string]interface{}{}
+	m := map[string]interface{}{
+		"credits":     endpoint.credits,
+		"blockCount":  endpoint.blockCount,
+		"blockedTime": int64(endpoint.blockedTime() / time.Millisecond),
+	}
 	stats, _ := c.NewStatistics(m)
 	return stats
 }
+
+// blockedTime is the total time spent waiting for credits, including
+// the ongoing wait if endpoint is blocked now.
+func (endpoint *RouterEndpoint) blockedTime() time.Duration {
+	if endpoint.Blocked() {
+		return endpoint.blockedTm + time.Since(endpoint.blockedSince)
+	}
+	return endpoint.blockedTm
+}
@@ -49,6 +49,8 @@ func (b *endpointBuffers) addKeyVersions(
 				endpoint.endCount++
 			case c.Snapshot:
 				endpoint.snapCount++
+			case c.UpsertNoop:
+				endpoint.noopCount++
 			}
 		}
 		endpoint.mutCount++
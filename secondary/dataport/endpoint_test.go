@@ -0,0 +1,169 @@
+package dataport
+
+import "fmt"
+import "strings"
+import "testing"
+import "time"
+
+import "github.com/couchbase/indexing/secondary/logging"
+import c "github.com/couchbase/indexing/secondary/common"
+import protobuf "github.com/couchbase/indexing/secondary/protobuf/data"
+
+// start a dataport server granting `window` credits and a router
+// endpoint that asks for flow control.
+func flowControlLoopback(
+	t *testing.T, raddr string, window, keyChSize int,
+	appch chan interface{}) (*Server, *RouterEndpoint) {
+
+	dconfig := c.SystemConfig.SectionConfig("indexer.dataport.", true /*trim*/)
+	dconfig.SetValue("creditWindow", window)
+	daemon, err := NewServer(raddr, 4, dconfig, appch)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	config := c.SystemConfig.SectionConfig("projector.dataport.", true /*trim*/)
+	config.SetValue("flowControl", true)
+	config.SetValue("bufferSize", 10)
+	config.SetValue("bufferTimeout", 1)
+	config.SetValue("keyChanSize", keyChSize)
+	endp, err := NewRouterEndpoint("clust", "topic", raddr, 4, config)
+	if err != nil {
+		daemon.Close()
+		t.Fatal(err)
+	}
+	return daemon, endp
+}
+
+// StreamBegin followed by `nMuts` upserts, of 1KB keys, for vbucket 0.
+func flowKeyVersions(nMuts int) []*c.DataportKeyVersions {
+	dkvs := make([]*c.DataportKeyVersions, 0, nMuts+1)
+	kv := c.NewKeyVersions(0, []byte("Bourne"), 1, 0)
+	kv.AddStreamBegin()
+	dkvs = append(dkvs, &c.DataportKeyVersions{
+		Bucket: "default", Vbno: 0, Vbuuid: 10, Kv: kv,
+	})
+	key := strings.Repeat("x", 1024)
+	for i := 1; i <= nMuts; i++ {
+		docid := []byte(fmt.Sprintf("doc%v", i))
+		kv := c.NewKeyVersions(uint64(i), docid, 1, 0)
+		kv.AddUpsert(1, []byte(key), nil, nil)
+		dkvs = append(dkvs, &c.DataportKeyVersions{
+			Bucket: "default", Vbno: 0, Vbuuid: 10, Kv: kv,
+		})
+	}
+	return dkvs
+}
+
+func waitFor(t *testing.T, what string, cond func() bool) {
+	timeout := time.After(5 * time.Second)
+	for !cond() {
+		select {
+		case <-timeout:
+			t.Fatalf("timeout waiting for %v", what)
+		case <-time.After(10 * time.Millisecond):
+		}
+	}
+}
+
+func TestFlowControlSlowConsumer(t *testing.T) {
+	logging.SetLogLevel(logging.Silent)
+
+	// application does not consume mutations till endpoint is blocked.
+	appch := make(chan interface{}, 1)
+	daemon, endp := flowControlLoopback(t, "localhost:8888", 16*1024, 10000, appch)
+	defer daemon.Close()
+	defer endp.Close()
+
+	nMuts := 200
+	for _, dkv := range flowKeyVersions(nMuts) {
+		if err := endp.Send(dkv); err != nil {
+			t.Fatal(err)
+		}
+	}
+	waitFor(t, "endpoint to block", endp.Blocked)
+
+	// time spent waiting for credits is accounted while still blocked.
+	time.Sleep(50 * time.Millisecond)
+	stats := endp.GetStatistics()
+	if ms := stats["blockedTime"].(int64); ms < 50 {
+		t.Errorf("expected blockedTime >= 50ms while blocked, got %v", ms)
+	}
+	if n := stats["blockCount"].(int64); n != 1 {
+		t.Errorf("expected blockCount 1, got %v", n)
+	}
+	if credits := stats["credits"].(int64); credits > 0 {
+		t.Errorf("expected credits to be exhausted, got %v", credits)
+	}
+
+	// as application catches up, credits are granted back and all of
+	// the mutations are delivered.
+	upserts := 0
+	timeout := time.After(5 * time.Second)
+	for upserts < nMuts {
+		select {
+		case msg := <-appch:
+			vbs, ok := msg.([]*protobuf.VbKeyVersions)
+			if !ok {
+				t.Fatalf("unexpected message %T", msg)
+			}
+			for _, vb := range protobuf2VbKeyVersions(vbs) {
+				for _, kv := range vb.Kvs {
+					for _, cmd := range kv.Commands {
+						if cmd == c.Upsert {
+							upserts++
+						}
+					}
+				}
+			}
+			time.Sleep(time.Millisecond) // slow consumer
+		case <-timeout:
+			t.Fatalf("expected %v upserts, got %v", nMuts, upserts)
+		}
+	}
+	waitFor(t, "endpoint to unblock", func() bool { return !endp.Blocked() })
+
+	stats = endp.GetStatistics()
+	if n := stats["blockCount"].(int64); n < 1 {
+		t.Errorf("expected endpoint to have blocked, got %v", n)
+	}
+	if ms := stats["blockedTime"].(int64); ms < 50 {
+		t.Errorf("expected blockedTime >= 50ms, got %v", ms)
+	}
+}
+
+func TestFlowControlBacklog(t *testing.T) {
+	logging.SetLogLevel(logging.Silent)
+
+	// application never consumes mutations.
+	appch := make(chan interface{}, 1)
+	daemon, endp := flowControlLoopback(t, "localhost:8888", 4*1024, 100, appch)
+	defer daemon.Close()
+
+	for _, dkv := range flowKeyVersions(50) {
+		if err := endp.Send(dkv); err != nil {
+			t.Fatal(err)
+		}
+	}
+	waitFor(t, "endpoint to block", endp.Blocked)
+
+	// endpoint gives up once its backlog exceeds keyChanSize.
+	for _, dkv := range flowKeyVersions(100) {
+		if err := endp.Send(dkv); err != nil {
+			break
+		}
+	}
+	done := make(chan error, 1)
+	go func() { done <- endp.WaitForExit() }()
+	select {
+	case <-done:
+	case <-time.After(5 * time.Second):
+		t.Fatal("expected endpoint to exit on backlog")
+	}
+	if endp.Blocked() {
+		t.Errorf("expected closed endpoint not to be blocked")
+	}
+	if endp.Ping() {
+		t.Errorf("expected endpoint to be closed")
+	}
+}
@@ -14,6 +14,10 @@ var ErrorTransportVersion = errors.New("dataport.transportVersion")
 // ErrorMissingPayload
 var ErrorMissingPayload = errors.New("dataport.missingPlayload")
 
+// flowCredits is exchanged between router endpoint and dataport server
+// for flow control, in bytes.
+type flowCredits uint64
+
 // protobufEncode encode payload message into protobuf array of bytes. Return
 // `data` can be transported to the other end and decoded back to Payload
 // message.
@@ -55,6 +59,9 @@ func protobufEncode(payload interface{}) (data []byte, err error) {
 					pkv.Oldkeys = append(pkv.Oldkeys, kv.Oldkeys[i])
 					pkv.Partnkeys = append(pkv.Partnkeys, kv.Partnkeys[i])
 				}
+				if len(kv.Exits) > 0 {
+					pkv.Exits = kv.Exits
+				}
 				pvb.Kvs = append(pvb.Kvs, pkv)
 			}
 			pl.Vbkeys = append(pl.Vbkeys, pvb)
@@ -66,6 +73,11 @@ func protobufEncode(payload interface{}) (data []byte, err error) {
 			Vbuuids:  val.Vbuuids,
 			Vbuckets: c.Vbno16to32(val.Vbuckets),
 		}
+
+	case flowCredits:
+		pl.Flowctrl = &protobuf.FlowControl{
+			Credits: proto.Uint64(uint64(val)),
+		}
 	}
 
 	if err == nil {
@@ -75,8 +87,8 @@ func protobufEncode(payload interface{}) (data []byte, err error) {
 }
 
 // protobufDecode complements protobufEncode() API. `data` returned by encode
-// is converted back to *protobuf.VbConnectionMap, or []*protobuf.VbKeyVersions
-// and returns back the value inside the payload
+// is converted back to *protobuf.VbConnectionMap, []*protobuf.VbKeyVersions
+// or *protobuf.FlowControl and returns back the value inside the payload
 func protobufDecode(data []byte) (value interface{}, err error) {
 	pl := &protobuf.Payload{}
 	if err = proto.Unmarshal(data, pl); err != nil {
@@ -117,6 +129,7 @@ func protobuf2KeyVersions(keys []*protobuf.KeyVersions) []*c.KeyVersions {
 			Keys:      make([][]byte, 0, size),
 			Oldkeys:   make([][]byte, 0, size),
 			Partnkeys: make([][]byte, 0, size),
+			Exits:     key.GetExits(),
 		}
 		commands := key.GetCommands()
 		newkeys := key.GetKeys()
@@ -33,6 +33,24 @@ func TestVbConnectionMap(t *testing.T) {
 	}
 }
 
+func TestFlowCredits(t *testing.T) {
+	data, err := protobufEncode(flowCredits(1024))
+	if err != nil {
+		t.Fatal(err)
+	}
+	payload, err := protobufDecode(data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	fc, ok := payload.(*protobuf.FlowControl)
+	if ok == false {
+		t.Fatal("expected reference FlowControl object")
+	}
+	if fc.GetCredits() != 1024 {
+		t.Fatalf("expected 1024 credits, got %v", fc.GetCredits())
+	}
+}
+
 func TestAddUpsert(t *testing.T) {
 	kv := kvUpserts()
 	vbno, vbuuid, nMuts := uint16(10), uint64(1000), 10
@@ -49,6 +67,30 @@ func TestAddUpsertDeletion(t *testing.T) {
 	testKeyVersions(t, vb)
 }
 
+func TestAddPredicateExit(t *testing.T) {
+	seqno, docid, maxCount := uint64(10), []byte("document-name"), int64(10)
+	kv := common.NewKeyVersions(seqno, docid, maxCount, 0)
+	kv.AddUpsertDeletion(1, nil, nil)
+	kv.AddPredicateExit(2, []byte("pune"), nil)
+	vbno, vbuuid, nMuts := uint16(10), uint64(1000), 10
+	vb := common.NewVbKeyVersions("default", vbno, vbuuid, nMuts)
+	vb.AddKeyVersions(kv)
+	testKeyVersions(t, vb)
+
+	data, err := protobufEncode([]*common.VbKeyVersions{vb})
+	if err != nil {
+		t.Fatal(err)
+	}
+	payload, err := protobufDecode(data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	pkv := payload.([]*protobuf.VbKeyVersions)[0].GetKvs()[0]
+	if pkv.IsPredicateExit(1) || !pkv.IsPredicateExit(2) {
+		t.Errorf("expected predicate exit only for 2, got %v", pkv.GetExits())
+	}
+}
+
 func TestAddDeletion(t *testing.T) {
 	kv := kvDeletions()
 	vbno, vbuuid, nMuts := uint16(10), uint64(1000), 10
@@ -49,6 +49,11 @@
 //    g. bucket delete
 //    h. bucket flush
 //    i. DCP feed error
+//
+// 4. when router endpoint asks for flow control, server grants it credits,
+//    in bytes, for the full window and thereafter replenishes them as and
+//    when application consumes the mutations, so that a slow application
+//    will slow down the router instead of backing up the socket.
 
 package dataport
 
@@ -83,6 +88,10 @@ var ErrorDuplicateClient = errors.New("dataport.duplicateClient")
 // ErrorWorkerKilled
 var ErrorWorkerKilled = errors.New("dataport.workerKilled")
 
+// fraction of credit window, consumed by application, to accumulate before
+// granting them back to router.
+const creditThreshold = 0.2
+
 type activeVb struct {
 	raddr  string // remote connection carrying this vbucket.
 	bucket string
@@ -120,6 +129,10 @@ type netConn struct {
 	worker chan interface{}
 	active bool
 	tpkt   *transport.TransportPacket
+	// flow control
+	flowctrl bool                       // remote asked for flow control
+	cpkt     *transport.TransportPacket // to send credits
+	credits  int                        // consumed, yet to be granted
 }
 
 // Server handles an active dataport server of mutation for all vbuckets.
@@ -139,6 +152,7 @@ type Server struct {
 	genChSize    int           // channel size for genServer routine
 	maxPayload   int           // maximum payload length from router
 	readDeadline time.Duration // timeout, in millisecond, reading from socket
+	creditWindow int           // credits, in bytes, granted to router
 	logPrefix    string
 }
 
@@ -165,6 +179,7 @@ func NewServer(
 		genChSize:    genChSize,
 		maxPayload:   config["maxPayload"].Int(),
 		readDeadline: time.Duration(config["tcpReadDeadline"].Int()),
+		creditWindow: config["creditWindow"].Int(),
 	}
 	s.logPrefix = fmt.Sprintf("DATP[->dataport %q]", laddr)
 	if s.lis, err = net.Listen("tcp", laddr); err != nil {
@@ -216,6 +231,7 @@ const (
 	serverCmdNewConnection byte = iota + 1
 	serverCmdVbmap
 	serverCmdVbKeyVersions
+	serverCmdFlowControl
 	serverCmdError
 	serverCmdClose
 )
@@ -268,7 +284,7 @@ func (s *Server) genServer(reqch, datach chan []interface{}) {
 						fmsg := "%v StreamEnd without StreamBegin for %v\n"
 						logging.Warnf(fmsg, s.logPrefix, id)
 					}
-				case c.Upsert, c.Deletion, c.UpsertDeletion:
+				case c.Upsert, c.Deletion, c.UpsertDeletion, c.UpsertNoop:
 					if avbok && avb != nil {
 						avb.seqno = kv.GetSeqno()
 						avb.kvers++
@@ -353,6 +369,10 @@ loop:
 
 			case serverCmdVbKeyVersions:
 				nicetoapp(parseVbs(msg))
+				s.replenishCredits(msg.raddr, msg.args[1].(int))
+
+			case serverCmdFlowControl:
+				s.startFlowControl(msg.raddr)
 
 			case serverCmdError:
 				var g interface{}
@@ -403,6 +423,47 @@ func (s *Server) startWorker(raddr string) {
 	nc.active = true
 }
 
+// grant credits for the full window to a router that asked for flow
+// control. If flow control is disabled on this side, the request is
+// ignored and router will continue without it.
+func (s *Server) startFlowControl(raddr string) {
+	nc, ok := s.conns[raddr]
+	if !ok || s.creditWindow <= 0 {
+		return
+	}
+	nc.flowctrl = true
+	nc.cpkt = newTransportPkt(64 /*credits are tiny*/)
+	logging.Infof("%v flow control for %q started\n", s.logPrefix, raddr)
+	s.grantCredits(raddr, nc, s.creditWindow)
+}
+
+// account for `size` bytes consumed by application and give them back to
+// router once enough of them have accumulated.
+func (s *Server) replenishCredits(raddr string, size int) {
+	nc, ok := s.conns[raddr]
+	if !ok || !nc.flowctrl {
+		return
+	}
+	nc.credits += size
+	if nc.credits >= int(creditThreshold*float64(s.creditWindow)) {
+		s.grantCredits(raddr, nc, nc.credits)
+		nc.credits = 0
+	}
+}
+
+func (s *Server) grantCredits(raddr string, nc *netConn, credits int) {
+	timeout := s.readDeadline * time.Millisecond
+	nc.conn.SetWriteDeadline(time.Now().Add(timeout))
+	// on failure, doReceive() will notice the broken connection.
+	if err := nc.cpkt.Send(nc.conn, flowCredits(credits)); err != nil {
+		fmsg := "%v granting %v credits to %q: %v\n"
+		logging.Errorf(fmsg, s.logPrefix, credits, raddr, err)
+		return
+	}
+	fmsg := "%v granted %v credits to %q\n"
+	logging.Tracef(fmsg, s.logPrefix, credits, raddr)
+}
+
 // jumbo size error handler, it either closes all connections and shutdown the
 // server or it closes all open connections with faulting remote-host and
 // returns back a message for application.
@@ -573,8 +634,13 @@ loop:
 			logging.Tracef(fmsg, prefix, msg.raddr)
 			break loop
 
+		} else if fc, ok := payload.(*protobuf.FlowControl); ok {
+			msg.cmd, msg.args = serverCmdFlowControl, []interface{}{fc}
+			datach <- []interface{}{msg}
+
 		} else if vbs, ok := payload.([]*protobuf.VbKeyVersions); ok {
-			msg.cmd, msg.args = serverCmdVbKeyVersions, []interface{}{vbs}
+			msg.cmd = serverCmdVbKeyVersions
+			msg.args = []interface{}{vbs, pkt.Size()}
 			if len(datach) == cap(datach) {
 				start, blocked = time.Now(), true
 			}
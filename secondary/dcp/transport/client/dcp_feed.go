@@ -18,6 +18,7 @@ import (
 
 const dcpMutationExtraLen = 16
 const bufferAckThreshold = 0.2
+const bufferAckRetry = 100 * time.Millisecond
 const opaqueOpen = 0xBEAF0001
 const opaqueFailover = 0xDEADBEEF
 const opaqueGetseqno = 0xDEADBEEF
@@ -51,6 +52,9 @@ type DcpFeed struct {
 	maxAckBytes uint32   // Max buffer control ack bytes
 	stats       DcpStats // Stats for dcp client
 	dcplatency  *Average
+	// flow control
+	ackHold func() bool // hold back buffer-ack while this returns true
+	ackHeld bool
 }
 
 // NewDcpFeed creates a new DCP Feed.
@@ -70,6 +74,9 @@ func NewDcpFeed(
 		logPrefix:  fmt.Sprintf("DCPT[%s]", name),
 		dcplatency: &Average{},
 	}
+	if val, ok := config["bufferAckHold"]; ok && val != nil {
+		feed.ackHold = val.(func() bool)
+	}
 
 	mc.Hijack()
 	feed.conn = mc
@@ -184,6 +191,14 @@ func (feed *DcpFeed) genServer(
 	defer func() {
 		latencyTm.Stop()
 	}()
+	// KV won't send anything while buffer-ack is held back, periodically
+	// check whether it can be released.
+	var ackch <-chan time.Time
+	if feed.ackHold != nil {
+		ackTm := time.NewTicker(bufferAckRetry)
+		defer ackTm.Stop()
+		ackch = ackTm.C
+	}
 
 loop:
 	for {
@@ -192,6 +207,11 @@ loop:
 			fmsg := "%v dcp latency stats %v\n"
 			logging.Infof(fmsg, prefix, feed.dcplatency)
 
+		case <-ackch:
+			if feed.ackHeld {
+				feed.sendBufferAck(true, 0)
+			}
+
 		case msg := <-reqch:
 			cmd := msg[0].(byte)
 			switch cmd {
@@ -766,6 +786,10 @@ func (feed *DcpFeed) sendBufferAck(sendAck bool, bytes uint32) {
 	prefix := feed.logPrefix
 	if sendAck {
 		totalBytes := feed.toAckBytes + bytes
+		if totalBytes > feed.maxAckBytes && feed.holdBufferAck() {
+			feed.toAckBytes += bytes
+			return
+		}
 		if totalBytes > feed.maxAckBytes {
 			feed.toAckBytes = 0
 			bufferAck := &transport.MCRequest{
@@ -785,6 +809,21 @@ func (feed *DcpFeed) sendBufferAck(sendAck bool, bytes uint32) {
 	}
 }
 
+// hold back buffer-ack while downstream is applying backpressure, once
+// the connection buffer is full KV will stop sending mutations.
+func (feed *DcpFeed) holdBufferAck() bool {
+	prefix := feed.logPrefix
+	hold := feed.ackHold != nil && feed.ackHold()
+	if hold && !feed.ackHeld {
+		logging.Infof("%v downstream is slow, holding buffer-ack\n", prefix)
+		feed.stats.TotalBufferAckHeld++
+	} else if !hold && feed.ackHeld {
+		logging.Infof("%v releasing buffer-ack\n", prefix)
+	}
+	feed.ackHeld = hold
+	return hold
+}
+
 func composeOpaque(vbno, opaqueMSB uint16) uint32 {
 	return (uint32(opaqueMSB) << 16) | uint32(vbno)
 }
@@ -943,6 +982,7 @@ type DcpStats struct {
 	TotalBytes         uint64
 	TotalMutation      uint64
 	TotalBufferAckSent uint64
+	TotalBufferAckHeld uint64
 	TotalSnapShot      uint64
 }
 
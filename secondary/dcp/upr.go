@@ -142,6 +142,7 @@ func (b *Bucket) StartDcpFeed(
 //      "genChanSize", buffer channel size for control path.
 //      "dataChanSize", buffer channel size for data path.
 //      "numConnections", number of connections with DCP for local vbuckets.
+//      "bufferAckHold", optional func() bool, to hold back buffer-ack.
 func (b *Bucket) StartDcpFeedOver(
 	name DcpFeedName,
 	sequence, flags uint32,
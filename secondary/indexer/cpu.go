@@ -13,13 +13,16 @@ import (
 //////////////////////////////////////////////////////////////
 
 var cpuPercent uint64
+var diskTotal uint64
+var diskAvail uint64
 
 //////////////////////////////////////////////////////////////
 // Concrete Type/Struct
 //////////////////////////////////////////////////////////////
 
 type cpuCollector struct {
-	stats *system.SystemStats
+	stats      *system.SystemStats
+	storageDir string
 }
 
 //////////////////////////////////////////////////////////////
@@ -27,11 +30,12 @@ type cpuCollector struct {
 //////////////////////////////////////////////////////////////
 
 //
-// Start Cpu collection
+// Start Cpu collection, along with usage of the file system that has
+// the storage directory.
 //
-func StartCpuCollector() error {
+func StartCpuCollector(storageDir string) error {
 
-	collector := &cpuCollector{}
+	collector := &cpuCollector{storageDir: storageDir}
 
 	// open sigar for stats
 	stats, err := system.NewSystemStats()
@@ -75,9 +79,28 @@ func (c *cpuCollector) runCollectCpu() {
 		}
 
 		updateCpuPercent(percent)
+
+		if count%10 == 1 {
+			c.collectDisk()
+		}
 	}
 }
 
+//
+// Gather file system usage of storage directory
+//
+func (c *cpuCollector) collectDisk() {
+
+	total, avail, err := c.stats.FileSystemUsage(c.storageDir)
+	if err != nil {
+		logging.Debugf("Fail to get file system usage of %v. Err=%v", c.storageDir, err)
+		return
+	}
+
+	atomic.StoreUint64(&diskTotal, total)
+	atomic.StoreUint64(&diskAvail, avail)
+}
+
 //////////////////////////////////////////////////////////////
 // Global Function
 //////////////////////////////////////////////////////////////
@@ -92,3 +115,8 @@ func getCpuPercent() float64 {
 	bits := atomic.LoadUint64(&cpuPercent)
 	return math.Float64frombits(bits)
 }
+
+func getDiskUsage() (uint64, uint64) {
+
+	return atomic.LoadUint64(&diskTotal), atomic.LoadUint64(&diskAvail)
+}
@@ -16,7 +16,6 @@
 package indexer
 
 import (
-	"github.com/couchbase/cbauth/metakv"
 	"github.com/couchbase/cbauth/service"
 	"github.com/couchbase/indexing/secondary/common"
 	"github.com/couchbase/indexing/secondary/logging"
@@ -278,7 +277,7 @@ func (m *DDLServiceMgr) startProcessDDL() {
 //
 func (m *DDLServiceMgr) cleanupDropCommand() {
 
-	entries, err := metakv.ListAllChildren(mc.DeleteDDLCommandTokenPath)
+	entries, err := common.GetMetadataStore().ListAllChildren(mc.DeleteDDLCommandTokenPath)
 	if err != nil {
 		logging.Warnf("DDLServiceMgr: Failed to cleanup delete index token upon rebalancing.  Skip cleanup.  Internal Error = %v", err)
 		return
@@ -346,7 +345,7 @@ func (m *DDLServiceMgr) cleanupDropCommand() {
 //
 func (m *DDLServiceMgr) cleanupBuildCommand() {
 
-	entries, err := metakv.ListAllChildren(mc.BuildDDLCommandTokenPath)
+	entries, err := common.GetMetadataStore().ListAllChildren(mc.BuildDDLCommandTokenPath)
 	if err != nil {
 		logging.Warnf("DDLServiceMgr: Failed to cleanup build index token upon rebalancing.  Skip cleanup.  Internal Error = %v", err)
 		return
@@ -409,7 +408,7 @@ func (m *DDLServiceMgr) cleanupBuildCommand() {
 func (m *DDLServiceMgr) cleanupCreateCommand() {
 
 	// get all create token from metakv
-	entries, err := metakv.ListAllChildren(mc.CreateDDLCommandTokenPath)
+	entries, err := common.GetMetadataStore().ListAllChildren(mc.CreateDDLCommandTokenPath)
 	if err != nil {
 		logging.Warnf("DDLServiceMgr: Failed to fetch token from metakv.  Internal Error = %v", err)
 		return
@@ -910,14 +909,14 @@ func (m *DDLServiceMgr) handleListMetadataTokens(w http.ResponseWriter, r *http.
 
 		logging.Infof("DDLServiceMgr::handleListMetadataTokens Processing Request %v", r)
 
-		buildTokens, err := metakv.ListAllChildren(mc.BuildDDLCommandTokenPath)
+		buildTokens, err := common.GetMetadataStore().ListAllChildren(mc.BuildDDLCommandTokenPath)
 		if err != nil {
 			w.WriteHeader(http.StatusInternalServerError)
 			w.Write([]byte(err.Error() + "\n"))
 			return
 		}
 
-		deleteTokens, err1 := metakv.ListAllChildren(mc.DeleteDDLCommandTokenPath)
+		deleteTokens, err1 := common.GetMetadataStore().ListAllChildren(mc.DeleteDDLCommandTokenPath)
 		if err1 != nil {
 			w.WriteHeader(http.StatusInternalServerError)
 			w.Write([]byte(err1.Error() + "\n"))
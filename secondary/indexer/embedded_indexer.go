@@ -0,0 +1,522 @@
+// Copyright (c) 2014 Couchbase, Inc.
+// Licensed under the Apache License, Version 2.0 (the "License"); you may not use this file
+// except in compliance with the License. You may obtain a copy of the License at
+//   http://www.apache.org/licenses/LICENSE-2.0
+// Unless required by applicable law or agreed to in writing, software distributed under the
+// License is distributed on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND,
+// either express or implied. See the License for the specific language governing permissions
+// and limitations under the License.
+
+package indexer
+
+import (
+	"errors"
+	"fmt"
+	"net"
+
+	"github.com/couchbase/indexing/secondary/common"
+	"github.com/couchbase/indexing/secondary/logging"
+)
+
+// EmbeddedIndexer runs the data path of an indexer node - kv sender,
+// mutation manager with its stream readers and flusher, storage manager
+// and scan coordinator - inside the calling process, for tests that
+// need real mutation and scan handling without ns_server. Indexes are
+// kept in memdb slices.
+//
+// It stands in for the supervisor and timekeeper of the indexer:
+//
+//   - all indexes are active and fed by MAINT_STREAM, there is no
+//     INIT_STREAM build or stream merge. Creating an index restarts
+//     bucket's stream from seqno 0, so that the new index is built from
+//     all documents in the bucket and existing indexes re-apply them.
+//   - every high-water timestamp of the stream, that is at a snapshot
+//     boundary for all vbuckets, is flushed as an in-memory snapshot.
+//   - there is no recovery, rollback, index manager, metadata or
+//     settings handling.
+//
+// Stream and service addresses are process wide, only one indexer,
+// EmbeddedIndexer or otherwise, can run in a process.
+type EmbeddedIndexer struct {
+	config common.Config
+
+	wrkrRecvCh      MsgChannel
+	mutMgrCmdCh     MsgChannel
+	kvSenderCmdCh   MsgChannel
+	storageMgrCmdCh MsgChannel
+	scanCoordCmdCh  MsgChannel
+
+	mutMgr     MutationManager
+	kvSender   KVSender
+	storageMgr StorageManager
+	scanCoord  ScanCoordinator
+
+	reqch  chan *embeddedRequest
+	donech chan bool
+
+	// following fields are owned by run()
+	indexInstMap  common.IndexInstMap
+	indexPartnMap IndexPartnMap
+	stats         *IndexerStats
+	streams       map[string]bool               // buckets in MAINT_STREAM
+	flushing      map[string]bool               // flush in progress
+	hwts          map[string]*common.TsVbuuid   // pending flush
+	flushTs       map[string]*common.TsVbuuid   // last flushed
+	pending       map[string][]*embeddedRequest // waiting for flush
+}
+
+// embeddedRequest is executed by run(), once there is no flush in
+// progress for the bucket, all buckets if bucket is empty.
+type embeddedRequest struct {
+	bucket string
+	fn     func() error
+	exit   bool
+	respch chan error
+}
+
+// NewEmbeddedIndexer starts an indexer with `config`, the "indexer."
+// section of the system config.
+func NewEmbeddedIndexer(config common.Config) (*EmbeddedIndexer, error) {
+	idx := &EmbeddedIndexer{
+		config:          config,
+		wrkrRecvCh:      make(MsgChannel, WORKER_RECV_QUEUE_LEN),
+		mutMgrCmdCh:     make(MsgChannel),
+		kvSenderCmdCh:   make(MsgChannel),
+		storageMgrCmdCh: make(MsgChannel),
+		scanCoordCmdCh:  make(MsgChannel),
+		reqch:           make(chan *embeddedRequest),
+		donech:          make(chan bool),
+		indexInstMap:    make(common.IndexInstMap),
+		indexPartnMap:   make(IndexPartnMap),
+		stats:           NewIndexerStats(),
+		streams:         make(map[string]bool),
+		flushing:        make(map[string]bool),
+		hwts:            make(map[string]*common.TsVbuuid),
+		flushTs:         make(map[string]*common.TsVbuuid),
+		pending:         make(map[string][]*embeddedRequest),
+	}
+
+	common.SetStorageMode(common.MOI)
+
+	port2addr := func(p string) common.Endpoint {
+		return common.Endpoint(net.JoinHostPort("", config[p].String()))
+	}
+	StreamAddrMap = make(StreamAddressMap)
+	StreamAddrMap[common.MAINT_STREAM] = port2addr("streamMaintPort")
+	StreamAddrMap[common.CATCHUP_STREAM] = port2addr("streamCatchupPort")
+	StreamAddrMap[common.INIT_STREAM] = port2addr("streamInitPort")
+
+	id := "embedded_" + config["scanPort"].String()
+	StreamTopicName = make(map[common.StreamId]string)
+	StreamTopicName[common.MAINT_STREAM] = MAINT_TOPIC + "_" + id
+	StreamTopicName[common.CATCHUP_STREAM] = CATCHUP_TOPIC + "_" + id
+	StreamTopicName[common.INIT_STREAM] = INIT_TOPIC + "_" + id
+
+	snapshotNotifych := make(chan IndexSnapshot, 100)
+
+	var res Message
+	if idx.mutMgr, res = NewMutationManager(idx.mutMgrCmdCh, idx.wrkrRecvCh, config); res.GetMsgType() != MSG_SUCCESS {
+		return nil, embeddedError("MutationManager", res)
+	}
+	if idx.kvSender, res = NewKVSender(idx.kvSenderCmdCh, idx.wrkrRecvCh, config); res.GetMsgType() != MSG_SUCCESS {
+		idx.shutdownWorkers()
+		return nil, embeddedError("KVSender", res)
+	}
+	idx.storageMgr, res = NewStorageManager(idx.storageMgrCmdCh, idx.wrkrRecvCh,
+		idx.indexPartnMap, config, snapshotNotifych)
+	if res.GetMsgType() != MSG_SUCCESS {
+		idx.shutdownWorkers()
+		return nil, embeddedError("StorageManager", res)
+	}
+	idx.scanCoord, res = NewScanCoordinator(idx.scanCoordCmdCh, idx.wrkrRecvCh, config, snapshotNotifych)
+	if res.GetMsgType() != MSG_SUCCESS {
+		idx.shutdownWorkers()
+		return nil, embeddedError("ScanCoordinator", res)
+	}
+
+	// mutation queue memory is computed from config
+	idx.mutMgrCmdCh <- &MsgConfigUpdate{cfg: config}
+	<-idx.mutMgrCmdCh
+
+	if err := idx.distributeIndexMaps(); err != nil {
+		idx.shutdownWorkers()
+		return nil, err
+	}
+
+	idx.scanCoordCmdCh <- &MsgIndexerState{mType: INDEXER_RESUME}
+	<-idx.scanCoordCmdCh
+
+	go idx.run()
+	logging.Infof("EmbeddedIndexer: started, scanport %v", config["scanPort"].String())
+	return idx, nil
+}
+
+// CreateIndex creates an active index instance for `defn` and builds
+// it from all documents in the bucket. Returns once the bucket's
+// stream is restarted, scans with consistency vector wait for the
+// build to catch up.
+func (idx *EmbeddedIndexer) CreateIndex(defn common.IndexDefn, instId common.IndexInstId) error {
+	return idx.request(defn.Bucket, false, func() error {
+		return idx.createIndex(defn, instId)
+	})
+}
+
+// DropIndex drops index instance `instId`.
+func (idx *EmbeddedIndexer) DropIndex(instId common.IndexInstId, bucket string) error {
+	return idx.request(bucket, false, func() error {
+		return idx.dropIndex(instId)
+	})
+}
+
+// Close the indexer, its streams are closed with projector.
+func (idx *EmbeddedIndexer) Close() {
+	idx.request("", true, func() error {
+		for bucket := range idx.streams {
+			if err := idx.removeBucketFromStream(bucket); err != nil {
+				logging.Errorf("EmbeddedIndexer: remove bucket %v: %v", bucket, err)
+			}
+		}
+		idx.shutdownWorkers()
+		return nil
+	})
+	<-idx.donech
+}
+
+func (idx *EmbeddedIndexer) request(bucket string, exit bool, fn func() error) error {
+	req := &embeddedRequest{bucket: bucket, fn: fn, exit: exit, respch: make(chan error, 1)}
+	select {
+	case idx.reqch <- req:
+	case <-idx.donech:
+		return common.ErrorClosed
+	}
+	return <-req.respch
+}
+
+func (idx *EmbeddedIndexer) run() {
+	defer close(idx.donech)
+
+	for {
+		select {
+		case msg := <-idx.wrkrRecvCh:
+			if idx.handleWorkerMsg(msg) {
+				return
+			}
+
+		case req := <-idx.reqch:
+			if idx.isFlushing(req.bucket) {
+				idx.pending[req.bucket] = append(idx.pending[req.bucket], req)
+			} else if idx.execute(req) {
+				return
+			}
+		}
+	}
+}
+
+// execute request, returns true if indexer is closed.
+func (idx *EmbeddedIndexer) execute(req *embeddedRequest) bool {
+	req.respch <- req.fn()
+	return req.exit
+}
+
+func (idx *EmbeddedIndexer) isFlushing(bucket string) bool {
+	if bucket != "" {
+		return idx.flushing[bucket]
+	}
+	for _, flushing := range idx.flushing {
+		if flushing {
+			return true
+		}
+	}
+	return false
+}
+
+// handleWorkerMsg returns true if a pending request closed the indexer.
+func (idx *EmbeddedIndexer) handleWorkerMsg(msg Message) bool {
+	switch msg.GetMsgType() {
+	case STREAM_READER_HWT:
+		hwt := msg.(*MsgBucketHWT)
+		bucket := hwt.GetBucket()
+		if hwt.GetStreamId() == common.MAINT_STREAM && idx.streams[bucket] {
+			idx.hwts[bucket] = hwt.GetHWT()
+			idx.maybeFlush(bucket)
+		}
+
+	case MUT_MGR_FLUSH_DONE:
+		idx.storageMgrCmdCh <- msg
+		<-idx.storageMgrCmdCh
+
+	case STORAGE_SNAP_DONE:
+		bucket := msg.(*MsgMutMgrFlushDone).GetBucket()
+		idx.flushing[bucket] = false
+		for _, b := range []string{bucket, ""} {
+			if idx.isFlushing(b) {
+				continue
+			}
+			reqs := idx.pending[b]
+			delete(idx.pending, b)
+			for _, req := range reqs {
+				if idx.execute(req) {
+					return true
+				}
+			}
+		}
+		idx.maybeFlush(bucket)
+
+	case STORAGE_INDEX_SNAP_REQUEST,
+		STORAGE_INDEX_STORAGE_STATS,
+		STORAGE_INDEX_COMPACT,
+		STORAGE_STATS:
+		idx.storageMgrCmdCh <- msg
+		<-idx.storageMgrCmdCh
+
+	case STREAM_READER_STREAM_BEGIN,
+		STREAM_READER_STREAM_END,
+		STREAM_READER_STREAM_DROP_DATA,
+		STREAM_READER_ERROR,
+		STREAM_READER_CONN_ERROR:
+		logging.Debugf("EmbeddedIndexer: %v", msg)
+
+	default:
+		logging.Errorf("EmbeddedIndexer: unhandled message %v", msg)
+	}
+	return false
+}
+
+// maybeFlush pending high-water timestamp of bucket, if it is at a
+// snapshot boundary and no flush is in progress.
+func (idx *EmbeddedIndexer) maybeFlush(bucket string) {
+	hwt := idx.hwts[bucket]
+	if hwt == nil || idx.flushing[bucket] || len(idx.pending[""]) > 0 {
+		return
+	}
+	for vb, seqno := range hwt.Seqnos {
+		if seqno != hwt.Snapshots[vb][1] {
+			return
+		}
+	}
+	delete(idx.hwts, bucket)
+
+	// first flush after stream is opened creates a snapshot even if
+	// there are no mutations, so that scans on empty bucket can proceed.
+	last := idx.flushTs[bucket]
+	changeVec, changed := make([]bool, len(hwt.Seqnos)), last == nil
+	for vb, seqno := range hwt.Seqnos {
+		if last == nil && seqno > 0 || last != nil && seqno != last.Seqnos[vb] {
+			changeVec[vb], changed = true, true
+		}
+	}
+	if !changed {
+		return
+	}
+
+	ts := hwt.Copy()
+	ts.SetSnapType(common.INMEM_SNAP)
+	idx.mutMgrCmdCh <- &MsgMutMgrFlushMutationQueue{
+		mType:     MUT_MGR_PERSIST_MUTATION_QUEUE,
+		bucket:    bucket,
+		ts:        ts,
+		streamId:  common.MAINT_STREAM,
+		changeVec: changeVec}
+	if resp := <-idx.mutMgrCmdCh; resp.GetMsgType() != MSG_SUCCESS {
+		logging.Errorf("EmbeddedIndexer: flush %v: %v", bucket, resp)
+		return
+	}
+	idx.flushing[bucket] = true
+	idx.flushTs[bucket] = ts
+}
+
+func (idx *EmbeddedIndexer) createIndex(defn common.IndexDefn, instId common.IndexInstId) error {
+	if _, ok := idx.indexInstMap[instId]; ok {
+		return fmt.Errorf("Index instance %v already exists", instId)
+	}
+
+	numVbuckets := idx.config["numVbuckets"].Int()
+	pc := common.NewKeyPartitionContainer(numVbuckets, 1, defn.PartitionScheme, defn.HashScheme)
+	endpt := StreamAddrMap[common.MAINT_STREAM]
+	pc.AddPartition(common.PartitionId(0), common.KeyPartitionDefn{
+		Id: common.PartitionId(0), Endpts: []common.Endpoint{endpt}})
+	inst := common.IndexInst{
+		InstId: instId,
+		Defn:   defn,
+		State:  common.INDEX_STATE_ACTIVE,
+		Stream: common.MAINT_STREAM,
+		Pc:     pc,
+	}
+
+	idx.stats.AddPartition(instId, defn.Bucket, defn.Name, 0, common.PartitionId(0))
+	partnInstMap := make(PartitionInstMap)
+	for _, partnDefn := range pc.GetAllPartitions() {
+		partnInst := PartitionInst{Defn: partnDefn, Sc: NewHashedSliceContainer()}
+		slice, err := NewSlice(SliceId(0), &inst, &partnInst, idx.config, idx.stats)
+		if err != nil {
+			idx.stats.RemoveIndex(instId)
+			for _, partnInst := range partnInstMap {
+				for _, slice := range partnInst.Sc.GetAllSlices() {
+					slice.Close()
+					slice.Destroy()
+				}
+			}
+			return err
+		}
+		partnInst.Sc.AddSlice(0, slice)
+		partnInstMap[partnDefn.GetPartitionId()] = partnInst
+	}
+
+	idx.indexInstMap[instId] = inst
+	idx.indexPartnMap[instId] = partnInstMap
+	if err := idx.distributeIndexMaps(); err != nil {
+		return err
+	}
+
+	// initial build, stream all documents of the bucket again.
+	if idx.streams[defn.Bucket] {
+		if err := idx.removeBucketFromStream(defn.Bucket); err != nil {
+			return err
+		}
+	}
+	return idx.openBucketStream(defn.Bucket)
+}
+
+func (idx *EmbeddedIndexer) dropIndex(instId common.IndexInstId) error {
+	inst, ok := idx.indexInstMap[instId]
+	if !ok {
+		return common.ErrIndexNotFound
+	}
+	bucket := inst.Defn.Bucket
+
+	partnInstMap := idx.indexPartnMap[instId]
+	delete(idx.indexInstMap, instId)
+	delete(idx.indexPartnMap, instId)
+	idx.stats.RemoveIndex(instId)
+	if err := idx.distributeIndexMaps(); err != nil {
+		return err
+	}
+	for _, partnInst := range partnInstMap {
+		for _, slice := range partnInst.Sc.GetAllSlices() {
+			slice.Close()
+			slice.Destroy()
+		}
+	}
+
+	if len(idx.bucketIndexes(bucket)) == 0 {
+		return idx.removeBucketFromStream(bucket)
+	}
+	respCh := make(MsgChannel)
+	return idx.sendStreamUpdate(&MsgStreamUpdate{mType: REMOVE_INDEX_LIST_FROM_STREAM,
+		streamId:  common.MAINT_STREAM,
+		bucket:    bucket,
+		indexList: []common.IndexInst{inst},
+		respCh:    respCh}, respCh)
+}
+
+// openBucketStream for all indexes of the bucket, from seqno 0.
+func (idx *EmbeddedIndexer) openBucketStream(bucket string) error {
+	respCh := make(MsgChannel)
+	cmd := &MsgStreamUpdate{mType: OPEN_STREAM,
+		streamId:  common.MAINT_STREAM,
+		bucket:    bucket,
+		indexList: idx.bucketIndexes(bucket),
+		respCh:    respCh}
+	if err := idx.sendStreamUpdate(cmd, respCh); err != nil {
+		return err
+	}
+	idx.streams[bucket] = true
+	delete(idx.flushTs, bucket)
+	idx.hwts[bucket] = common.NewTsVbuuid(bucket, idx.config["numVbuckets"].Int())
+	idx.maybeFlush(bucket)
+	return nil
+}
+
+func (idx *EmbeddedIndexer) removeBucketFromStream(bucket string) error {
+	respCh := make(MsgChannel)
+	cmd := &MsgStreamUpdate{mType: REMOVE_BUCKET_FROM_STREAM,
+		streamId: common.MAINT_STREAM,
+		bucket:   bucket,
+		respCh:   respCh}
+	delete(idx.streams, bucket)
+	delete(idx.hwts, bucket)
+	return idx.sendStreamUpdate(cmd, respCh)
+}
+
+// sendStreamUpdate to mutation manager and then to projector via kv
+// sender, waits for projector's response.
+func (idx *EmbeddedIndexer) sendStreamUpdate(cmd *MsgStreamUpdate, respCh MsgChannel) error {
+	idx.mutMgrCmdCh <- cmd
+	if resp := <-idx.mutMgrCmdCh; resp.GetMsgType() != MSG_SUCCESS {
+		return embeddedError("MutationManager", resp)
+	}
+
+	idx.kvSenderCmdCh <- cmd
+	<-idx.kvSenderCmdCh
+	switch resp := <-respCh; resp.GetMsgType() {
+	case MSG_SUCCESS, MSG_SUCCESS_OPEN_STREAM:
+		return nil
+	case INDEXER_ROLLBACK:
+		return fmt.Errorf("EmbeddedIndexer: %v %v rollback from projector",
+			cmd.GetStreamId(), cmd.GetBucket())
+	default:
+		return embeddedError("KVSender", resp)
+	}
+}
+
+func (idx *EmbeddedIndexer) bucketIndexes(bucket string) []common.IndexInst {
+	insts := make([]common.IndexInst, 0)
+	for _, inst := range idx.indexInstMap {
+		if inst.Defn.Bucket == bucket {
+			insts = append(insts, inst)
+		}
+	}
+	return insts
+}
+
+func (idx *EmbeddedIndexer) distributeIndexMaps() error {
+	workers := []struct {
+		cmdCh MsgChannel
+		name  string
+	}{
+		{idx.storageMgrCmdCh, "StorageMgr"},
+		{idx.mutMgrCmdCh, "MutationMgr"},
+		{idx.scanCoordCmdCh, "ScanCoordinator"},
+	}
+	for _, worker := range workers {
+		msgs := []Message{
+			&MsgUpdateInstMap{
+				indexInstMap: common.CopyIndexInstMap(idx.indexInstMap),
+				stats:        idx.stats.Clone()},
+			&MsgUpdatePartnMap{indexPartnMap: CopyIndexPartnMap(idx.indexPartnMap)},
+		}
+		for _, msg := range msgs {
+			worker.cmdCh <- msg
+			if resp := <-worker.cmdCh; resp.GetMsgType() == MSG_ERROR {
+				return embeddedError(worker.name, resp)
+			}
+		}
+	}
+	return nil
+}
+
+func (idx *EmbeddedIndexer) shutdownWorkers() {
+	if idx.mutMgr != nil {
+		idx.mutMgrCmdCh <- &MsgGeneral{mType: MUT_MGR_SHUTDOWN}
+		<-idx.mutMgrCmdCh
+	}
+	if idx.scanCoord != nil {
+		idx.scanCoordCmdCh <- &MsgGeneral{mType: SCAN_COORD_SHUTDOWN}
+		<-idx.scanCoordCmdCh
+	}
+	if idx.storageMgr != nil {
+		idx.storageMgrCmdCh <- &MsgGeneral{mType: STORAGE_MGR_SHUTDOWN}
+		<-idx.storageMgrCmdCh
+	}
+	if idx.kvSender != nil {
+		idx.kvSenderCmdCh <- &MsgGeneral{mType: KV_SENDER_SHUTDOWN}
+		<-idx.kvSenderCmdCh
+	}
+}
+
+func embeddedError(worker string, res Message) error {
+	if msgErr, ok := res.(*MsgError); ok && msgErr.GetError().cause != nil {
+		return fmt.Errorf("EmbeddedIndexer: %v: %v", worker, msgErr.GetError().cause)
+	}
+	return errors.New(fmt.Sprintf("EmbeddedIndexer: %v: %v", worker, res))
+}
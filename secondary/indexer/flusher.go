@@ -410,7 +410,10 @@ func (f *flusher) flush(mutk *MutationKeys, streamId common.StreamId) {
 			if skipUpsertDeletion {
 				continue
 			} else {
+				// slices count the exits that remove an entry.
+				mutk.meta.predicateExit = mut.exit
 				f.processDelete(mut, mutk.docid, mutk.meta)
+				mutk.meta.predicateExit = false
 			}
 
 		default:
@@ -0,0 +1,154 @@
+package indexer
+
+import (
+	"io/ioutil"
+	"os"
+	"testing"
+
+	"github.com/couchbase/indexing/secondary/common"
+	mcd "github.com/couchbase/indexing/secondary/dcp/transport"
+	mc "github.com/couchbase/indexing/secondary/dcp/transport/client"
+	"github.com/couchbase/indexing/secondary/projector"
+	protobuf "github.com/couchbase/indexing/secondary/protobuf/data"
+	projproto "github.com/couchbase/indexing/secondary/protobuf/projector"
+	"github.com/golang/protobuf/proto"
+)
+
+const flusherTestEndpoint = "localhost:9100"
+
+// flusherTestKeyVersions converts key-versions as dataport does on the
+// wire.
+func flusherTestKeyVersions(kv *common.KeyVersions) *protobuf.KeyVersions {
+	pkv := &protobuf.KeyVersions{
+		Seqno: proto.Uint64(kv.Seqno),
+		Docid: kv.Docid,
+		Exits: kv.Exits,
+	}
+	for i, uuid := range kv.Uuids {
+		pkv.Uuids = append(pkv.Uuids, uuid)
+		pkv.Commands = append(pkv.Commands, uint32(kv.Commands[i]))
+		pkv.Keys = append(pkv.Keys, kv.Keys[i])
+		pkv.Oldkeys = append(pkv.Oldkeys, kv.Oldkeys[i])
+		pkv.Partnkeys = append(pkv.Partnkeys, kv.Partnkeys[i])
+	}
+	data, err := proto.Marshal(pkv)
+	if err != nil {
+		panic(err)
+	}
+	pkv = &protobuf.KeyVersions{}
+	if err := proto.Unmarshal(data, pkv); err != nil {
+		panic(err)
+	}
+	return pkv
+}
+
+func TestFlusherPredicateExitDeletes(t *testing.T) {
+	dir, err := ioutil.TempDir("", "flusher")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	inst := verifyTestInst(common.IndexDefn{
+		DefnId: 10, SecExprs: []string{"`name`"}, WhereExpr: "`age` > 10",
+	})
+	inst.Stream = common.MAINT_STREAM
+	inst.Pc = common.NewKeyPartitionContainer(4, 1, common.SINGLE, common.CRC32)
+
+	slice := exportTestSlice(t, inst, dir)
+	sc := NewHashedSliceContainer()
+	sc.AddSlice(0, slice)
+	f := &flusher{
+		indexInstMap: common.IndexInstMap{inst.InstId: inst},
+		indexPartnMap: IndexPartnMap{
+			inst.InstId: PartitionInstMap{0: PartitionInst{Sc: sc}},
+		},
+	}
+
+	protoInst := &projproto.IndexInst{
+		InstId:      proto.Uint64(uint64(inst.InstId)),
+		State:       projproto.IndexState_IndexActive.Enum(),
+		Definition:  convertIndexDefnToProtobuf(inst.Defn),
+		SinglePartn: projproto.NewSinglePartition([]string{flusherTestEndpoint}),
+	}
+	ie, err := projproto.NewIndexEvaluator(protoInst, projproto.FeedVersion_watson)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	bucket := projector.NewFakeBuckets([]string{"default"})["default"]
+	feeder, err := bucket.OpenKVFeed("localhost:11210")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer bucket.Close("localhost:11210")
+
+	seqno := uint64(0)
+	feed := func(docid, value, oldValue string) {
+		seqno++
+		m := &mc.DcpEvent{
+			Opcode:  mcd.DCP_MUTATION,
+			VBucket: 1,
+			Seqno:   seqno,
+			Key:     []byte(docid),
+			Value:   []byte(value),
+		}
+		if oldValue != "" {
+			m.OldValue = []byte(oldValue)
+		}
+		m.TreatAsJSON()
+		bucket.C <- m
+		m = <-feeder.GetChannel()
+
+		data := make(map[string]interface{})
+		encodeBuf := make([]byte, 0, maxIndexEntrySize)
+		if _, err := ie.TransformRoute(1234, m, data, encodeBuf); err != nil {
+			t.Fatal(err)
+		}
+		dkv, ok := data[flusherTestEndpoint].(*common.DataportKeyVersions)
+		if !ok {
+			return
+		}
+
+		kv := flusherTestKeyVersions(dkv.Kv)
+		mutk := NewMutationKeys()
+		mutk.meta = NewMutationMeta()
+		mutk.meta.bucket, mutk.meta.vbucket = "default", Vbucket(m.VBucket)
+		mutk.meta.seqno = Seqno(seqno)
+		mutk.docid = kv.GetDocid()
+		for i := range kv.GetCommands() {
+			mutk.mut = append(mutk.mut, newKeyVersionMutation(kv, i))
+		}
+		f.flushSingleMutation(mutk, common.MAINT_STREAM)
+	}
+
+	testcases := []struct {
+		name            string
+		docid, value    string
+		oldValue        string
+		expectedEntries int
+		expectedExits   int64
+	}{
+		{"insert", "doc1", `{"name":"a","age":20}`, "", 1, 0},
+		{"in->out", "doc1", `{"name":"a","age":5}`, `{"name":"a","age":20}`, 0, 1},
+		{"out->out", "doc1", `{"name":"a","age":1}`, `{"name":"a","age":5}`, 0, 1},
+		{"insert again", "doc1", `{"name":"a","age":20}`, "", 1, 1},
+		// old document is not known, the entry is removed but it is
+		// not counted as an exit.
+		{"unknown", "doc1", `{"name":"a","age":5}`, "", 0, 1},
+		{"unknown not indexed", "doc2", `{"name":"b","age":5}`, "", 0, 1},
+	}
+
+	ts := common.NewTsVbuuid("default", 4)
+	for _, tc := range testcases {
+		feed(tc.docid, tc.value, tc.oldValue)
+
+		_, entries := exportTestEntries(t, slice, ts)
+		if len(entries) != tc.expectedEntries {
+			t.Errorf("%v: expected %v entries, got %v", tc.name, tc.expectedEntries, len(entries))
+		}
+		if exits := slice.idxStats.numPredicateExitDeletes.Value(); exits != tc.expectedExits {
+			t.Errorf("%v: expected %v predicate exit deletes, got %v", tc.name, tc.expectedExits, exits)
+		}
+	}
+}
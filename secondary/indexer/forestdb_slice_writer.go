@@ -274,7 +274,16 @@ func (fdb *fdbSlice) DecrRef() {
 //If forestdb has encountered any fatal error condition,
 //it will be returned as error.
 func (fdb *fdbSlice) Insert(rawKey []byte, docid []byte, meta *MutationMeta) error {
-	key, err := GetIndexEntryBytes(rawKey, docid, fdb.idxDefn.IsPrimary, fdb.idxDefn.IsArrayIndex, 1, fdb.idxDefn.Desc)
+	var key []byte
+	var err error
+	if len(fdb.idxDefn.Include) > 0 && !fdb.idxDefn.IsPrimary {
+		key, err = NewIncludeIndexEntry(rawKey, docid, len(fdb.idxDefn.SecExprs), fdb.idxDefn.Desc, nil)
+		if err == ErrSecKeyNil {
+			key, err = nil, nil
+		}
+	} else {
+		key, err = GetIndexEntryBytes(rawKey, docid, fdb.idxDefn.IsPrimary, fdb.idxDefn.IsArrayIndex, 1, fdb.idxDefn.Desc)
+	}
 	if err != nil {
 		return err
 	}
@@ -292,10 +301,18 @@ func (fdb *fdbSlice) Insert(rawKey []byte, docid []byte, meta *MutationMeta) err
 func (fdb *fdbSlice) Delete(docid []byte, meta *MutationMeta) error {
 	fdb.idxStats.numDocsFlushQueued.Add(1)
 	atomic.AddInt64(&fdb.qCount, 1)
-	fdb.cmdCh <- docid
+	if meta.predicateExit {
+		fdb.cmdCh <- predicateExitDocid(docid)
+	} else {
+		fdb.cmdCh <- docid
+	}
 	return fdb.fatalDbErr
 }
 
+//predicateExitDocid is the delete command for an UpsertDeletion on
+//a document that left the WHERE predicate, see MutationMeta.
+type predicateExitDocid []byte
+
 //handleCommands keep listening to any buffered
 //write requests for the slice and processes
 //those. This will shut itself down internal
@@ -328,6 +345,16 @@ loop:
 				elapsed = time.Since(start)
 				fdb.totalFlushTime += elapsed
 
+			case predicateExitDocid:
+				dcmd = c.(predicateExitDocid)
+				start = time.Now()
+				//secondary index deletes count only removed entries
+				if nmut = fdb.delete(dcmd, workerId); nmut > 0 {
+					fdb.idxStats.numPredicateExitDeletes.Add(1)
+				}
+				elapsed = time.Since(start)
+				fdb.totalFlushTime += elapsed
+
 			default:
 				logging.Errorf("ForestDBSlice::handleCommandsWorker \n\tSliceId %v IndexInstId %v Received "+
 					"Unknown Command %v", fdb.id, fdb.idxInstId, logging.TagUD(c))
@@ -13,6 +13,8 @@ var (
 	ErrSecKeyNil     = errors.New("Secondary key array is empty")
 	ErrSecKeyTooLong = errors.New(fmt.Sprintf("Secondary key is too long (> %d)", maxSecKeyLen))
 	ErrDocIdTooLong  = errors.New(fmt.Sprintf("DocID is too long (>%d)", MAX_DOCID_LEN))
+
+	ErrIncludeKeyMissing = errors.New("Include values missing in secondary key")
 )
 
 // Special index keys
@@ -111,15 +113,87 @@ func (e *primaryIndexEntry) String() string {
 
 // Storage encoding for secondary index entry
 // Format:
-// [collate_json_encoded_sec_key][raw_docid_bytes][optional_count_2_bytes][len_of_docid_2_bytes]
+// [collate_json_encoded_sec_key][raw_docid_bytes][optional_include][optional_count_2_bytes][len_of_docid_2_bytes]
 // The MSB of right byte of docid length indicates whether count is encoded or not
+// The next bit of right byte of docid length indicates whether include is encoded or not
+// Include is encoded as [collate_json_encoded_include_values][len_of_include_2_bytes]
 type secondaryIndexEntry []byte
 
+const (
+	entryCountFlag   = 0x80
+	entryIncludeFlag = 0x40
+	entryDocIdMask   = 0x3fff
+)
+
 func NewSecondaryIndexEntry(key []byte, docid []byte, isArray bool, count int, desc []bool, buf []byte) (secondaryIndexEntry, error) {
 	return NewSecondaryIndexEntry2(key, docid, isArray, count, desc, buf, true)
 }
 
 func NewSecondaryIndexEntry2(key []byte, docid []byte, isArray bool,
+	count int, desc []bool, buf []byte, validateSize bool) (secondaryIndexEntry, error) {
+	return newSecondaryIndexEntry(key, nil, docid, isArray, count, desc, buf, validateSize)
+}
+
+// NewIncludeIndexEntry creates a secondary index entry for an index with
+// include columns. key is the secondary key as evaluated by projector, with
+// values of include expressions following the first numKeys elements. The
+// include values are stored in the entry payload and do not take part in
+// collation.
+func NewIncludeIndexEntry(key []byte, docid []byte, numKeys int,
+	desc []bool, buf []byte) (secondaryIndexEntry, error) {
+
+	if isNilJsonKey(key) {
+		return nil, ErrSecKeyNil
+	}
+
+	if !allowLargeKeys && ((key[0] == '[' && isSecKeyLarge(key)) ||
+		(key[0] != '[' && len(key) > maxSecKeyBufferLen)) {
+		return nil, ErrSecKeyTooLong
+	}
+
+	sk, include, err := splitIncludeKey(key, numKeys)
+	if err != nil {
+		return nil, err
+	}
+	if size := len(sk) + len(docid) + len(include) + 6; size > cap(buf) {
+		buf = make([]byte, 0, size)
+	}
+	return newSecondaryIndexEntry(sk, include, docid, false, 1, desc, buf, false)
+}
+
+// splitIncludeKey splits a secondary key into collate encoded sort key made
+// of the first numKeys elements and include values.
+func splitIncludeKey(key []byte, numKeys int) ([]byte, []byte, error) {
+	var err error
+
+	code := key
+	if key[0] == '[' { // JSON
+		code = make([]byte, 0, len(key)*3+ENCODE_BUF_SAFE_PAD)
+		if code, err = jsonEncoder.Encode(key, code); err != nil {
+			return nil, nil, err
+		}
+	}
+
+	elems, err := jsonEncoder.ExplodeArray(code, make([]byte, 0, len(code)))
+	if err != nil {
+		return nil, nil, err
+	}
+	if len(elems) <= numKeys {
+		return nil, nil, ErrIncludeKeyMissing
+	}
+
+	buf := make([]byte, 0, len(code)+ENCODE_BUF_SAFE_PAD)
+	if buf, err = jsonEncoder.JoinArray(elems[:numKeys], buf); err != nil {
+		return nil, nil, err
+	}
+	l := len(buf)
+	if buf, err = jsonEncoder.JoinArray(elems[numKeys:], buf); err != nil {
+		return nil, nil, err
+	}
+	return buf[:l:l], buf[l:], nil
+}
+
+func newSecondaryIndexEntry(key []byte, include []byte, docid []byte, isArray bool,
 	count int, desc []bool, buf []byte, validateSize bool) (secondaryIndexEntry, error) {
 	var err error
 	var offset int
@@ -156,6 +230,13 @@ func NewSecondaryIndexEntry2(key []byte, docid []byte, isArray bool,
 
 	buf = append(buf, docid...)
 
+	if include != nil {
+		buf = append(buf, include...)
+		buf = buf[:len(buf)+2]
+		offset = len(buf) - 2
+		binary.LittleEndian.PutUint16(buf[offset:offset+2], uint16(len(include)))
+	}
+
 	if count > 1 {
 		buf = buf[:len(buf)+2]
 		offset = len(buf) - 2
@@ -166,13 +247,26 @@ func NewSecondaryIndexEntry2(key []byte, docid []byte, isArray bool,
 	offset = len(buf) - 2
 	binary.LittleEndian.PutUint16(buf[offset:offset+2], uint16(len(docid)))
 	if count > 1 {
-		buf[offset+1] |= byte(uint8(1) << 7)
+		buf[offset+1] |= entryCountFlag
+	}
+	if include != nil {
+		buf[offset+1] |= entryIncludeFlag
 	}
 
 	e := secondaryIndexEntry(buf)
 	return e, nil
 }
 
+// Create a non-array secondary index entry as per index definition
+func newDefnIndexEntry(key []byte, docid []byte, defn *common.IndexDefn,
+	buf []byte) (secondaryIndexEntry, error) {
+
+	if len(defn.Include) > 0 {
+		return NewIncludeIndexEntry(key, docid, len(defn.SecExprs), defn.Desc, buf)
+	}
+	return NewSecondaryIndexEntry(key, docid, defn.IsArrayIndex, 1, defn.Desc, buf)
+}
+
 func BytesToSecondaryIndexEntry(b []byte) (*secondaryIndexEntry, error) {
 	e := secondaryIndexEntry(b)
 	return &e, nil
@@ -182,31 +276,59 @@ func (e *secondaryIndexEntry) lenDocId() int {
 	rbuf := []byte(*e)
 	offset := len(rbuf) - 2
 	l := binary.LittleEndian.Uint16(rbuf[offset : offset+2])
-	len := l & 0x7fff // Length & 0111111 11111111 (as MSB of length is used to indicate presence of count)
+	len := l & entryDocIdMask // Length & 00111111 11111111 (as two MSBs of length are used as flags)
 	return int(len)
 }
 
 func (e *secondaryIndexEntry) lenKey() int {
-	if e.isCountEncoded() == true {
-		return len(*e) - e.lenDocId() - 4
+	return len(*e) - e.lenDocId() - e.lenTrailer()
+}
+
+// Length of the bytes following docid
+func (e *secondaryIndexEntry) lenTrailer() int {
+	l := 2
+	if e.isCountEncoded() {
+		l += 2
+	}
+	if e.isIncludeEncoded() {
+		l += 2 + e.lenInclude()
 	}
-	return len(*e) - e.lenDocId() - 2
+	return l
 }
 
 func (e *secondaryIndexEntry) isCountEncoded() bool {
 	rbuf := []byte(*e)
 	offset := len(rbuf) - 1 // Decode length byte to see if count is encoded
-	return (rbuf[offset] & 0x80) == 0x80
+	return (rbuf[offset] & entryCountFlag) == entryCountFlag
+}
+
+func (e *secondaryIndexEntry) isIncludeEncoded() bool {
+	rbuf := []byte(*e)
+	offset := len(rbuf) - 1 // Decode length byte to see if include is encoded
+	return (rbuf[offset] & entryIncludeFlag) == entryIncludeFlag
+}
+
+func (e *secondaryIndexEntry) lenInclude() int {
+	rbuf := []byte(*e)
+	offset := len(rbuf) - 4
+	if e.isCountEncoded() {
+		offset -= 2
+	}
+	return int(binary.LittleEndian.Uint16(rbuf[offset : offset+2]))
+}
+
+// Collate encoded array of include values, nil if not encoded
+func (e secondaryIndexEntry) includeBytes() []byte {
+	if !e.isIncludeEncoded() {
+		return nil
+	}
+	offset := e.lenKey() + e.lenDocId()
+	return e[offset : offset+e.lenInclude()]
 }
 
 func (e secondaryIndexEntry) ReadDocId(buf []byte) ([]byte, error) {
 	docidlen := e.lenDocId()
-	var offset int
-	if e.isCountEncoded() == true {
-		offset = len(e) - docidlen - 4
-	} else {
-		offset = len(e) - docidlen - 2
-	}
+	offset := e.lenKey()
 	buf = append(buf, e[offset:offset+docidlen]...)
 	return buf, nil
 }
@@ -224,13 +346,7 @@ func (e secondaryIndexEntry) Count() int {
 
 func (e secondaryIndexEntry) ReadSecKey(buf []byte) ([]byte, error) {
 	var err error
-	var encoded []byte
-	doclen := e.lenDocId()
-	if e.isCountEncoded() {
-		encoded = e[0 : len(e)-doclen-4]
-	} else {
-		encoded = e[0 : len(e)-doclen-2]
-	}
+	encoded := e[0:e.lenKey()]
 
 	if buf, err = jsonEncoder.Decode(encoded, buf); err != nil {
 		return nil, err
@@ -238,6 +354,16 @@ func (e secondaryIndexEntry) ReadSecKey(buf []byte) ([]byte, error) {
 	return buf, nil
 }
 
+// ReadInclude decodes include values of the entry as JSON array, buf is
+// returned unchanged if the entry does not have include values.
+func (e secondaryIndexEntry) ReadInclude(buf []byte) ([]byte, error) {
+	include := e.includeBytes()
+	if include == nil {
+		return buf, nil
+	}
+	return jsonEncoder.Decode(include, buf)
+}
+
 func (e *secondaryIndexEntry) Bytes() []byte {
 	return []byte(*e)
 }
@@ -343,6 +469,15 @@ func (k *primaryKey) String() string {
 type secondaryKey []byte
 
 func NewSecondaryKey(key []byte, buf []byte) (IndexKey, error) {
+	return NewCollatedSecondaryKey(key, buf, jsonEncoder, collatejson.TieValue)
+}
+
+// NewCollatedSecondaryKey creates a secondary key encoded with codec, tie
+// is the tie-break for strings of a collated index, refer to
+// collatejson.Tie.
+func NewCollatedSecondaryKey(key []byte, buf []byte, codec *collatejson.Codec,
+	tie collatejson.Tie) (IndexKey, error) {
+
 	if isNilJsonKey(key) {
 		return &NilIndexKey{}, nil
 	}
@@ -352,7 +487,7 @@ func NewSecondaryKey(key []byte, buf []byte) (IndexKey, error) {
 	}
 
 	var err error
-	if buf, err = jsonEncoder.Encode(key, buf); err != nil {
+	if buf, err = codec.EncodeBound(key, buf, tie); err != nil {
 		return nil, err
 	}
 
@@ -186,3 +186,66 @@ func TestLongDocIdEntry(t *testing.T) {
 		t.Errorf("Expected lenght to be 258 but instead got ", e.lenDocId())
 	}
 }
+
+func TestIncludeIndexEntry(t *testing.T) {
+	buf := make([]byte, 0, 300)
+	docid := []byte("doc-1")
+	key := []byte(`["field1","field2","incl1",10]`)
+	sk := []byte(`["field1","field2"]`)
+	incl := []byte(`["incl1",10]`)
+
+	e, err := NewIncludeIndexEntry(key, docid, 2, nil, make([]byte, 0, 4096))
+	if err != nil {
+		t.Fatalf("Got error %v", err)
+	}
+
+	buf, _ = e.ReadDocId(buf)
+	if !bytes.Equal(docid, buf) {
+		t.Errorf("Expected %v, received %v", string(docid), string(buf))
+	}
+	if !bytes.Equal(docid, docIdFromEntryBytes(e.Bytes())) {
+		t.Errorf("Expected %v, received %v", string(docid), string(docIdFromEntryBytes(e.Bytes())))
+	}
+
+	buf = buf[:0]
+	buf, _ = e.ReadSecKey(buf)
+	if !bytes.Equal(sk, buf) {
+		t.Errorf("Expected %v, received %v", string(sk), string(buf))
+	}
+
+	buf = buf[:0]
+	buf, _ = e.ReadInclude(buf)
+	if !bytes.Equal(incl, buf) {
+		t.Errorf("Expected %v, received %v", string(incl), string(buf))
+	}
+
+	// include values do not take part in comparison
+	k, _ := NewSecondaryKey(sk, make([]byte, 0, 300))
+	if k.Compare(&e) != 0 {
+		t.Errorf("Expected match")
+	}
+
+	// entry rebuilt from plasma back index entry
+	orig := append([]byte(nil), e.Bytes()...)
+	bentry := append([]byte(nil), entry2BackEntry(e)...)
+	rebuilt := backEntry2entry(docid, bentry, make([]byte, 0, 300))
+	if !bytes.Equal(orig, rebuilt) {
+		t.Errorf("Expected %v, received %v", orig, rebuilt)
+	}
+
+	// project include column followed by leading key
+	proj := &Projection{projectSecKeys: true, projectionKeys: []bool{true, false, false, true}, numKeys: 2}
+	out, err := projectKeys(nil, orig, make([]byte, 0, 300), proj, make([][]byte, 2))
+	if err != nil {
+		t.Fatalf("Got error %v", err)
+	}
+	pe := secondaryIndexEntry(out)
+	buf, _ = pe.ReadSecKey(buf[:0])
+	if expected := []byte(`["field1",10]`); !bytes.Equal(expected, buf) {
+		t.Errorf("Expected %v, received %v", string(expected), string(buf))
+	}
+
+	if _, err := NewIncludeIndexEntry(sk, docid, 2, nil, nil); err != ErrIncludeKeyMissing {
+		t.Errorf("Expected error %v, got %v", ErrIncludeKeyMissing, err)
+	}
+}
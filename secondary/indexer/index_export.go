@@ -0,0 +1,574 @@
+// Copyright (c) 2014 Couchbase, Inc.
+// Licensed under the Apache License, Version 2.0 (the "License"); you may not use this file
+// except in compliance with the License. You may obtain a copy of the License at
+//   http://www.apache.org/licenses/LICENSE-2.0
+// Unless required by applicable law or agreed to in writing, software distributed under the
+// License is distributed on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND,
+// either express or implied. See the License for the specific language governing permissions
+// and limitations under the License.
+
+package indexer
+
+import (
+	"bufio"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"hash/crc32"
+	"io"
+	"reflect"
+	"sort"
+	"time"
+
+	"github.com/couchbase/indexing/secondary/common"
+	"github.com/couchbase/indexing/secondary/common/queryutil"
+	couchbase "github.com/couchbase/indexing/secondary/dcp"
+	"github.com/couchbase/indexing/secondary/logging"
+)
+
+// Index export file is independent of the storage engine. It holds the
+// secondary keys in the form projector sends them, hence it can be imported
+// into a slice of any type:
+//
+//   magic "GSIX"
+//   uvarint length of header, JSON encoded IndexExportHeader
+//   one record per document:
+//       uvarint partition id, uvarint length of docid, docid,
+//       uvarint length of key, key (collate encoded, empty for primary index)
+//   trailer: uvarint 0, uvarint 0, uvarint number of records
+
+var (
+	ErrExportBadFormat    = errors.New("Not an index export file")
+	ErrExportVersion      = errors.New("Unsupported index export file version")
+	ErrExportTruncated    = errors.New("Index export file is truncated")
+	ErrExportMismatch     = errors.New("Index export does not match index definition")
+	ErrImportInProgress   = errors.New("Index import already in progress")
+	ErrImportInvalidState = errors.New("Index can be imported only before it is built")
+	ErrImportTimeout      = errors.New("Timeout waiting for imported snapshot to persist")
+	ErrImportHistory      = errors.New("Index export timestamp is not in the bucket history")
+)
+
+const indexExportMagic = "GSIX"
+const indexExportVersion = 1
+
+// IndexExportHeader describes the index snapshot held in an export file.
+type IndexExportHeader struct {
+	Version       int                  `json:"version"`
+	Definition    common.IndexDefn     `json:"definition"`
+	NumPartitions int                  `json:"numPartitions"`
+	Partitions    []common.PartitionId `json:"partitions"`
+	Timestamp     *common.TsVbuuid     `json:"timestamp"`
+}
+
+// ImportReport is the outcome of seeding an index from an export file.
+type ImportReport struct {
+	Bucket     string             `json:"bucket"`
+	Index      string             `json:"index"`
+	InstId     common.IndexInstId `json:"instId"`
+	Seqnos     []uint64           `json:"seqnos"`
+	NumDocs    uint64             `json:"numDocs"`
+	NumSkipped uint64             `json:"numSkipped"`
+	Elapsed    string             `json:"elapsed"`
+}
+
+//---------------------
+// export
+//---------------------
+
+// indexExporter writes the entries of an index snapshot to an export file.
+type indexExporter struct {
+	inst   common.IndexInst
+	ctxs   map[common.PartitionId]IndexReaderContext
+	w      *bufio.Writer
+	cancel <-chan struct{}
+
+	arrayExprPosition int
+	count             uint64
+	varBuf            []byte
+	tmpBuf            []byte
+}
+
+// arrayDoc accumulates the array items of a document, storage has one
+// entry per item whereas projector sends all of them in a single key.
+type arrayDoc struct {
+	elems [][]byte
+	items [][]byte
+}
+
+// newIndexExporter returns an exporter for the local partitions of `inst`,
+// `ctxs` supplies the reader context of each such partition. Export
+// fails with ErrClientCancel once `cancel` is closed.
+func newIndexExporter(inst common.IndexInst,
+	ctxs map[common.PartitionId]IndexReaderContext, w io.Writer,
+	cancel <-chan struct{}) (*indexExporter, error) {
+
+	var err error
+
+	e := &indexExporter{
+		inst:   inst,
+		ctxs:   ctxs,
+		w:      bufio.NewWriter(w),
+		cancel: cancel,
+		varBuf: make([]byte, binary.MaxVarintLen64),
+	}
+	if inst.Defn.IsArrayIndex {
+		_, _, e.arrayExprPosition, err =
+			queryutil.GetArrayExpressionPosition(inst.Defn.SecExprs)
+		if err != nil {
+			return nil, err
+		}
+	}
+	return e, nil
+}
+
+// Export writes snapshot `is` and returns the number of documents written.
+func (e *indexExporter) Export(is IndexSnapshot) (uint64, error) {
+	ts := is.Timestamp()
+	if ts == nil {
+		return 0, ErrSnapNotAvailable
+	}
+
+	header := &IndexExportHeader{
+		Version:       indexExportVersion,
+		Definition:    e.inst.Defn,
+		NumPartitions: e.inst.Pc.GetNumPartitions(),
+		Timestamp:     ts.Copy(),
+	}
+	for partnId := range e.ctxs {
+		header.Partitions = append(header.Partitions, partnId)
+	}
+	sort.Slice(header.Partitions, func(i, j int) bool {
+		return header.Partitions[i] < header.Partitions[j]
+	})
+
+	data, err := json.Marshal(header)
+	if err != nil {
+		return 0, err
+	}
+	e.w.WriteString(indexExportMagic)
+	e.writeUvarint(uint64(len(data)))
+	e.w.Write(data)
+
+	partitions := is.Partitions()
+	for _, partnId := range header.Partitions {
+		ps, ok := partitions[partnId]
+		if !ok {
+			continue
+		}
+		if err := e.exportPartition(partnId, ps); err != nil {
+			return 0, err
+		}
+	}
+
+	e.writeUvarint(0)
+	e.writeUvarint(0)
+	e.writeUvarint(e.count)
+	return e.count, e.w.Flush()
+}
+
+func (e *indexExporter) exportPartition(
+	partnId common.PartitionId, ps PartitionSnapshot) error {
+
+	var docid []byte
+	var err error
+
+	ctx := e.ctxs[partnId]
+	docs := make(map[string]*arrayDoc)
+
+	callb := func(entry []byte) error {
+		select {
+		case <-e.cancel:
+			return common.ErrClientCancel
+		default:
+		}
+
+		if e.inst.Defn.IsPrimary {
+			pe := primaryIndexEntry(entry)
+			docid, err = pe.ReadDocId(docid[:0])
+			if err != nil {
+				return err
+			}
+			return e.writeRecord(partnId, docid, nil)
+		}
+
+		se := secondaryIndexEntry(entry)
+		if docid, err = se.ReadDocId(docid[:0]); err != nil {
+			return err
+		}
+		code := e.entryKey(se)
+		if !e.inst.Defn.IsArrayIndex {
+			if include := se.includeBytes(); include != nil {
+				if code, err = e.joinInclude(code, include); err != nil {
+					return err
+				}
+			}
+			return e.writeRecord(partnId, docid, code)
+		}
+
+		elems, err := e.explode(code)
+		if err != nil {
+			return err
+		}
+		doc, ok := docs[string(docid)]
+		if !ok {
+			doc = &arrayDoc{elems: elems}
+			docs[string(docid)] = doc
+		}
+		for i := 0; i < se.Count(); i++ {
+			doc.items = append(doc.items, elems[e.arrayExprPosition])
+		}
+		return nil
+	}
+
+	for _, ss := range ps.Slices() {
+		if err := e.exportSlice(ctx, ss, callb); err != nil {
+			return err
+		}
+	}
+
+	for docid, doc := range docs {
+		array, err := jsonEncoder.JoinArray(doc.items, nil)
+		if err != nil {
+			return err
+		}
+		doc.elems[e.arrayExprPosition] = array
+		key, err := jsonEncoder.JoinArray(doc.elems, nil)
+		if err != nil {
+			return err
+		}
+		if err := e.writeRecord(partnId, []byte(docid), key); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// exportSlice scans slice snapshot `ss`, reader context is released
+// however the scan ends.
+func (e *indexExporter) exportSlice(ctx IndexReaderContext,
+	ss SliceSnapshot, callb EntryCallback) error {
+
+	ctx.Init()
+	defer ctx.Done()
+	return ss.Snapshot().All(ctx, callb)
+}
+
+// entryKey returns a copy of the collate encoded key of the entry, in
+// ascending collation.
+func (e *indexExporter) entryKey(se secondaryIndexEntry) []byte {
+	code := make([]byte, se.lenKey())
+	copy(code, se[:se.lenKey()])
+	if e.inst.Defn.Desc != nil {
+		code = jsonEncoder.ReverseCollate(code, e.inst.Defn.Desc)
+	}
+	return code
+}
+
+// explode returns the elements of a collate encoded array, elements are
+// copied so that they can outlive the entry.
+func (e *indexExporter) explode(code []byte) ([][]byte, error) {
+	if need := len(code)*3 + ENCODE_BUF_SAFE_PAD; cap(e.tmpBuf) < need {
+		e.tmpBuf = make([]byte, 0, need)
+	}
+	return jsonEncoder.ExplodeArray(code, e.tmpBuf[:0])
+}
+
+// joinInclude appends include values to the key, as projector sends them.
+func (e *indexExporter) joinInclude(code, include []byte) ([]byte, error) {
+	elems, err := e.explode(code)
+	if err != nil {
+		return nil, err
+	}
+	values, err := e.explode(include)
+	if err != nil {
+		return nil, err
+	}
+	return jsonEncoder.JoinArray(append(elems, values...), nil)
+}
+
+func (e *indexExporter) writeRecord(
+	partnId common.PartitionId, docid, key []byte) error {
+
+	e.writeUvarint(uint64(partnId))
+	e.writeUvarint(uint64(len(docid)))
+	e.w.Write(docid)
+	e.writeUvarint(uint64(len(key)))
+	_, err := e.w.Write(key)
+	e.count++
+	return err
+}
+
+func (e *indexExporter) writeUvarint(v uint64) {
+	n := binary.PutUvarint(e.varBuf, v)
+	e.w.Write(e.varBuf[:n])
+}
+
+//---------------------
+// import
+//---------------------
+
+// indexImporter seeds the local slices of an index, that is not yet built,
+// from an export file. Once the import is done the slices have a persisted
+// snapshot at the timestamp of the export, build of the index catches up
+// from KV starting at that timestamp. `failoverLogs` supplies the failover
+// logs of the bucket, to check that KV can resume from that timestamp.
+type indexImporter struct {
+	inst         common.IndexInst
+	slices       map[common.PartitionId]Slice
+	numVbuckets  int
+	timeout      time.Duration
+	failoverLogs func() (couchbase.FailoverLog, error)
+}
+
+func newIndexImporter(inst common.IndexInst, slices map[common.PartitionId]Slice,
+	numVbuckets int, timeout time.Duration,
+	failoverLogs func() (couchbase.FailoverLog, error)) *indexImporter {
+
+	return &indexImporter{
+		inst:         inst,
+		slices:       slices,
+		numVbuckets:  numVbuckets,
+		timeout:      timeout,
+		failoverLogs: failoverLogs,
+	}
+}
+
+// Import reads the export file from `r`. On error the slices are rolled
+// back to zero.
+func (im *indexImporter) Import(r io.Reader) (*ImportReport, error) {
+	t0 := time.Now()
+	br := bufio.NewReader(r)
+
+	header, err := readExportHeader(br)
+	if err != nil {
+		return nil, err
+	}
+	if err := im.validate(header); err != nil {
+		return nil, err
+	}
+	flogs, err := im.failoverLogs()
+	if err != nil {
+		return nil, err
+	}
+	if err := checkExportHistory(header.Timestamp, flogs); err != nil {
+		return nil, err
+	}
+	ts := header.Timestamp.Copy()
+	ts.Bucket = im.inst.Defn.Bucket
+
+	report := &ImportReport{
+		Bucket: im.inst.Defn.Bucket,
+		Index:  im.inst.Defn.Name,
+		InstId: im.inst.InstId,
+		Seqnos: ts.Seqnos,
+	}
+	if err = im.insertRecords(br, report); err == nil {
+		err = im.persist(ts)
+	}
+	if err != nil {
+		for _, slice := range im.slices {
+			if err := slice.RollbackToZero(); err != nil {
+				logging.Errorf("IndexImporter: %v rollback failed: %v", im.inst.InstId, err)
+			}
+		}
+		return nil, err
+	}
+
+	report.Elapsed = time.Since(t0).String()
+	return report, nil
+}
+
+func readExportHeader(br *bufio.Reader) (*IndexExportHeader, error) {
+	magic := make([]byte, len(indexExportMagic))
+	if _, err := io.ReadFull(br, magic); err != nil || string(magic) != indexExportMagic {
+		return nil, ErrExportBadFormat
+	}
+	n, err := binary.ReadUvarint(br)
+	if err != nil {
+		return nil, ErrExportBadFormat
+	}
+	data := make([]byte, n)
+	if _, err := io.ReadFull(br, data); err != nil {
+		return nil, ErrExportTruncated
+	}
+
+	header := &IndexExportHeader{}
+	if err := json.Unmarshal(data, header); err != nil {
+		return nil, ErrExportBadFormat
+	}
+	if header.Version != indexExportVersion {
+		return nil, ErrExportVersion
+	}
+	return header, nil
+}
+
+// validate checks that the exported entries are the ones this index would
+// hold. Name and bucket can differ, e.g. when cloning to another cluster.
+func (im *indexImporter) validate(header *IndexExportHeader) error {
+	src, dst := header.Definition, im.inst.Defn
+
+	mismatch := func(what string) error {
+		return fmt.Errorf("%v: %v", ErrExportMismatch, what)
+	}
+	switch {
+	case src.IsPrimary != dst.IsPrimary:
+		return mismatch("primary")
+	case src.ExprType != dst.ExprType:
+		return mismatch("expression type")
+	case !reflect.DeepEqual(src.SecExprs, dst.SecExprs):
+		return mismatch("secondary expressions")
+	case src.WhereExpr != dst.WhereExpr:
+		return mismatch("where clause")
+	case !reflect.DeepEqual(src.Desc, dst.Desc):
+		return mismatch("collation")
+	case !reflect.DeepEqual(src.Include, dst.Include):
+		return mismatch("include expressions")
+	case src.PartitionScheme != dst.PartitionScheme:
+		return mismatch("partition scheme")
+	case !reflect.DeepEqual(src.PartitionKeys, dst.PartitionKeys):
+		return mismatch("partition keys")
+	case !reflect.DeepEqual(src.DocKeyPrefixes, dst.DocKeyPrefixes):
+		return mismatch("document key prefixes")
+	case src.DocKeyPattern != dst.DocKeyPattern:
+		return mismatch("document key pattern")
+	case src.Collation != dst.Collation:
+		return mismatch("string collation")
+	case header.NumPartitions != im.inst.Pc.GetNumPartitions():
+		return mismatch("number of partitions")
+	case header.Timestamp == nil || len(header.Timestamp.Seqnos) != im.numVbuckets:
+		return mismatch("timestamp")
+	}
+	return nil
+}
+
+// checkExportHistory verifies that KV can resume the index from the export
+// timestamp. The vbuuid of every vbucket shall be in the failover log of
+// the bucket, with no failover after the seqno, otherwise documents the
+// export has were never seen, or were rolled back, by the bucket.
+func checkExportHistory(ts *common.TsVbuuid, flogs couchbase.FailoverLog) error {
+	for vbno, seqno := range ts.Seqnos {
+		if seqno == 0 {
+			continue
+		}
+		vbuuid := ts.Vbuuids[vbno]
+		flog, ok := flogs[uint16(vbno)]
+		if !ok {
+			return fmt.Errorf("%v: no failover log for vbucket %v", ErrImportHistory, vbno)
+		}
+
+		// failover log has the latest branch first
+		found := false
+		for i, entry := range flog {
+			if entry[0] != vbuuid {
+				continue
+			}
+			if i > 0 && seqno > flog[i-1][1] {
+				return fmt.Errorf("%v: vbucket %v seqno %v is past failover at seqno %v",
+					ErrImportHistory, vbno, seqno, flog[i-1][1])
+			}
+			found = true
+			break
+		}
+		if !found {
+			return fmt.Errorf("%v: vbucket %v vbuuid %v not in failover log",
+				ErrImportHistory, vbno, vbuuid)
+		}
+	}
+	return nil
+}
+
+func (im *indexImporter) insertRecords(br *bufio.Reader, report *ImportReport) error {
+	var docid, key []byte
+	var count uint64
+
+	readBytes := func(buf []byte) ([]byte, error) {
+		n, err := binary.ReadUvarint(br)
+		if err != nil {
+			return nil, ErrExportTruncated
+		}
+		if uint64(cap(buf)) < n {
+			buf = make([]byte, n)
+		}
+		buf = buf[:n]
+		if _, err := io.ReadFull(br, buf); err != nil {
+			return nil, ErrExportTruncated
+		}
+		return buf, nil
+	}
+
+	for {
+		partnId, err := binary.ReadUvarint(br)
+		if err != nil {
+			return ErrExportTruncated
+		}
+		if docid, err = readBytes(docid); err != nil {
+			return err
+		}
+		if len(docid) == 0 { // trailer
+			if total, err := binary.ReadUvarint(br); err != nil || total != count {
+				return ErrExportTruncated
+			}
+			return nil
+		}
+		if key, err = readBytes(key); err != nil {
+			return err
+		}
+		count++
+
+		slice, ok := im.slices[common.PartitionId(partnId)]
+		if !ok {
+			report.NumSkipped++
+			continue
+		}
+
+		meta := NewMutationMeta()
+		meta.bucket = im.inst.Defn.Bucket
+		// same vbucket as KV would map the document to
+		meta.vbucket = Vbucket(((crc32.ChecksumIEEE(docid) >> 16) & 0x7fff) % uint32(im.numVbuckets))
+		var k []byte
+		if len(key) > 0 {
+			k = append(k, key...)
+		}
+		err = slice.Insert(k, append([]byte(nil), docid...), meta)
+		meta.Free()
+		if err != nil {
+			return err
+		}
+		report.NumDocs++
+	}
+}
+
+// persist creates a committed snapshot at `ts` on every slice and waits
+// for the snapshot to be persisted, memdb persists in the background.
+func (im *indexImporter) persist(ts *common.TsVbuuid) error {
+	for _, slice := range im.slices {
+		info, err := slice.NewSnapshot(ts.Copy(), true)
+		if err != nil {
+			return err
+		}
+		snap, err := slice.OpenSnapshot(info)
+		if err != nil {
+			return err
+		}
+		snap.Close()
+	}
+
+	deadline := time.Now().Add(im.timeout)
+	for _, slice := range im.slices {
+		for {
+			infos, err := slice.GetSnapshots()
+			if err != nil {
+				return err
+			}
+			if NewSnapshotInfoContainer(infos).GetLatest() != nil {
+				break
+			}
+			if time.Now().After(deadline) {
+				return ErrImportTimeout
+			}
+			time.Sleep(100 * time.Millisecond)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,337 @@
+package indexer
+
+import (
+	"bytes"
+	"encoding/binary"
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/couchbase/indexing/secondary/common"
+	couchbase "github.com/couchbase/indexing/secondary/dcp"
+)
+
+func exportTestFile(t *testing.T, header *IndexExportHeader, records [][2]string, count uint64) []byte {
+	var buf bytes.Buffer
+	uvarint := func(v uint64) {
+		var scratch [binary.MaxVarintLen64]byte
+		buf.Write(scratch[:binary.PutUvarint(scratch[:], v)])
+	}
+
+	data, err := json.Marshal(header)
+	if err != nil {
+		t.Fatal(err)
+	}
+	buf.WriteString(indexExportMagic)
+	uvarint(uint64(len(data)))
+	buf.Write(data)
+	for _, rec := range records {
+		uvarint(1)
+		uvarint(uint64(len(rec[0])))
+		buf.WriteString(rec[0])
+		uvarint(uint64(len(rec[1])))
+		buf.WriteString(rec[1])
+	}
+	uvarint(0)
+	uvarint(0)
+	uvarint(count)
+	return buf.Bytes()
+}
+
+func exportTestHeader(inst common.IndexInst) *IndexExportHeader {
+	return &IndexExportHeader{
+		Version:       indexExportVersion,
+		Definition:    inst.Defn,
+		NumPartitions: 1,
+		Partitions:    []common.PartitionId{1},
+		Timestamp:     common.NewTsVbuuid("default", 4),
+	}
+}
+
+// every vbucket of the test bucket has had a single branch, vbuuid 1234.
+func exportTestFailoverLogs() (couchbase.FailoverLog, error) {
+	flogs := make(couchbase.FailoverLog)
+	for vbno := uint16(0); vbno < 4; vbno++ {
+		flogs[vbno] = [][2]uint64{{1234, 0}}
+	}
+	return flogs, nil
+}
+
+func TestIndexImportSkipsNonLocalPartitions(t *testing.T) {
+	inst := verifyTestInst(common.IndexDefn{SecExprs: []string{"`age`"}})
+	inst.Pc = common.NewKeyPartitionContainer(4, 1, common.SINGLE, common.CRC32)
+
+	file := exportTestFile(t, exportTestHeader(inst), [][2]string{{"doc1", `[20]`}, {"doc2", `[30]`}}, 2)
+	report, err := newIndexImporter(inst, nil, 4, time.Second, exportTestFailoverLogs).Import(bytes.NewReader(file))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if report.NumDocs != 0 || report.NumSkipped != 2 {
+		t.Errorf("expected 2 skipped docs, got %v %v", report.NumDocs, report.NumSkipped)
+	}
+
+	// trailer count not matching the records
+	file = exportTestFile(t, exportTestHeader(inst), [][2]string{{"doc1", `[20]`}}, 2)
+	if _, err := newIndexImporter(inst, nil, 4, time.Second, exportTestFailoverLogs).Import(bytes.NewReader(file)); err != ErrExportTruncated {
+		t.Errorf("expected %v, got %v", ErrExportTruncated, err)
+	}
+
+	if _, err := newIndexImporter(inst, nil, 4, time.Second, exportTestFailoverLogs).Import(bytes.NewReader([]byte("XXXX"))); err != ErrExportBadFormat {
+		t.Errorf("expected %v, got %v", ErrExportBadFormat, err)
+	}
+}
+
+func TestIndexImportValidate(t *testing.T) {
+	inst := verifyTestInst(common.IndexDefn{SecExprs: []string{"`age`"}})
+	inst.Pc = common.NewKeyPartitionContainer(4, 1, common.SINGLE, common.CRC32)
+	im := newIndexImporter(inst, nil, 4, time.Second, exportTestFailoverLogs)
+
+	header := exportTestHeader(inst)
+	header.Definition.Name = "clone"
+	if err := im.validate(header); err != nil {
+		t.Errorf("expected rename to be allowed, got %v", err)
+	}
+
+	header = exportTestHeader(inst)
+	header.Definition.SecExprs = []string{"`name`"}
+	if err := im.validate(header); err == nil {
+		t.Errorf("expected mismatch on secondary expressions")
+	}
+
+	header = exportTestHeader(inst)
+	header.Timestamp = common.NewTsVbuuid("default", 8)
+	if err := im.validate(header); err == nil {
+		t.Errorf("expected mismatch on timestamp")
+	}
+
+	header = exportTestHeader(inst)
+	header.Definition.DocKeyPrefixes = []string{"user::"}
+	if err := im.validate(header); err == nil {
+		t.Errorf("expected mismatch on document key prefixes")
+	}
+
+	header = exportTestHeader(inst)
+	header.Definition.Collation = "unicode"
+	if err := im.validate(header); err == nil {
+		t.Errorf("expected mismatch on string collation")
+	}
+}
+
+func TestIndexImportHistory(t *testing.T) {
+	// latest branch first: vbuuid 300 from seqno 200, 200 from seqno 100.
+	flogs := couchbase.FailoverLog{0: {{300, 200}, {200, 100}, {100, 0}}}
+
+	testcases := []struct {
+		vbuuid uint64
+		seqno  uint64
+		ok     bool
+	}{
+		{0, 0, true},
+		{300, 500, true},
+		{200, 150, true},
+		{200, 200, true},
+		// documents past seqno 200 of branch 200 were rolled back.
+		{200, 250, false},
+		// export is not from this bucket.
+		{999, 50, false},
+	}
+
+	for _, tc := range testcases {
+		ts := common.NewTsVbuuid("default", 1)
+		ts.Vbuuids[0], ts.Seqnos[0] = tc.vbuuid, tc.seqno
+		if err := checkExportHistory(ts, flogs); (err == nil) != tc.ok {
+			t.Errorf("vbuuid %v seqno %v expected ok %v, got %v", tc.vbuuid, tc.seqno, tc.ok, err)
+		}
+	}
+
+	ts := common.NewTsVbuuid("default", 2)
+	ts.Vbuuids[1], ts.Seqnos[1] = 300, 10
+	if err := checkExportHistory(ts, flogs); err == nil {
+		t.Errorf("expected error for vbucket without failover log")
+	}
+}
+
+// exportTestSlice returns a memdb slice for `inst` in a new directory
+// under `dir`.
+func exportTestSlice(t *testing.T, inst common.IndexInst, dir string) *memdbSlice {
+	stats := &IndexStats{}
+	stats.Init()
+	cfg := common.SystemConfig.SectionConfig("indexer.", true)
+	cfg.SetValue("numSliceWriters", 2)
+	path, err := ioutil.TempDir(dir, "slice")
+	if err != nil {
+		t.Fatal(err)
+	}
+	slice, err := NewMemDBSlice(path, 0, inst.Defn, inst.InstId,
+		inst.Defn.IsPrimary, true, cfg, stats)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return slice
+}
+
+// exportTestEntries returns the entries of a new snapshot of the slice.
+func exportTestEntries(t *testing.T, slice *memdbSlice, ts *common.TsVbuuid) (Snapshot, [][]byte) {
+	info, err := slice.NewSnapshot(ts, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	snap, err := slice.OpenSnapshot(info)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var entries [][]byte
+	err = snap.All(slice.GetReaderContext(), func(entry []byte) error {
+		entries = append(entries, append([]byte(nil), entry...))
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return snap, entries
+}
+
+func TestIndexExportImport(t *testing.T) {
+	dir, err := ioutil.TempDir("", "index_export")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	testcases := []struct {
+		name string
+		defn common.IndexDefn
+		docs map[string]string
+	}{
+		{
+			name: "primary",
+			defn: common.IndexDefn{IsPrimary: true},
+			docs: map[string]string{"doc1": "", "doc2": "", "doc3": ""},
+		},
+		{
+			name: "plain",
+			defn: common.IndexDefn{SecExprs: []string{"`age`", "`name`"}},
+			docs: map[string]string{
+				"doc1": `[20,"alice"]`, "doc2": `[30,"bob"]`, "doc3": `[20,"carol"]`,
+			},
+		},
+		{
+			name: "array",
+			defn: common.IndexDefn{
+				SecExprs:     []string{"`age`", "ALL ARRAY `t` FOR `t` IN `tags` END"},
+				IsArrayIndex: true,
+			},
+			docs: map[string]string{
+				"doc1": `[20,["a","b","a"]]`, "doc2": `[30,["c"]]`, "doc3": `[40,["b","c"]]`,
+			},
+		},
+		{
+			name: "desc",
+			defn: common.IndexDefn{SecExprs: []string{"`age`", "`name`"}, Desc: []bool{false, true}},
+			docs: map[string]string{
+				"doc1": `[20,"alice"]`, "doc2": `[30,"bob"]`, "doc3": `[20,"carol"]`,
+			},
+		},
+		{
+			name: "include",
+			defn: common.IndexDefn{SecExprs: []string{"`age`"}, Include: []string{"`city`"}},
+			docs: map[string]string{
+				"doc1": `[20,"paris"]`, "doc2": `[30,"rome"]`, "doc3": `[20,null]`,
+			},
+		},
+	}
+
+	ts := common.NewTsVbuuid("default", 4)
+	for vbno := range ts.Seqnos {
+		ts.Seqnos[vbno], ts.Vbuuids[vbno] = 100, 1234
+	}
+
+	for _, tc := range testcases {
+		inst := verifyTestInst(tc.defn)
+		inst.Pc = common.NewKeyPartitionContainer(4, 1, common.SINGLE, common.CRC32)
+
+		src := exportTestSlice(t, inst, dir)
+		for docid, key := range tc.docs {
+			var code []byte
+			if key != "" {
+				if code, err = jsonEncoder.Encode([]byte(key), make([]byte, 0, 1024)); err != nil {
+					t.Fatal(err)
+				}
+			}
+			meta := NewMutationMeta()
+			src.Insert(code, []byte(docid), meta)
+			meta.Free()
+		}
+		srcSnap, expected := exportTestEntries(t, src, ts)
+		if len(expected) == 0 {
+			t.Fatalf("%v: expected entries in source slice", tc.name)
+		}
+
+		is := &indexSnapshot{instId: inst.InstId, ts: ts,
+			partns: map[common.PartitionId]PartitionSnapshot{
+				0: &partitionSnapshot{id: 0, slices: map[SliceId]SliceSnapshot{
+					0: &sliceSnapshot{id: 0, snap: srcSnap}}},
+			}}
+		ctxs := map[common.PartitionId]IndexReaderContext{0: src.GetReaderContext()}
+		var file bytes.Buffer
+		exporter, err := newIndexExporter(inst, ctxs, &file, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		count, err := exporter.Export(is)
+		if err != nil {
+			t.Fatalf("%v: export failed: %v", tc.name, err)
+		}
+		if count != uint64(len(tc.docs)) {
+			t.Errorf("%v: expected %v exported docs, got %v", tc.name, len(tc.docs), count)
+		}
+
+		// import into a clone of the index, as on another cluster.
+		clone := inst
+		clone.InstId, clone.Defn.Name = 2, "clone"
+		dst := exportTestSlice(t, clone, dir)
+		slices := map[common.PartitionId]Slice{0: dst}
+		report, err := newIndexImporter(clone, slices, 4, 10*time.Second,
+			exportTestFailoverLogs).Import(&file)
+		if err != nil {
+			t.Fatalf("%v: import failed: %v", tc.name, err)
+		}
+		if report.NumDocs != uint64(len(tc.docs)) || report.NumSkipped != 0 {
+			t.Errorf("%v: expected %v imported docs, got %v %v",
+				tc.name, len(tc.docs), report.NumDocs, report.NumSkipped)
+		}
+
+		infos, err := dst.GetSnapshots()
+		if err != nil || len(infos) == 0 {
+			t.Fatalf("%v: expected a persisted snapshot, got %v %v", tc.name, infos, err)
+		}
+		if !reflect.DeepEqual(infos[0].Timestamp().Seqnos, ts.Seqnos) {
+			t.Errorf("%v: expected snapshot at %v, got %v", tc.name, ts.Seqnos, infos[0].Timestamp().Seqnos)
+		}
+
+		dstSnap, entries := exportTestEntries(t, dst, nil)
+		if !reflect.DeepEqual(entries, expected) {
+			t.Errorf("%v: imported entries differ\n%q\n%q", tc.name, entries, expected)
+		}
+
+		srcSnap.Close()
+		dstSnap.Close()
+		src.Close()
+		dst.Close()
+	}
+
+	// export taken on a bucket with a different history is rejected.
+	inst := verifyTestInst(common.IndexDefn{SecExprs: []string{"`age`"}})
+	inst.Pc = common.NewKeyPartitionContainer(4, 1, common.SINGLE, common.CRC32)
+	header := exportTestHeader(inst)
+	header.Timestamp.Seqnos[2], header.Timestamp.Vbuuids[2] = 100, 999
+	file := exportTestFile(t, header, nil, 0)
+	_, err = newIndexImporter(inst, nil, 4, time.Second, exportTestFailoverLogs).Import(bytes.NewReader(file))
+	if err == nil {
+		t.Errorf("expected import to fail on vbuuid not in failover log")
+	}
+}
@@ -0,0 +1,420 @@
+// Copyright (c) 2014 Couchbase, Inc.
+// Licensed under the Apache License, Version 2.0 (the "License"); you may not use this file
+// except in compliance with the License. You may obtain a copy of the License at
+//   http://www.apache.org/licenses/LICENSE-2.0
+// Unless required by applicable law or agreed to in writing, software distributed under the
+// License is distributed on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND,
+// either express or implied. See the License for the specific language governing permissions
+// and limitations under the License.
+
+package indexer
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"time"
+
+	"github.com/couchbase/indexing/secondary/common"
+	"github.com/couchbase/indexing/secondary/common/queryutil"
+	couchbase "github.com/couchbase/indexing/secondary/dcp"
+	mcd "github.com/couchbase/indexing/secondary/dcp/transport"
+	mc "github.com/couchbase/indexing/secondary/dcp/transport/client"
+	"github.com/couchbase/indexing/secondary/logging"
+	protobuf "github.com/couchbase/indexing/secondary/protobuf/projector"
+	"github.com/golang/protobuf/proto"
+)
+
+var (
+	ErrVerifyFeedClosed = errors.New("DCP feed closed during index verification")
+	ErrVerifyTimeout    = errors.New("Timeout during index verification")
+	ErrVerifyRollback   = errors.New("Index snapshot has diverged from KV (rollback)")
+)
+
+const defaultVerifyReportLimit = 100
+
+// VerifyReport is the outcome of comparing an index snapshot with the
+// documents of its bucket, replayed from KV as of the snapshot timestamp.
+// Docid lists are capped at `Limit` entries, counts are always complete.
+type VerifyReport struct {
+	Bucket     string               `json:"bucket"`
+	Index      string               `json:"index"`
+	InstId     common.IndexInstId   `json:"instId"`
+	Partitions []common.PartitionId `json:"partitions"`
+	Seqnos     []uint64             `json:"seqnos"`
+
+	NumDocs       uint64 `json:"numDocs"`
+	NumIndexed    uint64 `json:"numIndexed"`
+	NumMissing    uint64 `json:"numMissing"`
+	NumExtra      uint64 `json:"numExtra"`
+	NumMismatched uint64 `json:"numMismatched"`
+
+	Limit      int      `json:"limit"`
+	Missing    []string `json:"missing"`
+	Extra      []string `json:"extra"`
+	Mismatched []string `json:"mismatched"`
+
+	Elapsed string `json:"elapsed"`
+}
+
+// IsConsistent returns true if index and KV agree on every document.
+func (r *VerifyReport) IsConsistent() bool {
+	return r.NumMissing == 0 && r.NumExtra == 0 && r.NumMismatched == 0
+}
+
+// verifyDocSource replays the documents of a bucket as of timestamp `ts`.
+// Mutations for a given docid must be delivered in seqno order.
+type verifyDocSource interface {
+	Replay(ts *common.TsVbuuid, callb func(m *mc.DcpEvent) error) error
+}
+
+// indexVerifier checks the entries of an index snapshot against the
+// secondary keys computed by the projector's evaluator for the same
+// documents.
+type indexVerifier struct {
+	inst      common.IndexInst
+	evaluator *protobuf.IndexEvaluator
+	ctxs      map[common.PartitionId]IndexReaderContext
+	limit     int
+
+	isArrayDistinct   bool
+	arrayExprPosition int
+
+	encodeBuf []byte
+	arrayBuf  []byte
+}
+
+// newIndexVerifier returns a verifier for the local partitions of `inst`,
+// `ctxs` supplies the reader context of each such partition.
+func newIndexVerifier(inst common.IndexInst,
+	ctxs map[common.PartitionId]IndexReaderContext, limit int) (*indexVerifier, error) {
+
+	var err error
+
+	protoInst := &protobuf.IndexInst{
+		InstId:     proto.Uint64(uint64(inst.InstId)),
+		Definition: convertIndexDefnToProtobuf(inst.Defn),
+	}
+	v := &indexVerifier{
+		inst:      inst,
+		ctxs:      ctxs,
+		limit:     limit,
+		encodeBuf: make([]byte, 0, maxIndexEntrySize),
+		arrayBuf:  make([]byte, 0, maxArrayIndexEntrySize),
+	}
+	if v.limit <= 0 {
+		v.limit = defaultVerifyReportLimit
+	}
+
+	v.evaluator, err = protobuf.NewIndexEvaluator(protoInst, protobuf.FeedVersion_watson)
+	if err != nil {
+		return nil, err
+	}
+	if inst.Defn.IsArrayIndex {
+		_, v.isArrayDistinct, v.arrayExprPosition, err =
+			queryutil.GetArrayExpressionPosition(inst.Defn.SecExprs)
+		if err != nil {
+			return nil, err
+		}
+	}
+	return v, nil
+}
+
+// Verify compares snapshot `is` with the documents replayed by `src`.
+func (v *indexVerifier) Verify(
+	is IndexSnapshot, src verifyDocSource) (*VerifyReport, error) {
+
+	t0 := time.Now()
+	ts := is.Timestamp()
+	if ts == nil {
+		return nil, ErrSnapNotAvailable
+	}
+
+	report := &VerifyReport{
+		Bucket: v.inst.Defn.Bucket,
+		Index:  v.inst.Defn.Name,
+		InstId: v.inst.InstId,
+		Seqnos: ts.Seqnos,
+		Limit:  v.limit,
+	}
+	for partnId := range v.ctxs {
+		report.Partitions = append(report.Partitions, partnId)
+	}
+
+	indexed, err := v.indexEntries(is)
+	if err != nil {
+		return nil, err
+	}
+	report.NumIndexed = uint64(len(indexed))
+
+	expected := make(map[string][]string)
+	err = src.Replay(ts, func(m *mc.DcpEvent) error {
+		entries, ok, err := v.expectedEntries(m)
+		if err != nil {
+			return err
+		} else if ok {
+			expected[string(m.Key)] = entries
+		} else {
+			delete(expected, string(m.Key))
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	for _, entries := range expected {
+		if len(entries) > 0 {
+			report.NumDocs++
+		}
+	}
+	v.diff(expected, indexed, report)
+
+	report.Elapsed = time.Since(t0).String()
+	return report, nil
+}
+
+// indexEntries returns all entries in the snapshot grouped by docid.
+func (v *indexVerifier) indexEntries(is IndexSnapshot) (map[string][]string, error) {
+	var docid []byte
+	var err error
+
+	entries := make(map[string][]string)
+	callb := func(entry []byte) error {
+		if v.inst.Defn.IsPrimary {
+			e := primaryIndexEntry(entry)
+			docid, err = e.ReadDocId(docid[:0])
+		} else {
+			docid, err = secondaryIndexEntry(entry).ReadDocId(docid[:0])
+		}
+		if err != nil {
+			return err
+		}
+		key := string(docid)
+		entries[key] = append(entries[key], string(entry))
+		return nil
+	}
+
+	for partnId, ps := range is.Partitions() {
+		ctx, ok := v.ctxs[partnId]
+		if !ok {
+			continue
+		}
+		for _, ss := range ps.Slices() {
+			ctx.Init()
+			err := ss.Snapshot().All(ctx, callb)
+			ctx.Done()
+			if err != nil {
+				return nil, err
+			}
+		}
+	}
+	return entries, nil
+}
+
+// expectedEntries returns the storage entries the slice would hold for
+// the document in `m`. `ok` is false if the document does not belong to
+// a partition verified by this node.
+func (v *indexVerifier) expectedEntries(m *mc.DcpEvent) (entries []string, ok bool, err error) {
+	var pkey, key, newBuf []byte
+
+	if m.Opcode != mcd.DCP_MUTATION {
+		return nil, true, nil // deleted or expired
+	}
+
+	pkey, key, newBuf, err = v.evaluator.ProjectKey(m, v.encodeBuf)
+	if err != nil {
+		fmsg := "IndexVerifier: %v docid %s evaluation failed: %v"
+		logging.Errorf(fmsg, v.inst.InstId, logging.TagStrUD(m.Key), err)
+		return nil, true, nil // projector skips such documents
+	}
+	if newBuf != nil {
+		v.encodeBuf = newBuf
+	}
+
+	if common.IsPartitioned(v.inst.Defn.PartitionScheme) {
+		numPartitions := v.inst.Pc.GetNumPartitions()
+		partnId := common.HashKeyPartition(pkey, numPartitions, v.inst.Defn.HashScheme)
+		if _, local := v.ctxs[partnId]; !local {
+			return nil, false, nil
+		}
+	}
+
+	if v.inst.Defn.IsPrimary {
+		entry, err := NewPrimaryIndexEntry(m.Key)
+		if err != nil {
+			return nil, true, nil
+		}
+		return []string{string(entry)}, true, nil
+	}
+
+	if len(key) == 0 {
+		return nil, true, nil
+	}
+
+	if !v.inst.Defn.IsArrayIndex {
+		v.encodeBuf = resizeEncodeBuf(v.encodeBuf, len(key), allowLargeKeys)
+		entry, err := newDefnIndexEntry(key, m.Key, &v.inst.Defn, v.encodeBuf[:0])
+		if err != nil {
+			return nil, true, nil // slice skips keys it cannot store
+		}
+		return []string{string(entry)}, true, nil
+	}
+
+	v.arrayBuf = resizeArrayBuf(v.arrayBuf, len(key))
+	items, counts, bufLen, err := ArrayIndexItems(key, v.arrayExprPosition,
+		v.arrayBuf[:0], v.isArrayDistinct, !allowLargeKeys)
+	v.arrayBuf = resizeArrayBuf(v.arrayBuf, bufLen)
+	if err != nil {
+		return nil, true, nil
+	}
+	entries = make([]string, 0, len(items))
+	for i, item := range items {
+		v.encodeBuf = resizeEncodeBuf(v.encodeBuf, len(item), allowLargeKeys)
+		entry, err := NewSecondaryIndexEntry(item, m.Key, false, counts[i],
+			v.inst.Defn.Desc, v.encodeBuf[:0])
+		if err != nil {
+			return nil, true, nil
+		}
+		entries = append(entries, string(entry))
+	}
+	return entries, true, nil
+}
+
+// diff classifies every docid as missing (expected but not indexed),
+// extra (indexed but not expected) or mismatched (different entries).
+func (v *indexVerifier) diff(
+	expected, indexed map[string][]string, report *VerifyReport) {
+
+	add := func(list []string, docid string) []string {
+		if len(list) < v.limit {
+			list = append(list, docid)
+		}
+		return list
+	}
+
+	for docid, want := range expected {
+		have, ok := indexed[docid]
+		if !ok {
+			if len(want) > 0 {
+				report.NumMissing++
+				report.Missing = add(report.Missing, docid)
+			}
+			continue
+		}
+		delete(indexed, docid)
+		if len(want) == 0 {
+			report.NumExtra++
+			report.Extra = add(report.Extra, docid)
+		} else if !equalEntries(want, have) {
+			report.NumMismatched++
+			report.Mismatched = add(report.Mismatched, docid)
+		}
+	}
+	for docid := range indexed {
+		report.NumExtra++
+		report.Extra = add(report.Extra, docid)
+	}
+
+	sort.Strings(report.Missing)
+	sort.Strings(report.Extra)
+	sort.Strings(report.Mismatched)
+}
+
+func equalEntries(a, b []string) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	sort.Strings(a)
+	sort.Strings(b)
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
+
+// dcpBackfill replays documents by streaming every vbucket from seqno 0
+// up to the seqno recorded in the snapshot timestamp. Documents mutated
+// after the snapshot are not part of the backfill and will be reported
+// as extra, hence verification is best done on a quiesced bucket.
+type dcpBackfill struct {
+	cluster string
+	timeout time.Duration
+}
+
+func (d *dcpBackfill) Replay(
+	ts *common.TsVbuuid, callb func(m *mc.DcpEvent) error) error {
+
+	bucket, err := common.ConnectBucket(d.cluster, "default", ts.Bucket)
+	if err != nil {
+		return err
+	}
+	defer bucket.Close()
+
+	uuid, err := common.NewUUID()
+	if err != nil {
+		return err
+	}
+	name := couchbase.NewDcpFeedName(
+		fmt.Sprintf("verify-%s-%v", ts.Bucket, uuid.Uint64()))
+
+	config := common.SystemConfig
+	dcpConfig := map[string]interface{}{
+		"genChanSize":    config["projector.dcp.genChanSize"].Int(),
+		"dataChanSize":   config["projector.dcp.dataChanSize"].Int(),
+		"numConnections": config["projector.dcp.numConnections"].Int(),
+		"latencyTick":    config["projector.dcp.latencyTick"].Int(),
+		"activeVbOnly":   true,
+	}
+	opaque := uint16(0xABCD)
+	feed, err := bucket.StartDcpFeedOver(name, uint32(0), uint32(0), nil, opaque, dcpConfig)
+	if err != nil {
+		return err
+	}
+	defer feed.Close()
+
+	pending := 0
+	for vbno, seqno := range ts.Seqnos {
+		if seqno == 0 {
+			continue
+		}
+		err := feed.DcpRequestStream(uint16(vbno), opaque, uint32(0),
+			ts.Vbuuids[vbno], 0, seqno, 0, 0)
+		if err != nil {
+			return err
+		}
+		pending++
+	}
+
+	timeout := time.After(d.timeout)
+	for pending > 0 {
+		select {
+		case m, ok := <-feed.C:
+			if !ok {
+				return ErrVerifyFeedClosed
+			}
+			switch m.Opcode {
+			case mcd.DCP_STREAMREQ:
+				if m.Status == mcd.ROLLBACK {
+					return ErrVerifyRollback
+				} else if m.Status != mcd.SUCCESS {
+					return fmt.Errorf("StreamRequest for vbucket %v: %v", m.VBucket, m.Status)
+				}
+
+			case mcd.DCP_STREAMEND:
+				pending--
+
+			case mcd.DCP_MUTATION, mcd.DCP_DELETION, mcd.DCP_EXPIRATION:
+				if err := callb(m); err != nil {
+					return err
+				}
+			}
+
+		case <-timeout:
+			return ErrVerifyTimeout
+		}
+	}
+	return nil
+}
@@ -0,0 +1,92 @@
+package indexer
+
+import (
+	"testing"
+
+	"github.com/couchbase/indexing/secondary/common"
+	mcd "github.com/couchbase/indexing/secondary/dcp/transport"
+	mc "github.com/couchbase/indexing/secondary/dcp/transport/client"
+)
+
+func verifyTestEvent(docid, doc string) *mc.DcpEvent {
+	m := &mc.DcpEvent{Opcode: mcd.DCP_MUTATION, Key: []byte(docid), Value: []byte(doc)}
+	m.TreatAsJSON()
+	return m
+}
+
+func verifyTestInst(defn common.IndexDefn) common.IndexInst {
+	defn.Bucket, defn.Name, defn.ExprType = "default", "idx", common.N1QL
+	defn.PartitionScheme = common.SINGLE
+	return common.IndexInst{InstId: 1, Defn: defn, State: common.INDEX_STATE_ACTIVE}
+}
+
+func TestIndexVerifierExpectedEntries(t *testing.T) {
+	inst := verifyTestInst(common.IndexDefn{SecExprs: []string{"`age`"}, WhereExpr: "`age` > 10"})
+	ctxs := map[common.PartitionId]IndexReaderContext{0: &cursorCtx{}}
+	v, err := newIndexVerifier(inst, ctxs, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	entries, ok, err := v.expectedEntries(verifyTestEvent("doc1", `{"age": 20}`))
+	if err != nil || !ok || len(entries) != 1 {
+		t.Fatalf("expected one entry, got %v %v %v", entries, ok, err)
+	}
+	docid, _ := secondaryIndexEntry(entries[0]).ReadDocId(nil)
+	if string(docid) != "doc1" {
+		t.Errorf("expected docid doc1, got %s", docid)
+	}
+
+	// document not satisfying the where clause
+	entries, ok, err = v.expectedEntries(verifyTestEvent("doc2", `{"age": 5}`))
+	if err != nil || !ok || len(entries) != 0 {
+		t.Errorf("expected no entry, got %v %v %v", entries, ok, err)
+	}
+
+	// deleted document
+	m := verifyTestEvent("doc1", "")
+	m.Opcode = mcd.DCP_DELETION
+	entries, ok, err = v.expectedEntries(m)
+	if err != nil || !ok || len(entries) != 0 {
+		t.Errorf("expected no entry for deletion, got %v %v %v", entries, ok, err)
+	}
+}
+
+func TestIndexVerifierDiff(t *testing.T) {
+	inst := verifyTestInst(common.IndexDefn{SecExprs: []string{"`age`"}})
+	ctxs := map[common.PartitionId]IndexReaderContext{0: &cursorCtx{}}
+	v, err := newIndexVerifier(inst, ctxs, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expected := map[string][]string{
+		"ok":       []string{"a", "b"},
+		"missing1": []string{"a"},
+		"missing2": []string{"a"},
+		"mismatch": []string{"a"},
+		"deleted":  nil,
+	}
+	indexed := map[string][]string{
+		"ok":       []string{"b", "a"},
+		"mismatch": []string{"b"},
+		"deleted":  []string{"a"},
+		"stale":    []string{"a"},
+	}
+
+	report := &VerifyReport{}
+	v.diff(expected, indexed, report)
+
+	if report.NumMissing != 2 || len(report.Missing) != 1 {
+		t.Errorf("expected 2 missing (1 listed), got %v %v", report.NumMissing, report.Missing)
+	}
+	if report.NumExtra != 2 || len(report.Extra) != 1 {
+		t.Errorf("expected 2 extra (1 listed), got %v %v", report.NumExtra, report.Extra)
+	}
+	if report.NumMismatched != 1 || report.Mismatched[0] != "mismatch" {
+		t.Errorf("expected mismatch, got %v %v", report.NumMismatched, report.Mismatched)
+	}
+	if report.IsConsistent() {
+		t.Errorf("expected inconsistent report")
+	}
+}
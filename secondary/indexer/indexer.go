@@ -31,6 +31,7 @@ import (
 
 	"github.com/couchbase/cbauth"
 	"github.com/couchbase/indexing/secondary/common"
+	couchbase "github.com/couchbase/indexing/secondary/dcp"
 	"github.com/couchbase/indexing/secondary/fdb"
 	"github.com/couchbase/indexing/secondary/logging"
 	mc "github.com/couchbase/indexing/secondary/manager/common"
@@ -151,6 +152,9 @@ type indexer struct {
 	mergePartitionList []mergeSpec
 	prunePartitionList []pruneSpec
 
+	//index instances being seeded from an export file
+	importInProgress map[common.IndexInstId]bool
+
 	bootstrapStorageMode common.StorageMode
 
 	testServRunning bool
@@ -214,6 +218,7 @@ func NewIndexer(config common.Config) (Indexer, Message) {
 		bucketBuildTs:                make(map[string]Timestamp),
 		bucketRollbackTimes:          make(map[string]int64),
 		bucketCreateClientChMap:      make(map[string]MsgChannel),
+		importInProgress:             make(map[common.IndexInstId]bool),
 	}
 
 	logging.Infof("Indexer::NewIndexer Status Warmup")
@@ -961,6 +966,12 @@ func (idx *indexer) handleWorkerMsgs(msg Message) {
 	case INDEXER_CANCEL_MERGE_PARTITION:
 		idx.handleCancelMergePartition(msg)
 
+	case INDEXER_IMPORT_INDEX:
+		idx.handleImportIndex(msg)
+
+	case INDEXER_IMPORT_INDEX_DONE:
+		idx.handleImportIndexDone(msg)
+
 	default:
 		logging.Fatalf("Indexer::handleWorkerMsgs Unknown Message %+v", msg)
 		common.CrashOnError(errors.New("Unknown Msg On Worker Channel"))
@@ -1315,6 +1326,88 @@ func (idx *indexer) handleCreateIndex(msg Message) {
 
 }
 
+//handleImportIndex seeds an index, created but not yet built, from an
+//export file. The import runs in the background, build and drop of the
+//index are rejected till it is done.
+func (idx *indexer) handleImportIndex(msg Message) {
+
+	bucket := msg.(*MsgImportIndex).GetBucket()
+	name := msg.(*MsgImportIndex).GetIndexName()
+	reader := msg.(*MsgImportIndex).GetReader()
+	respch := msg.(*MsgImportIndex).GetRespCh()
+
+	var inst *common.IndexInst
+	for _, idxInst := range idx.indexInstMap {
+		if idxInst.Defn.Bucket == bucket && idxInst.Defn.Name == name &&
+			idxInst.State != common.INDEX_STATE_DELETED {
+			idxInst := idxInst
+			inst = &idxInst
+			break
+		}
+	}
+	if inst == nil {
+		respch <- common.ErrIndexNotFound
+		return
+	}
+	if idx.importInProgress[inst.InstId] {
+		respch <- ErrImportInProgress
+		return
+	}
+	if inst.State != common.INDEX_STATE_CREATED && inst.State != common.INDEX_STATE_READY {
+		respch <- ErrImportInvalidState
+		return
+	}
+
+	slices := make(map[common.PartitionId]Slice)
+	for partnId, partnInst := range idx.indexPartnMap[inst.InstId] {
+		slices[partnId] = partnInst.Sc.GetSliceById(0)
+	}
+
+	cluster := idx.config["clusterAddr"].String()
+	numVbuckets := idx.config["numVbuckets"].Int()
+	timeout := time.Duration(idx.config["settings.import_timeout"].Int()) * time.Millisecond
+	failoverLogs := func() (couchbase.FailoverLog, error) {
+		return GetFailoverLogs(cluster, DEFAULT_POOL, bucket, numVbuckets)
+	}
+	importer := newIndexImporter(*inst, slices, numVbuckets, timeout, failoverLogs)
+
+	idx.importInProgress[inst.InstId] = true
+	logging.Infof("Indexer::handleImportIndex %v:%v Inst %v Started", bucket, name, inst.InstId)
+
+	go func(instId common.IndexInstId) {
+		report, err := importer.Import(reader)
+		idx.internalRecvCh <- &MsgImportIndex{mType: INDEXER_IMPORT_INDEX_DONE,
+			bucket: bucket,
+			name:   name,
+			instId: instId,
+			report: report,
+			err:    err,
+			respch: respch}
+	}(inst.InstId)
+}
+
+func (idx *indexer) handleImportIndexDone(msg Message) {
+
+	importMsg := msg.(*MsgImportIndex)
+	instId := importMsg.GetInstId()
+	report := importMsg.GetReport()
+	err := importMsg.GetError()
+	respch := importMsg.GetRespCh()
+
+	delete(idx.importInProgress, instId)
+
+	if err != nil {
+		logging.Errorf("Indexer::handleImportIndex %v:%v Inst %v Failed %v",
+			importMsg.GetBucket(), importMsg.GetIndexName(), instId, err)
+		respch <- err
+		return
+	}
+
+	logging.Infof("Indexer::handleImportIndex %v:%v Inst %v Done. Docs %v Skipped %v",
+		importMsg.GetBucket(), importMsg.GetIndexName(), instId, report.NumDocs, report.NumSkipped)
+	respch <- report
+}
+
 func (idx *indexer) handleCancelMergePartition(msg Message) {
 
 	indexStateMap := msg.(*MsgCancelMergePartition).GetIndexStateMap()
@@ -2180,8 +2273,16 @@ func (idx *indexer) handleBuildIndex(msg Message) {
 			common.CrashOnError(err)
 		}
 
+		//index seeded from an imported snapshot catches up from the
+		//snapshot timestamp, otherwise the stream starts from zero
+		restartTs := idx.makeRestartTsForInsts(instIdList)[bucket]
+		if restartTs != nil {
+			logging.Infof("Indexer::handleBuildIndex Bucket %v Index %v Build "+
+				"From Imported Snapshot", bucket, instIdList)
+		}
+
 		//send Stream Update to workers
-		idx.sendStreamUpdateForBuildIndex(instIdList, buildStream, bucket, buildTs, clientCh)
+		idx.sendStreamUpdateForBuildIndex(instIdList, buildStream, bucket, buildTs, restartTs, clientCh)
 
 		idx.stateLock.Lock()
 		if _, ok := idx.streamBucketStatus[buildStream]; !ok {
@@ -2259,6 +2360,21 @@ func (idx *indexer) handleDropIndex(msg Message) {
 		return
 	}
 
+	//slices are being written by import, drop can be retried once it is done
+	if idx.importInProgress[indexInstId] {
+		errStr := fmt.Sprintf("Indexer Cannot Process Drop Index - Index Import In Progress")
+		logging.Errorf("Indexer::handleDropIndex %v", errStr)
+
+		if clientCh != nil {
+			clientCh <- &MsgError{
+				err: Error{code: ERROR_INDEXER_INTERNAL_ERROR,
+					severity: FATAL,
+					cause:    errors.New(errStr),
+					category: INDEXER}}
+		}
+		return
+	}
+
 	if idx.rebalanceRunning || idx.rebalanceToken != nil {
 
 		reqCtx := msg.(*MsgDropIndex).GetRequestCtx()
@@ -2912,7 +3028,8 @@ func (idx *indexer) Shutdown() Message {
 }
 
 func (idx *indexer) sendStreamUpdateForBuildIndex(instIdList []common.IndexInstId,
-	buildStream common.StreamId, bucket string, buildTs Timestamp, clientCh MsgChannel) bool {
+	buildStream common.StreamId, bucket string, buildTs Timestamp,
+	restartTs *common.TsVbuuid, clientCh MsgChannel) bool {
 
 	var cmd Message
 	var indexList []common.IndexInst
@@ -2931,7 +3048,7 @@ func (idx *indexer) sendStreamUpdateForBuildIndex(instIdList []common.IndexInstI
 		indexList:    indexList,
 		buildTs:      buildTs,
 		respCh:       respCh,
-		restartTs:    nil,
+		restartTs:    restartTs,
 		rollbackTime: idx.bucketRollbackTimes[bucket]}
 
 	//send stream update to timekeeper
@@ -3005,7 +3122,19 @@ func (idx *indexer) sendStreamUpdateForBuildIndex(instIdList []common.IndexInstI
 					}
 
 				case INDEXER_ROLLBACK:
-					//an initial build request should never receive rollback message
+					//an initial build request should never receive rollback message,
+					//unless the index is seeded from a snapshot KV cannot resume from.
+					//Rollback the index storage and restart the stream in that case.
+					if restartTs != nil {
+						logging.Infof("Indexer::sendStreamUpdateForBuildIndex Rollback from "+
+							"Projector For Stream %v Bucket %v", buildStream, bucket)
+						rollbackTs := resp.(*MsgRollback).GetRollbackTs()
+						idx.internalRecvCh <- &MsgRecovery{mType: INDEXER_INIT_PREP_RECOVERY,
+							streamId:  buildStream,
+							bucket:    bucket,
+							restartTs: rollbackTs}
+						break retryloop
+					}
 					logging.Errorf("Indexer::sendStreamUpdateForBuildIndex Unexpected Rollback from "+
 						"Projector during Initial Stream Request %v", resp)
 					common.CrashOnError(ErrKVRollbackForInitRequest)
@@ -4917,12 +5046,31 @@ func (idx *indexer) startStreams() bool {
 
 func (idx *indexer) makeRestartTs(streamId common.StreamId) map[string]*common.TsVbuuid {
 
+	var instIdList []common.IndexInstId
+	for idxInstId, _ := range idx.indexPartnMap {
+		if idx.indexInstMap[idxInstId].Stream == streamId {
+			instIdList = append(instIdList, idxInstId)
+		}
+	}
+	return idx.makeRestartTsForInsts(instIdList)
+}
+
+//makeRestartTsForInsts computes the restart timestamp of each bucket
+//from the persisted snapshots of the given index instances
+func (idx *indexer) makeRestartTsForInsts(instIdList []common.IndexInstId) map[string]*common.TsVbuuid {
+
 	restartTs := make(map[string]*common.TsVbuuid)
 
-	for idxInstId, partnMap := range idx.indexPartnMap {
+	//if any index of a bucket doesn't have a persisted snapshot, the
+	//bucket needs to be streamed from the beginning. Otherwise the stream
+	//restarts from the oldest snapshot, which lets an initial build resume
+	//from its last persisted snapshot.
+	fromZero := make(map[string]bool)
+
+	for _, idxInstId := range instIdList {
 		idxInst := idx.indexInstMap[idxInstId]
 
-		if idxInst.Stream == streamId {
+		if partnMap, ok := idx.indexPartnMap[idxInstId]; ok {
 
 			for _, partnInst := range partnMap {
 
@@ -4940,6 +5088,10 @@ func (idx *indexer) makeRestartTs(streamId common.StreamId) map[string]*common.T
 				s := NewSnapshotInfoContainer(infos)
 				latestSnapInfo := s.GetLatest()
 
+				if fromZero[idxInst.Defn.Bucket] {
+					continue
+				}
+
 				//There may not be a valid snapshot info if no flush
 				//happened for this index
 				if latestSnapInfo != nil {
@@ -4953,9 +5105,8 @@ func (idx *indexer) makeRestartTs(streamId common.StreamId) map[string]*common.T
 					}
 				} else {
 					//set restartTs to nil for this bucket
-					if _, ok := restartTs[idxInst.Defn.Bucket]; !ok {
-						restartTs[idxInst.Defn.Bucket] = nil
-					}
+					restartTs[idxInst.Defn.Bucket] = nil
+					fromZero[idxInst.Defn.Bucket] = true
 				}
 			}
 		}
@@ -5316,7 +5467,11 @@ func (idx *indexer) checkValidIndexInst(bucket string, instIdList []common.Index
 			}
 		} else {
 
-			if index.State == common.INDEX_STATE_CREATED ||
+			if idx.importInProgress[instId] {
+				errStr := fmt.Sprintf("Index Import In Progress for %v In Build Request", instId)
+				idx.updateError(instId, errStr)
+				errMap[instId] = &common.IndexerError{Reason: errStr, Code: common.IndexBuildInProgress}
+			} else if index.State == common.INDEX_STATE_CREATED ||
 				index.State == common.INDEX_STATE_READY ||
 				index.State == common.INDEX_STATE_ERROR {
 				newList[count] = instId
@@ -49,7 +49,7 @@ func NewKVSender(supvCmdch MsgChannel, supvRespch MsgChannel,
 	config c.Config) (KVSender, Message) {
 
 	var cinfo *c.ClusterInfoCache
-	url, err := c.ClusterAuthUrl(config["clusterAddr"].String())
+	url, err := c.ClusterInfoUrl(config["clusterAddr"].String())
 	if err == nil {
 		cinfo, err = c.NewClusterInfoCache(url, DEFAULT_POOL)
 	}
@@ -1176,11 +1176,15 @@ func convertIndexDefnToProtobuf(indexDefn c.IndexDefn) *protobuf.IndexDefn {
 		Using:              using,
 		ExprType:           exprType,
 		SecExpressions:     indexDefn.SecExprs,
+		IncludeExpressions: indexDefn.Include,
+		Collation:          proto.String(indexDefn.Collation),
 		PartitionScheme:    partnScheme,
 		PartnExpressions:   indexDefn.PartitionKeys,
 		HashScheme:         protobuf.HashScheme(indexDefn.HashScheme).Enum(),
 		WhereExpression:    proto.String(indexDefn.WhereExpr),
 		RetainDeletedXATTR: proto.Bool(indexDefn.RetainDeletedXATTR),
+		DocKeyPrefixes:     indexDefn.DocKeyPrefixes,
+		DocKeyPattern:      proto.String(indexDefn.DocKeyPattern),
 	}
 
 	return defn
@@ -0,0 +1,367 @@
+// Copyright (c) 2014 Couchbase, Inc.
+// Licensed under the Apache License, Version 2.0 (the "License"); you may not use this file
+// except in compliance with the License. You may obtain a copy of the License at
+//   http://www.apache.org/licenses/LICENSE-2.0
+// Unless required by applicable law or agreed to in writing, software distributed under the
+// License is distributed on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND,
+// either express or implied. See the License for the specific language governing permissions
+// and limitations under the License.
+
+package indexer
+
+import (
+	"bytes"
+	"runtime"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/couchbase/indexing/secondary/common"
+)
+
+// Parallel range scans on memdb snapshots.
+//
+// A scan range is split into key range shards using pivot items sampled
+// from the skiplist. Shards are iterated concurrently and each of them
+// fills batches of entries. memdbBatchCursor hands out the batches lazily
+// in key order, so the scan callback observes exactly the same sequence of
+// entries as with a single iterator.
+//
+// The first shard of a scan is always iterated, as a serial scan would be.
+// Every other shard needs a worker from a pool shared by all scans on the
+// node, so that concurrent scans do not multiply the number of goroutines.
+
+const (
+	memdbScanBatchSize  = 256
+	memdbScanBatchQueue = 4
+	memdbMaxScanShards  = 16
+)
+
+// memdbScanWorkers is the pool of shard workers shared by all parallel
+// scans on the node, a token is taken from the channel for every worker.
+var memdbScanWorkers atomic.Value // chan struct{}
+
+func init() {
+	memdbScanWorkers.Store(make(chan struct{}, runtime.NumCPU()))
+}
+
+// setScanWorkers resizes the node wide pool of shard workers. Workers
+// running on the old pool return their token to it.
+func setScanWorkers(cfg common.Config) {
+	workers := cfg["settings.moi.scan_workers"].Int()
+	if workers <= 0 {
+		workers = runtime.NumCPU()
+	}
+	if cap(memdbScanWorkers.Load().(chan struct{})) != workers {
+		memdbScanWorkers.Store(make(chan struct{}, workers))
+	}
+}
+
+func (mdb *memdbSlice) setScanShards(cfg common.Config) {
+	shards := cfg["settings.moi.scan_shards"].Int()
+	if shards <= 0 {
+		shards = runtime.NumCPU()
+		if shards > memdbMaxScanShards {
+			shards = memdbMaxScanShards
+		}
+	}
+	mdb.scanShards = shards
+	mdb.scanShardMinItems = int64(cfg["settings.moi.scan_shard_min_items"].Int())
+	setScanWorkers(cfg)
+}
+
+// splitKeys samples the snapshot once, the split keys are shared by all
+// scans on the snapshot.
+func (s *memdbSnapshot) splitKeys() [][]byte {
+	s.splitOnce.Do(func() {
+		shards := s.slice.scanShards
+		s.splits = s.slice.mainstore.RangeSplitKeys(s.info.MainSnap, shards)
+	})
+	return s.splits
+}
+
+// scanPivots returns entries splitting range low-high into shards. No pivots
+// are returned if the snapshot is too small or parallel scans are disabled.
+func (s *memdbSnapshot) scanPivots(low, high IndexKey, cmpFn CmpEntry) [][]byte {
+	shards := s.slice.scanShards
+	if shards <= 1 || s.info.MainSnap.Count() < s.slice.scanShardMinItems {
+		return nil
+	}
+
+	var entry IndexEntry
+	pivots := make([][]byte, 0, shards)
+	for _, key := range s.splitKeys() {
+		s.newIndexEntry(key, &entry)
+		// pivots have to lie strictly within the range, so that only the
+		// first and last shard need to deal with inclusion.
+		if cmpFn(low, entry) < 0 && cmpFn(high, entry) > 0 {
+			pivots = append(pivots, key)
+		}
+	}
+	return pivots
+}
+
+type memdbScanShard struct {
+	start, end []byte // pivot entries, nil for the ends of the range
+	batchch    chan [][]byte
+	count      uint64
+	err        error
+}
+
+type memdbBatchCursor struct {
+	snap      *memdbSnapshot
+	low, high IndexKey
+	inclusion Inclusion
+	cmpFn     CmpEntry
+
+	shards []*memdbScanShard
+	curr   int
+	donech chan struct{}
+	wg     sync.WaitGroup
+	once   sync.Once
+}
+
+func newMemdbBatchCursor(s *memdbSnapshot, low, high IndexKey,
+	inclusion Inclusion, cmpFn CmpEntry, pivots [][]byte) *memdbBatchCursor {
+
+	c := &memdbBatchCursor{
+		snap:      s,
+		low:       low,
+		high:      high,
+		inclusion: inclusion,
+		cmpFn:     cmpFn,
+		shards:    make([]*memdbScanShard, len(pivots)+1),
+		donech:    make(chan struct{}),
+	}
+
+	var start []byte
+	for i := range c.shards {
+		var end []byte
+		if i < len(pivots) {
+			end = pivots[i]
+		}
+		c.shards[i] = &memdbScanShard{
+			start:   start,
+			end:     end,
+			batchch: make(chan [][]byte, memdbScanBatchQueue),
+		}
+		start = end
+	}
+	return c
+}
+
+// start iterates shards, each shard but the first one with a worker from
+// the node wide pool. Shards are picked up in key order, so the shard being
+// consumed always has a worker.
+func (c *memdbBatchCursor) start(
+	visit func(sh *memdbScanShard) func([]byte) error) {
+
+	run := func(i int, sh *memdbScanShard, release func()) {
+		defer c.wg.Done()
+		defer release()
+		defer close(sh.batchch)
+
+		sh.err = c.iterateShard(i, visit(sh))
+	}
+
+	c.wg.Add(1)
+	go run(0, c.shards[0], func() {})
+
+	c.wg.Add(1)
+	go func() {
+		defer c.wg.Done()
+		pool := memdbScanWorkers.Load().(chan struct{})
+		for i, sh := range c.shards[1:] {
+			select {
+			case pool <- struct{}{}:
+			case <-c.donech:
+				// shards not started have to look done to Next and Count
+				for _, sh := range c.shards[i+1:] {
+					sh.err = common.ErrClientCancel
+					close(sh.batchch)
+				}
+				return
+			}
+
+			c.wg.Add(1)
+			go run(i+1, sh, func() { <-pool })
+		}
+	}()
+}
+
+// startBatches iterates shards and queues entries in batches for Next.
+func (c *memdbBatchCursor) startBatches() {
+	c.start(func(sh *memdbScanShard) func([]byte) error {
+		batch := make([][]byte, 0, memdbScanBatchSize)
+		return func(entry []byte) error {
+			if entry == nil { // flush
+				if len(batch) > 0 {
+					return c.send(sh, batch)
+				}
+				return nil
+			}
+			batch = append(batch, entry)
+			if len(batch) == cap(batch) {
+				if err := c.send(sh, batch); err != nil {
+					return err
+				}
+				batch = make([][]byte, 0, memdbScanBatchSize)
+			}
+			return nil
+		}
+	})
+}
+
+// startCount counts entries of each shard, there is nothing to consume.
+func (c *memdbBatchCursor) startCount(stopch StopChannel) {
+	c.start(func(sh *memdbScanShard) func([]byte) error {
+		return func(entry []byte) error {
+			if entry == nil {
+				return nil
+			}
+			select {
+			case <-stopch:
+				return common.ErrClientCancel
+			case <-c.donech:
+				return common.ErrClientCancel
+			default:
+				sh.count++
+			}
+			return nil
+		}
+	})
+}
+
+func (c *memdbBatchCursor) send(sh *memdbScanShard, batch [][]byte) error {
+	select {
+	case sh.batchch <- batch:
+		return nil
+	case <-c.donech:
+		return common.ErrClientCancel
+	}
+}
+
+// iterateShard calls visit for every entry in shard i and finally with a
+// nil entry once the shard is done.
+func (c *memdbBatchCursor) iterateShard(i int, visit func([]byte) error) error {
+	var entry IndexEntry
+	var err error
+
+	s, sh := c.snap, c.shards[i]
+	first, last := i == 0, i == len(c.shards)-1
+
+	t0 := time.Now()
+	it := s.info.MainSnap.NewIterator()
+	defer it.Close()
+
+	if !first {
+		it.Seek(sh.start)
+	} else if c.low.Bytes() == nil {
+		it.SeekFirst()
+	} else {
+		it.Seek(c.low.Bytes())
+
+		// Discard equal keys if low inclusion is requested
+		if c.inclusion == Neither || c.inclusion == High {
+			if err = s.iterEqualKeys(c.low, it, c.cmpFn, nil); err != nil {
+				return err
+			}
+		}
+	}
+	s.slice.idxStats.Timings.stNewIterator.Put(time.Since(t0))
+
+	for ; it.Valid(); it.Next() {
+		itm := it.Get()
+		if !last {
+			if bytes.Compare(itm, sh.end) >= 0 {
+				break
+			}
+		} else {
+			// Iterator has reached past the high key
+			s.newIndexEntry(itm, &entry)
+			if c.cmpFn(c.high, entry) <= 0 {
+				break
+			}
+		}
+		if err = visit(itm); err != nil {
+			return err
+		}
+	}
+
+	// Include equal keys if high inclusion is requested
+	if last && (c.inclusion == Both || c.inclusion == High) {
+		if err = s.iterEqualKeys(c.high, it, c.cmpFn, visit); err != nil {
+			return err
+		}
+	}
+
+	return visit(nil)
+}
+
+// Next returns the next batch of entries in key order, or nil when the
+// range is exhausted.
+func (c *memdbBatchCursor) Next() ([][]byte, error) {
+	for c.curr < len(c.shards) {
+		sh := c.shards[c.curr]
+		if batch, ok := <-sh.batchch; ok {
+			return batch, nil
+		}
+		if sh.err != nil {
+			return nil, sh.err
+		}
+		c.curr++
+	}
+	return nil, nil
+}
+
+// Count waits for all shards and returns the total number of entries.
+func (c *memdbBatchCursor) Count() (uint64, error) {
+	var count uint64
+	for _, sh := range c.shards {
+		for range sh.batchch {
+		}
+		if sh.err != nil {
+			return 0, sh.err
+		}
+		count += sh.count
+	}
+	return count, nil
+}
+
+// Close stops the workers and waits for them to release their iterators.
+func (c *memdbBatchCursor) Close() {
+	c.once.Do(func() { close(c.donech) })
+	c.wg.Wait()
+}
+
+func (s *memdbSnapshot) parallelIterate(low, high IndexKey, inclusion Inclusion,
+	cmpFn CmpEntry, pivots [][]byte, callback EntryCallback) error {
+
+	cur := newMemdbBatchCursor(s, low, high, inclusion, cmpFn, pivots)
+	defer cur.Close()
+
+	cur.startBatches()
+	for {
+		batch, err := cur.Next()
+		if err != nil {
+			return err
+		} else if batch == nil {
+			return nil
+		}
+		for _, entry := range batch {
+			if err := callback(entry); err != nil {
+				return err
+			}
+		}
+	}
+}
+
+func (s *memdbSnapshot) parallelCount(low, high IndexKey, inclusion Inclusion,
+	cmpFn CmpEntry, pivots [][]byte, stopch StopChannel) (uint64, error) {
+
+	cur := newMemdbBatchCursor(s, low, high, inclusion, cmpFn, pivots)
+	defer cur.Close()
+
+	cur.startCount(stopch)
+	return cur.Count()
+}
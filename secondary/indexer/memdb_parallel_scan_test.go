@@ -0,0 +1,126 @@
+package indexer
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/couchbase/indexing/secondary/memdb"
+)
+
+func newTestMemdbSnapshot(t *testing.T, n int) *memdbSnapshot {
+	cfg := memdb.DefaultConfig()
+	cfg.SetKeyComparator(byteItemCompare)
+	db := memdb.NewWithConfig(cfg)
+	w := db.NewWriter()
+	for i := 0; i < n; i++ {
+		w.Put([]byte(fmt.Sprintf("doc-%08d", i)))
+	}
+	snap, err := db.NewSnapshot()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	stats := &IndexStats{}
+	stats.Init()
+	slice := &memdbSlice{mainstore: db, isPrimary: true, idxStats: stats,
+		scanShards: 8, scanShardMinItems: 1}
+	return &memdbSnapshot{slice: slice, info: &memdbSnapshotInfo{MainSnap: snap}}
+}
+
+func TestMemdbParallelRange(t *testing.T) {
+	s := newTestMemdbSnapshot(t, 100000)
+
+	low, _ := NewPrimaryKey([]byte("doc-00001000"))
+	high, _ := NewPrimaryKey([]byte("doc-00090000"))
+	for _, incl := range []Inclusion{Neither, Low, High, Both} {
+		if pivots := s.scanPivots(low, high, s.rangeCmpFn()); len(pivots) == 0 {
+			t.Fatalf("expected range to be split into shards")
+		}
+
+		var parallel, serial [][]byte
+		err := s.Range(nil, low, high, incl, func(e []byte) error {
+			parallel = append(parallel, e)
+			return nil
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+		err = s.Iterate(nil, low, high, incl, compareExact, func(e []byte) error {
+			serial = append(serial, e)
+			return nil
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if len(parallel) != len(serial) {
+			t.Fatalf("inclusion %v: expected %v entries, got %v", incl, len(serial), len(parallel))
+		}
+		for i := range serial {
+			if string(parallel[i]) != string(serial[i]) {
+				t.Fatalf("inclusion %v: mismatch at %v: %s != %s", incl, i, parallel[i], serial[i])
+			}
+		}
+
+		count, err := s.CountRange(nil, low, high, incl, nil)
+		if err != nil || count != uint64(len(serial)) {
+			t.Errorf("inclusion %v: expected count %v, got %v %v", incl, len(serial), count, err)
+		}
+	}
+}
+
+func TestMemdbParallelRangeAbort(t *testing.T) {
+	s := newTestMemdbSnapshot(t, 100000)
+
+	errStop := fmt.Errorf("stop")
+	count := 0
+	err := s.All(nil, func(e []byte) error {
+		if count++; count == 10000 {
+			return errStop
+		}
+		return nil
+	})
+	if err != errStop || count != 10000 {
+		t.Errorf("expected scan to stop after 10000 entries, got %v %v", count, err)
+	}
+}
+
+func TestMemdbParallelRangeWorkers(t *testing.T) {
+	s := newTestMemdbSnapshot(t, 100000)
+
+	// a single worker for all scans, concurrent scans still complete
+	old := memdbScanWorkers.Load()
+	memdbScanWorkers.Store(make(chan struct{}, 1))
+	defer memdbScanWorkers.Store(old)
+
+	low, _ := NewPrimaryKey([]byte("doc-00001000"))
+	high, _ := NewPrimaryKey([]byte("doc-00090000"))
+	errch := make(chan error, 4)
+	for i := 0; i < cap(errch); i++ {
+		go func() {
+			count := 0
+			err := s.Range(nil, low, high, Low, func(e []byte) error {
+				count++
+				return nil
+			})
+			if err == nil && count != 89000 {
+				err = fmt.Errorf("expected 89000 entries, got %v", count)
+			}
+			errch <- err
+		}()
+	}
+	for i := 0; i < cap(errch); i++ {
+		if err := <-errch; err != nil {
+			t.Error(err)
+		}
+	}
+	if n := len(memdbScanWorkers.Load().(chan struct{})); n != 0 {
+		t.Errorf("expected all workers to be released, %v in use", n)
+	}
+
+	// split keys are sampled once per snapshot
+	splits := s.splitKeys()
+	if len(splits) == 0 || &s.splitKeys()[0] != &splits[0] {
+		t.Errorf("expected split keys to be cached")
+	}
+}
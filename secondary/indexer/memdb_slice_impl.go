@@ -48,20 +48,24 @@ type indexMutation struct {
 	op    int
 	key   []byte
 	docid []byte
+
+	predicateExit bool // see MutationMeta
 }
 
 func docIdFromEntryBytes(e []byte) []byte {
 	offset := len(e) - 2
 	l := binary.LittleEndian.Uint16(e[offset : offset+2])
-	// Length & 0111111 00000000
-	// as MSB of length is used to indicate presence of count
-	docidlen := int(l & 0x7fff)
-	offset = len(e) - 1
-	if (e[offset] & 0x80) == 0x80 { // if count is encoded
-		offset = len(e) - docidlen - 4
-	} else {
-		offset = len(e) - docidlen - 2
+	// Length & 00111111 11111111
+	// as two MSBs of length are used to indicate presence of count and include
+	docidlen := int(l & 0x3fff)
+	if (e[len(e)-1] & 0x80) == 0x80 { // if count is encoded
+		offset -= 2
+	}
+	if (e[len(e)-1] & 0x40) == 0x40 { // if include is encoded
+		incl := binary.LittleEndian.Uint16(e[offset-2 : offset])
+		offset -= 2 + int(incl)
 	}
+	offset -= docidlen
 	return e[offset : offset+docidlen]
 }
 
@@ -157,6 +161,10 @@ type memdbSlice struct {
 	maxRollbacks   int
 	hasPersistence bool
 
+	// Parallel range scans
+	scanShards        int
+	scanShardMinItems int64
+
 	totalFlushTime  time.Duration
 	totalCommitTime time.Duration
 
@@ -201,6 +209,7 @@ func NewMemDBSlice(path string, sliceId SliceId, idxDefn common.IndexDefn,
 	slice.id = sliceId
 	slice.numWriters = sysconf["numSliceWriters"].Int()
 	slice.maxRollbacks = sysconf["settings.moi.recovery.max_rollbacks"].Int()
+	slice.setScanShards(sysconf)
 
 	sliceBufSize := sysconf["settings.sliceBufSize"].Uint64()
 	if sliceBufSize < uint64(slice.numWriters) {
@@ -304,7 +313,8 @@ func (mdb *memdbSlice) Insert(key []byte, docid []byte, meta *MutationMeta) erro
 func (mdb *memdbSlice) Delete(docid []byte, meta *MutationMeta) error {
 	mdb.idxStats.numDocsFlushQueued.Add(1)
 	atomic.AddInt64(&mdb.qCount, 1)
-	mdb.cmdCh[int(meta.vbucket)%mdb.numWriters] <- indexMutation{op: opDelete, docid: docid}
+	mdb.cmdCh[int(meta.vbucket)%mdb.numWriters] <- indexMutation{op: opDelete, docid: docid,
+		predicateExit: meta.predicateExit}
 	return mdb.fatalDbErr
 }
 
@@ -326,10 +336,14 @@ loop:
 				mdb.totalFlushTime += elapsed
 
 			case opDelete:
+				var removed bool
 				start = time.Now()
-				nmut = mdb.delete(icmd.docid, workerId)
+				nmut, removed = mdb.delete(icmd.docid, workerId)
 				elapsed = time.Since(start)
 				mdb.totalFlushTime += elapsed
+				if removed && icmd.predicateExit {
+					mdb.idxStats.numPredicateExitDeletes.Add(1)
+				}
 
 			default:
 				logging.Errorf("MemDBSlice::handleCommandsWorker \n\tSliceId %v IndexInstId %v Received "+
@@ -357,7 +371,7 @@ func (mdb *memdbSlice) insert(key []byte, docid []byte, workerId int) int {
 	if mdb.isPrimary {
 		nmut = mdb.insertPrimaryIndex(key, docid, workerId)
 	} else if len(key) == 0 {
-		nmut = mdb.delete(docid, workerId)
+		nmut, _ = mdb.delete(docid, workerId)
 	} else {
 		if mdb.idxDefn.IsArrayIndex {
 			nmut = mdb.insertSecArrayIndex(key, docid, workerId)
@@ -390,8 +404,7 @@ func (mdb *memdbSlice) insertSecIndex(key []byte, docid []byte, workerId int) in
 	t0 := time.Now()
 
 	mdb.encodeBuf[workerId] = resizeEncodeBuf(mdb.encodeBuf[workerId], len(key), allowLargeKeys)
-	entry, err := NewSecondaryIndexEntry(key, docid, mdb.idxDefn.IsArrayIndex,
-		1, mdb.idxDefn.Desc, mdb.encodeBuf[workerId])
+	entry, err := newDefnIndexEntry(key, docid, &mdb.idxDefn, mdb.encodeBuf[workerId])
 	if err != nil {
 		logging.Errorf("MemDBSlice::insertSecIndex Slice Id %v IndexInstId %v "+
 			"Skipping docid:%s (%v)", mdb.Id, mdb.idxInstId, logging.TagStrUD(docid), err)
@@ -527,19 +540,23 @@ func (mdb *memdbSlice) insertSecArrayIndex(keys []byte, docid []byte, workerId i
 	return nmut
 }
 
-func (mdb *memdbSlice) delete(docid []byte, workerId int) int {
-	var nmut int
+// delete returns whether an entry of docid was removed, along with the
+// number of mutations.
+func (mdb *memdbSlice) delete(docid []byte, workerId int) (nmut int, removed bool) {
 
 	if mdb.isPrimary {
 		nmut = mdb.deletePrimaryIndex(docid, workerId)
+		removed = true
 	} else if !mdb.idxDefn.IsArrayIndex {
-		nmut = mdb.deleteSecIndex(docid, workerId)
+		removed = mdb.removeSecIndex(docid, workerId)
+		nmut = 1
 	} else {
 		nmut = mdb.deleteSecArrayIndex(docid, workerId)
+		removed = nmut > 0
 	}
 
 	mdb.logWriterStat()
-	return nmut
+	return
 }
 
 func (mdb *memdbSlice) deletePrimaryIndex(docid []byte, workerId int) (nmut int) {
@@ -564,6 +581,12 @@ func (mdb *memdbSlice) deletePrimaryIndex(docid []byte, workerId int) (nmut int)
 }
 
 func (mdb *memdbSlice) deleteSecIndex(docid []byte, workerId int) int {
+	mdb.removeSecIndex(docid, workerId)
+	return 1
+}
+
+// removeSecIndex returns false if docid is not in the index.
+func (mdb *memdbSlice) removeSecIndex(docid []byte, workerId int) bool {
 	lookupentry := entryBytesFromDocId(docid)
 
 	// Delete entry from back and main index if present
@@ -577,7 +600,7 @@ func (mdb *memdbSlice) deleteSecIndex(docid []byte, workerId int) int {
 		mdb.idxStats.Timings.stKVDelete.Put(time.Since(t0))
 	}
 	mdb.isDirty = true
-	return 1
+	return success
 }
 
 func (mdb *memdbSlice) deleteSecArrayIndex(docid []byte, workerId int) (nmut int) {
@@ -643,6 +666,9 @@ type memdbSnapshot struct {
 	committed bool
 
 	refCount int32
+
+	splitOnce sync.Once
+	splits    [][]byte // see splitKeys
 }
 
 // Creates an open snapshot handle from snapshot info
@@ -1146,6 +1172,7 @@ func (mdb *memdbSlice) UpdateConfig(cfg common.Config) {
 
 	mdb.sysconf = cfg
 	mdb.maxRollbacks = cfg["settings.moi.recovery.max_rollbacks"].Int()
+	mdb.setScanShards(cfg)
 }
 
 func (mdb *memdbSlice) GetReaderContext() IndexReaderContext {
@@ -1294,6 +1321,11 @@ func (s *memdbSnapshot) CountTotal(ctx IndexReaderContext, stopch StopChannel) (
 func (s *memdbSnapshot) CountRange(ctx IndexReaderContext, low, high IndexKey, inclusion Inclusion,
 	stopch StopChannel) (uint64, error) {
 
+	cmpFn := s.rangeCmpFn()
+	if pivots := s.scanPivots(low, high, cmpFn); len(pivots) > 0 {
+		return s.parallelCount(low, high, inclusion, cmpFn, pivots, stopch)
+	}
+
 	var count uint64
 	callb := func([]byte) error {
 		select {
@@ -1437,16 +1469,21 @@ func (s *memdbSnapshot) Lookup(ctx IndexReaderContext, key IndexKey, callb Entry
 func (s *memdbSnapshot) Range(ctx IndexReaderContext, low, high IndexKey, inclusion Inclusion,
 	callb EntryCallback) error {
 
-	var cmpFn CmpEntry
-	if s.isPrimary() {
-		cmpFn = compareExact
-	} else {
-		cmpFn = comparePrefix
+	cmpFn := s.rangeCmpFn()
+	if pivots := s.scanPivots(low, high, cmpFn); len(pivots) > 0 {
+		return s.parallelIterate(low, high, inclusion, cmpFn, pivots, callb)
 	}
 
 	return s.Iterate(ctx, low, high, inclusion, cmpFn, callb)
 }
 
+func (s *memdbSnapshot) rangeCmpFn() CmpEntry {
+	if s.isPrimary() {
+		return compareExact
+	}
+	return comparePrefix
+}
+
 func (s *memdbSnapshot) All(ctx IndexReaderContext, callb EntryCallback) error {
 	return s.Range(ctx, MinIndexKey, MaxIndexKey, Both, callb)
 }
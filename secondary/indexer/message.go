@@ -13,6 +13,7 @@ package indexer
 import (
 	"fmt"
 	"github.com/couchbase/indexing/secondary/common"
+	"io"
 	"time"
 )
 
@@ -126,6 +127,8 @@ const (
 	INDEXER_UPDATE_RSTATE
 	INDEXER_MERGE_PARTITION
 	INDEXER_CANCEL_MERGE_PARTITION
+	INDEXER_IMPORT_INDEX
+	INDEXER_IMPORT_INDEX_DONE
 
 	//SCAN COORDINATOR
 	SCAN_COORD_SHUTDOWN
@@ -1506,6 +1509,52 @@ func (m *MsgUpdateIndexRState) GetRState() common.RebalanceState {
 	return m.rstate
 }
 
+//MsgImportIndex seeds an index from an export file. INDEXER_IMPORT_INDEX
+//is the request, INDEXER_IMPORT_INDEX_DONE carries the outcome of the
+//import back to indexer.
+type MsgImportIndex struct {
+	mType  MsgType
+	bucket string
+	name   string
+	reader io.Reader
+	instId common.IndexInstId
+	report *ImportReport
+	err    error
+	respch chan interface{}
+}
+
+func (m *MsgImportIndex) GetMsgType() MsgType {
+	return m.mType
+}
+
+func (m *MsgImportIndex) GetBucket() string {
+	return m.bucket
+}
+
+func (m *MsgImportIndex) GetIndexName() string {
+	return m.name
+}
+
+func (m *MsgImportIndex) GetReader() io.Reader {
+	return m.reader
+}
+
+func (m *MsgImportIndex) GetInstId() common.IndexInstId {
+	return m.instId
+}
+
+func (m *MsgImportIndex) GetReport() *ImportReport {
+	return m.report
+}
+
+func (m *MsgImportIndex) GetError() error {
+	return m.err
+}
+
+func (m *MsgImportIndex) GetRespCh() chan interface{} {
+	return m.respch
+}
+
 //Helper function to return string for message type
 
 func (m MsgType) String() string {
@@ -1633,6 +1682,10 @@ func (m MsgType) String() string {
 		return "INDEXER_MERGE_PARTITION"
 	case INDEXER_CANCEL_MERGE_PARTITION:
 		return "INDEXER_CANCEL_MERGE_PARTITION"
+	case INDEXER_IMPORT_INDEX:
+		return "INDEXER_IMPORT_INDEX"
+	case INDEXER_IMPORT_INDEX_DONE:
+		return "INDEXER_IMPORT_INDEX_DONE"
 
 	case SCAN_COORD_SHUTDOWN:
 		return "SCAN_COORD_SHUTDOWN"
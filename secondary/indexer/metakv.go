@@ -15,60 +15,24 @@
 package indexer
 
 import (
-	"encoding/json"
-	"github.com/couchbase/cbauth/metakv"
-	"github.com/couchbase/indexing/secondary/logging"
+	"github.com/couchbase/indexing/secondary/common"
 )
 
-func MetakvGet(path string, v interface{}) (bool, error) {
-	raw, _, err := metakv.Get(path)
-	if err != nil {
-		logging.Fatalf("MetakvGet: Failed to fetch %s from metakv: %s", path, err.Error())
-	}
-
-	if raw == nil {
-		return false, err
-	}
+// Metakv helpers of indexer use the process wide metadata store, same
+// as the ones in common package.
 
-	err = json.Unmarshal(raw, v)
-	if err != nil {
-		logging.Fatalf("MetakvGet: Failed unmarshalling value for %s: %s\n%s",
-			path, err.Error(), string(raw))
-		return false, err
-	}
-
-	return true, nil
+func MetakvGet(path string, v interface{}) (bool, error) {
+	return common.MetakvGet(path, v)
 }
 
 func MetakvSet(path string, v interface{}) error {
-	raw, err := json.Marshal(v)
-	if err != nil {
-		logging.Fatalf("MetakvSet: Failed to marshal value for %s: %s\n%v",
-			path, err.Error(), v)
-		return err
-	}
-
-	err = metakv.Set(path, raw, nil)
-	if err != nil {
-		logging.Fatalf("MetakvSet Failed to set %s: %s", path, err.Error())
-	}
-	return err
+	return common.MetakvSet(path, v)
 }
 
 func MetakvDel(path string) error {
-
-	err := metakv.Delete(path, nil)
-	if err != nil {
-		logging.Fatalf("MetakvDel: Failed to delete %s: %s", path, err.Error())
-	}
-	return err
+	return common.MetakvDel(path)
 }
 
 func MetakvRecurciveDel(dirpath string) error {
-
-	err := metakv.RecursiveDelete(dirpath)
-	if err != nil {
-		logging.Fatalf("MetakvRecurciveDel: Failed to delete %s: %s", dirpath, err.Error())
-	}
-	return err
+	return common.MetakvRecurciveDel(dirpath)
 }
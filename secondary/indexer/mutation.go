@@ -23,6 +23,10 @@ type MutationMeta struct {
 	vbuuid    Vbuuid  //uuid for vbucket
 	seqno     Seqno   //vbucket sequence number for this mutation
 	firstSnap bool    //belongs to first DCP snapshot
+
+	// UpsertDeletion for a document that left the WHERE predicate of a
+	// partial index. Set by flusher for the Delete call only.
+	predicateExit bool
 }
 
 var mutMetaPool = sync.Pool{New: newMutationMeta}
@@ -131,6 +135,7 @@ type Mutation struct {
 	key      []byte             // key-version for index
 	oldkey   []byte             // previous key-version, if available
 	partnkey []byte             // partition key
+	exit     bool               // UpsertDeletion is a WHERE predicate exit
 }
 
 var mutPool = sync.Pool{New: newMutation}
@@ -163,6 +168,7 @@ func (m *Mutation) Free() {
 		m.key = m.key[:0]
 		m.oldkey = m.oldkey[:0]
 		m.partnkey = m.partnkey[:0]
+		m.exit = false
 		mutPool.Put(m)
 	}
 }
@@ -402,6 +402,10 @@ func (m *mutationMgr) handleOpenStream(cmd Message) {
 			m.streamFlusherStopChMap[streamId] = make(BucketStopChMap)
 		}()
 
+		if streamId == common.INIT_STREAM {
+			m.updateInitStreamInstMap()
+		}
+
 		//send success on supv channel
 		m.supvCmdch <- &MsgSuccess{}
 	}
@@ -1000,10 +1004,29 @@ func (m *mutationMgr) handleUpdateIndexInstMap(cmd Message) {
 	indexInstMap := req.GetIndexInstMap()
 	m.indexInstMap = common.CopyIndexInstMap(indexInstMap)
 	m.stats.Set(req.GetStatsObject())
+	m.updateInitStreamInstMap()
 	m.supvCmdch <- &MsgSuccess{}
 
 }
 
+//updateInitStreamInstMap lets the INIT_STREAM reader know the index
+//instances in initial build, as only those are subject to the build
+//mutation rate. Caller is expected to hold m.lock.
+func (m *mutationMgr) updateInitStreamInstMap() {
+
+	if _, ok := m.streamReaderMap[common.INIT_STREAM]; !ok {
+		return
+	}
+
+	msg := &MsgUpdateInstMap{indexInstMap: m.indexInstMap}
+	respMsg := m.sendMsgToStreamReader(common.INIT_STREAM, msg)
+	if respMsg.GetMsgType() != MSG_SUCCESS {
+		err := respMsg.(*MsgError).GetError()
+		logging.Errorf("MutationMgr::updateInitStreamInstMap Error "+
+			"Updating Stream %v %v", common.INIT_STREAM, err)
+	}
+}
+
 //handleUpdateIndexPartnMap updates the indexPartnMap
 func (m *mutationMgr) handleUpdateIndexPartnMap(cmd Message) {
 
@@ -1062,6 +1085,18 @@ func (m *mutationMgr) handleConfigUpdate(cmd Message) {
 
 	m.setMaxMemoryFromQuota()
 
+	//initial build mutation rate is enforced by the stream reader
+	m.lock.Lock()
+	if _, ok := m.streamReaderMap[common.INIT_STREAM]; ok {
+		respMsg := m.sendMsgToStreamReader(common.INIT_STREAM, cmd)
+		if respMsg.GetMsgType() != MSG_SUCCESS {
+			err := respMsg.(*MsgError).GetError()
+			logging.Errorf("MutationMgr::handleConfigUpdate Error "+
+				"Updating Stream %v %v", common.INIT_STREAM, err)
+		}
+	}
+	m.lock.Unlock()
+
 	m.supvCmdch <- &MsgSuccess{}
 }
 
@@ -393,7 +393,8 @@ func (mdb *plasmaSlice) Delete(docid []byte, meta *MutationMeta) error {
 	if !meta.firstSnap {
 		mdb.idxStats.numDocsFlushQueued.Add(1)
 		atomic.AddInt64(&mdb.qCount, 1)
-		mdb.cmdCh[int(meta.vbucket)%mdb.numWriters] <- indexMutation{op: opDelete, docid: docid}
+		mdb.cmdCh[int(meta.vbucket)%mdb.numWriters] <- indexMutation{op: opDelete, docid: docid,
+			predicateExit: meta.predicateExit}
 	}
 	return mdb.fatalDbErr
 }
@@ -416,10 +417,14 @@ loop:
 				mdb.totalFlushTime += elapsed
 
 			case opDelete:
+				var removed bool
 				start = time.Now()
-				nmut = mdb.delete(icmd.docid, workerId)
+				nmut, removed = mdb.delete(icmd.docid, workerId)
 				elapsed = time.Since(start)
 				mdb.totalFlushTime += elapsed
+				if removed && icmd.predicateExit {
+					mdb.idxStats.numPredicateExitDeletes.Add(1)
+				}
 
 			default:
 				logging.Errorf("plasmaSlice::handleCommandsWorker \n\tSliceId %v IndexInstId %v Received "+
@@ -447,7 +452,7 @@ func (mdb *plasmaSlice) insert(key []byte, docid []byte, workerId int, init bool
 	if mdb.isPrimary {
 		nmut = mdb.insertPrimaryIndex(key, docid, workerId)
 	} else if len(key) == 0 {
-		nmut = mdb.delete(docid, workerId)
+		nmut, _ = mdb.delete(docid, workerId)
 	} else {
 		if mdb.idxDefn.IsArrayIndex {
 			nmut = mdb.insertSecArrayIndex(key, docid, workerId, init)
@@ -492,8 +497,7 @@ func (mdb *plasmaSlice) insertSecIndex(key []byte, docid []byte, workerId int, i
 	}
 
 	mdb.encodeBuf[workerId] = resizeEncodeBuf(mdb.encodeBuf[workerId], len(key), allowLargeKeys)
-	entry, err := NewSecondaryIndexEntry(key, docid, mdb.idxDefn.IsArrayIndex,
-		1, mdb.idxDefn.Desc, mdb.encodeBuf[workerId])
+	entry, err := newDefnIndexEntry(key, docid, &mdb.idxDefn, mdb.encodeBuf[workerId])
 	if err != nil {
 		logging.Errorf("plasmaSlice::insertSecIndex Slice Id %v IndexInstId %v "+
 			"Skipping docid:%s (%v)", mdb.Id, mdb.idxInstId, logging.TagStrUD(docid), err)
@@ -708,19 +712,23 @@ func (mdb *plasmaSlice) insertSecArrayIndex(key []byte, docid []byte, workerId i
 	return nmut
 }
 
-func (mdb *plasmaSlice) delete(docid []byte, workerId int) int {
-	var nmut int
+// delete returns whether an entry of docid was removed, along with the
+// number of mutations.
+func (mdb *plasmaSlice) delete(docid []byte, workerId int) (nmut int, removed bool) {
 
 	if mdb.isPrimary {
 		nmut = mdb.deletePrimaryIndex(docid, workerId)
+		removed = nmut > 0
 	} else if !mdb.idxDefn.IsArrayIndex {
-		nmut = mdb.deleteSecIndex(docid, workerId)
+		removed = mdb.removeSecIndex(docid, workerId)
+		nmut = 1
 	} else {
 		nmut = mdb.deleteSecArrayIndex(docid, workerId)
+		removed = nmut > 0
 	}
 
 	mdb.logWriterStat()
-	return nmut
+	return
 }
 
 func (mdb *plasmaSlice) deletePrimaryIndex(docid []byte, workerId int) (nmut int) {
@@ -752,6 +760,12 @@ func (mdb *plasmaSlice) deletePrimaryIndex(docid []byte, workerId int) (nmut int
 }
 
 func (mdb *plasmaSlice) deleteSecIndex(docid []byte, workerId int) int {
+	mdb.removeSecIndex(docid, workerId)
+	return 1
+}
+
+// removeSecIndex returns false if docid is not in the index.
+func (mdb *plasmaSlice) removeSecIndex(docid []byte, workerId int) bool {
 	// Delete entry from back and main index if present
 	mdb.back[workerId].Begin()
 	defer mdb.back[workerId].End()
@@ -772,7 +786,7 @@ func (mdb *plasmaSlice) deleteSecIndex(docid []byte, workerId int) int {
 	}
 
 	mdb.isDirty = true
-	return 1
+	return err == nil
 }
 
 func (mdb *plasmaSlice) deleteSecArrayIndex(docid []byte, workerId int) (nmut int) {
@@ -1804,20 +1818,27 @@ func (s *plasmaSnapshot) iterEqualKeys(k IndexKey, it *plasma.MVCCIterator,
 
 // TODO: Cleanup the leaky hack to reuse the buffer
 // Extract only secondary key
+// Format: [key][optional_include][optional_len_of_include_2_bytes][count_2_bytes]
+// The MSB of count indicates whether include is encoded or not
 func entry2BackEntry(entry secondaryIndexEntry) []byte {
 	buf := entry.Bytes()
 	kl := entry.lenKey()
+	count := 0
 	if entry.isCountEncoded() {
-		// Store count
-		dl := entry.lenDocId()
-		copy(buf[kl:kl+2], buf[kl+dl:kl+dl+2])
-		return buf[:kl+2]
-	} else {
-		// Set count to 0
-		buf[kl] = 0
-		buf[kl+1] = 0
+		count = entry.Count()
+	}
+	if entry.isIncludeEncoded() {
+		// Store include values
+		include := entry.includeBytes()
+		il := len(include)
+		copy(buf[kl:kl+il], include)
+		binary.LittleEndian.PutUint16(buf[kl+il:kl+il+2], uint16(il))
+		kl += il + 2
+		count |= 0x8000
 	}
 
+	// Store count, 0 if not encoded
+	binary.LittleEndian.PutUint16(buf[kl:kl+2], uint16(count))
 	return buf[:kl+2]
 }
 
@@ -1825,6 +1846,13 @@ func entry2BackEntry(entry secondaryIndexEntry) []byte {
 func backEntry2entry(docid []byte, bentry []byte, buf []byte) []byte {
 	l := len(bentry)
 	count := int(binary.LittleEndian.Uint16(bentry[l-2 : l]))
-	entry, _ := NewSecondaryIndexEntry2(bentry[:l-2], docid, false, count, nil, buf[:0], false)
+	var include []byte
+	if count&0x8000 != 0 {
+		count &= 0x7fff
+		il := int(binary.LittleEndian.Uint16(bentry[l-4 : l-2]))
+		include = bentry[l-4-il : l-4]
+		l -= il + 2
+	}
+	entry, _ := newSecondaryIndexEntry(bentry[:l-2], include, docid, false, count, nil, buf[:0], false)
 	return entry.Bytes()
 }
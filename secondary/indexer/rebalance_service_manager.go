@@ -32,7 +32,6 @@ import (
 	"encoding/json"
 
 	"github.com/couchbase/cbauth"
-	"github.com/couchbase/cbauth/metakv"
 	"github.com/couchbase/cbauth/service"
 	c "github.com/couchbase/indexing/secondary/common"
 	"github.com/couchbase/indexing/secondary/fdb"
@@ -634,9 +633,13 @@ func (m *ServiceMgr) startRebalance(change service.TopologyChange) error {
 			timeout := cfg["planner.timeout"].Int()
 			threshold := cfg["planner.variationThreshold"].Float64()
 			cpuProfile := cfg["planner.cpuProfile"].Bool()
+			moveCostWeight := cfg["planner.moveCostWeight"].Float64()
+			diskCostWeight := cfg["planner.diskCostWeight"].Float64()
+			minimizeMove := cfg["planner.minimizeMove"].Bool()
 
 			transferTokens, err = planner.ExecuteRebalance(cfg["clusterAddr"].String(), change,
-				string(m.nodeInfo.NodeID), onEjectOnly, disableReplicaRepair, threshold, timeout, cpuProfile)
+				string(m.nodeInfo.NodeID), onEjectOnly, disableReplicaRepair, threshold, timeout, cpuProfile,
+				moveCostWeight, diskCostWeight, minimizeMove)
 			if err != nil {
 				l.Errorf("ServiceMgr::startRebalance Planner Error %v", err)
 				m.runCleanupPhaseLOCKED(RebalanceTokenPath, true)
@@ -1870,7 +1873,7 @@ func (m *ServiceMgr) handleNodeuuid(w http.ResponseWriter, r *http.Request) {
 
 func (m *ServiceMgr) getCurrRebalTokens() (*RebalTokens, error) {
 
-	metainfo, err := metakv.ListAllChildren(RebalanceMetakvDir)
+	metainfo, err := c.GetMetadataStore().ListAllChildren(RebalanceMetakvDir)
 	if err != nil {
 		return nil, err
 	}
@@ -2003,7 +2006,7 @@ func (m *ServiceMgr) listenMoveIndex() {
 
 	cancel := make(chan struct{})
 	for {
-		err := metakv.RunObserveChildren(RebalanceMetakvDir, m.processMoveIndex, cancel)
+		err := c.GetMetadataStore().RunObserveChildren(RebalanceMetakvDir, m.processMoveIndex, cancel)
 		if err != nil {
 			l.Infof("ServiceMgr::listenMoveIndex metakv err %v. Retrying...", err)
 			time.Sleep(2 * time.Second)
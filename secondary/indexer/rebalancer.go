@@ -25,7 +25,6 @@ import (
 	"sync/atomic"
 	"time"
 
-	"github.com/couchbase/cbauth/metakv"
 	c "github.com/couchbase/indexing/secondary/common"
 	l "github.com/couchbase/indexing/secondary/logging"
 	"github.com/couchbase/indexing/secondary/manager"
@@ -210,7 +209,7 @@ func (r *Rebalancer) observeRebalance() {
 
 	<-r.waitForTokenPublish
 
-	err := metakv.RunObserveChildren(RebalanceMetakvDir, r.processTokens, r.metakvCancel)
+	err := c.GetMetadataStore().RunObserveChildren(RebalanceMetakvDir, r.processTokens, r.metakvCancel)
 	if err != nil {
 		l.Infof("Rebalancer::observeRebalance Exiting On Metakv Error %v", err)
 		r.finish(err)
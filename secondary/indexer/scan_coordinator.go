@@ -12,7 +12,10 @@ import (
 	"encoding/json"
 	"errors"
 	"fmt"
+	"io"
 	"net"
+	"net/http"
+	"strconv"
 	"strings"
 	"sync"
 	"sync/atomic"
@@ -39,6 +42,9 @@ var (
 
 var secKeyBufPool *common.BytesBufPool
 
+// structured logger for scan requests
+var scanLogger = logging.Component("scan")
+
 func init() {
 	secKeyBufPool = common.NewByteBufferPool(maxSecKeyBufferLen + ENCODE_BUF_SAFE_PAD)
 }
@@ -107,6 +113,10 @@ func NewScanCoordinator(supvCmdch MsgChannel, supvMsgch MsgChannel,
 
 	s.setIndexerState(common.INDEXER_BOOTSTRAP)
 
+	http.HandleFunc("/verifyIndex", s.handleVerifyIndexReq)
+	http.HandleFunc("/exportIndex", s.handleExportIndexReq)
+	http.HandleFunc("/importIndex", s.handleImportIndexReq)
+
 	// main loop
 	go s.run()
 	go s.listenSnapshot()
@@ -339,20 +349,20 @@ func (s *scanCoordinator) handleScanRequest(req *ScanRequest, w ScanResponseWrit
 
 	if err != nil {
 		status := fmt.Sprintf("(error = %s)", err)
-		logging.LazyVerbose(func() string {
-			return fmt.Sprintf("%s RESPONSE rows:%d, scanned:%d, waitTime:%v, totalTime:%v, status:%s, requestId:%s",
-				req.LogPrefix, scanPipeline.RowsReturned(), scanPipeline.RowsScanned(), waitTime, scanTime, status, req.RequestId)
-		})
+		if log := req.logger(); log.IsEnabled(logging.Verbose) {
+			log.Verbosef("%s RESPONSE rows:%d, scanned:%d, waitTime:%v, totalTime:%v, status:%s",
+				req.LogPrefix, scanPipeline.RowsReturned(), scanPipeline.RowsScanned(), waitTime, scanTime, status)
+		}
 
 		if err == common.ErrClientCancel {
 			req.Stats.clientCancelError.Add(1)
 		}
 	} else {
 		status := "ok"
-		logging.LazyVerbose(func() string {
-			return fmt.Sprintf("%s RESPONSE rows:%d, waitTime:%v, totalTime:%v, status:%s",
+		if log := req.logger(); log.IsEnabled(logging.Verbose) {
+			log.Verbosef("%s RESPONSE rows:%d, waitTime:%v, totalTime:%v, status:%s",
 				req.LogPrefix, scanPipeline.RowsReturned(), waitTime, scanTime, status)
-		})
+		}
 	}
 }
 
@@ -627,7 +637,7 @@ func (s *scanCoordinator) respondWithError(conn net.Conn, req *ScanRequest, err
 	}
 
 finish:
-	logging.Errorf("%s RESPONSE Failed with error (%s), requestId: %v", req.LogPrefix, err, req.RequestId)
+	req.logger().Errorf("%s RESPONSE Failed with error (%s)", req.LogPrefix, err)
 }
 
 func (s *scanCoordinator) handleError(prefix string, err error) {
@@ -644,11 +654,13 @@ func (s *scanCoordinator) tryRespondWithError(w ScanResponseWriter, req *ScanReq
 			stats := s.stats.Get()
 			stats.notFoundError.Add(1)
 		} else if err == common.ErrIndexerInBootstrap {
-			logging.Verbosef("%s REQUEST %s", req.LogPrefix, req)
-			logging.Verbosef("%s RESPONSE status:(error = %s), requestId: %v", req.LogPrefix, err, req.RequestId)
+			log := req.logger()
+			log.Verbosef("%s REQUEST %s", req.LogPrefix, req)
+			log.Verbosef("%s RESPONSE status:(error = %s)", req.LogPrefix, err)
 		} else {
-			logging.Infof("%s REQUEST %s", req.LogPrefix, req)
-			logging.Infof("%s RESPONSE status:(error = %s), requestId: %v", req.LogPrefix, err, req.RequestId)
+			log := req.logger()
+			log.Infof("%s REQUEST %s", req.LogPrefix, req)
+			log.Infof("%s RESPONSE status:(error = %s)", req.LogPrefix, err)
 		}
 		s.handleError(req.LogPrefix, w.Error(err))
 		return true
@@ -903,6 +915,294 @@ func (s *scanCoordinator) updateItemsCount(instId common.IndexInstId, idxStats *
 	return nil
 }
 
+// GET /verifyIndex?bucket=<bucket>&index=<name>[&limit=<n>]
+//
+// Compare the latest snapshot of a local index with the documents of its
+// bucket, replayed from KV up to the snapshot timestamp, and respond with
+// a VerifyReport.
+func (s *scanCoordinator) handleVerifyIndexReq(w http.ResponseWriter, r *http.Request) {
+	creds, valid, err := common.IsAuthValid(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	} else if valid == false {
+		http.Error(w, "401 Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	if r.Method != "GET" {
+		http.Error(w, "Unsupported method", http.StatusMethodNotAllowed)
+		return
+	}
+
+	q := r.URL.Query()
+	bucket, name := q.Get("bucket"), q.Get("index")
+	if bucket == "" || name == "" {
+		http.Error(w, "bucket and index are required", http.StatusBadRequest)
+		return
+	}
+	limit := defaultVerifyReportLimit
+	if val := q.Get("limit"); val != "" {
+		if limit, err = strconv.Atoi(val); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+	}
+
+	permissions := []string{
+		fmt.Sprintf("cluster.bucket[%s].n1ql.index!list", bucket),
+		fmt.Sprintf("cluster.bucket[%s].data.docs!read", bucket),
+	}
+	if !common.IsAllAllowed(creds, permissions, w) {
+		return
+	}
+
+	report, err := s.verifyIndex(bucket, name, limit)
+	if err == common.ErrIndexNotFound {
+		http.Error(w, err.Error(), http.StatusNotFound)
+		return
+	} else if err != nil {
+		logging.Errorf("%v verifyIndex %v:%v failed: %v", s.logPrefix, bucket, name, err)
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	data, err := json.Marshal(report)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	w.Write(data)
+}
+
+func (s *scanCoordinator) verifyIndex(bucket, name string, limit int) (*VerifyReport, error) {
+	inst, ctxs, is, err := s.getLocalIndexSnapshot(bucket, name)
+	if err != nil {
+		return nil, err
+	}
+	defer DestroyIndexSnapshot(is)
+
+	logging.Infof("%v verifyIndex %v:%v inst %v started", s.logPrefix, bucket, name, inst.InstId)
+	verifier, err := newIndexVerifier(*inst, ctxs, limit)
+	if err != nil {
+		return nil, err
+	}
+	cfg := s.config.Load()
+	src := &dcpBackfill{
+		cluster: cfg["clusterAddr"].String(),
+		timeout: time.Duration(cfg["settings.verify_timeout"].Int()) * time.Millisecond,
+	}
+	report, err := verifier.Verify(is, src)
+	if err == nil {
+		fmsg := "%v verifyIndex %v:%v inst %v done: missing %v extra %v mismatched %v"
+		logging.Infof(fmsg, s.logPrefix, bucket, name, inst.InstId,
+			report.NumMissing, report.NumExtra, report.NumMismatched)
+	}
+	return report, err
+}
+
+// handleExportIndexReq writes a point-in-time snapshot of the local
+// partitions of an index in the portable export format.
+func (s *scanCoordinator) handleExportIndexReq(w http.ResponseWriter, r *http.Request) {
+	creds, valid, err := common.IsAuthValid(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	} else if valid == false {
+		http.Error(w, "401 Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	if r.Method != "GET" {
+		http.Error(w, "Unsupported method", http.StatusMethodNotAllowed)
+		return
+	}
+
+	q := r.URL.Query()
+	bucket, name := q.Get("bucket"), q.Get("index")
+	if bucket == "" || name == "" {
+		http.Error(w, "bucket and index are required", http.StatusBadRequest)
+		return
+	}
+
+	permissions := []string{
+		fmt.Sprintf("cluster.bucket[%s].n1ql.index!list", bucket),
+		fmt.Sprintf("cluster.bucket[%s].data.docs!read", bucket),
+	}
+	if !common.IsAllAllowed(creds, permissions, w) {
+		return
+	}
+
+	inst, ctxs, is, err := s.getLocalIndexSnapshot(bucket, name)
+	if err == common.ErrIndexNotFound {
+		http.Error(w, err.Error(), http.StatusNotFound)
+		return
+	} else if err != nil {
+		logging.Errorf("%v exportIndex %v:%v failed: %v", s.logPrefix, bucket, name, err)
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	// snapshot is held from here on, every return below releases it
+	defer DestroyIndexSnapshot(is)
+
+	exporter, err := newIndexExporter(*inst, ctxs, w, r.Context().Done())
+	if err != nil {
+		logging.Errorf("%v exportIndex %v:%v failed: %v", s.logPrefix, bucket, name, err)
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	// client went away while waiting for the snapshot
+	if err := r.Context().Err(); err != nil {
+		logging.Warnf("%v exportIndex %v:%v cancelled: %v", s.logPrefix, bucket, name, err)
+		return
+	}
+
+	logging.Infof("%v exportIndex %v:%v inst %v started", s.logPrefix, bucket, name, inst.InstId)
+	filename := fmt.Sprintf("%v_%v.gsix", bucket, name)
+	w.Header().Set("Content-Type", "application/octet-stream")
+	w.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=%q", filename))
+	w.WriteHeader(http.StatusOK)
+
+	// response is already on its way, an error leaves the file truncated
+	count, err := exporter.Export(is)
+	if err == common.ErrClientCancel {
+		logging.Warnf("%v exportIndex %v:%v cancelled by client", s.logPrefix, bucket, name)
+		return
+	} else if err != nil {
+		logging.Errorf("%v exportIndex %v:%v failed: %v", s.logPrefix, bucket, name, err)
+		return
+	}
+	logging.Infof("%v exportIndex %v:%v inst %v done: %v docs", s.logPrefix, bucket, name, inst.InstId, count)
+}
+
+// getLocalIndexSnapshot returns the active instance named `name` of
+// `bucket`, a reader context for each of its local partitions and its
+// latest snapshot. Caller must destroy the snapshot once done with it.
+func (s *scanCoordinator) getLocalIndexSnapshot(bucket, name string) (*common.IndexInst,
+	map[common.PartitionId]IndexReaderContext, IndexSnapshot, error) {
+
+	inst, ctxs, err := func() (*common.IndexInst, map[common.PartitionId]IndexReaderContext, error) {
+		s.mu.RLock()
+		defer s.mu.RUnlock()
+
+		for _, inst := range s.indexInstMap {
+			if inst.Defn.Bucket != bucket || inst.Defn.Name != name ||
+				inst.State != common.INDEX_STATE_ACTIVE {
+				continue
+			}
+			if pmap, ok := s.indexPartnMap[inst.InstId]; ok {
+				ctxs := make(map[common.PartitionId]IndexReaderContext)
+				for partnId, partition := range pmap {
+					ctxs[partnId] = partition.Sc.GetSliceById(0).GetReaderContext()
+				}
+				return &inst, ctxs, nil
+			}
+		}
+		return nil, nil, common.ErrIndexNotFound
+	}()
+	if err != nil {
+		return nil, nil, nil, err
+	}
+
+	snapResch := make(chan interface{}, 1)
+	s.supvMsgch <- &MsgIndexSnapRequest{
+		cons:      common.AnyConsistency,
+		respch:    snapResch,
+		idxInstId: inst.InstId,
+	}
+
+	var is IndexSnapshot
+	switch msg := (<-snapResch).(type) {
+	case IndexSnapshot:
+		is = msg
+	case error:
+		return nil, nil, nil, msg
+	}
+	if is == nil {
+		return nil, nil, nil, ErrSnapNotAvailable
+	}
+	return inst, ctxs, is, nil
+}
+
+// handleImportIndexReq seeds an index, created but not yet built, from an
+// export file in the request body. Building the index afterwards catches
+// up from KV starting at the timestamp of the export.
+func (s *scanCoordinator) handleImportIndexReq(w http.ResponseWriter, r *http.Request) {
+	creds, valid, err := common.IsAuthValid(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	} else if valid == false {
+		http.Error(w, "401 Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	if r.Method != "POST" {
+		http.Error(w, "Unsupported method", http.StatusMethodNotAllowed)
+		return
+	}
+
+	q := r.URL.Query()
+	bucket, name := q.Get("bucket"), q.Get("index")
+	if bucket == "" || name == "" {
+		http.Error(w, "bucket and index are required", http.StatusBadRequest)
+		return
+	}
+
+	permissions := []string{
+		fmt.Sprintf("cluster.bucket[%s].n1ql.index!create", bucket),
+	}
+	if !common.IsAllAllowed(creds, permissions, w) {
+		return
+	}
+
+	report, err := s.importIndex(bucket, name, r.Body)
+	switch err {
+	case nil:
+	case common.ErrIndexNotFound:
+		http.Error(w, err.Error(), http.StatusNotFound)
+		return
+	case ErrImportInProgress, ErrImportInvalidState:
+		http.Error(w, err.Error(), http.StatusConflict)
+		return
+	default:
+		logging.Errorf("%v importIndex %v:%v failed: %v", s.logPrefix, bucket, name, err)
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	data, err := json.Marshal(report)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	w.Write(data)
+}
+
+// importIndex hands the import over to indexer, so that it is serialized
+// with build and drop of the index.
+func (s *scanCoordinator) importIndex(bucket, name string, r io.Reader) (*ImportReport, error) {
+	respch := make(chan interface{}, 1)
+	s.supvMsgch <- &MsgImportIndex{mType: INDEXER_IMPORT_INDEX,
+		bucket: bucket,
+		name:   name,
+		reader: r,
+		respch: respch}
+
+	switch resp := (<-respch).(type) {
+	case *ImportReport:
+		return resp, nil
+	case error:
+		return nil, resp
+	}
+	return nil, ErrInconsistentState
+}
+
 /////////////////////////////////////////////////////////////////////////
 //
 // utility methods
@@ -645,10 +645,27 @@ func projectKeys(compositekeys [][]byte, key, buf []byte, projection *Projection
 		}
 	}
 
+	entry := secondaryIndexEntry(key)
+
+	var includekeys [][]byte
+	if include := entry.includeBytes(); include != nil {
+		tmp := make([]byte, 0, len(include)+RESIZE_PAD)
+		if includekeys, err = jsonEncoder.ExplodeArray(include, tmp); err != nil {
+			return nil, err
+		}
+	}
+
 	var keysToJoin [][]byte
 	for i, projectKey := range projection.projectionKeys {
-		if projectKey {
+		if !projectKey {
+			continue
+		}
+		if i < projection.numKeys {
 			keysToJoin = append(keysToJoin, compositekeys[i])
+		} else if j := i - projection.numKeys; j < len(includekeys) {
+			keysToJoin = append(keysToJoin, includekeys[j])
+		} else {
+			return nil, ErrIncludeKeyMissing
 		}
 	}
 	// Note: Reusing the same buf used for Explode in JoinArray as well
@@ -658,7 +675,6 @@ func projectKeys(compositekeys [][]byte, key, buf []byte, projection *Projection
 		return nil, err
 	}
 
-	entry := secondaryIndexEntry(key)
 	buf = append(buf, key[entry.lenKey():]...)
 	return buf, nil
 }
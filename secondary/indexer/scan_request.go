@@ -63,6 +63,7 @@ type ScanRequest struct {
 	Incl      Inclusion
 	Limit     int64
 	isPrimary bool
+	codec     *collatejson.Codec // nil for binary collation
 
 	// New parameters for spock
 	Scans             []Scan
@@ -103,6 +104,7 @@ type ScanRequest struct {
 type Projection struct {
 	projectSecKeys   bool
 	projectionKeys   []bool
+	numKeys          int // projectionKeys beyond numKeys are include columns
 	entryKeysEmpty   bool
 	projectGroupKeys []projGroup
 }
@@ -357,7 +359,8 @@ func NewScanRequest(protoReq interface{},
 		if proj != nil {
 			var localerr error
 			if req.GetGroupAggr() == nil {
-				if r.Indexprojection, localerr = validateIndexProjection(proj, len(r.IndexInst.Defn.SecExprs)); localerr != nil {
+				if r.Indexprojection, localerr = validateIndexProjection(proj, len(r.IndexInst.Defn.SecExprs),
+					len(r.IndexInst.Defn.Include)); localerr != nil {
 					err = localerr
 					return
 				}
@@ -416,6 +419,13 @@ func NewScanRequest(protoReq interface{},
 	return
 }
 
+// logger returns a structured logger tagged with index and request id, so
+// that a scan can be correlated between client and indexer logs.
+func (r *ScanRequest) logger() *logging.Entry {
+	log := scanLogger.WithIndex(r.Bucket, r.IndexName, uint64(r.IndexInstId))
+	return log.WithReqId(r.RequestId).With("scanId", r.ScanId)
+}
+
 func (r *ScanRequest) getTimeoutCh() <-chan time.Time {
 	if r.Timeout != nil {
 		return r.Timeout.C
@@ -470,7 +480,7 @@ func (r *ScanRequest) newLowKey(k []byte) (IndexKey, error) {
 		return MinIndexKey, nil
 	}
 
-	return r.newKey(k)
+	return r.newBoundKey(k)
 }
 
 func (r *ScanRequest) newHighKey(k []byte) (IndexKey, error) {
@@ -478,7 +488,17 @@ func (r *ScanRequest) newHighKey(k []byte) (IndexKey, error) {
 		return MaxIndexKey, nil
 	}
 
-	return r.newKey(k)
+	return r.newBoundKey(k)
+}
+
+// Strings of a collated index are encoded with sort key, followed by
+// tie-breaks. Bounds are encoded without tie-breaks, so that they match
+// all strings equal by collation.
+func (r *ScanRequest) newBoundKey(k []byte) (IndexKey, error) {
+	if r.codec == nil {
+		return r.newKey(k)
+	}
+	return NewCollatedSecondaryKey(k, r.getKeyBuffer(), r.codec, collatejson.TieNone)
 }
 
 func (r *ScanRequest) fillRanges(low, high []byte, keys [][]byte) (localErr error) {
@@ -667,6 +687,10 @@ func (r *ScanRequest) fillFilterLowHigh(compFilters []CompositeElementFilter, fi
 }
 
 func (r *ScanRequest) fillFilterEquals(protoScan *protobuf.Scan, filter *Filter) error {
+	if r.codec != nil {
+		return r.fillCollatedFilterEquals(protoScan, filter)
+	}
+
 	var e error
 	var equals [][]byte
 	for _, k := range protoScan.Equals {
@@ -712,6 +736,37 @@ func (r *ScanRequest) fillFilterEquals(protoScan *protobuf.Scan, filter *Filter)
 	return nil
 }
 
+// Strings equal by collation may differ in their encoding, hence each
+// equals key of a collated index is scanned as a range of keys having
+// same sort key.
+func (r *ScanRequest) fillCollatedFilterEquals(protoScan *protobuf.Scan, filter *Filter) error {
+	var compFilters []CompositeElementFilter
+	for _, k := range protoScan.Equals {
+		low, e := r.newLowKey(k)
+		if e != nil {
+			return fmt.Errorf("Invalid equal key %s (%s)", string(k), e)
+		}
+		high, e := r.newHighKey(k)
+		if e != nil {
+			return fmt.Errorf("Invalid equal key %s (%s)", string(k), e)
+		}
+		fl := CompositeElementFilter{
+			Low:       low,
+			High:      high,
+			Inclusion: Both,
+		}
+		compFilters = append(compFilters, fl)
+	}
+
+	if e := r.fillFilterLowHigh(compFilters, filter); e != nil {
+		return e
+	}
+	filter.Inclusion = Both
+	filter.CompositeFilters = compFilters
+	filter.ScanType = FilterRangeReq
+	return nil
+}
+
 ///// Compose Scans for Secondary Index
 // Create scans from sorted Index Points
 // Iterate over sorted points and keep track of applicable filters
@@ -1087,6 +1142,10 @@ func (r *ScanRequest) setIndexParams() (localErr error) {
 		if indexInst.State != common.INDEX_STATE_ACTIVE {
 			localErr = common.ErrIndexNotReady
 		}
+		if collation := indexInst.Defn.Collation; collation != "" && localErr == nil {
+			r.codec = collatejson.NewCodec(16)
+			localErr = r.codec.SetCollation(collation)
+		}
 		r.Stats = stats.indexes[r.IndexInstId]
 		rbMap := *r.sco.getRollbackInProgress()
 		r.hasRollback = rbMap[indexInst.Defn.Bucket]
@@ -1094,7 +1153,10 @@ func (r *ScanRequest) setIndexParams() (localErr error) {
 	return
 }
 
-func validateIndexProjection(projection *protobuf.IndexProjection, cklen int) (*Projection, error) {
+// Entry keys of projection refer to index keys followed by include
+// columns, numKeys being the number of index keys.
+func validateIndexProjection(projection *protobuf.IndexProjection, numKeys, numInclude int) (*Projection, error) {
+	cklen := numKeys + numInclude
 	if len(projection.EntryKeys) > cklen {
 		e := errors.New(fmt.Sprintf("Invalid number of Entry Keys %v in IndexProjection", len(projection.EntryKeys)))
 		return nil, e
@@ -1110,16 +1172,25 @@ func validateIndexProjection(projection *protobuf.IndexProjection, cklen int) (*
 	}
 
 	projectAllSecKeys := true
-	for _, sp := range projectionKeys {
+	for _, sp := range projectionKeys[:numKeys] {
 		if sp == false {
 			projectAllSecKeys = false
 		}
 	}
 
+	// Include columns are not part of the secondary key
+	projectInclude := false
+	for _, sp := range projectionKeys[numKeys:] {
+		if sp {
+			projectInclude = true
+		}
+	}
+
 	indexProjection := &Projection{}
-	indexProjection.projectSecKeys = !projectAllSecKeys
+	indexProjection.projectSecKeys = !projectAllSecKeys || projectInclude
 	indexProjection.projectionKeys = projectionKeys
 	indexProjection.entryKeysEmpty = len(projection.EntryKeys) == 0
+	indexProjection.numKeys = numKeys
 
 	return indexProjection, nil
 }
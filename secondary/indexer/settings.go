@@ -15,7 +15,6 @@ import (
 	"fmt"
 
 	"github.com/couchbase/cbauth"
-	"github.com/couchbase/cbauth/metakv"
 	"github.com/couchbase/indexing/secondary/common"
 	"github.com/couchbase/indexing/secondary/logging"
 	"github.com/couchbase/indexing/secondary/pipeline"
@@ -77,7 +76,7 @@ func NewSettingsManager(supvCmdch MsgChannel,
 			if r > 0 {
 				logging.Errorf("IndexerSettingsManager: metakv notifier failed (%v)..Restarting %v", err, r)
 			}
-			err = metakv.RunObserveChildren("/", s.metaKVCallback, s.cancelCh)
+			err = common.GetMetadataStore().RunObserveChildren("/", s.metaKVCallback, s.cancelCh)
 			return err
 		}
 		rh := common.NewRetryHelper(MAX_METAKV_RETRIES, time.Second, 2, fn)
@@ -143,7 +142,7 @@ func (s *settingsManager) handleSettings(w http.ResponseWriter, r *http.Request,
 		bytes, _ := ioutil.ReadAll(r.Body)
 
 		config := s.config.FilterConfig(".settings.")
-		current, rev, err := metakv.Get(common.IndexingSettingsMetaPath)
+		current, rev, err := common.GetMetadataStore().Get(common.IndexingSettingsMetaPath)
 		if err == nil {
 			if len(current) > 0 {
 				config.Update(current)
@@ -166,7 +165,7 @@ func (s *settingsManager) handleSettings(w http.ResponseWriter, r *http.Request,
 
 		//settingsConfig := config.FilterConfig(".settings.")
 		newSettingsBytes := config.Json()
-		if err = metakv.Set(common.IndexingSettingsMetaPath, newSettingsBytes, rev); err != nil {
+		if err = common.GetMetadataStore().Set(common.IndexingSettingsMetaPath, newSettingsBytes, rev); err != nil {
 			s.writeError(w, err)
 			return
 		}
@@ -204,14 +203,14 @@ func (s *settingsManager) handleCompactionTrigger(w http.ResponseWriter, r *http
 		return
 	}
 
-	_, rev, err := metakv.Get(indexCompactonMetaPath)
+	_, rev, err := common.GetMetadataStore().Get(indexCompactonMetaPath)
 	if err != nil {
 		s.writeError(w, err)
 		return
 	}
 
 	newToken := time.Now().String()
-	if err = metakv.Set(indexCompactonMetaPath, []byte(newToken), rev); err != nil {
+	if err = common.GetMetadataStore().Set(indexCompactonMetaPath, []byte(newToken), rev); err != nil {
 		s.writeError(w, err)
 		return
 	}
@@ -257,7 +256,7 @@ func (s *settingsManager) metaKVCallback(path string, value []byte, rev interfac
 
 		upgradedConfig, upgraded := tryUpgradeConfig(value)
 		if upgraded {
-			if err := metakv.Set(common.IndexingSettingsMetaPath, upgradedConfig, rev); err != nil {
+			if err := common.GetMetadataStore().Set(common.IndexingSettingsMetaPath, upgradedConfig, rev); err != nil {
 				return err
 			}
 			return nil
@@ -343,6 +342,17 @@ func setLogger(config common.Config) {
 	level := logging.Level(logLevel)
 	logging.Infof("Setting log level to %v", level)
 	logging.SetLogLevel(level)
+
+	format := logging.Format(config["indexer.settings.log_format"].String())
+	logging.Infof("Setting log format to %v", format)
+	logging.SetLogFormat(format)
+
+	levels := config["indexer.settings.log_component_levels"].String()
+	if err := logging.SetComponentLevels(levels); err != nil {
+		logging.Errorf("Setting component log levels failed: %v", err)
+	} else {
+		logging.Infof("Setting component log levels to %q", levels)
+	}
 }
 
 func setBlockPoolSize(o, n common.Config) {
@@ -45,6 +45,10 @@ type BucketStats struct {
 
 	tsQueueSize   stats.Int64Val
 	numNonAlignTS stats.Int64Val
+
+	//number of mutations not streamed again as initial build resumed
+	//from the restart timestamp of INIT_STREAM
+	numInitBuildSkipped stats.Int64Val
 }
 
 func (s *BucketStats) Init() {
@@ -53,6 +57,7 @@ func (s *BucketStats) Init() {
 	s.numMutationsQueued.Init()
 	s.tsQueueSize.Init()
 	s.numNonAlignTS.Init()
+	s.numInitBuildSkipped.Init()
 }
 
 type IndexTimingStats struct {
@@ -141,6 +146,7 @@ type IndexStats struct {
 	lastNumFlushQueued        stats.Int64Val
 	lastTsTime                stats.Int64Val
 	numDocsFlushQueued        stats.Int64Val
+	numPredicateExitDeletes   stats.Int64Val
 	fragPercent               stats.Int64Val
 	sinceLastSnapshot         stats.Int64Val
 	numSnapshotWaiters        stats.Int64Val
@@ -221,6 +227,7 @@ func (s *IndexStats) Init() {
 	s.numCompactions.Init()
 	s.numItemsFlushed.Init()
 	s.numDocsFlushQueued.Init()
+	s.numPredicateExitDeletes.Init()
 	s.sinceLastSnapshot.Init()
 	s.numSnapshotWaiters.Init()
 	s.numLastSnapshotReply.Init()
@@ -457,6 +464,9 @@ func (is IndexerStats) GetStats(getPartition bool, skipEmpty bool) common.Statis
 	addStat("storage_mode", storageMode)
 	addStat("num_cpu_core", num_cpu_core)
 	addStat("cpu_utilization", getCpuPercent())
+	storageDiskTotal, storageDiskAvail := getDiskUsage()
+	addStat("storage_disk_total", int64(storageDiskTotal))
+	addStat("storage_disk_avail", int64(storageDiskAvail))
 
 	indexerState := common.IndexerState(is.indexerState.Value())
 	if indexerState == common.INDEXER_PREPARE_UNPAUSE {
@@ -657,6 +667,11 @@ func (is IndexerStats) GetStats(getPartition bool, skipEmpty bool) common.Statis
 			s.partnInt64Stats(func(ss *IndexStats) int64 {
 				return ss.numDocsFlushQueued.Value()
 			}))
+		// partition stats
+		addStat("num_predicate_exit_deletes",
+			s.partnInt64Stats(func(ss *IndexStats) int64 {
+				return ss.numPredicateExitDeletes.Value()
+			}))
 		addStat("since_last_snapshot",
 			s.int64Stats(func(ss *IndexStats) int64 {
 				return ss.sinceLastSnapshot.Value()
@@ -809,6 +824,7 @@ func (is IndexerStats) GetStats(getPartition bool, skipEmpty bool) common.Statis
 		addStat("num_mutations_queued", s.numMutationsQueued.Value())
 		addStat("ts_queue_size", s.tsQueueSize.Value())
 		addStat("num_nonalign_ts", s.numNonAlignTS.Value())
+		addStat("num_init_build_skipped", s.numInitBuildSkipped.Value())
 		if st := common.BucketSeqsTiming(s.bucket); st != nil {
 			addStat("timings/dcp_getseqs", st.Value())
 		}
@@ -1018,7 +1034,7 @@ func NewStatsManager(supvCmdch MsgChannel,
 	http.HandleFunc("/stats/reset", s.handleStatsResetReq)
 	go s.run()
 	go s.runStatsDumpLogger()
-	StartCpuCollector()
+	StartCpuCollector(config["storage_dir"].String())
 	return s, &MsgSuccess{}
 }
 
@@ -60,6 +60,12 @@ type mutationStreamReader struct {
 	streamWorkers []*streamWorker
 
 	config common.Config
+
+	mutationRate    int64        //max mutations per second for INIT_STREAM, 0 for no limit
+	buildBuckets    atomic.Value //map[string]bool, buckets with index in initial build
+	rateLock        sync.Mutex
+	rateWindowStart time.Time //start of the current rate limit window
+	rateWindowCount int64     //mutations read in the current rate limit window
 }
 
 //CreateMutationStreamReader creates a new mutation stream and starts
@@ -109,6 +115,7 @@ func CreateMutationStreamReader(streamId common.StreamId, bucketQueueMap BucketQ
 	}
 
 	r.stats.Set(stats)
+	r.setMutationRate(config)
 
 	logging.Infof("MutationStreamReader: Setting Stream Workers %v %v", r.streamId, numWorkers)
 
@@ -228,6 +235,58 @@ func (r *mutationStreamReader) handleVbKeyVersions(vbKeyVers []*protobuf.VbKeyVe
 
 }
 
+//throttleDelay returns how long a stream worker has to wait before queuing
+//a mutation of the bucket, so that initial build is slowed down and
+//MAINT_STREAM can keep up. Mutations not read stay in the dataport buffers
+//and push back on the projector. Buckets in CATCHUP are not throttled, so
+//that they can catch up with MAINT_STREAM.
+func (r *mutationStreamReader) throttleDelay(bucket string) time.Duration {
+
+	rate := atomic.LoadInt64(&r.mutationRate)
+	if rate <= 0 {
+		return 0
+	}
+
+	if buckets, _ := r.buildBuckets.Load().(map[string]bool); !buckets[bucket] {
+		return 0
+	}
+
+	r.rateLock.Lock()
+	defer r.rateLock.Unlock()
+
+	now := time.Now()
+	if now.Sub(r.rateWindowStart) >= time.Second {
+		r.rateWindowStart = now
+		r.rateWindowCount = 0
+	}
+	r.rateWindowCount++
+
+	//time by which the mutations in the window are due at the given rate
+	due := r.rateWindowStart.Add(time.Duration(r.rateWindowCount * int64(time.Second) / rate))
+	return due.Sub(now)
+}
+
+//setBuildBuckets records the buckets that have index in initial build,
+//i.e. in INITIAL state, on this stream.
+func (r *mutationStreamReader) setBuildBuckets(indexInstMap common.IndexInstMap) {
+
+	buckets := make(map[string]bool)
+	for _, inst := range indexInstMap {
+		if inst.Stream == r.streamId && inst.State == common.INDEX_STATE_INITIAL {
+			buckets[inst.Defn.Bucket] = true
+		}
+	}
+	r.buildBuckets.Store(buckets)
+}
+
+func (r *mutationStreamReader) setMutationRate(config common.Config) {
+
+	rate := int64(config["settings.build.mutation_rate"].Int())
+	if old := atomic.SwapInt64(&r.mutationRate, rate); old != rate {
+		logging.Infof("MutationStreamReader: Stream %v mutation rate %v", r.streamId, rate)
+	}
+}
+
 //handleStreamInfoMsg handles the error messages from Dataport
 func (r *mutationStreamReader) handleStreamInfoMsg(msg interface{}) {
 
@@ -305,6 +364,14 @@ func (r *mutationStreamReader) handleSupervisorCommands(cmd Message) Message {
 		r.setIndexerState(common.INDEXER_PAUSED)
 		return &MsgSuccess{}
 
+	case CONFIG_SETTINGS_UPDATE:
+		r.setMutationRate(cmd.(*MsgConfigUpdate).GetConfig())
+		return &MsgSuccess{}
+
+	case UPDATE_INDEX_INSTANCE_MAP:
+		r.setBuildBuckets(cmd.(*MsgUpdateInstMap).GetIndexInstMap())
+		return &MsgSuccess{}
+
 	default:
 		logging.Errorf("MutationStreamReader::handleSupervisorCommands Received Unknown Command %v", cmd)
 		return &MsgError{
@@ -588,7 +655,7 @@ func (w *streamWorker) handleSingleKeyVersion(bucket string, vbucket Vbucket, vb
 		switch byte(cmd) {
 
 		//case protobuf.Command_Upsert, protobuf.Command_Deletion, protobuf.Command_UpsertDeletion:
-		case common.Upsert, common.Deletion, common.UpsertDeletion:
+		case common.Upsert, common.Deletion, common.UpsertDeletion, common.UpsertNoop:
 
 			//As there can multiple keys in a KeyVersion for a mutation,
 			//filter needs to be evaluated and set only once.
@@ -626,17 +693,13 @@ func (w *streamWorker) handleSingleKeyVersion(bucket string, vbucket Vbucket, vb
 				mutk.mut = mutk.mut[:0]
 			}
 
-			mut := NewMutation()
-			mut.uuid = common.IndexInstId(kv.GetUuids()[i])
-			mut.key = append(mut.key, kv.GetKeys()[i]...)
-			mut.command = byte(kv.GetCommands()[i])
-
-			// For backward compatibilty, projector may not send partnkey pre-5.1.
-			if len(kv.GetPartnkeys()) != 0 && len(kv.GetPartnkeys()[i]) != 0 {
-				mut.partnkey = append(mut.partnkey, kv.GetPartnkeys()[i]...)
+			// key is unchanged, only the seqno is to be queued, so that
+			// flusher can dequeue upto the seqno in stream's timestamp.
+			if byte(cmd) == common.UpsertNoop {
+				continue
 			}
 
-			mutk.mut = append(mutk.mut, mut)
+			mutk.mut = append(mutk.mut, newKeyVersionMutation(kv, i))
 
 		case common.DropData:
 			//send message to supervisor to take decision
@@ -678,11 +741,37 @@ func (w *streamWorker) handleSingleKeyVersion(bucket string, vbucket Vbucket, vb
 
 	//place secKey in the right worker's queue
 	if mutk != nil {
+		if wait := w.reader.throttleDelay(bucket); wait > 0 {
+			select {
+			case <-time.After(wait):
+			case <-w.workerStopCh:
+				mutk.Free()
+				return
+			}
+		}
 		w.handleSingleMutation(mutk, w.reader.stopch)
 	}
 
 }
 
+//newKeyVersionMutation returns the Mutation for i-th key-version of kv
+func newKeyVersionMutation(kv *protobuf.KeyVersions, i int) *Mutation {
+
+	mut := NewMutation()
+	mut.uuid = common.IndexInstId(kv.GetUuids()[i])
+	mut.key = append(mut.key, kv.GetKeys()[i]...)
+	mut.command = byte(kv.GetCommands()[i])
+	if mut.command == common.UpsertDeletion {
+		mut.exit = kv.IsPredicateExit(uint64(mut.uuid))
+	}
+
+	// For backward compatibilty, projector may not send partnkey pre-5.1.
+	if len(kv.GetPartnkeys()) != 0 && len(kv.GetPartnkeys()[i]) != 0 {
+		mut.partnkey = append(mut.partnkey, kv.GetPartnkeys()[i]...)
+	}
+	return mut
+}
+
 //handleSingleMutation enqueues mutation in the mutation queue
 func (w *streamWorker) handleSingleMutation(mut *MutationKeys, stopch StopChannel) {
 
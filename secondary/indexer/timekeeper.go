@@ -255,6 +255,7 @@ func (tk *timekeeper) handleStreamOpen(cmd Message) {
 		}
 		tk.ss.setRollbackTime(bucket, rollbackTime)
 		tk.addIndextoStream(cmd)
+		tk.updateInitBuildSkipped(streamId, bucket, restartTs)
 		tk.startTimer(streamId, bucket)
 
 	//repair
@@ -349,6 +350,44 @@ func (tk *timekeeper) handleAddIndextoStream(cmd Message) {
 	tk.supvCmdch <- &MsgSuccess{}
 }
 
+//updateInitBuildSkipped accounts for the mutations that need not be
+//streamed again when initial build resumes from the restart timestamp
+func (tk *timekeeper) updateInitBuildSkipped(streamId common.StreamId,
+	bucket string, restartTs *common.TsVbuuid) {
+
+	if restartTs == nil || streamId != common.INIT_STREAM {
+		return
+	}
+
+	initial := false
+	for _, buildInfo := range tk.indexBuildInfo {
+		idx := buildInfo.indexInst
+		if idx.Defn.Bucket == bucket &&
+			idx.Stream == streamId &&
+			idx.State == common.INDEX_STATE_INITIAL {
+			initial = true
+			break
+		}
+	}
+	if !initial {
+		return
+	}
+
+	var skipped uint64
+	for _, seqno := range restartTs.Seqnos {
+		skipped += seqno
+	}
+
+	stats := tk.stats.Get()
+	if stat, ok := stats.buckets[bucket]; ok {
+		stat.numInitBuildSkipped.Add(int64(skipped))
+	}
+
+	logging.Infof("Timekeeper::updateInitBuildSkipped Stream %v Bucket %v "+
+		"Resume Initial Build From Restart Ts. Skipped %v Mutations.",
+		streamId, bucket, skipped)
+}
+
 func (tk *timekeeper) addIndextoStream(cmd Message) {
 
 	indexInstList := cmd.(*MsgStreamUpdate).GetIndexList()
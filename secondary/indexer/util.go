@@ -16,6 +16,7 @@ import (
 	"time"
 
 	"github.com/couchbase/indexing/secondary/common"
+	couchbase "github.com/couchbase/indexing/secondary/dcp"
 	"github.com/couchbase/indexing/secondary/logging"
 )
 
@@ -115,10 +116,40 @@ func GetCurrentKVTs(cluster, pooln, bucketn string, numVbs int) (Timestamp, erro
 	return ts, err
 }
 
+//GetFailoverLogs returns the failover log of every vbucket of the bucket,
+//as reported by KV.
+func GetFailoverLogs(cluster, pooln, bucketn string, numVbs int) (couchbase.FailoverLog, error) {
+
+	bucket, err := common.ConnectBucket(cluster, pooln, bucketn)
+	if err != nil {
+		return nil, err
+	}
+	defer bucket.Close()
+
+	vbnos := make([]uint16, numVbs)
+	for i := range vbnos {
+		vbnos[i] = uint16(i)
+	}
+	dcpConfig := map[string]interface{}{
+		"genChanSize":    16,
+		"dataChanSize":   16,
+		"numConnections": 1,
+	}
+	flogs, err := bucket.GetFailoverLogs(0xABCD, vbnos, dcpConfig)
+	if err != nil {
+		logging.Errorf("Indexer::getFailoverLogs Bucket %v Error %v", bucketn, err)
+		return nil, err
+	}
+	if len(flogs) < numVbs {
+		return nil, fmt.Errorf("GetFailoverLogs(): got logs only for %v vbs", len(flogs))
+	}
+	return flogs, nil
+}
+
 func ValidateBucket(cluster, bucket string, uuids []string) bool {
 
 	var cinfo *common.ClusterInfoCache
-	url, err := common.ClusterAuthUrl(cluster)
+	url, err := common.ClusterInfoUrl(cluster)
 	if err == nil {
 		cinfo, err = common.NewClusterInfoCache(url, DEFAULT_POOL)
 	}
@@ -153,7 +184,7 @@ func ValidateBucket(cluster, bucket string, uuids []string) bool {
 
 func IsEphemeral(cluster, bucket string) (bool, error) {
 	var cinfo *common.ClusterInfoCache
-	url, err := common.ClusterAuthUrl(cluster)
+	url, err := common.ClusterInfoUrl(cluster)
 	if err == nil {
 		cinfo, err = common.NewClusterInfoCache(url, DEFAULT_POOL)
 	}
@@ -185,7 +216,7 @@ func FlipBits(code []byte) {
 func GetBucketUUID(cluster, bucket string) string {
 
 	var cinfo *common.ClusterInfoCache
-	url, err := common.ClusterAuthUrl(cluster)
+	url, err := common.ClusterInfoUrl(cluster)
 	if err == nil {
 		cinfo, err = common.NewClusterInfoCache(url, DEFAULT_POOL)
 	}
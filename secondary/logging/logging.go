@@ -233,11 +233,14 @@ func (log *destination) IsEnabled(at LogLevel) bool {
 
 func (log *destination) printf(at LogLevel, format string, v ...interface{}) {
 	if log.IsEnabled(at) {
-		ts := time.Now().Format("2006-01-02T15:04:05.000-07:00")
-		log.target.Printf(ts+" ["+at.String()+"] "+format, v...)
+		log.output(at, "", nil, fmt.Sprintf(format, v...))
 	}
 }
 
+func (log *destination) timestamp() string {
+	return time.Now().Format("2006-01-02T15:04:05.000-07:00")
+}
+
 func (log *destination) getStackTrace(skip int, stack []byte) string {
 	var buf bytes.Buffer
 	lines := strings.Split(string(stack), "\n")
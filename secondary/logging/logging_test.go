@@ -2,6 +2,7 @@ package logging
 
 import (
 	"bytes"
+	"encoding/json"
 	"os"
 	"regexp"
 	"strings"
@@ -160,3 +161,81 @@ func StackMe() {
 	st := StackTrace()
 	SystemLogger.Errorf(st)
 }
+
+func TestLogComponentLevels(t *testing.T) {
+	buffer.Reset()
+	SetLogWriter(buffer)
+	defer SetLogWriter(os.Stdout)
+	defer SetComponentLevels("")
+
+	if err := SetComponentLevels("scan:debug, feed:error"); err != nil {
+		t.Fatal(err)
+	}
+	if s := ComponentLevels(); s != "feed:error,scan:debug" {
+		t.Errorf("ComponentLevels() failed %v", s)
+	}
+	Component("scan").Debugf("scandebug")
+	Component("feed").Infof("feedinfo")
+	Component("other").Debugf("otherdebug")
+	Debugf("basedebug")
+	s := string(buffer.Bytes())
+	if strings.Contains(s, "scandebug") == false {
+		t.Errorf("component Debugf() failed %v", s)
+	} else if strings.Contains(s, "feedinfo") == true {
+		t.Errorf("component Infof() failed %v", s)
+	} else if strings.Contains(s, "otherdebug") == true {
+		t.Errorf("component Debugf() failed %v", s)
+	} else if strings.Contains(s, "basedebug") == true {
+		t.Errorf("Debugf() failed %v", s)
+	}
+
+	if err := SetComponentLevels("scan:loud"); err == nil {
+		t.Errorf("expected error for invalid level")
+	}
+	if err := SetComponentLevels("scan"); err == nil {
+		t.Errorf("expected error for missing level")
+	}
+}
+
+func TestLogFormat(t *testing.T) {
+	SetLogWriter(buffer)
+	defer SetLogWriter(os.Stdout)
+	defer SetLogFormat(TextFormat)
+
+	log := Component("scan").WithIndex("default", "idx", 10).WithReqId("r1")
+
+	buffer.Reset()
+	log.Infof("scan done")
+	s := string(buffer.Bytes())
+	if !strings.Contains(s, "[Info] scan done component=scan bucket=default index=idx instId=10 reqId=r1") {
+		t.Errorf("text format failed %v", s)
+	}
+
+	buffer.Reset()
+	log.Errorf("%v ##%x engine started\n", "ENGN", 1)
+	s = string(buffer.Bytes())
+	expected := "##1 engine started component=scan bucket=default index=idx instId=10 reqId=r1\n"
+	if strings.Count(s, "\n") != 1 || !strings.HasSuffix(s, expected) {
+		t.Errorf("text format with trailing newline failed %q", s)
+	}
+
+	buffer.Reset()
+	SetLogFormat(JSONFormat)
+	log.Infof("scan \"done\"")
+	var m map[string]interface{}
+	if err := json.Unmarshal(buffer.Bytes(), &m); err != nil {
+		t.Fatalf("json format failed %v: %v", buffer.String(), err)
+	}
+	if m["level"] != "Info" || m["component"] != "scan" || m["bucket"] != "default" ||
+		m["instId"] != float64(10) || m["reqId"] != "r1" || m["msg"] != "scan \"done\"" {
+		t.Errorf("json format failed %v", m)
+	}
+
+	buffer.Reset()
+	SetLogFormat(LogfmtFormat)
+	Infof("plain message")
+	s = string(buffer.Bytes())
+	if !strings.HasPrefix(s, "ts=") || !strings.Contains(s, " level=Info msg=\"plain message\"") {
+		t.Errorf("logfmt format failed %v", s)
+	}
+}
@@ -0,0 +1,323 @@
+package logging
+
+import "bytes"
+import "encoding/json"
+import "fmt"
+import "sort"
+import "strconv"
+import "strings"
+import "sync"
+import "sync/atomic"
+
+// LogFormat selects how log lines are rendered.
+type LogFormat int32
+
+const (
+	// TextFormat is the classic "ts [Level] msg" line, structured fields
+	// are appended as key=value pairs.
+	TextFormat LogFormat = iota
+	// JSONFormat renders one JSON object per line.
+	JSONFormat
+	// LogfmtFormat renders one line of key=value pairs.
+	LogfmtFormat
+)
+
+// Well known field names carried by structured log entries.
+const (
+	FieldTs        = "ts"
+	FieldLevel     = "level"
+	FieldMsg       = "msg"
+	FieldComponent = "component"
+	FieldBucket    = "bucket"
+	FieldIndex     = "index"
+	FieldInstId    = "instId"
+	FieldReqId     = "reqId"
+)
+
+func (f LogFormat) String() string {
+	switch f {
+	case JSONFormat:
+		return "json"
+	case LogfmtFormat:
+		return "logfmt"
+	default:
+		return "text"
+	}
+}
+
+// Format converts a format name to LogFormat, defaults to TextFormat.
+func Format(s string) LogFormat {
+	switch strings.ToLower(s) {
+	case "json":
+		return JSONFormat
+	case "logfmt":
+		return LogfmtFormat
+	default:
+		return TextFormat
+	}
+}
+
+var logFormat int32 // LogFormat
+
+// SetLogFormat sets the format for all log lines.
+func SetLogFormat(f LogFormat) {
+	atomic.StoreInt32(&logFormat, int32(f))
+}
+
+// GetLogFormat returns the current log format.
+func GetLogFormat() LogFormat {
+	return LogFormat(atomic.LoadInt32(&logFormat))
+}
+
+//
+// Per component log levels
+//
+
+var componentLevels atomic.Value // map[string]LogLevel, copy on write
+var componentMu sync.Mutex
+
+func init() {
+	componentLevels.Store(map[string]LogLevel{})
+}
+
+// SetComponentLevel overrides the base log level for a component.
+func SetComponentLevel(component string, level LogLevel) {
+	componentMu.Lock()
+	defer componentMu.Unlock()
+
+	old := componentLevels.Load().(map[string]LogLevel)
+	levels := make(map[string]LogLevel, len(old)+1)
+	for c, l := range old {
+		levels[c] = l
+	}
+	levels[component] = level
+	componentLevels.Store(levels)
+}
+
+// SetComponentLevels replaces all component overrides with the ones
+// specified as "component:level,component:level". An empty string
+// clears all overrides.
+func SetComponentLevels(s string) error {
+	levels, err := ParseComponentLevels(s)
+	if err != nil {
+		return err
+	}
+	componentMu.Lock()
+	defer componentMu.Unlock()
+	componentLevels.Store(levels)
+	return nil
+}
+
+// ParseComponentLevels parses "component:level,component:level".
+func ParseComponentLevels(s string) (map[string]LogLevel, error) {
+	levels := map[string]LogLevel{}
+	for _, item := range strings.Split(s, ",") {
+		item = strings.TrimSpace(item)
+		if item == "" {
+			continue
+		}
+		parts := strings.Split(item, ":")
+		if len(parts) != 2 || strings.TrimSpace(parts[0]) == "" {
+			return nil, fmt.Errorf("invalid component log level %q", item)
+		}
+		name := strings.TrimSpace(parts[1])
+		level := Level(name)
+		if !strings.EqualFold(level.String(), name) {
+			return nil, fmt.Errorf("invalid log level %q for component %q",
+				name, parts[0])
+		}
+		levels[strings.TrimSpace(parts[0])] = level
+	}
+	return levels, nil
+}
+
+// ComponentLevels returns the current component overrides in the same
+// format accepted by SetComponentLevels.
+func ComponentLevels() string {
+	levels := componentLevels.Load().(map[string]LogLevel)
+	items := make([]string, 0, len(levels))
+	for c, l := range levels {
+		items = append(items, c+":"+strings.ToLower(l.String()))
+	}
+	sort.Strings(items)
+	return strings.Join(items, ",")
+}
+
+func componentLevel(component string) (LogLevel, bool) {
+	if component == "" {
+		return Silent, false
+	}
+	level, ok := componentLevels.Load().(map[string]LogLevel)[component]
+	return level, ok
+}
+
+//
+// Structured entries
+//
+
+// Field is a key value pair attached to a log entry.
+type Field struct {
+	Key   string
+	Value interface{}
+}
+
+// Entry logs messages for a component along with a set of fields. Entries
+// are immutable, With returns a new entry, so they can be shared between
+// go-routines.
+type Entry struct {
+	component string
+	fields    []Field
+}
+
+// Component returns a structured logger for component.
+func Component(name string) *Entry {
+	return &Entry{component: name}
+}
+
+// With returns a new entry with field key added.
+func (e *Entry) With(key string, val interface{}) *Entry {
+	fields := make([]Field, len(e.fields), len(e.fields)+1)
+	copy(fields, e.fields)
+	return &Entry{component: e.component, fields: append(fields, Field{key, val})}
+}
+
+// WithIndex returns a new entry with bucket, index and instance fields.
+func (e *Entry) WithIndex(bucket, index string, instId uint64) *Entry {
+	fields := make([]Field, len(e.fields), len(e.fields)+3)
+	copy(fields, e.fields)
+	fields = append(fields,
+		Field{FieldBucket, bucket}, Field{FieldIndex, index},
+		Field{FieldInstId, instId})
+	return &Entry{component: e.component, fields: fields}
+}
+
+// WithReqId returns a new entry with request id field.
+func (e *Entry) WithReqId(reqId string) *Entry {
+	return e.With(FieldReqId, reqId)
+}
+
+// IsEnabled checks whether messages at level are logged for this entry.
+func (e *Entry) IsEnabled(at LogLevel) bool {
+	return SystemLogger.isEnabledFor(e.component, at)
+}
+
+func (e *Entry) Fatalf(format string, v ...interface{}) {
+	SystemLogger.printEntry(Fatal, e, format, v...)
+}
+
+func (e *Entry) Errorf(format string, v ...interface{}) {
+	SystemLogger.printEntry(Error, e, format, v...)
+}
+
+func (e *Entry) Warnf(format string, v ...interface{}) {
+	SystemLogger.printEntry(Warn, e, format, v...)
+}
+
+func (e *Entry) Infof(format string, v ...interface{}) {
+	SystemLogger.printEntry(Info, e, format, v...)
+}
+
+func (e *Entry) Verbosef(format string, v ...interface{}) {
+	SystemLogger.printEntry(Verbose, e, format, v...)
+}
+
+func (e *Entry) Debugf(format string, v ...interface{}) {
+	SystemLogger.printEntry(Debug, e, format, v...)
+}
+
+func (e *Entry) Tracef(format string, v ...interface{}) {
+	SystemLogger.printEntry(Trace, e, format, v...)
+}
+
+//
+// Rendering
+//
+
+func (log *destination) isEnabledFor(component string, at LogLevel) bool {
+	if level, ok := componentLevel(component); ok {
+		return level >= at
+	}
+	return log.IsEnabled(at)
+}
+
+func (log *destination) printEntry(
+	at LogLevel, e *Entry, format string, v ...interface{}) {
+
+	if log.isEnabledFor(e.component, at) {
+		log.output(at, e.component, e.fields, fmt.Sprintf(format, v...))
+	}
+}
+
+func (log *destination) output(
+	at LogLevel, component string, fields []Field, msg string) {
+
+	// many callers terminate the format with a newline, fields must
+	// stay on the same line.
+	msg = strings.TrimRight(msg, "\r\n")
+
+	ts := log.timestamp()
+	var buf bytes.Buffer
+	switch GetLogFormat() {
+	case JSONFormat:
+		buf.WriteString("{")
+		writeJSONField(&buf, FieldTs, ts, true)
+		writeJSONField(&buf, FieldLevel, at.String(), false)
+		if component != "" {
+			writeJSONField(&buf, FieldComponent, component, false)
+		}
+		for _, f := range fields {
+			writeJSONField(&buf, f.Key, f.Value, false)
+		}
+		writeJSONField(&buf, FieldMsg, msg, false)
+		buf.WriteString("}")
+
+	case LogfmtFormat:
+		writeLogfmtField(&buf, FieldTs, ts, true)
+		writeLogfmtField(&buf, FieldLevel, at.String(), false)
+		if component != "" {
+			writeLogfmtField(&buf, FieldComponent, component, false)
+		}
+		for _, f := range fields {
+			writeLogfmtField(&buf, f.Key, f.Value, false)
+		}
+		writeLogfmtField(&buf, FieldMsg, msg, false)
+
+	default:
+		// keep the classic prefix intact for existing log parsers.
+		buf.WriteString(ts + " [" + at.String() + "] " + msg)
+		if component != "" {
+			writeLogfmtField(&buf, FieldComponent, component, false)
+		}
+		for _, f := range fields {
+			writeLogfmtField(&buf, f.Key, f.Value, false)
+		}
+	}
+	log.target.Print(buf.String())
+}
+
+func writeJSONField(buf *bytes.Buffer, key string, val interface{}, first bool) {
+	if !first {
+		buf.WriteString(",")
+	}
+	k, _ := json.Marshal(key)
+	buf.Write(k)
+	buf.WriteString(":")
+	v, err := json.Marshal(val)
+	if err != nil {
+		v, _ = json.Marshal(fmt.Sprintf("%v", val))
+	}
+	buf.Write(v)
+}
+
+func writeLogfmtField(buf *bytes.Buffer, key string, val interface{}, first bool) {
+	if !first {
+		buf.WriteString(" ")
+	}
+	buf.WriteString(key)
+	buf.WriteString("=")
+	s := fmt.Sprintf("%v", val)
+	if s == "" || strings.ContainsAny(s, " =\"\t\r\n") {
+		s = strconv.Quote(s)
+	}
+	buf.WriteString(s)
+}
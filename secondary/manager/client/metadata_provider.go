@@ -16,6 +16,7 @@ import (
 	gometaL "github.com/couchbase/gometa/log"
 	"github.com/couchbase/gometa/message"
 	"github.com/couchbase/gometa/protocol"
+	"github.com/couchbase/indexing/secondary/collatejson"
 	c "github.com/couchbase/indexing/secondary/common"
 	"github.com/couchbase/indexing/secondary/common/queryutil"
 	"github.com/couchbase/indexing/secondary/logging"
@@ -171,7 +172,8 @@ type watcherCallback func(string, c.IndexerId, c.IndexerId)
 var REQUEST_CHANNEL_COUNT = 1000
 
 var VALID_PARAM_NAMES = []string{"nodes", "defer_build", "retain_deleted_xattr", "immutable",
-	"num_partition", "num_replica", "docKeySize", "secKeySize", "arrSize", "numDoc", "residentRatio"}
+	"num_partition", "num_replica", "docKeySize", "secKeySize", "arrSize", "numDoc", "residentRatio",
+	"include", "collation", "doc_key_prefixes", "doc_key_pattern", "build_priority"}
 
 ///////////////////////////////////////////////////////
 // Public function : MetadataProvider
@@ -1011,6 +1013,11 @@ func (o *MetadataProvider) PrepareIndexDefn(
 	var immutable bool = false
 	var deferred bool = false
 	var nodes []string = nil
+	var include []string = nil
+	var collation string = ""
+	var docKeyPrefixes []string = nil
+	var docKeyPattern string = ""
+	var buildPriority int = 0
 	var numReplica int = 0
 	var numPartition int = 0
 	var retainDeletedXATTR = false
@@ -1039,8 +1046,29 @@ func (o *MetadataProvider) PrepareIndexDefn(
 			return nil, err, retry
 		}
 
+		include, err, retry = o.getIncludeParam(plan, isPrimary)
+		if err != nil {
+			return nil, err, retry
+		}
+
+		collation, err, retry = o.getCollationParam(plan, isPrimary)
+		if err != nil {
+			return nil, err, retry
+		}
+
+		docKeyPrefixes, docKeyPattern, err, retry = o.getDocKeyFilterParam(plan)
+		if err != nil {
+			return nil, err, retry
+		}
+
+		buildPriority, err, retry = o.getBuildPriorityParam(plan)
+		if err != nil {
+			return nil, err, retry
+		}
+
 		xattrExprs := make([]string, 0)
 		xattrExprs = append(xattrExprs, secExprs...)
+		xattrExprs = append(xattrExprs, include...)
 		if len(whereExpr) > 0 {
 			xattrExprs = append(xattrExprs, whereExpr)
 		}
@@ -1182,6 +1210,10 @@ func (o *MetadataProvider) PrepareIndexDefn(
 		return nil, errors.New("Fails to create index.  Multiple expressions with ALL are found. Only one array expression is supported per index."), false
 	}
 
+	if isArrayIndex && len(include) != 0 {
+		return nil, errors.New("Fails to create index.  Parameter include is not supported for array index."), false
+	}
+
 	//
 	// Ascending/Descending key
 	//
@@ -1214,6 +1246,11 @@ func (o *MetadataProvider) PrepareIndexDefn(
 		Bucket:             bucket,
 		IsPrimary:          isPrimary,
 		SecExprs:           secExprs,
+		Include:            include,
+		Collation:          collation,
+		DocKeyPrefixes:     docKeyPrefixes,
+		DocKeyPattern:      docKeyPattern,
+		BuildPriority:      buildPriority,
 		Desc:               desc,
 		ExprType:           c.ExprType(exprType),
 		PartitionScheme:    partitionScheme,
@@ -1385,6 +1422,133 @@ func (o *MetadataProvider) getNodesParam(plan map[string]interface{}) ([]string,
 	return nodes, nil, true
 }
 
+func (o *MetadataProvider) getIncludeParam(plan map[string]interface{}, isPrimary bool) ([]string, error, bool) {
+
+	var include []string = nil
+
+	es, ok := plan["include"].([]interface{})
+	if ok {
+		for _, ese := range es {
+			e, ok := ese.(string)
+			if ok {
+				include = append(include, e)
+			} else {
+				return nil, errors.New(fmt.Sprintf("Fails to create index.  Include expression '%v' is not valid", plan["include"])), false
+			}
+		}
+	} else {
+		e, ok := plan["include"].(string)
+		if ok {
+			include = []string{e}
+		} else if _, ok := plan["include"]; ok {
+			return nil, errors.New(fmt.Sprintf("Fails to create index.  Include expression '%v' is not valid", plan["include"])), false
+		}
+	}
+
+	if len(include) != 0 && isPrimary {
+		return nil, errors.New("Fails to create index.  Parameter include is not supported for primary index."), false
+	}
+
+	for _, exp := range include {
+		isArray, _, err := queryutil.IsArrayExpression(exp)
+		if err != nil {
+			return nil, errors.New(fmt.Sprintf("Fails to create index.  Error in parsing include expression %v : %v", exp, err)), false
+		}
+		if isArray {
+			return nil, errors.New(fmt.Sprintf("Fails to create index.  Include expression %v cannot be an array expression.", exp)), false
+		}
+	}
+
+	return include, nil, true
+}
+
+func (o *MetadataProvider) getCollationParam(plan map[string]interface{}, isPrimary bool) (string, error, bool) {
+
+	param, ok := plan["collation"]
+	if !ok {
+		return "", nil, true
+	}
+
+	collation, ok := param.(string)
+	if !ok {
+		return "", errors.New(fmt.Sprintf("Fails to create index.  Collation '%v' is not valid", param)), false
+	}
+
+	if collation == collatejson.CollationBinary {
+		return "", nil, true
+	}
+
+	if isPrimary {
+		return "", errors.New("Fails to create index.  Parameter collation is not supported for primary index."), false
+	}
+
+	if err := collatejson.NewCodec(16).SetCollation(collation); err != nil {
+		return "", errors.New(fmt.Sprintf("Fails to create index.  Collation '%v' is not valid", collation)), false
+	}
+
+	return collation, nil, true
+}
+
+func (o *MetadataProvider) getDocKeyFilterParam(plan map[string]interface{}) ([]string, string, error, bool) {
+
+	var prefixes []string = nil
+
+	ps, ok := plan["doc_key_prefixes"].([]interface{})
+	if ok {
+		for _, pse := range ps {
+			p, ok := pse.(string)
+			if !ok || len(p) == 0 {
+				return nil, "", errors.New(fmt.Sprintf("Fails to create index.  Document key prefixes '%v' is not valid", plan["doc_key_prefixes"])), false
+			}
+			prefixes = append(prefixes, p)
+		}
+	} else {
+		p, ok := plan["doc_key_prefixes"].(string)
+		if ok && len(p) != 0 {
+			prefixes = []string{p}
+		} else if _, ok := plan["doc_key_prefixes"]; ok {
+			return nil, "", errors.New(fmt.Sprintf("Fails to create index.  Document key prefixes '%v' is not valid", plan["doc_key_prefixes"])), false
+		}
+	}
+
+	pattern := ""
+	if param, ok := plan["doc_key_pattern"]; ok {
+		if pattern, ok = param.(string); !ok {
+			return nil, "", errors.New(fmt.Sprintf("Fails to create index.  Document key pattern '%v' is not valid", param)), false
+		}
+	}
+
+	if _, err := c.NewDocKeyFilter(prefixes, pattern); err != nil {
+		return nil, "", errors.New(fmt.Sprintf("Fails to create index.  Document key pattern '%v' is not valid: %v", pattern, err)), false
+	}
+
+	return prefixes, pattern, nil, true
+}
+
+func (o *MetadataProvider) getBuildPriorityParam(plan map[string]interface{}) (int, error, bool) {
+
+	priority := 0
+
+	priority2, ok := plan["build_priority"].(float64)
+	if !ok {
+		priority_str, ok := plan["build_priority"].(string)
+		if ok {
+			priority3, err := strconv.ParseInt(priority_str, 10, 32)
+			if err != nil {
+				return 0, errors.New("Fails to create index.  Parameter build_priority must be a integer value."), false
+			}
+			priority = int(priority3)
+
+		} else if _, ok := plan["build_priority"]; ok {
+			return 0, errors.New("Fails to create index.  Parameter build_priority must be a integer value."), false
+		}
+	} else {
+		priority = int(priority2)
+	}
+
+	return priority, nil, false
+}
+
 func (o *MetadataProvider) getImmutableParam(partitionScheme c.PartitionScheme, plan map[string]interface{}) (bool, error, bool) {
 
 	// for partitioned index, by default, it is immutable, regardless it is a full index or partial index
@@ -13,7 +13,6 @@ import (
 	"encoding/json"
 	"errors"
 	"fmt"
-	"github.com/couchbase/cbauth/metakv"
 	c "github.com/couchbase/indexing/secondary/common"
 	"github.com/couchbase/indexing/secondary/logging"
 	"strconv"
@@ -648,7 +647,7 @@ func (m *CommandListener) ListenTokens() {
 			if r > 0 {
 				logging.Errorf("CommandListener: metakv notifier failed (%v)..Restarting %v", err, r)
 			}
-			err = metakv.RunObserveChildren(CommandMetakvDir, metaKVCallback, m.cancelCh)
+			err = c.GetMetadataStore().RunObserveChildren(CommandMetakvDir, metaKVCallback, m.cancelCh)
 			return err
 		}
 
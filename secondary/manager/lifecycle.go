@@ -23,6 +23,7 @@ import (
 	"github.com/couchbase/indexing/secondary/manager/client"
 	mc "github.com/couchbase/indexing/secondary/manager/common"
 	"math"
+	"sort"
 	"strings"
 	"sync/atomic"
 	"time"
@@ -92,6 +93,13 @@ type builder struct {
 	batchSize int32
 	disable   int32
 
+	// build scheduling
+	maxConcurrent int32             // max buckets building in INIT_STREAM
+	priorities    map[uint64]int    // defnId -> build priority
+	arrivals      map[uint64]uint64 // defnId -> order in which it is queued
+	arrival       uint64
+	queue         atomic.Value // []common.IndexDefnId, pending in build order
+
 	commandListener *mc.CommandListener
 	listenerDonech  chan bool
 }
@@ -961,7 +969,7 @@ func (m *LifecycleMgr) handleBuildIndexes(content []byte, reqCtx *common.Metadat
 		msg := "Build index fails."
 
 		if len(retryList) == 1 {
-			msg += fmt.Sprint("  %v", retryList[0])
+			msg += fmt.Sprintf("  %v", retryList[0])
 		}
 
 		if len(errList) == 1 {
@@ -999,6 +1007,7 @@ func (m *LifecycleMgr) BuildIndexes(ids []common.IndexDefnId,
 	skipList := ([]common.IndexDefnId)(nil)
 
 	instIdList := []common.IndexInstId(nil)
+	defnList := []*common.IndexDefn(nil)
 	defnIdMap := make(map[common.IndexDefnId]bool)
 	buckets := []string(nil)
 	inst2DefnMap := make(map[common.IndexInstId]common.IndexDefnId)
@@ -1030,6 +1039,7 @@ func (m *LifecycleMgr) BuildIndexes(ids []common.IndexDefnId,
 			continue
 		}
 
+		scheduled := false
 		for _, inst := range insts {
 
 			if inst.State != uint32(common.INDEX_STATE_READY) {
@@ -1049,6 +1059,11 @@ func (m *LifecycleMgr) BuildIndexes(ids []common.IndexDefnId,
 
 			instIdList = append(instIdList, common.IndexInstId(inst.InstId))
 			inst2DefnMap[common.IndexInstId(inst.InstId)] = defn.DefnId
+			scheduled = true
+		}
+
+		if scheduled {
+			defnList = append(defnList, defn)
 		}
 
 		found := false
@@ -1063,6 +1078,31 @@ func (m *LifecycleMgr) BuildIndexes(ids []common.IndexDefnId,
 		}
 	}
 
+	// Queue the build on the builder if it would exceed the maximum number of concurrent
+	// INIT_STREAM builds.  The index instances are already marked as scheduled, so the
+	// builder will build them by priority as other builds complete.  This is not a build
+	// failure.  Index status reports the index as scheduled, with its position in the queue.
+	if reqCtx.ReqSource == common.DDLRequestSourceUser && len(instIdList) != 0 {
+		if max := m.builder.getMaxConcurrent(); max > 0 {
+			building := m.initStreamBuckets()
+			count := len(building)
+			for _, bucket := range buckets {
+				if !building[bucket] {
+					count++
+				}
+			}
+
+			if count > max {
+				for _, defn := range defnList {
+					logging.Infof("LifecycleMgr.handleBuildIndexes() : Maximum concurrent build (%v) is reached.  Queue index (%v, %v) for build.",
+						max, defn.Bucket, defn.Name)
+					m.builder.notifych <- defn
+				}
+				instIdList = nil
+			}
+		}
+	}
+
 	if m.notifier != nil && len(instIdList) != 0 {
 
 		if errMap := m.notifier.OnIndexBuild(instIdList, buckets, reqCtx); len(errMap) != 0 {
@@ -2606,7 +2646,7 @@ func (s *builder) run() {
 		select {
 		case defn := <-s.notifych:
 			logging.Infof("builder:  Received new index build request %v.  Schedule to build index for bucket %v", defn.DefnId, defn.Bucket)
-			s.addPending(defn.Bucket, uint64(defn.DefnId))
+			s.addPending(defn.Bucket, uint64(defn.DefnId), defn.BuildPriority)
 
 		case <-ticker.C:
 			s.processBuildToken(false)
@@ -2639,10 +2679,20 @@ func (s *builder) getBuildList() ([]string, int32) {
 	// get quota
 	quota, skipList := s.getQuota()
 
+	return s.sortBuildList(quota, skipList), quota
+}
+
+//
+// Order the buckets with pending builds, leaving out buckets in skipList that
+// are already building.  No more buckets than allowed by max_concurrent are
+// returned.
+//
+func (s *builder) sortBuildList(quota int32, skipList map[string]bool) []string {
+
 	// filter bucket that is not available
 	buildList := ([]string)(nil)
-	for bucket, _ := range s.pendings {
-		if _, ok := skipList[bucket]; !ok {
+	for bucket, defnIds := range s.pendings {
+		if _, ok := skipList[bucket]; !ok && len(defnIds) != 0 {
 			buildList = append(buildList, bucket)
 		}
 	}
@@ -2675,10 +2725,27 @@ func (s *builder) getBuildList() ([]string, int32) {
 		}
 	}
 
-	return buildList, quota
+	// bucket with the highest priority index goes first.  Pending list
+	// of each bucket is sorted by priority.
+	sort.SliceStable(buildList, func(i, j int) bool {
+		return s.priorities[s.pendings[buildList[i]][0]] > s.priorities[s.pendings[buildList[j]][0]]
+	})
+
+	// skipList has the buckets that are already building in INIT_STREAM
+	if max := s.getMaxConcurrent(); max > 0 {
+		available := max - len(skipList)
+		if available < 0 {
+			available = 0
+		}
+		if len(buildList) > available {
+			buildList = buildList[:available]
+		}
+	}
+
+	return buildList
 }
 
-func (s *builder) addPending(bucket string, id uint64) bool {
+func (s *builder) addPending(bucket string, id uint64, priority int) bool {
 
 	for _, id2 := range s.pendings[bucket] {
 		if id2 == id {
@@ -2686,10 +2753,74 @@ func (s *builder) addPending(bucket string, id uint64) bool {
 		}
 	}
 
+	s.priorities[id] = priority
+	s.arrival++
+	s.arrivals[id] = s.arrival
+
 	s.pendings[bucket] = append(s.pendings[bucket], uint64(id))
+	s.sortPendings(s.pendings[bucket])
+	s.publishQueue()
 	return true
 }
 
+//
+// Order pending builds by descending priority.  Builds with the same
+// priority are kept in the order they are queued.
+//
+func (s *builder) sortPendings(defnIds []uint64) {
+
+	sort.SliceStable(defnIds, func(i, j int) bool {
+		if s.priorities[defnIds[i]] != s.priorities[defnIds[j]] {
+			return s.priorities[defnIds[i]] > s.priorities[defnIds[j]]
+		}
+		return s.arrivals[defnIds[i]] < s.arrivals[defnIds[j]]
+	})
+}
+
+//
+// Publish the pending builds of all buckets, in the order of priority, so
+// that index status can report the position of each index in the queue.
+//
+func (s *builder) publishQueue() {
+
+	pendings := make([]uint64, 0)
+	for _, defnIds := range s.pendings {
+		pendings = append(pendings, defnIds...)
+	}
+	s.sortPendings(pendings)
+
+	queue := make([]common.IndexDefnId, 0, len(pendings))
+	current := make(map[uint64]bool)
+	for _, defnId := range pendings {
+		queue = append(queue, common.IndexDefnId(defnId))
+		current[defnId] = true
+	}
+	s.queue.Store(queue)
+
+	// forget about index that is no longer pending
+	for defnId := range s.arrivals {
+		if !current[defnId] {
+			delete(s.arrivals, defnId)
+			delete(s.priorities, defnId)
+		}
+	}
+}
+
+//
+// Return the pending builds in the order they will be built.  This can be
+// called concurrently with the builder.
+//
+func (s *builder) getQueue() []common.IndexDefnId {
+
+	queue, _ := s.queue.Load().([]common.IndexDefnId)
+	return queue
+}
+
+func (s *builder) getMaxConcurrent() int {
+
+	return int(atomic.LoadInt32(&s.maxConcurrent))
+}
+
 func (s *builder) tryBuildIndex(bucket string, quota int32) int32 {
 
 	newQuota := quota
@@ -2756,6 +2887,7 @@ func (s *builder) tryBuildIndex(bucket string, quota int32) int32 {
 			if len(pendingList) == 0 {
 				pendingList = nil
 			}
+			s.sortPendings(pendingList)
 
 			if len(buildList) != 0 {
 
@@ -2772,6 +2904,7 @@ func (s *builder) tryBuildIndex(bucket string, quota int32) int32 {
 				// Clean up the map.  If there is any index that needs retry, they will be put into the notifych again.
 				// Once this function is done, the map will be populated again from the notifych.
 				s.pendings[bucket] = pendingList
+				s.publishQueue()
 
 				// If any of the index cannot be built, those index will be skipped by lifecycle manager, so it
 				// will send the rest of the indexes to the indexer.  An index cannot be built if it does not have
@@ -2787,6 +2920,7 @@ func (s *builder) tryBuildIndex(bucket string, quota int32) int32 {
 				// Clean up the map.  If there is any index that needs retry, they will be put into the notifych again.
 				// Once this function is done, the map will be populated again from the notifych.
 				s.pendings[bucket] = pendingList
+				s.publishQueue()
 			}
 		}
 	}
@@ -2794,6 +2928,37 @@ func (s *builder) tryBuildIndex(bucket string, quota int32) int32 {
 	return newQuota
 }
 
+//
+// Return the buckets that have index being built in INIT_STREAM on this node.
+//
+func (m *LifecycleMgr) initStreamBuckets() map[string]bool {
+
+	buckets := make(map[string]bool)
+
+	metaIter, err := m.repo.NewIterator()
+	if err != nil {
+		logging.Warnf("LifecycleMgr.initStreamBuckets():  Unable to read from metadata repository.")
+		return buckets
+	}
+	defer metaIter.Close()
+
+	for _, defn, err := metaIter.Next(); err == nil; _, defn, err = metaIter.Next() {
+
+		insts, err := m.FindAllLocalIndexInst(defn.Bucket, defn.DefnId)
+		if len(insts) == 0 || err != nil {
+			continue
+		}
+
+		for _, inst := range insts {
+			if inst.State == uint32(common.INDEX_STATE_INITIAL) || inst.State == uint32(common.INDEX_STATE_CATCHUP) {
+				buckets[defn.Bucket] = true
+			}
+		}
+	}
+
+	return buckets
+}
+
 func (s *builder) getQuota() (int32, map[string]bool) {
 
 	quota := atomic.LoadInt32(&s.batchSize)
@@ -2858,7 +3023,7 @@ func (s *builder) processBuildToken(bootstrap bool) {
 			if inst.State == uint32(common.INDEX_STATE_READY) {
 				logging.Infof("builder: Processing build token %v", entry)
 
-				if s.addPending(defn.Bucket, uint64(defn.DefnId)) {
+				if s.addPending(defn.Bucket, uint64(defn.DefnId), defn.BuildPriority) {
 					logging.Infof("builder: Schedule index build for (%v, %v).", defn.Bucket, defn.Name)
 				}
 			}
@@ -2901,7 +3066,7 @@ func (s *builder) recover() {
 		for _, inst := range insts {
 
 			if inst.Scheduled && inst.State == uint32(common.INDEX_STATE_READY) {
-				if s.addPending(defn.Bucket, uint64(defn.DefnId)) {
+				if s.addPending(defn.Bucket, uint64(defn.DefnId), defn.BuildPriority) {
 					logging.Infof("builder: Schedule index build for (%v, %v, %v).", defn.Bucket, defn.Name, inst.ReplicaId)
 				}
 			}
@@ -2913,6 +3078,10 @@ func (s *builder) configUpdate(config *common.Config) {
 	newBatchSize := int32((*config)["settings.build.batch_size"].Int())
 	atomic.StoreInt32(&s.batchSize, newBatchSize)
 
+	if cv, ok := (*config)["settings.build.max_concurrent"]; ok {
+		atomic.StoreInt32(&s.maxConcurrent, int32(cv.Int()))
+	}
+
 	disable := (*config)["build.background.disable"].Bool()
 	if disable {
 		atomic.StoreInt32(&s.disable, int32(1))
@@ -2939,9 +3108,13 @@ func newBuilder(mgr *LifecycleMgr) *builder {
 		pendings:        make(map[string][]uint64),
 		notifych:        make(chan *common.IndexDefn, 10000),
 		batchSize:       int32(common.SystemConfig["indexer.settings.build.batch_size"].Int()),
+		maxConcurrent:   int32(common.SystemConfig["indexer.settings.build.max_concurrent"].Int()),
+		priorities:      make(map[uint64]int),
+		arrivals:        make(map[uint64]uint64),
 		commandListener: mc.NewCommandListener(donech, false, true, false),
 		listenerDonech:  donech,
 	}
+	builder.queue.Store([]common.IndexDefnId(nil))
 
 	disable := common.SystemConfig["indexer.build.background.disable"].Bool()
 	if disable {
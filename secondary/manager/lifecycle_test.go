@@ -0,0 +1,113 @@
+// Copyright (c) 2014 Couchbase, Inc.
+// Licensed under the Apache License, Version 2.0 (the "License"); you may not use this file
+// except in compliance with the License. You may obtain a copy of the License at
+//   http://www.apache.org/licenses/LICENSE-2.0
+// Unless required by applicable law or agreed to in writing, software distributed under the
+// License is distributed on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND,
+// either express or implied. See the License for the specific language governing permissions
+// and limitations under the License.
+
+package manager
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/couchbase/indexing/secondary/common"
+)
+
+func testBuilder(maxConcurrent int32) *builder {
+	return &builder{
+		pendings:      make(map[string][]uint64),
+		priorities:    make(map[uint64]int),
+		arrivals:      make(map[uint64]uint64),
+		maxConcurrent: maxConcurrent,
+	}
+}
+
+func TestBuilderPriority(t *testing.T) {
+	s := testBuilder(0)
+
+	pendings := []struct {
+		bucket   string
+		id       uint64
+		priority int
+	}{
+		{"b1", 1, 0},
+		{"b1", 2, 5},
+		{"b2", 3, 1},
+		{"b1", 4, 5},
+		{"b2", 5, 0},
+	}
+	for _, p := range pendings {
+		if !s.addPending(p.bucket, p.id, p.priority) {
+			t.Fatalf("expected index %v to be queued", p.id)
+		}
+	}
+	if s.addPending("b1", 2, 5) {
+		t.Errorf("expected index 2 not to be queued twice")
+	}
+
+	// by descending priority, in the order queued for same priority.
+	if !reflect.DeepEqual(s.pendings["b1"], []uint64{2, 4, 1}) {
+		t.Errorf("unexpected pending list %v", s.pendings["b1"])
+	}
+	if !reflect.DeepEqual(s.pendings["b2"], []uint64{3, 5}) {
+		t.Errorf("unexpected pending list %v", s.pendings["b2"])
+	}
+
+	queue := []common.IndexDefnId{2, 4, 3, 1, 5}
+	if !reflect.DeepEqual(s.getQueue(), queue) {
+		t.Errorf("expected queue %v, got %v", queue, s.getQueue())
+	}
+
+	// bucket with the highest priority index is built first.
+	if buildList := s.sortBuildList(10, nil); !reflect.DeepEqual(buildList, []string{"b1", "b2"}) {
+		t.Errorf("unexpected build list %v", buildList)
+	}
+
+	// index that is built is no longer queued.
+	s.pendings["b1"] = []uint64{1}
+	s.publishQueue()
+	queue = []common.IndexDefnId{3, 1, 5}
+	if !reflect.DeepEqual(s.getQueue(), queue) {
+		t.Errorf("expected queue %v, got %v", queue, s.getQueue())
+	}
+	if _, ok := s.priorities[2]; ok {
+		t.Errorf("expected priority of built index to be forgotten")
+	}
+	if buildList := s.sortBuildList(10, nil); !reflect.DeepEqual(buildList, []string{"b2", "b1"}) {
+		t.Errorf("unexpected build list %v", buildList)
+	}
+}
+
+func TestBuilderMaxConcurrent(t *testing.T) {
+	s := testBuilder(2)
+	s.addPending("b1", 1, 1)
+	s.addPending("b2", 2, 3)
+	s.addPending("b3", 3, 2)
+
+	testcases := []struct {
+		building  map[string]bool
+		buildList []string
+	}{
+		{nil, []string{"b2", "b3"}},
+		{map[string]bool{"b4": true}, []string{"b2"}},
+		{map[string]bool{"b2": true}, []string{"b3"}},
+		{map[string]bool{"b4": true, "b5": true}, []string{}},
+		{map[string]bool{"b4": true, "b5": true, "b6": true}, []string{}},
+	}
+	for _, tc := range testcases {
+		buildList := s.sortBuildList(10, tc.building)
+		if len(buildList) != len(tc.buildList) ||
+			(len(buildList) != 0 && !reflect.DeepEqual(buildList, tc.buildList)) {
+			t.Errorf("building %v expected %v, got %v", tc.building, tc.buildList, buildList)
+		}
+	}
+
+	// no limit
+	s.maxConcurrent = 0
+	if buildList := s.sortBuildList(10, nil); !reflect.DeepEqual(buildList, []string{"b2", "b3", "b1"}) {
+		t.Errorf("unexpected build list %v", buildList)
+	}
+}
@@ -22,6 +22,7 @@ import (
 	"io"
 	"math"
 	"net/http"
+	"regexp"
 	"sort"
 	"strconv"
 	"strings"
@@ -65,12 +66,13 @@ type IndexResponse struct {
 //
 
 type LocalIndexMetadata struct {
-	IndexerId        string             `json:"indexerId,omitempty"`
-	NodeUUID         string             `json:"nodeUUID,omitempty"`
-	StorageMode      string             `json:"storageMode,omitempty"`
-	LocalSettings    map[string]string  `json:"localSettings,omitempty"`
-	IndexTopologies  []IndexTopology    `json:"topologies,omitempty"`
-	IndexDefinitions []common.IndexDefn `json:"definitions,omitempty"`
+	IndexerId        string               `json:"indexerId,omitempty"`
+	NodeUUID         string               `json:"nodeUUID,omitempty"`
+	StorageMode      string               `json:"storageMode,omitempty"`
+	LocalSettings    map[string]string    `json:"localSettings,omitempty"`
+	IndexTopologies  []IndexTopology      `json:"topologies,omitempty"`
+	IndexDefinitions []common.IndexDefn   `json:"definitions,omitempty"`
+	BuildQueue       []common.IndexDefnId `json:"buildQueue,omitempty"`
 }
 
 type ClusterIndexMetadata struct {
@@ -85,9 +87,21 @@ type BackupResponse struct {
 }
 
 type RestoreResponse struct {
-	Version uint64 `json:"version,omitempty"`
-	Code    string `json:"code,omitempty"`
-	Error   string `json:"error,omitempty"`
+	Version uint64             `json:"version,omitempty"`
+	Code    string             `json:"code,omitempty"`
+	Error   string             `json:"error,omitempty"`
+	Diff    []RestoreIndexDiff `json:"diff,omitempty"`
+}
+
+type RestoreIndexDiff struct {
+	Bucket     string               `json:"bucket,omitempty"`
+	Name       string               `json:"name,omitempty"`
+	NewName    string               `json:"newName,omitempty"`
+	ReplicaId  int                  `json:"replicaId"`
+	Partitions []common.PartitionId `json:"partitions,omitempty"`
+	Action     string               `json:"action,omitempty"`
+	Reason     string               `json:"reason,omitempty"`
+	Hosts      []string             `json:"hosts,omitempty"`
 }
 
 //
@@ -103,24 +117,26 @@ type IndexStatusResponse struct {
 }
 
 type IndexStatus struct {
-	DefnId       common.IndexDefnId `json:"defnId,omitempty"`
-	InstId       common.IndexInstId `json:"instId,omitempty"`
-	Name         string             `json:"name,omitempty"`
-	Bucket       string             `json:"bucket,omitempty"`
-	IsPrimary    bool               `json:"isPrimary,omitempty"`
-	SecExprs     []string           `json:"secExprs,omitempty"`
-	WhereExpr    string             `json:"where,omitempty"`
-	IndexType    string             `json:"indexType,omitempty"`
-	Status       string             `json:"status,omitempty"`
-	Definition   string             `json:"definition"`
-	Hosts        []string           `json:"hosts,omitempty"`
-	Error        string             `json:"error,omitempty"`
-	Completion   int                `json:"completion"`
-	Progress     float64            `json:"progress"`
-	Scheduled    bool               `json:"scheduled"`
-	Partitioned  bool               `json:"partitioned"`
-	NumPartition int                `json:"numPartition"`
-	PartitionMap map[string][]int   `json:"partitionMap"`
+	DefnId        common.IndexDefnId `json:"defnId,omitempty"`
+	InstId        common.IndexInstId `json:"instId,omitempty"`
+	Name          string             `json:"name,omitempty"`
+	Bucket        string             `json:"bucket,omitempty"`
+	IsPrimary     bool               `json:"isPrimary,omitempty"`
+	SecExprs      []string           `json:"secExprs,omitempty"`
+	WhereExpr     string             `json:"where,omitempty"`
+	IndexType     string             `json:"indexType,omitempty"`
+	Status        string             `json:"status,omitempty"`
+	Definition    string             `json:"definition"`
+	Hosts         []string           `json:"hosts,omitempty"`
+	Error         string             `json:"error,omitempty"`
+	Completion    int                `json:"completion"`
+	Progress      float64            `json:"progress"`
+	Scheduled     bool               `json:"scheduled"`
+	BuildPriority int                `json:"buildPriority,omitempty"`
+	BuildPosition int                `json:"buildPosition,omitempty"`
+	Partitioned   bool               `json:"partitioned"`
+	NumPartition  int                `json:"numPartition"`
+	PartitionMap  map[string][]int   `json:"partitionMap"`
 }
 
 type indexStatusSorter []IndexStatus
@@ -169,6 +185,7 @@ func registerRequestHandler(mgr *IndexManager, clusterUrl string) {
 		http.HandleFunc("/getIndexStatus", handlerContext.handleIndexStatusRequest)
 		http.HandleFunc("/getIndexStatement", handlerContext.handleIndexStatementRequest)
 		http.HandleFunc("/planIndex", handlerContext.handleIndexPlanRequest)
+		http.HandleFunc("/planner/whatif", handlerContext.handlePlannerWhatIfRequest)
 		http.HandleFunc("/settings/storageMode", handlerContext.handleIndexStorageModeRequest)
 		http.HandleFunc("/settings/planner", handlerContext.handlePlannerRequest)
 	})
@@ -526,30 +543,37 @@ func (m *requestHandlerContext) getIndexStatus(creds cbauth.Creds, bucket string
 								progress = math.Float64frombits(uint64(stat.(float64)))
 							}
 
+							position := 0
+							if state == common.INDEX_STATE_READY && instance.Scheduled {
+								position = buildQueuePosition(localMeta.BuildQueue, defn.DefnId)
+							}
+
 							partitionMap := make(map[string][]int)
 							for _, partnDef := range instance.Partitions {
 								partitionMap[curl] = append(partitionMap[curl], int(partnDef.PartId))
 							}
 
 							status := IndexStatus{
-								DefnId:       defn.DefnId,
-								InstId:       common.IndexInstId(instance.InstId),
-								Name:         name,
-								Bucket:       defn.Bucket,
-								IsPrimary:    defn.IsPrimary,
-								SecExprs:     defn.SecExprs,
-								WhereExpr:    defn.WhereExpr,
-								IndexType:    string(defn.Using),
-								Status:       stateStr,
-								Error:        errStr,
-								Hosts:        []string{curl},
-								Definition:   common.IndexStatement(defn, true),
-								Completion:   completion,
-								Progress:     progress,
-								Scheduled:    instance.Scheduled,
-								Partitioned:  common.IsPartitioned(defn.PartitionScheme),
-								NumPartition: len(instance.Partitions),
-								PartitionMap: partitionMap,
+								DefnId:        defn.DefnId,
+								InstId:        common.IndexInstId(instance.InstId),
+								Name:          name,
+								Bucket:        defn.Bucket,
+								IsPrimary:     defn.IsPrimary,
+								SecExprs:      defn.SecExprs,
+								WhereExpr:     defn.WhereExpr,
+								IndexType:     string(defn.Using),
+								Status:        stateStr,
+								Error:         errStr,
+								Hosts:         []string{curl},
+								Definition:    common.IndexStatement(defn, true),
+								Completion:    completion,
+								Progress:      progress,
+								Scheduled:     instance.Scheduled,
+								BuildPriority: defn.BuildPriority,
+								BuildPosition: position,
+								Partitioned:   common.IsPartitioned(defn.PartitionScheme),
+								NumPartition:  len(instance.Partitions),
+								PartitionMap:  partitionMap,
 							}
 
 							list = append(list, status)
@@ -571,6 +595,20 @@ func (m *requestHandlerContext) getIndexStatus(creds cbauth.Creds, bucket string
 	return list, failedNodes, nil
 }
 
+//
+// Position of the index in the build queue of a node, starting from 1.
+// Return 0 if the index is not queued.
+//
+func buildQueuePosition(queue []common.IndexDefnId, defnId common.IndexDefnId) int {
+
+	for i, id := range queue {
+		if id == defnId {
+			return i + 1
+		}
+	}
+	return 0
+}
+
 func (m *requestHandlerContext) consolideIndexStatus(statuses []IndexStatus) []IndexStatus {
 
 	statusMap := make(map[common.IndexInstId]IndexStatus)
@@ -584,6 +622,9 @@ func (m *requestHandlerContext) consolideIndexStatus(statuses []IndexStatus) []I
 			s2.Completion = (s2.Completion + status.Completion) / 2
 			s2.Progress = (s2.Progress + status.Progress) / 2.0
 			s2.NumPartition += status.NumPartition
+			if status.BuildPosition != 0 && (s2.BuildPosition == 0 || status.BuildPosition < s2.BuildPosition) {
+				s2.BuildPosition = status.BuildPosition
+			}
 			if len(status.Error) != 0 {
 				s2.Error = fmt.Sprintf("%v %v", s2.Error, status.Error)
 			}
@@ -880,6 +921,17 @@ func (m *requestHandlerContext) getLocalIndexMetadata(creds cbauth.Creds, bucket
 		topology, err = iter1.Next()
 	}
 
+	if m.mgr.lifecycleMgr != nil && m.mgr.lifecycleMgr.builder != nil {
+		for _, defnId := range m.mgr.lifecycleMgr.builder.getQueue() {
+			for _, defn := range meta.IndexDefinitions {
+				if defn.DefnId == defnId {
+					meta.BuildQueue = append(meta.BuildQueue, defnId)
+					break
+				}
+			}
+		}
+	}
+
 	return meta, nil
 }
 
@@ -895,6 +947,11 @@ func (m *requestHandlerContext) getLocalIndexMetadata(creds cbauth.Creds, bucket
 // 3) Index defn is deleted or missing in current repository.  Index Defn restored from backup if bucket exists.
 //    - Index defn of the same <bucket, name> exists.   It will rename the index to <index name>_restore_<seqNo>
 //    - Bucket does not exist.   It will restore an index defn with a non-existent bucket.
+// 4) Only indexes of the buckets in "bucket" (comma separated) and with name matching the RE2 "index" are restored.
+//    Bucket of the restored index is remapped with "remap" (comma separated <image bucket>:<bucket>).
+//    Index remapped to the same <bucket, name> as another index in the image is renamed to <index name>_<seqNo>.
+// 5) With "dryRun=true", nothing is restored.  The response has the action (create/skip/conflict) and placement
+//    of each index in the image.
 //
 func (m *requestHandlerContext) handleRestoreIndexMetadataRequest(w http.ResponseWriter, r *http.Request) {
 
@@ -903,12 +960,19 @@ func (m *requestHandlerContext) handleRestoreIndexMetadataRequest(w http.Respons
 		return
 	}
 
+	options, err := m.getRestoreOptions(r)
+	if err != nil {
+		send(http.StatusBadRequest, w, &RestoreResponse{Code: RESP_ERROR, Error: err.Error()})
+		return
+	}
+
 	// convert backup image into runtime data structure
 	image := m.convertIndexMetadataRequest(r)
 	if image == nil {
 		send(http.StatusBadRequest, w, &RestoreResponse{Code: RESP_ERROR, Error: "Unable to process request input"})
 		return
 	}
+	remapped := filterRestoreImage(image, options)
 
 	for _, localMeta := range image.Metadata {
 		for _, topology := range localMeta.IndexTopologies {
@@ -926,17 +990,31 @@ func (m *requestHandlerContext) handleRestoreIndexMetadataRequest(w http.Respons
 		}
 	}
 
+	context := createRestoreContext(image, m.clusterUrl, remapped)
+
+	// Dry run
+	if options.DryRun {
+		diff, err := context.computeRestoreDiff()
+		if err != nil {
+			send(http.StatusInternalServerError, w, &RestoreResponse{Code: RESP_ERROR, Error: fmt.Sprintf("Unable to plan restore.  Error=%v", err)})
+			return
+		}
+		send(http.StatusOK, w, &RestoreResponse{Code: RESP_SUCCESS, Diff: diff})
+		return
+	}
+
 	// Restore
-	context := createRestoreContext(image, m.clusterUrl)
 	hostIndexMap, err := context.computeIndexLayout()
 	if err != nil {
 		send(http.StatusInternalServerError, w, &RestoreResponse{Code: RESP_ERROR, Error: fmt.Sprintf("Unable to restore metadata.  Error=%v", err)})
+		return
 	}
 
 	for host, indexes := range hostIndexMap {
 		for _, index := range indexes {
 			if !m.makeCreateIndexRequest(*index, host) {
 				send(http.StatusInternalServerError, w, &RestoreResponse{Code: RESP_ERROR, Error: "Unable to restore metadata."})
+				return
 			}
 		}
 	}
@@ -944,6 +1022,44 @@ func (m *requestHandlerContext) handleRestoreIndexMetadataRequest(w http.Respons
 	send(http.StatusOK, w, &RestoreResponse{Code: RESP_SUCCESS})
 }
 
+func (m *requestHandlerContext) getRestoreOptions(r *http.Request) (*RestoreOptions, error) {
+
+	options := &RestoreOptions{BucketMap: make(map[string]string)}
+	query := r.URL.Query()
+
+	if dryRun := query.Get("dryRun"); len(dryRun) != 0 {
+		value, err := strconv.ParseBool(dryRun)
+		if err != nil {
+			return nil, errors.New(fmt.Sprintf("Invalid dryRun %v", dryRun))
+		}
+		options.DryRun = value
+	}
+
+	if buckets := query.Get("bucket"); len(buckets) != 0 {
+		options.Buckets = strings.Split(buckets, ",")
+	}
+
+	if pattern := query.Get("index"); len(pattern) != 0 {
+		re, err := regexp.Compile(pattern)
+		if err != nil {
+			return nil, errors.New(fmt.Sprintf("Invalid index name pattern %v.  Error=%v", pattern, err))
+		}
+		options.Pattern = re
+	}
+
+	if remap := query.Get("remap"); len(remap) != 0 {
+		for _, pair := range strings.Split(remap, ",") {
+			buckets := strings.Split(pair, ":")
+			if len(buckets) != 2 || len(buckets[0]) == 0 || len(buckets[1]) == 0 {
+				return nil, errors.New(fmt.Sprintf("Invalid bucket remap %v", pair))
+			}
+			options.BucketMap[buckets[0]] = buckets[1]
+		}
+	}
+
+	return options, nil
+}
+
 func (m *requestHandlerContext) makeCreateIndexRequest(defn common.IndexDefn, host string) bool {
 
 	// deferred build for restore
@@ -1035,6 +1151,51 @@ func (m *requestHandlerContext) convertIndexPlanRequest(r *http.Request) ([]*pla
 	return specs, nil
 }
 
+func (m *requestHandlerContext) handlePlannerWhatIfRequest(w http.ResponseWriter, r *http.Request) {
+
+	_, ok := doAuth(r, w)
+	if !ok {
+		return
+	}
+
+	result, err := m.getWhatIfPlan(r)
+
+	if err == nil {
+		send(http.StatusOK, w, result)
+	} else {
+		sendHttpError(w, err.Error(), http.StatusInternalServerError)
+	}
+}
+
+func (m *requestHandlerContext) getWhatIfPlan(r *http.Request) (*planner.WhatIfResult, error) {
+
+	plan, err := planner.RetrievePlanFromCluster(m.clusterUrl, nil)
+	if err != nil {
+		return nil, errors.New(fmt.Sprintf("Fail to retreive index information from cluster.   Error=%v", err))
+	}
+
+	buf := new(bytes.Buffer)
+	if _, err := buf.ReadFrom(r.Body); err != nil {
+		logging.Debugf("RequestHandler::getWhatIfPlan: unable to read request body, err %v", err)
+		return nil, err
+	}
+
+	whatIf := &planner.WhatIf{}
+	if buf.Len() != 0 {
+		if err := json.Unmarshal(buf.Bytes(), whatIf); err != nil {
+			logging.Debugf("RequestHandler::getWhatIfPlan: unable to unmarshall request body. Buf = %s, err %v", buf, err)
+			return nil, errors.New(fmt.Sprintf("Fail to read what-if request.   Error=%v", err))
+		}
+	}
+
+	result, err := planner.ExecuteWhatIf(plan, whatIf)
+	if err != nil {
+		return nil, errors.New(fmt.Sprintf("Fail to plan what-if request.   Error=%v", err))
+	}
+
+	return result, nil
+}
+
 //////////////////////////////////////////////////////
 // Storage Mode
 ///////////////////////////////////////////////////////
@@ -0,0 +1,87 @@
+// Copyright (c) 2014 Couchbase, Inc.
+// Licensed under the Apache License, Version 2.0 (the "License"); you may not use this file
+// except in compliance with the License. You may obtain a copy of the License at
+//   http://www.apache.org/licenses/LICENSE-2.0
+// Unless required by applicable law or agreed to in writing, software distributed under the
+// License is distributed on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND,
+// either express or implied. See the License for the specific language governing permissions
+// and limitations under the License.
+
+package manager
+
+import (
+	"net/http/httptest"
+	"reflect"
+	"testing"
+
+	"github.com/couchbase/indexing/secondary/common"
+)
+
+func TestBuildQueuePosition(t *testing.T) {
+	queue := []common.IndexDefnId{30, 10, 20}
+
+	testcases := []struct {
+		defnId   common.IndexDefnId
+		position int
+	}{
+		{30, 1},
+		{10, 2},
+		{20, 3},
+		{40, 0},
+	}
+	for _, tc := range testcases {
+		if position := buildQueuePosition(queue, tc.defnId); position != tc.position {
+			t.Errorf("index %v expected position %v, got %v", tc.defnId, tc.position, position)
+		}
+	}
+
+	// replicas queued on different nodes report the earliest position.
+	m := &requestHandlerContext{}
+	statuses := []IndexStatus{
+		{InstId: 1, Status: "Created", BuildPosition: 3, PartitionMap: map[string][]int{}},
+		{InstId: 1, Status: "Created", BuildPosition: 0, PartitionMap: map[string][]int{}},
+		{InstId: 1, Status: "Created", BuildPosition: 2, PartitionMap: map[string][]int{}},
+	}
+	result := m.consolideIndexStatus(statuses)
+	if len(result) != 1 || result[0].BuildPosition != 2 {
+		t.Errorf("expected build position 2, got %v", result)
+	}
+}
+
+func TestGetRestoreOptions(t *testing.T) {
+	m := &requestHandlerContext{}
+
+	r := httptest.NewRequest("POST", "/restoreIndexMetadata?dryRun=true&bucket=a,b&index=^idx&remap=a:c,b:d", nil)
+	options, err := m.getRestoreOptions(r)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !options.DryRun {
+		t.Errorf("expected dry run")
+	}
+	if !reflect.DeepEqual(options.Buckets, []string{"a", "b"}) {
+		t.Errorf("unexpected buckets %v", options.Buckets)
+	}
+	if !options.matchName("idx_age") || options.matchName("age_idx") {
+		t.Errorf("unexpected index name pattern %v", options.Pattern)
+	}
+	if !reflect.DeepEqual(options.BucketMap, map[string]string{"a": "c", "b": "d"}) {
+		t.Errorf("unexpected bucket remap %v", options.BucketMap)
+	}
+
+	// no filter restores everything, as is.
+	options, err = m.getRestoreOptions(httptest.NewRequest("POST", "/restoreIndexMetadata", nil))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if options.DryRun || !options.matchBucket("any") || !options.matchName("any") || options.remapBucket("any") != "any" {
+		t.Errorf("expected options to select all indexes, got %+v", options)
+	}
+
+	for _, query := range []string{"dryRun=maybe", "index=(", "remap=a", "remap=a:", "remap=:c", "remap=a:b:c"} {
+		r := httptest.NewRequest("POST", "/restoreIndexMetadata?"+query, nil)
+		if _, err := m.getRestoreOptions(r); err == nil {
+			t.Errorf("expected error for %v", query)
+		}
+	}
+}
@@ -15,6 +15,8 @@ import (
 	"github.com/couchbase/indexing/secondary/common"
 	"github.com/couchbase/indexing/secondary/logging"
 	"github.com/couchbase/indexing/secondary/planner"
+	"regexp"
+	"sort"
 	"unsafe"
 )
 
@@ -29,16 +31,53 @@ type RestoreContext struct {
 	idxFromImage map[common.IndexerId][]*planner.IndexUsage
 	idxToRestore map[common.IndexerId][]*planner.IndexUsage
 	indexerMap   map[common.IndexerId]common.IndexerId
+	decisions    []*restoreDecision
+	placement    map[*planner.IndexUsage]string
+	remapped     map[common.IndexDefnId]string
 }
 
+//
+// Filter and bucket remap applied to the backup image, and whether
+// restore only reports what it would do.
+//
+type RestoreOptions struct {
+	DryRun    bool
+	Buckets   []string
+	Pattern   *regexp.Regexp
+	BucketMap map[string]string
+}
+
+//
+// What restore does with an index (partition/replica) of the image.
+//
+type restoreDecision struct {
+	bucket      string
+	name        string
+	newName     string
+	replicaId   int
+	partnId     common.PartitionId
+	partitioned bool
+	action      string
+	reason      string
+	index       *planner.IndexUsage
+}
+
+const (
+	RESTORE_CREATE   = "create"
+	RESTORE_SKIP     = "skip"
+	RESTORE_CONFLICT = "conflict"
+)
+
 //////////////////////////////////////////////////////////////
 // RestoreContext
 //////////////////////////////////////////////////////////////
 
 //
-// Initialize restore context
+// Initialize restore context.  remapped has the name in the backup image
+// of the indexes renamed by bucket remap.
 //
-func createRestoreContext(image *ClusterIndexMetadata, clusterUrl string) *RestoreContext {
+func createRestoreContext(image *ClusterIndexMetadata, clusterUrl string,
+	remapped map[common.IndexDefnId]string) *RestoreContext {
 
 	context := &RestoreContext{
 		clusterUrl:   clusterUrl,
@@ -46,6 +85,8 @@ func createRestoreContext(image *ClusterIndexMetadata, clusterUrl string) *Resto
 		idxFromImage: make(map[common.IndexerId][]*planner.IndexUsage),
 		idxToRestore: make(map[common.IndexerId][]*planner.IndexUsage),
 		indexerMap:   make(map[common.IndexerId]common.IndexerId),
+		placement:    make(map[*planner.IndexUsage]string),
+		remapped:     remapped,
 	}
 
 	return context
@@ -129,6 +170,8 @@ func (m *RestoreContext) convertImage() error {
 			if len(indexes) == 0 {
 				logging.Infof("RestoreContext:  Index could be in the process of being created or dropped.  Skip restoring index (%v, %v).",
 					defn.Bucket, defn.Name)
+				m.decisions = append(m.decisions, &restoreDecision{bucket: defn.Bucket, name: defn.Name,
+					action: RESTORE_SKIP, reason: "index is being created or dropped"})
 				continue
 			}
 
@@ -163,6 +206,7 @@ func (m *RestoreContext) cleanseBackupMetadata() {
 
 			if index.Instance == nil {
 				logging.Infof("RestoreContext:  Skip restoring orphan index with no instance metadata (%v, %v, %v).", index.Bucket, index.Name, index.PartnId)
+				m.decide(index, RESTORE_SKIP, "no instance metadata")
 				continue
 			}
 
@@ -196,6 +240,7 @@ func (m *RestoreContext) findIndexToRestore() {
 
 	defnId2NameMap := make(map[common.IndexDefnId]string)
 	instPartnCount := make(map[common.IndexInstId]int)
+	renamed := make(map[*planner.IndexUsage]string)
 
 	for indexerId, indexes := range m.idxFromImage {
 
@@ -205,6 +250,7 @@ func (m *RestoreContext) findIndexToRestore() {
 			// **For pre-spock backup, RState of an instance is ACTIVE (0).
 			if index.Instance == nil || index.Instance.RState != common.REBAL_ACTIVE {
 				logging.Infof("RestoreContext:  Skip restoring RState PENDING index (%v, %v).", index.Bucket, index.Name)
+				m.decide(index, RESTORE_SKIP, "index is being rebalanced")
 				continue
 			}
 
@@ -224,6 +270,7 @@ func (m *RestoreContext) findIndexToRestore() {
 					if anyReplica != nil {
 						logging.Infof("RestoreContext:  Find index in the target cluster with the same bucket, name, replicaId and definition. "+
 							"Skip restoring index (%v, %v, %v, %v).", index.Bucket, index.Name, index.PartnId, index.Instance.ReplicaId)
+						m.decide(index, RESTORE_SKIP, "index already exists")
 						continue
 					}
 
@@ -231,6 +278,7 @@ func (m *RestoreContext) findIndexToRestore() {
 					if (anyInst.Instance.Defn.NumReplica + 1) <= uint32(index.Instance.ReplicaId) {
 						logging.Infof("RestoreContext:  Find index in the target cluster with the same bucket, name and definition, but fewer replica. "+
 							"Skip restoring index (%v, %v, %v, %v).", index.Bucket, index.Name, index.PartnId, index.Instance.ReplicaId)
+						m.decide(index, RESTORE_SKIP, "index exists with fewer replica")
 						continue
 					}
 
@@ -250,6 +298,7 @@ func (m *RestoreContext) findIndexToRestore() {
 						" Renaming index from (%v, %v, %v) to (%v, %v, %v).",
 						index.Bucket, index.Name, index.Instance.ReplicaId, index.Bucket, defnId2NameMap[index.DefnId], index.Instance.ReplicaId)
 
+					renamed[index] = index.Name
 					index.Name = defnId2NameMap[index.DefnId]
 					index.Instance.Defn.Name = defnId2NameMap[index.DefnId]
 				}
@@ -274,9 +323,23 @@ func (m *RestoreContext) findIndexToRestore() {
 				logging.Infof("RestoreContext:  Index (%v, %v, %v, %v) does not exist in current cluster.  Make it a restore candidate.",
 					index.Bucket, index.Name, index.PartnId, index.Instance.ReplicaId)
 
+				if name, ok := renamed[index]; ok {
+					decision := m.decide(index, RESTORE_CONFLICT, "index with same name and different definition exists")
+					decision.name, decision.newName = name, index.Name
+					if name, ok := m.remapped[index.DefnId]; ok {
+						decision.name = name
+					}
+				} else if name, ok := m.remapped[index.DefnId]; ok {
+					decision := m.decide(index, RESTORE_CONFLICT, "index with same name is remapped to the bucket")
+					decision.name, decision.newName = name, index.Name
+				} else {
+					m.decide(index, RESTORE_CREATE, "")
+				}
+
 			} else {
 				logging.Infof("RestoreContext:  Find index in the restore image with missing partition. "+
 					"Skip restoring index (%v, %v, %v, %v).", index.Bucket, index.Name, index.PartnId, index.Instance.ReplicaId)
+				m.decide(index, RESTORE_SKIP, "missing partition in backup image")
 			}
 		}
 
@@ -430,6 +493,7 @@ func (m *RestoreContext) buildIndexHostMapping(solution *planner.Solution) map[s
 				if indexer := solution.FindIndexerWithReplica(index.Name, index.Bucket, index.PartnId, index.Instance.ReplicaId); indexer != nil {
 					logging.Infof("RestoreContext:  Restoring index (%v, %v, %v, %v) at indexer %v",
 						index.Bucket, index.Name, index.PartnId, index.Instance.ReplicaId, indexer.NodeId)
+					m.placement[index] = indexer.NodeId
 
 					defns := result[indexer.RestUrl]
 					found := false
@@ -469,6 +533,309 @@ func (m *RestoreContext) buildIndexHostMapping(solution *planner.Solution) map[s
 	return result
 }
 
+//
+// Record what restore does with the index.
+//
+func (m *RestoreContext) decide(index *planner.IndexUsage, action string, reason string) *restoreDecision {
+
+	decision := &restoreDecision{
+		bucket: index.Bucket,
+		name:   index.Name,
+		action: action,
+		reason: reason,
+		index:  index,
+	}
+
+	if index.Instance != nil {
+		decision.replicaId = index.Instance.ReplicaId
+		decision.partnId = index.PartnId
+		decision.partitioned = common.IsPartitioned(index.Instance.Defn.PartitionScheme)
+	}
+
+	m.decisions = append(m.decisions, decision)
+	return decision
+}
+
+//
+// Compute the index layout without restoring, and report the action
+// taken for each index in the image along with its placement.
+//
+func (m *RestoreContext) computeRestoreDiff() ([]RestoreIndexDiff, error) {
+
+	if _, err := m.computeIndexLayout(); err != nil {
+		return nil, err
+	}
+
+	return m.restoreDiff(), nil
+}
+
+//
+// Group the decisions by index replica, along with the hosts the
+// replica is placed at.
+//
+func (m *RestoreContext) restoreDiff() []RestoreIndexDiff {
+
+	diffs := ([]*RestoreIndexDiff)(nil)
+	diffMap := make(map[string]*RestoreIndexDiff)
+
+	for _, decision := range m.decisions {
+		key := fmt.Sprintf("%v %v %v %v %v %v", decision.bucket, decision.name, decision.newName,
+			decision.replicaId, decision.action, decision.reason)
+
+		diff, ok := diffMap[key]
+		if !ok {
+			diff = &RestoreIndexDiff{
+				Bucket:    decision.bucket,
+				Name:      decision.name,
+				NewName:   decision.newName,
+				ReplicaId: decision.replicaId,
+				Action:    decision.action,
+				Reason:    decision.reason,
+			}
+			diffMap[key] = diff
+			diffs = append(diffs, diff)
+		}
+
+		if decision.partitioned {
+			diff.Partitions = append(diff.Partitions, decision.partnId)
+		}
+
+		if host, ok := m.placement[decision.index]; ok && decision.index != nil {
+			found := false
+			for _, h := range diff.Hosts {
+				if h == host {
+					found = true
+					break
+				}
+			}
+			if !found {
+				diff.Hosts = append(diff.Hosts, host)
+			}
+		} else if decision.action != RESTORE_SKIP {
+			diff.Reason = "fail to place index"
+		}
+	}
+
+	sort.Slice(diffs, func(i, j int) bool {
+		if diffs[i].Bucket != diffs[j].Bucket {
+			return diffs[i].Bucket < diffs[j].Bucket
+		}
+		if diffs[i].Name != diffs[j].Name {
+			return diffs[i].Name < diffs[j].Name
+		}
+		return diffs[i].ReplicaId < diffs[j].ReplicaId
+	})
+
+	result := make([]RestoreIndexDiff, 0, len(diffs))
+	for _, diff := range diffs {
+		sort.Slice(diff.Partitions, func(i, j int) bool { return diff.Partitions[i] < diff.Partitions[j] })
+		sort.Strings(diff.Hosts)
+		result = append(result, *diff)
+	}
+
+	return result
+}
+
+//////////////////////////////////////////////////////////////
+// Restore Options
+//////////////////////////////////////////////////////////////
+
+//
+// Bucket filter applies to the bucket name in the backup image, i.e.
+// before remap.
+//
+func (o *RestoreOptions) matchBucket(bucket string) bool {
+
+	if len(o.Buckets) == 0 {
+		return true
+	}
+
+	for _, b := range o.Buckets {
+		if b == bucket {
+			return true
+		}
+	}
+	return false
+}
+
+func (o *RestoreOptions) matchName(name string) bool {
+
+	return o.Pattern == nil || o.Pattern.MatchString(name)
+}
+
+func (o *RestoreOptions) remapBucket(bucket string) string {
+
+	if target, ok := o.BucketMap[bucket]; ok {
+		return target
+	}
+	return bucket
+}
+
+//
+// Remove the indexes not selected by the options from the image, and
+// remap the bucket of the remaining ones.  Index remapped to the same
+// <bucket, name> as another index in the image is renamed.  Return the
+// name in the backup image of the renamed indexes.
+//
+func filterRestoreImage(image *ClusterIndexMetadata, options *RestoreOptions) map[common.IndexDefnId]string {
+
+	origBuckets := make(map[common.IndexDefnId]string)
+
+	for i, _ := range image.Metadata {
+		meta := &image.Metadata[i]
+
+		topologies := make([]IndexTopology, 0, len(meta.IndexTopologies))
+		for _, topology := range meta.IndexTopologies {
+			if !options.matchBucket(topology.Bucket) {
+				continue
+			}
+
+			defns := make([]IndexDefnDistribution, 0, len(topology.Definitions))
+			for _, defn := range topology.Definitions {
+				if options.matchName(defn.Name) {
+					defn.Bucket = options.remapBucket(defn.Bucket)
+					defns = append(defns, defn)
+				}
+			}
+			topology.Bucket = options.remapBucket(topology.Bucket)
+			topology.Definitions = defns
+
+			// more than one bucket can be remapped to the same bucket
+			merged := false
+			for j, _ := range topologies {
+				if topologies[j].Bucket == topology.Bucket {
+					topologies[j].Definitions = append(topologies[j].Definitions, topology.Definitions...)
+					merged = true
+					break
+				}
+			}
+			if !merged {
+				topologies = append(topologies, topology)
+			}
+		}
+		meta.IndexTopologies = topologies
+
+		definitions := make([]common.IndexDefn, 0, len(meta.IndexDefinitions))
+		for _, defn := range meta.IndexDefinitions {
+			if options.matchBucket(defn.Bucket) && options.matchName(defn.Name) {
+				origBuckets[defn.DefnId] = defn.Bucket
+				defn.Bucket = options.remapBucket(defn.Bucket)
+				definitions = append(definitions, defn)
+			}
+		}
+		meta.IndexDefinitions = definitions
+	}
+
+	return renameRemappedIndexes(image, origBuckets)
+}
+
+//
+// Rename indexes sharing <bucket, name> with another index after bucket
+// remap, otherwise they would be restored as replicas of the same index.
+// The index that is not remapped, or else the one from the first bucket
+// in the image, keeps its name.
+//
+func renameRemappedIndexes(image *ClusterIndexMetadata, origBuckets map[common.IndexDefnId]string) map[common.IndexDefnId]string {
+
+	type remappedIndex struct {
+		bucket  string
+		name    string
+		defnIds []common.IndexDefnId
+	}
+
+	indexes := make(map[string]*remappedIndex)
+	keys := ([]string)(nil)
+	names := make(map[string]bool)
+
+	for _, meta := range image.Metadata {
+		for _, defn := range meta.IndexDefinitions {
+			key := fmt.Sprintf("%v %v", defn.Bucket, defn.Name)
+			names[key] = true
+
+			index, ok := indexes[key]
+			if !ok {
+				index = &remappedIndex{bucket: defn.Bucket, name: defn.Name}
+				indexes[key] = index
+				keys = append(keys, key)
+			}
+
+			found := false
+			for _, defnId := range index.defnIds {
+				if defnId == defn.DefnId {
+					found = true
+					break
+				}
+			}
+			if !found {
+				index.defnIds = append(index.defnIds, defn.DefnId)
+			}
+		}
+	}
+	sort.Strings(keys)
+
+	newNames := make(map[common.IndexDefnId]string)
+	renamed := make(map[common.IndexDefnId]string)
+
+	for _, key := range keys {
+		index := indexes[key]
+		if len(index.defnIds) < 2 {
+			continue
+		}
+
+		defnIds := index.defnIds
+		sort.Slice(defnIds, func(i, j int) bool {
+			bi, bj := origBuckets[defnIds[i]], origBuckets[defnIds[j]]
+			if (bi == index.bucket) != (bj == index.bucket) {
+				return bi == index.bucket
+			}
+			if bi != bj {
+				return bi < bj
+			}
+			return defnIds[i] < defnIds[j]
+		})
+
+		count := 0
+		for _, defnId := range defnIds[1:] {
+			for ; true; count++ {
+				newName := fmt.Sprintf("%v_%v", index.name, count)
+				if !names[fmt.Sprintf("%v %v", index.bucket, newName)] {
+					names[fmt.Sprintf("%v %v", index.bucket, newName)] = true
+					newNames[defnId] = newName
+					renamed[defnId] = index.name
+					break
+				}
+			}
+
+			logging.Infof("RestoreContext:  Find index in the backup image with the same bucket and index name after bucket remap.  "+
+				" Renaming index from (%v, %v, %v) to (%v, %v, %v).",
+				origBuckets[defnId], index.name, defnId, index.bucket, newNames[defnId], defnId)
+		}
+	}
+
+	for i, _ := range image.Metadata {
+		meta := &image.Metadata[i]
+
+		for j, _ := range meta.IndexDefinitions {
+			defn := &meta.IndexDefinitions[j]
+			if newName, ok := newNames[defn.DefnId]; ok {
+				defn.Name = newName
+			}
+		}
+
+		for j, _ := range meta.IndexTopologies {
+			topology := &meta.IndexTopologies[j]
+			for k, _ := range topology.Definitions {
+				defn := &topology.Definitions[k]
+				if newName, ok := newNames[common.IndexDefnId(defn.DefnId)]; ok {
+					defn.Name = newName
+				}
+			}
+		}
+	}
+
+	return renamed
+}
+
 //////////////////////////////////////////////////////////////
 // Utility
 //////////////////////////////////////////////////////////////
@@ -0,0 +1,203 @@
+// Copyright (c) 2014 Couchbase, Inc.
+// Licensed under the Apache License, Version 2.0 (the "License"); you may not use this file
+// except in compliance with the License. You may obtain a copy of the License at
+//   http://www.apache.org/licenses/LICENSE-2.0
+// Unless required by applicable law or agreed to in writing, software distributed under the
+// License is distributed on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND,
+// either express or implied. See the License for the specific language governing permissions
+// and limitations under the License.
+
+package manager
+
+import (
+	"reflect"
+	"regexp"
+	"testing"
+
+	"github.com/couchbase/indexing/secondary/common"
+	"github.com/couchbase/indexing/secondary/planner"
+)
+
+// restoreTestMeta returns the metadata of an indexer holding `defns`.
+func restoreTestMeta(indexerId string, defns ...common.IndexDefn) LocalIndexMetadata {
+	meta := LocalIndexMetadata{IndexerId: indexerId, IndexDefinitions: defns}
+	for _, defn := range defns {
+		dist := IndexDefnDistribution{Bucket: defn.Bucket, Name: defn.Name, DefnId: uint64(defn.DefnId)}
+
+		found := false
+		for i, _ := range meta.IndexTopologies {
+			if meta.IndexTopologies[i].Bucket == defn.Bucket {
+				meta.IndexTopologies[i].Definitions = append(meta.IndexTopologies[i].Definitions, dist)
+				found = true
+			}
+		}
+		if !found {
+			meta.IndexTopologies = append(meta.IndexTopologies,
+				IndexTopology{Bucket: defn.Bucket, Definitions: []IndexDefnDistribution{dist}})
+		}
+	}
+	return meta
+}
+
+func restoreTestNames(image *ClusterIndexMetadata) map[common.IndexDefnId]string {
+	names := make(map[common.IndexDefnId]string)
+	for _, meta := range image.Metadata {
+		for _, defn := range meta.IndexDefinitions {
+			names[defn.DefnId] = defn.Bucket + ":" + defn.Name
+		}
+		for _, topology := range meta.IndexTopologies {
+			for _, defn := range topology.Definitions {
+				if defn.Bucket != topology.Bucket {
+					names[common.IndexDefnId(defn.DefnId)] = "topology bucket mismatch"
+				} else if names[common.IndexDefnId(defn.DefnId)] != defn.Bucket+":"+defn.Name {
+					names[common.IndexDefnId(defn.DefnId)] = "topology name mismatch"
+				}
+			}
+		}
+	}
+	return names
+}
+
+func TestFilterRestoreImage(t *testing.T) {
+	image := &ClusterIndexMetadata{Metadata: []LocalIndexMetadata{
+		restoreTestMeta("i1",
+			common.IndexDefn{DefnId: 1, Bucket: "a", Name: "idx"},
+			common.IndexDefn{DefnId: 2, Bucket: "a", Name: "other"},
+			common.IndexDefn{DefnId: 3, Bucket: "b", Name: "idx"},
+			common.IndexDefn{DefnId: 4, Bucket: "c", Name: "idx"},
+			common.IndexDefn{DefnId: 5, Bucket: "c", Name: "idx_0"},
+			common.IndexDefn{DefnId: 6, Bucket: "d", Name: "idx"}),
+		// replica of index 3 is not a name collision.
+		restoreTestMeta("i2",
+			common.IndexDefn{DefnId: 3, Bucket: "b", Name: "idx"}),
+	}}
+	options := &RestoreOptions{
+		Buckets:   []string{"a", "b", "c"},
+		Pattern:   regexp.MustCompile("^idx"),
+		BucketMap: map[string]string{"a": "c", "b": "c"},
+	}
+
+	remapped := filterRestoreImage(image, options)
+
+	// index that is not remapped keeps its name.
+	expected := map[common.IndexDefnId]string{
+		1: "c:idx_1",
+		3: "c:idx_2",
+		4: "c:idx",
+		5: "c:idx_0",
+	}
+	if names := restoreTestNames(image); !reflect.DeepEqual(names, expected) {
+		t.Errorf("expected indexes %v, got %v", expected, names)
+	}
+	if expected := map[common.IndexDefnId]string{1: "idx", 3: "idx"}; !reflect.DeepEqual(remapped, expected) {
+		t.Errorf("expected renamed indexes %v, got %v", expected, remapped)
+	}
+	for _, meta := range image.Metadata {
+		if len(meta.IndexTopologies) != 1 || meta.IndexTopologies[0].Bucket != "c" {
+			t.Errorf("expected topologies to be merged into bucket c, got %v", meta.IndexTopologies)
+		}
+	}
+
+	// without remap nothing is renamed.
+	image = &ClusterIndexMetadata{Metadata: []LocalIndexMetadata{
+		restoreTestMeta("i1",
+			common.IndexDefn{DefnId: 1, Bucket: "a", Name: "idx"},
+			common.IndexDefn{DefnId: 3, Bucket: "b", Name: "idx"}),
+	}}
+	if remapped := filterRestoreImage(image, &RestoreOptions{}); len(remapped) != 0 {
+		t.Errorf("expected no renamed index, got %v", remapped)
+	}
+}
+
+func restoreTestIndex(defnId common.IndexDefnId, bucket, name string, replicaId int,
+	partnId common.PartitionId, scheme common.PartitionScheme) *planner.IndexUsage {
+
+	defn := common.IndexDefn{DefnId: defnId, Bucket: bucket, Name: name, PartitionScheme: scheme}
+	return &planner.IndexUsage{
+		DefnId:  defnId,
+		InstId:  common.IndexInstId(defnId*10) + common.IndexInstId(replicaId),
+		PartnId: partnId,
+		Name:    name,
+		Bucket:  bucket,
+		Instance: &common.IndexInst{
+			InstId:    common.IndexInstId(defnId*10) + common.IndexInstId(replicaId),
+			Defn:      defn,
+			ReplicaId: replicaId,
+			RState:    common.REBAL_ACTIVE,
+			Pc:        common.NewKeyPartitionContainer(1024, 2, scheme, common.CRC32),
+		},
+	}
+}
+
+func TestFindIndexToRestoreRemapped(t *testing.T) {
+	m := createRestoreContext(nil, "", map[common.IndexDefnId]string{1: "idx"})
+	m.current = &planner.Plan{}
+	m.idxFromImage["i1"] = []*planner.IndexUsage{
+		restoreTestIndex(1, "c", "idx_0", 0, 0, common.SINGLE),
+		restoreTestIndex(2, "c", "idx", 0, 0, common.SINGLE),
+	}
+
+	m.findIndexToRestore()
+
+	if len(m.decisions) != 2 {
+		t.Fatalf("expected 2 decisions, got %v", len(m.decisions))
+	}
+	for _, decision := range m.decisions {
+		switch decision.index.DefnId {
+		case 1:
+			if decision.action != RESTORE_CONFLICT || decision.name != "idx" || decision.newName != "idx_0" {
+				t.Errorf("expected remapped index to be reported as conflict, got %+v", decision)
+			}
+		case 2:
+			if decision.action != RESTORE_CREATE || decision.newName != "" {
+				t.Errorf("expected index to be created, got %+v", decision)
+			}
+		}
+	}
+}
+
+func TestRestoreDiff(t *testing.T) {
+	m := createRestoreContext(nil, "", nil)
+
+	partn1 := restoreTestIndex(1, "b", "part", 0, 1, common.KEY)
+	partn2 := restoreTestIndex(1, "b", "part", 0, 2, common.KEY)
+	replica0 := restoreTestIndex(2, "a", "idx", 0, 0, common.SINGLE)
+	replica1 := restoreTestIndex(2, "a", "idx", 1, 0, common.SINGLE)
+	unplaced := restoreTestIndex(3, "a", "new", 0, 0, common.SINGLE)
+	existing := restoreTestIndex(4, "a", "old", 0, 0, common.SINGLE)
+
+	m.decide(partn2, RESTORE_CREATE, "")
+	m.decide(partn1, RESTORE_CREATE, "")
+	conflict := m.decide(replica0, RESTORE_CONFLICT, "index with same name and different definition exists")
+	conflict.name, conflict.newName = "idx", "idx_0"
+	conflict = m.decide(replica1, RESTORE_CONFLICT, "index with same name and different definition exists")
+	conflict.name, conflict.newName = "idx", "idx_0"
+	m.decide(unplaced, RESTORE_CREATE, "")
+	m.decide(existing, RESTORE_SKIP, "index already exists")
+
+	m.placement[partn1] = "n2"
+	m.placement[partn2] = "n1"
+	m.placement[replica0] = "n1"
+	m.placement[replica1] = "n2"
+
+	expected := []RestoreIndexDiff{
+		{Bucket: "a", Name: "idx", NewName: "idx_0", ReplicaId: 0, Action: RESTORE_CONFLICT,
+			Reason: "index with same name and different definition exists", Hosts: []string{"n1"}},
+		{Bucket: "a", Name: "idx", NewName: "idx_0", ReplicaId: 1, Action: RESTORE_CONFLICT,
+			Reason: "index with same name and different definition exists", Hosts: []string{"n2"}},
+		{Bucket: "a", Name: "new", ReplicaId: 0, Action: RESTORE_CREATE, Reason: "fail to place index"},
+		{Bucket: "a", Name: "old", ReplicaId: 0, Action: RESTORE_SKIP, Reason: "index already exists"},
+		{Bucket: "b", Name: "part", ReplicaId: 0, Partitions: []common.PartitionId{1, 2},
+			Action: RESTORE_CREATE, Hosts: []string{"n1", "n2"}},
+	}
+
+	diff := m.restoreDiff()
+	if len(diff) != len(expected) {
+		t.Fatalf("expected %v diffs, got %v: %+v", len(expected), len(diff), diff)
+	}
+	for i := range expected {
+		if !reflect.DeepEqual(diff[i], expected[i]) {
+			t.Errorf("diff %v: expected %+v, got %+v", i, expected[i], diff[i])
+		}
+	}
+}
@@ -701,6 +701,51 @@ func (m *MemDB) ptrToItem(itmPtr unsafe.Pointer) *Item {
 	return itm
 }
 
+// rangePivots returns sorted pivot items which split the snapshot into
+// upto shards key ranges of roughly equal size.
+func (m *MemDB) rangePivots(snap *Snapshot, shards int) []*Item {
+	var pivotItems []*Item
+
+	tmpIter := m.NewIterator(snap)
+	if tmpIter == nil {
+		panic("iterator cannot be nil")
+	}
+	defer tmpIter.Close()
+
+	barrier := m.store.GetAccesBarrier()
+	token := barrier.Acquire()
+	defer barrier.Release(token)
+
+	pivotPtrs := m.store.GetRangeSplitItems(shards)
+	for _, itmPtr := range pivotPtrs {
+		itm := m.ptrToItem(itmPtr)
+		tmpIter.Seek(itm.Bytes())
+		if tmpIter.Valid() {
+			// Find bigger item than prev pivot
+			if len(pivotItems) == 0 ||
+				m.insCmp(unsafe.Pointer(itm), unsafe.Pointer(pivotItems[len(pivotItems)-1])) > 0 {
+				pivotItems = append(pivotItems, itm)
+			}
+		}
+	}
+	return pivotItems
+}
+
+// RangeSplitKeys returns sorted keys which split the snapshot into upto
+// shards key ranges of roughly equal size. Keys are owned by the caller.
+func (m *MemDB) RangeSplitKeys(snap *Snapshot, shards int) [][]byte {
+	if snap == nil {
+		panic("snapshot cannot be nil")
+	}
+
+	pivotItems := m.rangePivots(snap, shards)
+	keys := make([][]byte, 0, len(pivotItems))
+	for _, itm := range pivotItems {
+		keys = append(keys, append([]byte(nil), itm.Bytes()...))
+	}
+	return keys
+}
+
 func (m *MemDB) Visitor(snap *Snapshot, callb VisitorCallback, shards int, concurrency int) error {
 	var wg sync.WaitGroup
 	var pivotItems []*Item
@@ -711,32 +756,9 @@ func (m *MemDB) Visitor(snap *Snapshot, callb VisitorCallback, shards int, concu
 		panic("snapshot cannot be nil")
 	}
 
-	func() {
-		tmpIter := m.NewIterator(snap)
-		if tmpIter == nil {
-			panic("iterator cannot be nil")
-		}
-		defer tmpIter.Close()
-
-		barrier := m.store.GetAccesBarrier()
-		token := barrier.Acquire()
-		defer barrier.Release(token)
-
-		pivotItems = append(pivotItems, nil) // start item
-		pivotPtrs := m.store.GetRangeSplitItems(shards)
-		for _, itmPtr := range pivotPtrs {
-			itm := m.ptrToItem(itmPtr)
-			tmpIter.Seek(itm.Bytes())
-			if tmpIter.Valid() {
-				prevItm := pivotItems[len(pivotItems)-1]
-				// Find bigger item than prev pivot
-				if prevItm == nil || m.insCmp(unsafe.Pointer(itm), unsafe.Pointer(prevItm)) > 0 {
-					pivotItems = append(pivotItems, itm)
-				}
-			}
-		}
-		pivotItems = append(pivotItems, nil) // end item
-	}()
+	pivotItems = append(pivotItems, nil) // start item
+	pivotItems = append(pivotItems, m.rangePivots(snap, shards)...)
+	pivotItems = append(pivotItems, nil) // end item
 
 	errors := make([]error, len(pivotItems)-1)
 
@@ -46,9 +46,13 @@ type RunConfig struct {
 	MaxCpuUse      int
 	MemQuota       int64
 	CpuQuota       int
+	DiskQuota      int64
 	DataCostWeight float64
 	CpuCostWeight  float64
 	MemCostWeight  float64
+	MoveCostWeight float64
+	DiskCostWeight float64
+	MinimizeMove   bool
 	EjectOnly      bool
 	DisableRepair  bool
 	Timeout        int
@@ -80,6 +84,11 @@ type RunStats struct {
 	Initial_stdDevIndexerCpu  float64
 	Initial_movedIndex        uint64
 	Initial_movedData         uint64
+
+	MovedIndex        uint64
+	MovedData         uint64
+	MovedDocs         uint64
+	ResourceVariation float64
 }
 
 type Plan struct {
@@ -87,6 +96,7 @@ type Plan struct {
 	Placement []*IndexerNode `json:"placement,omitempty"`
 	MemQuota  uint64         `json:"memQuota,omitempty"`
 	CpuQuota  uint64         `json:"cpuQuota,omitempty"`
+	DiskQuota uint64         `json:"diskQuota,omitempty"`
 	IsLive    bool           `json:"isLive,omitempty"`
 }
 
@@ -127,15 +137,17 @@ type IndexSpec struct {
 /////////////////////////////////////////////////////////////
 
 func ExecuteRebalance(clusterUrl string, topologyChange service.TopologyChange, masterId string, ejectOnly bool,
-	disableReplicaRepair bool, threshold float64, timeout int, cpuProfile bool) (map[string]*common.TransferToken, error) {
+	disableReplicaRepair bool, threshold float64, timeout int, cpuProfile bool,
+	moveCostWeight float64, diskCostWeight float64, minimizeMove bool) (map[string]*common.TransferToken, error) {
 	runtime := time.Now()
 	return ExecuteRebalanceInternal(clusterUrl, topologyChange, masterId, false, true, ejectOnly, disableReplicaRepair,
-		timeout, threshold, cpuProfile, &runtime)
+		timeout, threshold, cpuProfile, moveCostWeight, diskCostWeight, minimizeMove, &runtime)
 }
 
 func ExecuteRebalanceInternal(clusterUrl string,
 	topologyChange service.TopologyChange, masterId string, addNode bool, detail bool, ejectOnly bool,
-	disableReplicaRepair bool, timeout int, threshold float64, cpuProfile bool, runtime *time.Time) (map[string]*common.TransferToken, error) {
+	disableReplicaRepair bool, timeout int, threshold float64, cpuProfile bool,
+	moveCostWeight float64, diskCostWeight float64, minimizeMove bool, runtime *time.Time) (map[string]*common.TransferToken, error) {
 
 	plan, err := RetrievePlanFromCluster(clusterUrl, nil)
 	if err != nil {
@@ -170,6 +182,9 @@ func ExecuteRebalanceInternal(clusterUrl string,
 	config.Runtime = runtime
 	config.Threshold = threshold
 	config.CpuProfile = cpuProfile
+	config.MoveCostWeight = moveCostWeight
+	config.DiskCostWeight = diskCostWeight
+	config.MinimizeMove = minimizeMove
 
 	p, _, err := execute(config, CommandRebalance, plan, nil, deleteNodes)
 	if p != nil && detail {
@@ -517,7 +532,7 @@ func plan(config *RunConfig, plan *Plan, indexes []*IndexUsage) (*SAPlanner, *Ru
 	}
 
 	// run planner
-	cost = newUsageBasedCostMethod(constraint, config.DataCostWeight, config.CpuCostWeight, config.MemCostWeight)
+	cost = newUsageBasedCostMethod(constraint, config.DataCostWeight, config.CpuCostWeight, config.MemCostWeight, config.MoveCostWeight, config.DiskCostWeight)
 	planner := newSAPlanner(cost, constraint, placement, sizing)
 	if _, err := planner.Plan(CommandPlan, solution); err != nil {
 		return planner, s, err
@@ -604,11 +619,12 @@ func rebalance(command CommandType, config *RunConfig, plan *Plan, indexes []*In
 
 	// run planner
 	placement = newRandomPlacement(indexes, config.AllowSwap, command == CommandSwap)
-	cost = newUsageBasedCostMethod(constraint, config.DataCostWeight, config.CpuCostWeight, config.MemCostWeight)
+	cost = newUsageBasedCostMethod(constraint, config.DataCostWeight, config.CpuCostWeight, config.MemCostWeight, config.MoveCostWeight, config.DiskCostWeight)
 	planner := newSAPlanner(cost, constraint, placement, sizing)
 	planner.SetTimeout(config.Timeout)
 	planner.SetRuntime(config.Runtime)
 	planner.SetVariationThreshold(config.Threshold)
+	planner.SetMinimizeMove(config.MinimizeMove)
 	planner.SetCpuProfile(config.CpuProfile)
 	if config.Detail {
 		logging.Infof("************ Index Layout Before Rebalance *************")
@@ -622,6 +638,7 @@ func rebalance(command CommandType, config *RunConfig, plan *Plan, indexes []*In
 	// save result
 	s.MemoryQuota = constraint.GetMemQuota()
 	s.CpuQuota = constraint.GetCpuQuota()
+	setMovementStats(s, planner, cost)
 
 	if config.Output != "" {
 		if err := savePlan(config.Output, planner.Result, constraint); err != nil {
@@ -738,9 +755,13 @@ func DefaultRunConfig() *RunConfig {
 		MaxCpuUse:      -1,
 		MemQuota:       -1,
 		CpuQuota:       -1,
+		DiskQuota:      -1,
 		DataCostWeight: 1,
 		CpuCostWeight:  1,
 		MemCostWeight:  1,
+		MoveCostWeight: 0,
+		DiskCostWeight: 0,
+		MinimizeMove:   false,
 		EjectOnly:      false,
 		DisableRepair:  false,
 	}
@@ -791,7 +812,9 @@ func initialSolution(config *RunConfig,
 
 	memQuota, cpuQuota := computeQuota(config, sizing, indexes, false)
 
-	constraint := newIndexerConstraint(memQuota, cpuQuota, resize, maxNumNode, maxCpuUse, maxMemUse)
+	diskQuota := computeDiskQuota(config, nil)
+
+	constraint := newIndexerConstraint(memQuota, cpuQuota, diskQuota, resize, maxNumNode, maxCpuUse, maxMemUse)
 
 	indexers := indexerNodes(constraint, indexes, sizing, false)
 
@@ -816,7 +839,9 @@ func emptySolution(config *RunConfig,
 
 	memQuota, cpuQuota := computeQuota(config, sizing, indexes, false)
 
-	constraint := newIndexerConstraint(memQuota, cpuQuota, resize, maxNumNode, maxCpuUse, maxMemUse)
+	diskQuota := computeDiskQuota(config, nil)
+
+	constraint := newIndexerConstraint(memQuota, cpuQuota, diskQuota, resize, maxNumNode, maxCpuUse, maxMemUse)
 
 	r := newSolution(constraint, sizing, ([]*IndexerNode)(nil), false, false, config.DisableRepair)
 
@@ -857,7 +882,9 @@ func solutionFromPlan(command CommandType, config *RunConfig, sizing SizingMetho
 		cpuQuota = uint64(float64(plan.CpuQuota) * cpuQuotaFactor)
 	}
 
-	constraint := newIndexerConstraint(memQuota, cpuQuota, resize, maxNumNode, maxCpuUse, maxMemUse)
+	diskQuota := computeDiskQuota(config, plan)
+
+	constraint := newIndexerConstraint(memQuota, cpuQuota, diskQuota, resize, maxNumNode, maxCpuUse, maxMemUse)
 
 	r := newSolution(constraint, sizing, plan.Placement, plan.IsLive, useLive, config.DisableRepair)
 	r.calculateSize() // in case sizing formula changes after the plan is saved
@@ -899,6 +926,23 @@ func computeQuota(config *RunConfig, sizing SizingMethod, indexes []*IndexUsage,
 	return memQuota, cpuQuota
 }
 
+//
+// Disk quota from config overrides the one in plan.  Returns 0 if there
+// is no disk quota.
+//
+func computeDiskQuota(config *RunConfig, plan *Plan) uint64 {
+
+	if config.DiskQuota != -1 {
+		return uint64(config.DiskQuota)
+	}
+
+	if plan != nil {
+		return plan.DiskQuota
+	}
+
+	return 0
+}
+
 //
 // This function is only called during placement to make existing index as
 // eligible candidate for planner.
@@ -1056,13 +1100,29 @@ func setInitialLayoutStats(s *RunStats,
 	s.Initial_indexCount = uint64(len(initialIndexes))
 	s.Initial_indexerCount = uint64(len(solution.Placement))
 
-	initial_cost := newUsageBasedCostMethod(constraint, config.DataCostWeight, config.CpuCostWeight, config.MemCostWeight)
+	initial_cost := newUsageBasedCostMethod(constraint, config.DataCostWeight, config.CpuCostWeight, config.MemCostWeight, config.MoveCostWeight, config.DiskCostWeight)
 	s.Initial_score = initial_cost.Cost(solution)
 
 	s.Initial_movedIndex = movedIndex
 	s.Initial_movedData = movedData
 }
 
+//
+// Set stats for index movement of the planner result
+//
+func setMovementStats(s *RunStats, p *SAPlanner, cost CostMethod) {
+
+	if p.Result == nil {
+		return
+	}
+
+	_, s.MovedData, _, s.MovedIndex = p.Result.computeIndexMovement(true)
+	_, s.MovedDocs = p.Result.computeDocMovement()
+
+	cost.Cost(p.Result)
+	s.ResourceVariation = cost.ComputeResourceVariation()
+}
+
 //////////////////////////////////////////////////////////////
 // Index Generation (from Index Spec)
 /////////////////////////////////////////////////////////////
@@ -1214,6 +1274,10 @@ func savePlan(output string, solution *Solution, constraint ConstraintMethod) er
 		IsLive:    solution.isLiveData,
 	}
 
+	if c, ok := constraint.(*IndexerConstraint); ok {
+		plan.DiskQuota = c.DiskQuota
+	}
+
 	data, err := json.MarshalIndent(plan, "", "	")
 	if err != nil {
 		return errors.New(fmt.Sprintf("Unable to save plan into %v. err = %s", output, err))
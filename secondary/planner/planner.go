@@ -54,6 +54,14 @@ const (
 	MOIScanTimeout                = 120
 )
 
+// constant - index sizing - disk
+const (
+	PlasmaDiskFragmentation    uint64 = 30 // percentage
+	PlasmaWriteAmplification          = 3
+	ForestDBDiskFragmentation         = 30 // percentage
+	ForestDBWriteAmplification        = 10
+)
+
 // constant - command
 type CommandType string
 
@@ -70,6 +78,7 @@ const (
 	NoViolation          ViolationCode = "NoViolation"
 	MemoryViolation                    = "MemoryViolation"
 	CpuViolation                       = "CpuViolation"
+	DiskViolation                      = "DiskViolation"
 	ReplicaViolation                   = "ReplicaViolation"
 	EquivIndexViolation                = "EquivIndexViolation"
 	ServerGroupViolation               = "ServerGroupViolation"
@@ -149,18 +158,24 @@ type IndexerNode struct {
 	ServerGroup string `json:"serverGroup,omitempty"`
 	StorageMode string `json:"storageMode,omitempty"`
 
+	// input: disk capacity of the node (from live cluster).  Disk quota
+	// of the constraint applies if it is lower, or if this is not set.
+	DiskQuota uint64 `json:"diskQuota,omitempty"`
+
 	// input/output: resource consumption (from sizing)
-	MemUsage    uint64  `json:"memUsage"`
-	CpuUsage    float64 `json:"cpuUsage"`
-	DiskUsage   uint64  `json:"diskUsage,omitempty"`
-	MemOverhead uint64  `json:"memOverhead"`
-	DataSize    uint64  `json:"dataSize"`
+	MemUsage      uint64  `json:"memUsage"`
+	CpuUsage      float64 `json:"cpuUsage"`
+	DiskUsage     uint64  `json:"diskUsage,omitempty"`
+	DiskWriteRate uint64  `json:"diskWriteRate,omitempty"`
+	MemOverhead   uint64  `json:"memOverhead"`
+	DataSize      uint64  `json:"dataSize"`
 
 	// input/output: resource consumption (from live cluster)
 	ActualMemUsage    uint64  `json:"actualMemUsage"`
 	ActualMemOverhead uint64  `json:"actualMemOverhead"`
 	ActualCpuUsage    float64 `json:"actualCpuUsage"`
 	ActualDataSize    uint64  `json:"actualDataSize"`
+	ActualDiskUsage   uint64  `json:"actualDiskUsage,omitempty"`
 
 	// input: index residing on the node
 	Indexes []*IndexUsage `json:"indexes"`
@@ -202,11 +217,12 @@ type IndexUsage struct {
 	ScanRate      uint64  `json:"scanRate"`
 
 	// input: resource consumption (from sizing equation)
-	MemUsage    uint64  `json:"memUsage"`
-	CpuUsage    float64 `json:"cpuUsage"`
-	DiskUsage   uint64  `json:"diskUsage,omitempty"`
-	MemOverhead uint64  `json:"memOverhead,omitempty"`
-	DataSize    uint64  `json:"dataSize,omitempty"`
+	MemUsage      uint64  `json:"memUsage"`
+	CpuUsage      float64 `json:"cpuUsage"`
+	DiskUsage     uint64  `json:"diskUsage,omitempty"`
+	DiskWriteRate uint64  `json:"diskWriteRate,omitempty"`
+	MemOverhead   uint64  `json:"memOverhead,omitempty"`
+	DataSize      uint64  `json:"dataSize,omitempty"`
 
 	// input: resource consumption (from live cluster)
 	ActualMemUsage        uint64  `json:"actualMemUsage"`
@@ -217,6 +233,7 @@ type IndexUsage struct {
 	ActualResidentPercent uint64  `json:"actualResidentPercent"`
 	ActualDataSize        uint64  `json:"actualDataSize"`
 	ActualNumDocs         uint64  `json:"actualNumDocs"`
+	ActualDiskUsage       uint64  `json:"actualDiskUsage,omitempty"`
 
 	// input: resource consumption (estimated sizing)
 	NoUsageInfo       bool   `json:"NoUsageInfo"`
@@ -280,12 +297,13 @@ type Violations struct {
 }
 
 type Violation struct {
-	Name     string
-	Bucket   string
-	NodeId   string
-	CpuUsage float64
-	MemUsage uint64
-	Details  []string
+	Name      string
+	Bucket    string
+	NodeId    string
+	CpuUsage  float64
+	MemUsage  uint64
+	DiskUsage uint64
+	Details   []string
 }
 
 //////////////////////////////////////////////////////////////
@@ -299,10 +317,11 @@ type SAPlanner struct {
 	sizing     SizingMethod
 
 	// config
-	timeout    int
-	runtime    *time.Time
-	threshold  float64
-	cpuProfile bool
+	timeout      int
+	runtime      *time.Time
+	threshold    float64
+	cpuProfile   bool
+	minimizeMove bool
 
 	// result
 	Result          *Solution `json:"result,omitempty"`
@@ -332,10 +351,18 @@ type UsageBasedCostMethod struct {
 	DataMoved      uint64  `json:"dataMoved,omitempty"`
 	TotalIndex     uint64  `json:"totalIndex,omitempty"`
 	IndexMoved     uint64  `json:"indexMoved,omitempty"`
+	TotalDocs      uint64  `json:"totalDocs,omitempty"`
+	DocsMoved      uint64  `json:"docsMoved,omitempty"`
+	DiskMean       float64 `json:"diskMean,omitempty"`
+	DiskStdDev     float64 `json:"diskStdDev,omitempty"`
+	DiskRateMean   float64 `json:"diskRateMean,omitempty"`
+	DiskRateStdDev float64 `json:"diskRateStdDev,omitempty"`
 	constraint     ConstraintMethod
 	dataCostWeight float64
 	cpuCostWeight  float64
 	memCostWeight  float64
+	moveCostWeight float64
+	diskCostWeight float64
 }
 
 //////////////////////////////////////////////////////////////
@@ -387,6 +414,7 @@ type IndexerConstraint struct {
 	// system level constraint
 	MemQuota   uint64 `json:"memQuota,omitempty"`
 	CpuQuota   uint64 `json:"cpuQuota,omitempty"`
+	DiskQuota  uint64 `json:"diskQuota,omitempty"`
 	MaxMemUse  int64  `json:"maxMemUse,omitempty"`
 	MaxCpuUse  int64  `json:"maxCpuUse,omitempty"`
 	canResize  bool
@@ -502,9 +530,33 @@ func (p *SAPlanner) planSingleRun(command CommandType, solution *Solution) (*Sol
 		startTemp = temperature
 	}
 
+	// With minimizeMove, keep the solution with the least data movement,
+	// and then the least number of indexes moved, among those with
+	// resource variation under threshold that satisfy all constraints.
+	var leastMove *Solution
+	leastMoveCost := old_cost
+	leastMoveData := uint64(math.MaxUint64)
+	leastMoveIndex := uint64(math.MaxUint64)
+	leastMoveFound := false
+	tryLeastMove := func(s *Solution, cost float64) {
+		if !p.minimizeMove || p.threshold <= 0 || s.cost == nil || s.cost.ComputeResourceVariation() > p.threshold {
+			return
+		}
+		if !p.constraint.SatisfyClusterConstraint(s, eligibles) {
+			return
+		}
+		_, dataMoved, _, indexMoved := s.computeIndexMovement(false)
+		if dataMoved < leastMoveData || (dataMoved == leastMoveData && indexMoved < leastMoveIndex) {
+			leastMove, leastMoveCost, leastMoveData, leastMoveIndex = s, cost, dataMoved, indexMoved
+			leastMoveFound = true
+		}
+	}
+	tryLeastMove(current, old_cost)
+
 	for temperature > MinTemperature && !done {
 		lastMove := move
 		lastPositiveMove := positiveMove
+		leastMoveFound = false
 		for i := 0; i < IterationPerTemp; i++ {
 			new_solution, force, final := p.findNeighbor(current)
 			if new_solution != nil {
@@ -529,6 +581,8 @@ func (p *SAPlanner) planSingleRun(command CommandType, solution *Solution) (*Sol
 					move++
 
 					logging.Tracef("Planner::accept solution: new_cost %v temp %v", new_cost, temperature)
+
+					tryLeastMove(current, old_cost)
 				}
 
 				iteration++
@@ -548,6 +602,11 @@ func (p *SAPlanner) planSingleRun(command CommandType, solution *Solution) (*Sol
 			done = true
 		}
 
+		// stop once a round no longer improves on the least movement.
+		if leastMove != nil && !leastMoveFound {
+			done = true
+		}
+
 		temperature = temperature * Alpha
 
 		if command == CommandPlan && initialPlan {
@@ -564,6 +623,13 @@ func (p *SAPlanner) planSingleRun(command CommandType, solution *Solution) (*Sol
 		}
 	}
 
+	if leastMove != nil && leastMove != current {
+		logging.Infof("Planner::use solution with least data movement %v under variation threshold %v",
+			formatMemoryStr(leastMoveData), p.threshold)
+		current = leastMove
+		old_cost = leastMoveCost
+	}
+
 	p.ElapseTime = uint64(time.Now().Sub(startTime).Nanoseconds())
 	p.ConvergenceTime = uint64(lastUpdateTime.Sub(startTime).Nanoseconds())
 	p.Result = current
@@ -595,6 +661,10 @@ func (p *SAPlanner) SetVariationThreshold(threshold float64) {
 	p.threshold = threshold
 }
 
+func (p *SAPlanner) SetMinimizeMove(minimizeMove bool) {
+	p.minimizeMove = minimizeMove
+}
+
 func (p *SAPlanner) SetCpuProfile(cpuProfile bool) {
 	p.cpuProfile = cpuProfile
 }
@@ -1216,6 +1286,7 @@ func (s *Solution) addIndex(n *IndexerNode, idx *IndexUsage, meetConstraint bool
 	n.AddMemUsageOverhead(s, idx.GetMemUsage(s.UseLiveData()), idx.GetMemOverhead(s.UseLiveData()))
 	n.AddCpuUsage(s, idx.GetCpuUsage(s.UseLiveData()))
 	n.AddDataSize(s, idx.GetDataSize(s.UseLiveData()))
+	n.AddDiskUsage(s, idx.GetDiskUsage(s.UseLiveData()), idx.GetDiskWriteRate(s.UseLiveData()))
 	n.EvaluateNodeStats(s)
 	s.updateServerGroupMap(idx, n)
 }
@@ -1234,6 +1305,7 @@ func (s *Solution) removeIndex(n *IndexerNode, i int) {
 	n.SubtractMemUsageOverhead(s, idx.GetMemUsage(s.UseLiveData()), idx.GetMemOverhead(s.UseLiveData()))
 	n.SubtractCpuUsage(s, idx.GetCpuUsage(s.UseLiveData()))
 	n.SubtractDataSize(s, idx.GetDataSize(s.UseLiveData()))
+	n.SubtractDiskUsage(s, idx.GetDiskUsage(s.UseLiveData()), idx.GetDiskWriteRate(s.UseLiveData()))
 
 	n.EvaluateNodeConstraint(s, false, nil, idx)
 	n.EvaluateNodeStats(s)
@@ -1420,6 +1492,11 @@ func (s *Solution) PrintLayout() {
 			indexer.GetMemOverhead(s.UseLiveData()), formatMemoryStr(uint64(indexer.GetMemOverhead(s.UseLiveData()))),
 			indexer.GetDataSize(s.UseLiveData()), formatMemoryStr(uint64(indexer.GetDataSize(s.UseLiveData()))),
 			indexer.GetCpuUsage(s.UseLiveData()), len(indexer.Indexes))
+		if indexer.GetDiskUsage(s.UseLiveData()) != 0 {
+			logging.Infof("Indexer disk:%v (%s), disk write rate:%v (%s/s)",
+				indexer.GetDiskUsage(s.UseLiveData()), formatMemoryStr(indexer.GetDiskUsage(s.UseLiveData())),
+				indexer.GetDiskWriteRate(s.UseLiveData()), formatMemoryStr(indexer.GetDiskWriteRate(s.UseLiveData())))
+		}
 		logging.Infof("Indexer isDeleted:%v isNew:%v exclude:%v meetConstraint:%v",
 			indexer.IsDeleted(), indexer.isNew, indexer.exclude, indexer.meetConstraint)
 
@@ -1578,6 +1655,37 @@ func (s *Solution) ComputeDataSize() (float64, float64) {
 	return meanDataSize, stdDevDataSize
 }
 
+//
+// Compute statistics on disk usage and disk write rate
+//
+func (s *Solution) ComputeDiskUsage() (float64, float64, float64, float64) {
+
+	// Compute mean disk usage and write rate
+	var meanDisk float64
+	var meanWrite float64
+	for _, indexerUsage := range s.Placement {
+		meanDisk += float64(indexerUsage.GetDiskUsage(s.UseLiveData()))
+		meanWrite += float64(indexerUsage.GetDiskWriteRate(s.UseLiveData()))
+	}
+	meanDisk = meanDisk / float64(len(s.Placement))
+	meanWrite = meanWrite / float64(len(s.Placement))
+
+	// compute disk usage and write rate variance
+	var varianceDisk float64
+	var varianceWrite float64
+	for _, indexerUsage := range s.Placement {
+		v := float64(indexerUsage.GetDiskUsage(s.UseLiveData())) - meanDisk
+		varianceDisk += v * v
+
+		v = float64(indexerUsage.GetDiskWriteRate(s.UseLiveData())) - meanWrite
+		varianceWrite += v * v
+	}
+	varianceDisk = varianceDisk / float64(len(s.Placement))
+	varianceWrite = varianceWrite / float64(len(s.Placement))
+
+	return meanDisk, math.Sqrt(varianceDisk), meanWrite, math.Sqrt(varianceWrite)
+}
+
 //
 // Compute statistics on index movement
 //
@@ -1624,6 +1732,40 @@ func (s *Solution) computeIndexMovement(useNewNode bool) (uint64, uint64, uint64
 	return totalSize, dataMoved, totalIndex, indexMoved
 }
 
+//
+// Compute number of docs to be re-indexed due to index movement.  This
+// approximates the build time of moved indexes.
+//
+func (s *Solution) computeDocMovement() (uint64, uint64) {
+
+	totalDocs := uint64(0)
+	docsMoved := uint64(0)
+
+	for _, indexer := range s.Placement {
+
+		// ignore cost moving to a new node
+		if indexer.isNew {
+			continue
+		}
+
+		for _, index := range indexer.Indexes {
+
+			// ignore cost of moving an index out of an to-be-deleted node
+			if index.initialNode == nil || index.initialNode.isDelete {
+				continue
+			}
+
+			numDocs := index.GetNumDocs(s.UseLiveData())
+			totalDocs += numDocs
+			if index.initialNode.NodeId != indexer.NodeId {
+				docsMoved += numDocs
+			}
+		}
+	}
+
+	return totalDocs, docsMoved
+}
+
 //
 // Compute indexer free ratio
 //
@@ -2501,6 +2643,7 @@ func (s *Solution) computeMaxMemUsage() uint64 {
 //
 func newIndexerConstraint(memQuota uint64,
 	cpuQuota uint64,
+	diskQuota uint64,
 	canResize bool,
 	maxNumNode int,
 	maxCpuUse int,
@@ -2508,6 +2651,7 @@ func newIndexerConstraint(memQuota uint64,
 	return &IndexerConstraint{
 		MemQuota:   memQuota,
 		CpuQuota:   cpuQuota,
+		DiskQuota:  diskQuota,
 		canResize:  canResize,
 		maxNumNode: uint64(maxNumNode),
 		MaxCpuUse:  int64(maxCpuUse),
@@ -2521,6 +2665,7 @@ func newIndexerConstraint(memQuota uint64,
 func (c *IndexerConstraint) Print() {
 	logging.Infof("Memory Quota %v (%s)", c.MemQuota, formatMemoryStr(c.MemQuota))
 	logging.Infof("CPU Quota %v", c.CpuQuota)
+	logging.Infof("Disk Quota %v (%s)", c.DiskQuota, formatMemoryStr(c.DiskQuota))
 	logging.Infof("Max Cpu Utilization %v", c.MaxCpuUse)
 	logging.Infof("Max Memory Utilization %v", c.MaxMemUse)
 }
@@ -2589,12 +2734,13 @@ func (c *IndexerConstraint) GetViolations(s *Solution, eligibles map[*IndexUsage
 					}
 
 					violation := &Violation{
-						Name:     index.GetDisplayName(),
-						Bucket:   index.Bucket,
-						NodeId:   indexer.NodeId,
-						MemUsage: index.GetMemTotal(s.UseLiveData()),
-						CpuUsage: index.GetCpuUsage(s.UseLiveData()),
-						Details:  nil}
+						Name:      index.GetDisplayName(),
+						Bucket:    index.Bucket,
+						NodeId:    indexer.NodeId,
+						MemUsage:  index.GetMemTotal(s.UseLiveData()),
+						CpuUsage:  index.GetCpuUsage(s.UseLiveData()),
+						DiskUsage: index.GetDiskUsage(s.UseLiveData()),
+						Details:   nil}
 
 					// If this indexer node has a placeable index, then check if the
 					// index can be moved to other nodes.
@@ -2670,6 +2816,18 @@ func (c *IndexerConstraint) GetCpuQuota() uint64 {
 	return c.CpuQuota
 }
 
+//
+// Get disk quota of the node, which is the lesser of disk available on
+// the node and the disk quota of constraint.  Returns 0 if there is no
+// disk quota.
+//
+func (c *IndexerConstraint) getDiskQuota(n *IndexerNode) uint64 {
+	if n.DiskQuota != 0 && (c.DiskQuota == 0 || n.DiskQuota < c.DiskQuota) {
+		return n.DiskQuota
+	}
+	return c.DiskQuota
+}
+
 //
 // Allow Add Node
 //
@@ -2755,6 +2913,11 @@ func (c *IndexerConstraint) CanAddIndex(s *Solution, n *IndexerNode, u *IndexUsa
 		return MemoryViolation
 	}
 
+	if diskQuota := c.getDiskQuota(n); diskQuota != 0 &&
+		u.GetDiskUsage(s.UseLiveData())+n.GetDiskUsage(s.UseLiveData()) > diskQuota {
+		return DiskViolation
+	}
+
 	/*
 		if u.GetCpuUsage(s.UseLiveData())+n.GetCpuUsage(s.UseLiveData()) > cpuQuota {
 			return CpuViolation
@@ -2815,6 +2978,11 @@ func (c *IndexerConstraint) CanSwapIndex(sol *Solution, n *IndexerNode, s *Index
 		return MemoryViolation
 	}
 
+	if diskQuota := c.getDiskQuota(n); diskQuota != 0 &&
+		s.GetDiskUsage(sol.UseLiveData())+n.GetDiskUsage(sol.UseLiveData())-t.GetDiskUsage(sol.UseLiveData()) > diskQuota {
+		return DiskViolation
+	}
+
 	/*
 		if s.GetCpuUsage(sol.UseLiveData())+n.GetCpuUsage(sol.UseLiveData())-t.GetCpuUsage(sol.UseLiveData()) > cpuQuota {
 			return CpuViolation
@@ -2848,6 +3016,10 @@ func (c *IndexerConstraint) SatisfyNodeResourceConstraint(s *Solution, n *Indexe
 		return false
 	}
 
+	if diskQuota := c.getDiskQuota(n); diskQuota != 0 && n.GetDiskUsage(s.UseLiveData()) > diskQuota {
+		return false
+	}
+
 	/*
 		if n.GetCpuUsage(s.UseLiveData()) > cpuQuota {
 			return false
@@ -3084,6 +3256,8 @@ func (o *IndexerNode) clone() *IndexerNode {
 		DataSize:          o.DataSize,
 		CpuUsage:          o.CpuUsage,
 		DiskUsage:         o.DiskUsage,
+		DiskWriteRate:     o.DiskWriteRate,
+		DiskQuota:         o.DiskQuota,
 		Indexes:           make([]*IndexUsage, len(o.Indexes)),
 		isDelete:          o.isDelete,
 		isNew:             o.isNew,
@@ -3092,6 +3266,7 @@ func (o *IndexerNode) clone() *IndexerNode {
 		ActualMemOverhead: o.ActualMemOverhead,
 		ActualCpuUsage:    o.ActualCpuUsage,
 		ActualDataSize:    o.ActualDataSize,
+		ActualDiskUsage:   o.ActualDiskUsage,
 		meetConstraint:    o.meetConstraint,
 		numEmptyIndex:     o.numEmptyIndex,
 		hasEligible:       o.hasEligible,
@@ -3262,6 +3437,53 @@ func (o *IndexerNode) SubtractDataSize(s *Solution, datasize uint64) {
 	}
 }
 
+//
+// Get disk usage
+//
+func (o *IndexerNode) GetDiskUsage(useLive bool) uint64 {
+
+	if useLive {
+		return o.ActualDiskUsage
+	}
+
+	return o.DiskUsage
+}
+
+//
+// Get disk write rate.  There is no live stats on disk write rate, so
+// it is always from sizing.
+//
+func (o *IndexerNode) GetDiskWriteRate(useLive bool) uint64 {
+
+	return o.DiskWriteRate
+}
+
+//
+// Add disk usage and write rate
+//
+func (o *IndexerNode) AddDiskUsage(s *Solution, usage uint64, writeRate uint64) {
+
+	if s.UseLiveData() {
+		o.ActualDiskUsage += usage
+	} else {
+		o.DiskUsage += usage
+	}
+	o.DiskWriteRate += writeRate
+}
+
+//
+// Subtract disk usage and write rate
+//
+func (o *IndexerNode) SubtractDiskUsage(s *Solution, usage uint64, writeRate uint64) {
+
+	if s.UseLiveData() {
+		o.ActualDiskUsage -= usage
+	} else {
+		o.DiskUsage -= usage
+	}
+	o.DiskWriteRate -= writeRate
+}
+
 //
 // This function returns whether to exclude this node for taking in new index
 //
@@ -3534,6 +3756,38 @@ func (o *IndexUsage) GetDataSize(useLive bool) uint64 {
 	return o.DataSize
 }
 
+//
+// Get disk usage
+//
+func (o *IndexUsage) GetDiskUsage(useLive bool) uint64 {
+
+	if useLive {
+		return o.ActualDiskUsage
+	}
+
+	return o.DiskUsage
+}
+
+//
+// Get disk write rate
+//
+func (o *IndexUsage) GetDiskWriteRate(useLive bool) uint64 {
+
+	return o.DiskWriteRate
+}
+
+//
+// Get number of docs
+//
+func (o *IndexUsage) GetNumDocs(useLive bool) uint64 {
+
+	if useLive {
+		return o.ActualNumDocs
+	}
+
+	return o.NumOfDocs
+}
+
 //
 // Get resident ratio
 //
@@ -3705,6 +3959,11 @@ func (o *IndexUsage) IsPlasma() bool {
 	return o.StorageMode == common.PlasmaDB
 }
 
+func (o *IndexUsage) IsForestDB() bool {
+
+	return o.StorageMode == common.ForestDB
+}
+
 //////////////////////////////////////////////////////////////
 // UsageBasedCostMethod
 //////////////////////////////////////////////////////////////
@@ -3715,13 +3974,17 @@ func (o *IndexUsage) IsPlasma() bool {
 func newUsageBasedCostMethod(constraint ConstraintMethod,
 	dataCostWeight float64,
 	cpuCostWeight float64,
-	memCostWeight float64) *UsageBasedCostMethod {
+	memCostWeight float64,
+	moveCostWeight float64,
+	diskCostWeight float64) *UsageBasedCostMethod {
 
 	return &UsageBasedCostMethod{
 		constraint:     constraint,
 		dataCostWeight: dataCostWeight,
 		memCostWeight:  memCostWeight,
 		cpuCostWeight:  cpuCostWeight,
+		moveCostWeight: moveCostWeight,
+		diskCostWeight: diskCostWeight,
 	}
 }
 
@@ -3754,6 +4017,7 @@ func (c *UsageBasedCostMethod) ComputeResourceVariation() float64 {
 	memCost := float64(0)
 	cpuCost := float64(0)
 	dataSizeCost := float64(0)
+	diskCost := float64(0)
 	count := 0
 
 	if c.MemMean != 0 {
@@ -3771,7 +4035,12 @@ func (c *UsageBasedCostMethod) ComputeResourceVariation() float64 {
 		count++
 	}
 
-	return (memCost + cpuCost + dataSizeCost) / float64(count)
+	if c.diskCostWeight > 0 && c.DiskMean != 0 {
+		diskCost = c.DiskStdDev / c.DiskMean
+		count++
+	}
+
+	return (memCost + cpuCost + dataSizeCost + diskCost) / float64(count)
 }
 
 //
@@ -3784,10 +4053,19 @@ func (c *UsageBasedCostMethod) Cost(s *Solution) float64 {
 	c.CpuMean, c.CpuStdDev = s.ComputeCpuUsage()
 	c.TotalData, c.DataMoved, c.TotalIndex, c.IndexMoved = s.computeIndexMovement(false)
 	c.DataSizeMean, c.DataSizeStdDev = s.ComputeDataSize()
+	if c.moveCostWeight > 0 {
+		c.TotalDocs, c.DocsMoved = s.computeDocMovement()
+	}
+	if c.diskCostWeight > 0 {
+		c.DiskMean, c.DiskStdDev, c.DiskRateMean, c.DiskRateStdDev = s.ComputeDiskUsage()
+	}
 
 	memCost := float64(0)
 	cpuCost := float64(0)
 	movementCost := float64(0)
+	moveCost := float64(0)
+	diskCost := float64(0)
+	diskWriteCost := float64(0)
 	indexCost := float64(0)
 	emptyIdxCost := float64(0)
 	dataSizeCost := float64(0)
@@ -3808,6 +4086,18 @@ func (c *UsageBasedCostMethod) Cost(s *Solution) float64 {
 	}
 	count++
 
+	// Disk usage and disk write rate only apply to indexes on disk
+	// (plasma and forestdb).
+	if c.diskCostWeight > 0 && c.DiskMean != 0 {
+		diskCost = c.DiskStdDev / c.DiskMean * c.diskCostWeight
+		count++
+	}
+
+	if c.diskCostWeight > 0 && c.DiskRateMean != 0 {
+		diskWriteCost = c.DiskRateStdDev / c.DiskRateMean * c.diskCostWeight
+		count++
+	}
+
 	// Empty index is index with no recored memory or cpu usage (exlcuding mem overhead).
 	// It could be index without stats or sizing information.
 	// The cost function minimize the residual memory after subtracting the estimated empty
@@ -3841,10 +4131,23 @@ func (c *UsageBasedCostMethod) Cost(s *Solution) float64 {
 		count++
 	}
 
-	logging.Tracef("Planner::cost: mem cost %v cpu cost %v data moved %v index moved %v emptyIdx cost %v dataSize cost %v count %v",
-		memCost, cpuCost, movementCost, indexCost, emptyIdxCost, dataSizeCost, count)
+	// Unlike data movement cost above, move cost is not relaxed by
+	// usage cost.  It penalizes bytes moved, weighted by index data
+	// size and by index build time (approximated by number of docs to
+	// be indexed on the new node), even if cluster is unbalanced.
+	if c.moveCostWeight > 0 && c.TotalData != 0 {
+		moveCost = float64(c.DataMoved) / float64(c.TotalData)
+		if c.TotalDocs != 0 {
+			moveCost = (moveCost + float64(c.DocsMoved)/float64(c.TotalDocs)) / 2
+		}
+		moveCost = moveCost * c.moveCostWeight
+		count++
+	}
+
+	logging.Tracef("Planner::cost: mem cost %v cpu cost %v data moved %v index moved %v move cost %v emptyIdx cost %v dataSize cost %v disk cost %v disk write cost %v count %v",
+		memCost, cpuCost, movementCost, indexCost, moveCost, emptyIdxCost, dataSizeCost, diskCost, diskWriteCost, count)
 
-	return (memCost + cpuCost + emptyIdxCost + movementCost + indexCost + dataSizeCost) / float64(count)
+	return (memCost + cpuCost + emptyIdxCost + movementCost + indexCost + moveCost + dataSizeCost + diskCost + diskWriteCost) / float64(count)
 }
 
 //
@@ -3890,6 +4193,23 @@ func (s *UsageBasedCostMethod) Print() {
 	logging.Infof("Index Data Moved (exclude new node) %v (%.2f%%)", formatMemoryStr(s.DataMoved), dataMoved)
 	logging.Infof("No. Index (from non-deleted node) %v", formatMemoryStr(s.TotalIndex))
 	logging.Infof("No. Index Moved (exclude new node) %v (%.2f%%)", formatMemoryStr(s.IndexMoved), indexMoved)
+	if s.DiskMean != 0 {
+		logging.Infof("Indexer Disk Mean %v (%s)", uint64(s.DiskMean), formatMemoryStr(uint64(s.DiskMean)))
+		logging.Infof("Indexer Disk Deviation %v (%s) (%.2f%%)", uint64(s.DiskStdDev), formatMemoryStr(uint64(s.DiskStdDev)),
+			s.DiskStdDev/s.DiskMean*100)
+	}
+	if s.DiskRateMean != 0 {
+		logging.Infof("Indexer Disk Write Rate Mean %v (%s/s)", uint64(s.DiskRateMean), formatMemoryStr(uint64(s.DiskRateMean)))
+		logging.Infof("Indexer Disk Write Rate Deviation %v (%s/s) (%.2f%%)", uint64(s.DiskRateStdDev), formatMemoryStr(uint64(s.DiskRateStdDev)),
+			s.DiskRateStdDev/s.DiskRateMean*100)
+	}
+	if s.moveCostWeight > 0 {
+		var docsMoved float64
+		if s.TotalDocs != 0 {
+			docsMoved = float64(s.DocsMoved) / float64(s.TotalDocs) * 100
+		}
+		logging.Infof("No. Docs Moved (exclude new node) %v (%.2f%%)", s.DocsMoved, docsMoved)
+	}
 }
 
 //
@@ -4986,6 +5306,10 @@ func (s *GeneralSizingMethod) ComputeIndexSize(idx *IndexUsage) {
 		// for both MOI and forestdb
 		// we don't have sizing for forestdb but we have simulation tests that run with forestdb
 		s.MOI.ComputeIndexSize(idx)
+
+		if idx.IsForestDB() {
+			computeIndexDisk(idx, ForestDBDiskFragmentation, ForestDBWriteAmplification)
+		}
 	}
 }
 
@@ -4997,11 +5321,15 @@ func (s *GeneralSizingMethod) ComputeIndexerSize(o *IndexerNode) {
 	o.MemUsage = 0
 	o.CpuUsage = 0
 	o.DataSize = 0
+	o.DiskUsage = 0
+	o.DiskWriteRate = 0
 
 	for _, idx := range o.Indexes {
 		o.MemUsage += idx.MemUsage
 		o.CpuUsage += idx.CpuUsage
 		o.DataSize += idx.DataSize
+		o.DiskUsage += idx.DiskUsage
+		o.DiskWriteRate += idx.DiskWriteRate
 	}
 
 	s.ComputeIndexerOverhead(o)
@@ -5213,6 +5541,16 @@ func (s *PlasmaSizingMethod) ComputeIndexSize(idx *IndexUsage) {
 	idx.CpuUsage = float64(idx.MutationRate)/float64(MOIMutationRatePerCore) + float64(idx.ScanRate)/float64(MOIScanRatePerCore)
 
 	idx.MemOverhead = s.ComputeIndexOverhead(idx)
+
+	s.ComputeIndexDisk(idx)
+}
+
+//
+// This function computes the index disk usage and disk write rate
+//
+func (s *PlasmaSizingMethod) ComputeIndexDisk(idx *IndexUsage) {
+
+	computeIndexDisk(idx, PlasmaDiskFragmentation, PlasmaWriteAmplification)
 }
 
 //
@@ -5303,6 +5641,42 @@ func (s *PlasmaSizingMethod) ComputeMinQuota(indexes []*IndexUsage, useLive bool
 	return memQuota, cpuQuota
 }
 
+//////////////////////////////////////////////////////////////
+// Disk Sizing
+//////////////////////////////////////////////////////////////
+
+//
+// This function computes disk usage and disk write rate of an index
+// persisted on disk, given the storage fragmentation (as percentage)
+// and write amplification.
+//
+func computeIndexDisk(idx *IndexUsage, fragmentation uint64, writeAmp uint64) {
+
+	// disk size : DataSize (including back index) * (1 + fragmentation before compaction)
+	idx.DiskUsage = idx.DataSize * (100 + fragmentation) / 100
+	idx.DiskWriteRate = 0
+
+	numDocs := idx.NumOfDocs
+	if numDocs == 0 {
+		numDocs = idx.ActualNumDocs
+	}
+
+	if numDocs == 0 || idx.MutationRate == 0 {
+		return
+	}
+
+	// disk write rate : MutationRate * SizePerItem * WriteAmplification
+	// Mutation on non-resident items has to read and write back the page,
+	// so write amplification grows with the non-resident ratio.
+	residentRatio := idx.ResidentRatio
+	if residentRatio <= 0 || residentRatio > 100 {
+		residentRatio = 100
+	}
+
+	writeRate := float64(idx.MutationRate*(idx.DataSize/numDocs)*writeAmp) * (1 + (100-residentRatio)/100)
+	idx.DiskWriteRate = uint64(writeRate)
+}
+
 //////////////////////////////////////////////////////////////
 // Violations
 //////////////////////////////////////////////////////////////
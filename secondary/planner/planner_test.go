@@ -0,0 +1,239 @@
+// Copyright (c) 2014 Couchbase, Inc.
+// Licensed under the Apache License, Version 2.0 (the "License"); you may not use this file
+// except in compliance with the License. You may obtain a copy of the License at
+//   http://www.apache.org/licenses/LICENSE-2.0
+// Unless required by applicable law or agreed to in writing, software distributed under the
+// License is distributed on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND,
+// either express or implied. See the License for the specific language governing permissions
+// and limitations under the License.
+
+package planner
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/couchbase/indexing/secondary/common"
+)
+
+func TestComputeIndexDisk(t *testing.T) {
+	idx := &IndexUsage{
+		DataSize:      1000,
+		NumOfDocs:     10,
+		MutationRate:  5,
+		ResidentRatio: 50,
+	}
+	computeIndexDisk(idx, 30, 3)
+
+	if idx.DiskUsage != 1300 {
+		t.Errorf("expected disk usage 1300, got %v", idx.DiskUsage)
+	}
+	// 5 mutations/s * 100 bytes * 3, and half of it for non-resident items.
+	if idx.DiskWriteRate != 2250 {
+		t.Errorf("expected disk write rate 2250, got %v", idx.DiskWriteRate)
+	}
+
+	idx.MutationRate = 0
+	computeIndexDisk(idx, 30, 3)
+	if idx.DiskWriteRate != 0 {
+		t.Errorf("expected no disk write without mutation, got %v", idx.DiskWriteRate)
+	}
+}
+
+func TestDiskQuota(t *testing.T) {
+	testcases := []struct {
+		constraint uint64
+		node       uint64
+		quota      uint64
+	}{
+		{0, 0, 0},
+		{1000, 0, 1000},
+		{0, 500, 500},
+		{1000, 500, 500},
+		{1000, 2000, 1000},
+	}
+
+	for _, tc := range testcases {
+		c := newIndexerConstraint(0, 0, tc.constraint, false, 1, -1, -1)
+		n := &IndexerNode{DiskQuota: tc.node}
+		if quota := c.getDiskQuota(n); quota != tc.quota {
+			t.Errorf("constraint %v node %v expected quota %v, got %v",
+				tc.constraint, tc.node, tc.quota, quota)
+		}
+	}
+}
+
+func diskSolution(constraint *IndexerConstraint, diskUsages ...uint64) *Solution {
+	sizing := newGeneralSizingMethod()
+
+	var indexers []*IndexerNode
+	for i, diskUsage := range diskUsages {
+		index := &IndexUsage{
+			DefnId:    common.IndexDefnId(i + 1),
+			Name:      "idx",
+			MemUsage:  100,
+			CpuUsage:  1,
+			DataSize:  100,
+			DiskUsage: diskUsage,
+		}
+		nodeId := string(rune('a' + i))
+		indexers = append(indexers, CreateIndexerNodeWithIndexes(nodeId, sizing, []*IndexUsage{index}))
+	}
+	return newSolution(constraint, sizing, indexers, false, false, false)
+}
+
+func TestDiskCostWeight(t *testing.T) {
+	constraint := newIndexerConstraint(1024*1024*1024, 8, 0, false, 2, -1, -1)
+	s := diskSolution(constraint, 1000, 0)
+
+	// disk is not considered by default.
+	cost := newUsageBasedCostMethod(constraint, 1, 1, 1, 0, 0)
+	noDisk := cost.Cost(s)
+	if cost.DiskMean != 0 {
+		t.Errorf("expected disk usage not to be computed, got mean %v", cost.DiskMean)
+	}
+
+	cost = newUsageBasedCostMethod(constraint, 1, 1, 1, 0, 1)
+	withDisk := cost.Cost(s)
+	if cost.DiskMean != 500 {
+		t.Errorf("expected disk mean 500, got %v", cost.DiskMean)
+	}
+	if withDisk <= noDisk {
+		t.Errorf("expected unbalanced disk to add to cost, got %v <= %v", withDisk, noDisk)
+	}
+}
+
+func TestDiskViolation(t *testing.T) {
+	constraint := newIndexerConstraint(1024*1024*1024, 8, 1500, false, 2, -1, -1)
+	s := diskSolution(constraint, 1000, 0)
+
+	u := &IndexUsage{DefnId: 100, Name: "new", MemUsage: 100, DiskUsage: 1000}
+	if code := constraint.CanAddIndex(s, s.Placement[0], u); code != DiskViolation {
+		t.Errorf("expected disk violation, got %v", code)
+	}
+	if code := constraint.CanAddIndex(s, s.Placement[1], u); code == DiskViolation {
+		t.Errorf("unexpected disk violation")
+	}
+}
+
+func rebalanceTestIndex(defnId common.IndexDefnId, replicaId int, numReplica uint32) *IndexUsage {
+	instId := common.IndexInstId(uint64(defnId)*10) + common.IndexInstId(replicaId)
+	return &IndexUsage{
+		DefnId:         defnId,
+		InstId:         instId,
+		Name:           fmt.Sprintf("idx%v", defnId),
+		Bucket:         "default",
+		StorageMode:    common.MemoryOptimized,
+		ActualMemUsage: 100 * 1024 * 1024,
+		ActualCpuUsage: 1,
+		ActualDataSize: 100 * 1024 * 1024,
+		Instance: &common.IndexInst{
+			InstId: instId,
+			Defn: common.IndexDefn{DefnId: defnId, Name: fmt.Sprintf("idx%v", defnId),
+				Bucket: "default", SecExprs: []string{fmt.Sprintf("field%v", defnId)},
+				NumReplica: numReplica},
+			ReplicaId: replicaId,
+		},
+	}
+}
+
+func rebalanceTestPlan(placement map[string][]*IndexUsage) *Plan {
+	p := &Plan{MemQuota: 8 * 1024 * 1024 * 1024, CpuQuota: 16, IsLive: true}
+	for _, nodeId := range []string{"n1", "n2", "n3"} {
+		if indexes, ok := placement[nodeId]; ok {
+			p.Placement = append(p.Placement,
+				CreateIndexerNodeWithIndexes(nodeId, newGeneralSizingMethod(), indexes))
+		}
+	}
+	return p
+}
+
+// rebalanceTestNodes returns the node hosting each index of the result.
+func rebalanceTestNodes(t *testing.T, p *SAPlanner) map[*IndexUsage]string {
+	if p == nil || p.Result == nil {
+		t.Fatalf("expected rebalance result")
+	}
+	if !p.constraint.SatisfyClusterConstraint(p.Result, p.placement.GetEligibleIndexes()) {
+		t.Errorf("expected result to satisfy constraints, got %v",
+			p.constraint.GetViolations(p.Result, p.placement.GetEligibleIndexes()))
+	}
+	nodes := make(map[*IndexUsage]string)
+	for _, indexer := range p.Result.Placement {
+		for _, index := range indexer.Indexes {
+			nodes[index] = indexer.NodeId
+		}
+	}
+	return nodes
+}
+
+func TestRebalanceLeastMoveDeletedNode(t *testing.T) {
+	a0, a1 := rebalanceTestIndex(1, 0, 1), rebalanceTestIndex(1, 1, 1)
+	b, c, d := rebalanceTestIndex(2, 0, 0), rebalanceTestIndex(3, 0, 0), rebalanceTestIndex(4, 0, 0)
+	plan := rebalanceTestPlan(map[string][]*IndexUsage{
+		"n1": {a0, b},
+		"n2": {c},
+		"n3": {a1, d},
+	})
+
+	config := DefaultRunConfig()
+	config.MinimizeMove = true
+	config.Threshold = 10 // any layout is under threshold.
+	p, stats, err := rebalance(CommandRebalance, config, plan, nil, []string{"n3"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	nodes := rebalanceTestNodes(t, p)
+	for index, nodeId := range nodes {
+		if nodeId == "n3" {
+			t.Errorf("expected no index on deleted node, got %v", index.Name)
+		}
+	}
+	if nodes[a0] == nodes[a1] {
+		t.Errorf("expected replicas on different nodes, got %v", nodes[a0])
+	}
+	if nodes[a1] != "n2" {
+		t.Errorf("expected replica to move to n2, got %v", nodes[a1])
+	}
+	// only indexes of the deleted node move, they are not counted.
+	if nodes[b] != "n1" || nodes[c] != "n2" {
+		t.Errorf("expected indexes on remaining nodes not to move, got %v %v", nodes[b], nodes[c])
+	}
+	if stats.MovedIndex != 0 {
+		t.Errorf("expected no index moved off remaining nodes, got %v", stats.MovedIndex)
+	}
+}
+
+func TestRebalanceLeastMoveReplica(t *testing.T) {
+	a0, a1 := rebalanceTestIndex(1, 0, 1), rebalanceTestIndex(1, 1, 1)
+	b, c := rebalanceTestIndex(2, 0, 0), rebalanceTestIndex(3, 0, 0)
+	plan := rebalanceTestPlan(map[string][]*IndexUsage{
+		"n1": {a0, b, c},
+		"n2": {a1},
+	})
+
+	config := DefaultRunConfig()
+	config.MinimizeMove = true
+	config.Threshold = 0.05 // only 2 indexes on each node.
+	p, stats, err := rebalance(CommandRebalance, config, plan, nil, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// a0 cannot join its replica on n2, moving b or c balances the
+	// nodes with a single move.
+	nodes := rebalanceTestNodes(t, p)
+	if nodes[a0] == nodes[a1] {
+		t.Errorf("expected replicas on different nodes, got %v", nodes[a0])
+	}
+	count := make(map[string]int)
+	for _, nodeId := range nodes {
+		count[nodeId]++
+	}
+	if count["n1"] != 2 || count["n2"] != 2 {
+		t.Errorf("expected 2 indexes on each node, got %v", count)
+	}
+	if stats.MovedIndex != 1 {
+		t.Errorf("expected 1 index moved, got %v", stats.MovedIndex)
+	}
+}
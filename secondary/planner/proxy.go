@@ -435,7 +435,15 @@ func getIndexStats(clusterUrl string, plan *Plan) error {
 			actualCpuUtil = cpuUtil.(float64) / 100
 		}
 
+		// storage_disk_avail is the free space of the file system
+		// that has the indexer storage directory.
+		var actualDiskAvail uint64
+		if diskAvail, ok := statsMap["storage_disk_avail"]; ok {
+			actualDiskAvail = uint64(diskAvail.(float64))
+		}
+
 		var totalIndexMemUsed uint64
+		var totalIndexDiskUsed uint64
 		var totalMutation uint64
 		var totalScan uint64
 		for _, index := range indexer.Indexes {
@@ -489,6 +497,13 @@ func getIndexStats(clusterUrl string, plan *Plan) error {
 				totalIndexMemUsed += index.ActualMemUsage
 			}
 
+			// disk_size is the size of index files on disk (plasma and forestdb).
+			key = fmt.Sprintf("%v:%v:disk_size", index.Bucket, indexName)
+			if diskSize, ok := statsMap[key]; ok {
+				index.ActualDiskUsage = uint64(diskSize.(float64))
+				totalIndexDiskUsed += index.ActualDiskUsage
+			}
+
 			// avg_sec_key_size is currently unavailable in 4.5.   To estimate,
 			// the key size, it divides index data_size by items_count.  This
 			// contains sec key size + doc key size + main index overhead (74 bytes).
@@ -605,13 +620,21 @@ func getIndexStats(clusterUrl string, plan *Plan) error {
 				index.ActualMemUsage = index.ActualMemUsage * 100 / index.ActualBuildPercent
 				index.ActualMemOverhead = index.ActualMemOverhead * 100 / index.ActualBuildPercent
 				index.ActualDataSize = index.ActualDataSize * 100 / index.ActualBuildPercent
+				index.ActualDiskUsage = index.ActualDiskUsage * 100 / index.ActualBuildPercent
 			}
 
 			indexer.ActualDataSize += index.ActualDataSize
+			indexer.ActualDiskUsage += index.ActualDiskUsage
 			indexer.ActualMemUsage += index.ActualMemUsage
 			indexer.ActualMemOverhead += index.ActualMemOverhead
 		}
 
+		// Disk available to indexes on the node is the free space, plus
+		// the space already used by the indexes.
+		if actualDiskAvail != 0 {
+			indexer.DiskQuota = actualDiskAvail + totalIndexDiskUsed
+		}
+
 		// Compute the estimated cpu usage for each index.  This also computes the aggregated indexer cpu usage.
 		//
 		// The cpu usage is computed as follows (per node):
@@ -47,9 +47,14 @@ var gMaxCpuUse int
 var gMaxMemUse int
 var gMemQuota string
 var gCpuQuota int
+var gDiskQuota string
 var gDataCostWeight float64
 var gCpuCostWeight float64
 var gMemCostWeight float64
+var gMoveCostWeight float64
+var gDiskCostWeight float64
+var gMinimizeMove bool
+var gThreshold float64
 var gGenStmt string
 
 //////////////////////////////////////////////////////////////
@@ -79,6 +84,7 @@ func init() {
 	flag.IntVar(&gMaxMemUse, "maxMemUse", -1, "maximum memory utilization (as percentage) per indexer node")
 	flag.StringVar(&gMemQuota, "memQuota", "", "memory quota per indexer node")
 	flag.IntVar(&gCpuQuota, "cpuQuota", -1, "cpu quota per indexer node")
+	flag.StringVar(&gDiskQuota, "diskQuota", "", "disk quota per indexer node")
 
 	// cluster size
 	flag.BoolVar(&gResize, "resize", false, "allow new node to be dynamcially added to cluster while running the planner")
@@ -98,6 +104,10 @@ func init() {
 	flag.Float64Var(&gDataCostWeight, "dataCostWeight", 1, "Adjusted weight for data movement cost.")
 	flag.Float64Var(&gCpuCostWeight, "cpuCostWeight", 1, "Adjusted weight for cpu usage cost.")
 	flag.Float64Var(&gMemCostWeight, "memCostWeight", 1, "Adjusted weight for mem usage cost.")
+	flag.Float64Var(&gMoveCostWeight, "moveCostWeight", 0, "Adjusted weight for bytes and docs moved, regardless of usage cost.")
+	flag.Float64Var(&gDiskCostWeight, "diskCostWeight", 0, "Adjusted weight for disk usage and disk write rate cost.")
+	flag.BoolVar(&gMinimizeMove, "minimizeMove", false, "flag to tell if planner should stop with least movement once variation is under threshold.")
+	flag.Float64Var(&gThreshold, "variationThreshold", 0, "acceptance threshold on resource variation. Use with argument 'minimizeMove'.")
 }
 
 func TestSimulation(t *testing.T) {
@@ -176,9 +186,14 @@ func TestSimulation(t *testing.T) {
 		MaxCpuUse:      gMaxCpuUse,
 		MemQuota:       parseMemoryStr(t, gMemQuota),
 		CpuQuota:       gCpuQuota,
+		DiskQuota:      parseMemoryStr(t, gDiskQuota),
 		DataCostWeight: gDataCostWeight,
 		CpuCostWeight:  gCpuCostWeight,
 		MemCostWeight:  gMemCostWeight,
+		MoveCostWeight: gMoveCostWeight,
+		DiskCostWeight: gDiskCostWeight,
+		MinimizeMove:   gMinimizeMove,
+		Threshold:      gThreshold,
 		AllowUnpin:     gAllowUnpin,
 	}
 
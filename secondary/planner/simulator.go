@@ -47,7 +47,10 @@ import (
             "minMutationRate"   : 10000,
             "maxMutationRate"   : 300000,
             "minScanRate"       : 1000,
-            "maxScanRate"       : 50000
+            "maxScanRate"       : 50000,
+            "storageMode"       : "plasma",
+            "minResidentRatio"  : 20,
+            "maxResidentRatio"  : 100
         }],
         "distribution"   : [100]
     }],
@@ -98,6 +101,11 @@ type CollectionSpec struct {
 	MaxMutationRate int64  `json:"maxMutationRate,omitempty"`
 	MinScanRate     int64  `json:"minScanRate,omitempty"`
 	MaxScanRate     int64  `json:"maxScanRate,omitempty"`
+
+	// optional: default to memory optimized, with all data resident in memory
+	StorageMode      string `json:"storageMode,omitempty"`
+	MinResidentRatio int64  `json:"minResidentRatio,omitempty"`
+	MaxResidentRatio int64  `json:"maxResidentRatio,omitempty"`
 }
 
 //////////////////////////////////////////////////////////////
@@ -140,6 +148,12 @@ func (t *simulator) RunSimulation(count int, config *RunConfig, command CommandT
 	var dataMoved uint64
 	var indexMoved uint64
 	var indexCanBeMoved uint64
+	var docsMoved uint64
+	var variation float64
+	var indexerDisk float64
+	var indexerDiskDev float64
+	var indexerDiskWrite float64
+	var indexerDiskWriteDev float64
 	var initial_score float64
 	var initial_indexCount uint64
 	var initial_indexerCount uint64
@@ -202,6 +216,8 @@ func (t *simulator) RunSimulation(count int, config *RunConfig, command CommandT
 		dataMoved += t2
 		indexCanBeMoved += t3
 		indexMoved += t4
+		docsMoved += s.MovedDocs
+		variation += s.ResourceVariation
 
 		sa, sd := p.Result.ComputeMemUsage()
 		indexerSize += sa
@@ -211,6 +227,12 @@ func (t *simulator) RunSimulation(count int, config *RunConfig, command CommandT
 		indexerCpu += ca
 		indexerCpuDev += cd
 
+		da, dd, wa, wd := p.Result.ComputeDiskUsage()
+		indexerDisk += da
+		indexerDiskDev += dd
+		indexerDiskWrite += wa
+		indexerDiskWriteDev += wd
+
 		indexSize += s.AvgIndexSize
 		indexSizeDev += s.StdDevIndexSize
 		indexCpu += s.AvgIndexCpu
@@ -269,6 +291,10 @@ func (t *simulator) RunSimulation(count int, config *RunConfig, command CommandT
 	logging.Infof("\taverage index data moved : %v", formatMemoryStr(dataMoved/uint64(count)))
 	logging.Infof("\taverage no. index can be moved : %v", formatMemoryStr(indexCanBeMoved/uint64(count)))
 	logging.Infof("\taverage no. index moved : %v", formatMemoryStr(indexMoved/uint64(count)))
+	if command == CommandRebalance {
+		logging.Infof("\taverage no. docs moved : %v", docsMoved/uint64(count))
+		logging.Infof("\taverage resource variation : %.4f", variation/float64(count))
+	}
 	logging.Infof("\t--- quota ")
 	logging.Infof("\taverage memory quota: %v", formatMemoryStr(memoryQuota/uint64(count)))
 	logging.Infof("\taverage cpu quota: %v", cpuQuota/uint64(count))
@@ -282,6 +308,16 @@ func (t *simulator) RunSimulation(count int, config *RunConfig, command CommandT
 	logging.Infof("\taverage indexer cpu deviation (core) : %v", indexerCpuDev/float64(count))
 	logging.Infof("\taverage indexer cpu score : %v", indexerCpuDev/indexerCpu)
 	logging.Infof("\taverage indexer cpu utilization (core) : %v%s", uint64(indexerCpuUtil/float64(count)*100), "%")
+	if indexerDisk != 0 {
+		logging.Infof("\taverage indexer disk: %v", formatMemoryStr(uint64(indexerDisk/float64(count))))
+		logging.Infof("\taverage indexer disk deviation: %v", formatMemoryStr(uint64(indexerDiskDev/float64(count))))
+		logging.Infof("\taverage indexer disk score : %v", indexerDiskDev/indexerDisk)
+	}
+	if indexerDiskWrite != 0 {
+		logging.Infof("\taverage indexer disk write rate: %v/s", formatMemoryStr(uint64(indexerDiskWrite/float64(count))))
+		logging.Infof("\taverage indexer disk write rate deviation: %v/s", formatMemoryStr(uint64(indexerDiskWriteDev/float64(count))))
+		logging.Infof("\taverage indexer disk write rate score : %v", indexerDiskWriteDev/indexerDiskWrite)
+	}
 
 	if command == CommandPlan {
 		logging.Infof("\t--- placement : index stats")
@@ -465,7 +501,7 @@ func (t *simulator) indexUsage(s SizingMethod, bucket string, spec *CollectionSp
 		// TODO
 		//index.IsPrimary = t.isPrimary(spec)
 		index.IsPrimary = false
-		index.StorageMode = common.MemoryOptimized
+		index.StorageMode = t.storageMode(spec)
 		index.AvgSecKeySize = t.avgSecKeySize(spec)
 		index.AvgDocKeySize = t.avgDocKeySize(spec)
 		//TODO
@@ -474,7 +510,7 @@ func (t *simulator) indexUsage(s SizingMethod, bucket string, spec *CollectionSp
 		index.AvgArrKeySize = 0
 		index.AvgArrSize = 0
 		index.NumOfDocs = t.numOfDocs(spec)
-		index.ResidentRatio = 100
+		index.ResidentRatio = t.residentRatio(spec)
 		index.MutationRate = t.mutationRate(spec)
 		index.ScanRate = t.scanRate(spec)
 
@@ -532,6 +568,21 @@ func (t *simulator) scanRate(spec *CollectionSpec) uint64 {
 	return uint64(v + spec.MinScanRate)
 }
 
+func (t *simulator) storageMode(spec *CollectionSpec) string {
+	if len(spec.StorageMode) == 0 {
+		return common.MemoryOptimized
+	}
+	return spec.StorageMode
+}
+
+func (t *simulator) residentRatio(spec *CollectionSpec) float64 {
+	if spec.MaxResidentRatio == 0 {
+		return 100
+	}
+	v := t.rs.Int63n(spec.MaxResidentRatio + 1 - spec.MinResidentRatio)
+	return float64(v + spec.MinResidentRatio)
+}
+
 func (t *simulator) bucket(spec *WorkloadSpec) (*BucketSpec, error) {
 
 	b := t.rs.Int63n(100) + 1
@@ -0,0 +1,260 @@
+// Copyright (c) 2014 Couchbase, Inc.
+// Licensed under the Apache License, Version 2.0 (the "License"); you may not use this file
+// except in compliance with the License. You may obtain a copy of the License at
+//   http://www.apache.org/licenses/LICENSE-2.0
+// Unless required by applicable law or agreed to in writing, software distributed under the
+// License is distributed on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND,
+// either express or implied. See the License for the specific language governing permissions
+// and limitations under the License.
+
+package planner
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/couchbase/indexing/secondary/common"
+)
+
+//////////////////////////////////////////////////////////////
+// Concrete Type/Struct
+/////////////////////////////////////////////////////////////
+
+//
+// WhatIf describes hypothetical changes to be applied on top of an
+// index layout.  Nothing is executed on the cluster.
+//
+type WhatIf struct {
+	AddNodes    []string     `json:"addNodes,omitempty"`
+	RemoveNodes []string     `json:"removeNodes,omitempty"`
+	Indexes     []*IndexSpec `json:"indexes,omitempty"`
+	MemQuota    int64        `json:"memQuota,omitempty"`
+	CpuQuota    int          `json:"cpuQuota,omitempty"`
+	DiskQuota   int64        `json:"diskQuota,omitempty"`
+}
+
+type WhatIfResult struct {
+	Placement  []*WhatIfNode `json:"placement"`
+	Movements  []*WhatIfMove `json:"movements"`
+	Violations []*Violation  `json:"violations,omitempty"`
+	MemQuota   uint64        `json:"memQuota"`
+	CpuQuota   uint64        `json:"cpuQuota"`
+}
+
+type WhatIfNode struct {
+	NodeId      string   `json:"nodeId"`
+	ServerGroup string   `json:"serverGroup,omitempty"`
+	MemUsage    uint64   `json:"memUsage"`
+	CpuUsage    float64  `json:"cpuUsage"`
+	DataSize    uint64   `json:"dataSize"`
+	NumIndexes  int      `json:"numIndexes"`
+	IsNew       bool     `json:"isNew,omitempty"`
+	IsDeleted   bool     `json:"isDeleted,omitempty"`
+	Indexes     []string `json:"indexes,omitempty"`
+}
+
+type WhatIfMove struct {
+	Name      string             `json:"name"`
+	Bucket    string             `json:"bucket"`
+	DefnId    common.IndexDefnId `json:"defnId"`
+	InstId    common.IndexInstId `json:"instId"`
+	PartnId   common.PartitionId `json:"partnId"`
+	ReplicaId int                `json:"replicaId"`
+	From      string             `json:"from,omitempty"` // empty for new index
+	To        string             `json:"to"`
+}
+
+type whatIfKey struct {
+	defnId  common.IndexDefnId
+	instId  common.IndexInstId
+	partnId common.PartitionId
+}
+
+//////////////////////////////////////////////////////////////
+// What-If Analysis
+/////////////////////////////////////////////////////////////
+
+//
+// ExecuteWhatIf runs the planner against the given layout with the
+// hypothetical changes applied, and returns the proposed layout along
+// with the index movements and constraint violations.  New indexes are
+// placed first, then the cluster is rebalanced if nodes are added or
+// removed, or if quota has changed.  Plan is modified in place.
+//
+func ExecuteWhatIf(p *Plan, whatIf *WhatIf) (*WhatIfResult, error) {
+
+	if p == nil {
+		return nil, errors.New("missing argument: plan must be present")
+	}
+
+	if whatIf == nil {
+		whatIf = &WhatIf{}
+	}
+
+	config := DefaultRunConfig()
+	config.Resize = false
+	config.UseLive = true
+	if whatIf.MemQuota > 0 {
+		config.MemQuota = whatIf.MemQuota
+	}
+	if whatIf.CpuQuota > 0 {
+		config.CpuQuota = whatIf.CpuQuota
+	}
+	if whatIf.DiskQuota > 0 {
+		config.DiskQuota = whatIf.DiskQuota
+	}
+
+	// remember where each index is placed before planning
+	origins := make(map[whatIfKey]string)
+	for _, indexer := range p.Placement {
+		for _, index := range indexer.Indexes {
+			origins[whatIfKey{index.DefnId, index.InstId, index.PartnId}] = indexer.NodeId
+		}
+	}
+
+	for _, nodeId := range whatIf.AddNodes {
+		for _, indexer := range p.Placement {
+			if indexer.NodeId == nodeId {
+				return nil, errors.New(fmt.Sprintf("Node %v already exists in cluster", nodeId))
+			}
+		}
+		p.Placement = append(p.Placement, newIndexerNode(nodeId, newGeneralSizingMethod()))
+	}
+
+	if err := validateRemoveNodes(p, whatIf.RemoveNodes); err != nil {
+		return nil, err
+	}
+
+	var planner *SAPlanner
+	var err error
+
+	if len(whatIf.Indexes) != 0 {
+		var indexes []*IndexUsage
+		if indexes, err = indexUsagesFromSpec(newGeneralSizingMethod(), whatIf.Indexes); err != nil {
+			return nil, err
+		}
+
+		if planner, _, err = plan(config, p, indexes); err != nil {
+			return nil, err
+		}
+
+		p = &Plan{
+			Placement: planner.Result.Placement,
+			MemQuota:  planner.constraint.GetMemQuota(),
+			CpuQuota:  planner.constraint.GetCpuQuota(),
+			DiskQuota: p.DiskQuota,
+			IsLive:    p.IsLive,
+		}
+	}
+
+	rebalanceNeeded := len(whatIf.AddNodes) != 0 || len(whatIf.RemoveNodes) != 0 ||
+		(len(whatIf.Indexes) == 0 && (whatIf.MemQuota > 0 || whatIf.CpuQuota > 0 || whatIf.DiskQuota > 0))
+
+	if rebalanceNeeded {
+		if planner, _, err = rebalance(CommandRebalance, config, p, nil, whatIf.RemoveNodes); err != nil {
+			return nil, err
+		}
+	}
+
+	if planner == nil {
+		// no change given, show what a rebalance would do to the layout
+		if planner, _, err = rebalance(CommandRebalance, config, p, nil, nil); err != nil {
+			return nil, err
+		}
+	}
+
+	if planner.Result == nil {
+		return nil, errors.New("planner did not return a layout")
+	}
+
+	return whatIfResult(planner, origins), nil
+}
+
+//
+// validateRemoveNodes checks that nodes to be removed are in the layout,
+// and that at least one node is left to hold the indexes.
+//
+func validateRemoveNodes(p *Plan, removeNodes []string) error {
+
+	removed := make(map[string]bool)
+	for _, nodeId := range removeNodes {
+		if removed[nodeId] {
+			return errors.New(fmt.Sprintf("Node %v is removed more than once", nodeId))
+		}
+
+		found := false
+		for _, indexer := range p.Placement {
+			found = found || indexer.NodeId == nodeId
+		}
+		if !found {
+			return errors.New(fmt.Sprintf("Node %v does not exist in cluster", nodeId))
+		}
+		removed[nodeId] = true
+	}
+
+	if len(removed) != 0 && len(removed) == len(p.Placement) {
+		return errors.New("Cannot remove all nodes from cluster")
+	}
+
+	return nil
+}
+
+func whatIfResult(p *SAPlanner, origins map[whatIfKey]string) *WhatIfResult {
+
+	s := p.Result
+	useLive := s.UseLiveData()
+
+	result := &WhatIfResult{
+		Placement: make([]*WhatIfNode, 0, len(s.Placement)),
+		Movements: make([]*WhatIfMove, 0),
+		MemQuota:  p.constraint.GetMemQuota(),
+		CpuQuota:  p.constraint.GetCpuQuota(),
+	}
+
+	for _, indexer := range s.Placement {
+		node := &WhatIfNode{
+			NodeId:      indexer.NodeId,
+			ServerGroup: indexer.ServerGroup,
+			MemUsage:    indexer.GetMemTotal(useLive),
+			CpuUsage:    indexer.GetCpuUsage(useLive),
+			DataSize:    indexer.GetDataSize(useLive),
+			NumIndexes:  len(indexer.Indexes),
+			IsNew:       indexer.isNew,
+			IsDeleted:   indexer.isDelete,
+		}
+
+		for _, index := range indexer.Indexes {
+			node.Indexes = append(node.Indexes, index.GetDisplayName())
+
+			from := origins[whatIfKey{index.DefnId, index.InstId, index.PartnId}]
+			if from == indexer.NodeId {
+				continue
+			}
+
+			move := &WhatIfMove{
+				Name:    index.GetDisplayName(),
+				Bucket:  index.Bucket,
+				DefnId:  index.DefnId,
+				InstId:  index.InstId,
+				PartnId: index.PartnId,
+				From:    from,
+				To:      indexer.NodeId,
+			}
+			if index.Instance != nil {
+				move.ReplicaId = index.Instance.ReplicaId
+			}
+			result.Movements = append(result.Movements, move)
+		}
+
+		result.Placement = append(result.Placement, node)
+	}
+
+	eligibles := p.placement.GetEligibleIndexes()
+	if !p.constraint.SatisfyClusterConstraint(s, eligibles) {
+		if violations := p.constraint.GetViolations(s, eligibles); violations != nil {
+			result.Violations = violations.Violations
+		}
+	}
+
+	return result
+}
@@ -0,0 +1,101 @@
+// Copyright (c) 2014 Couchbase, Inc.
+// Licensed under the Apache License, Version 2.0 (the "License"); you may not use this file
+// except in compliance with the License. You may obtain a copy of the License at
+//   http://www.apache.org/licenses/LICENSE-2.0
+// Unless required by applicable law or agreed to in writing, software distributed under the
+// License is distributed on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND,
+// either express or implied. See the License for the specific language governing permissions
+// and limitations under the License.
+
+package planner
+
+import (
+	"testing"
+)
+
+func whatIfPlan(nodeIds ...string) *Plan {
+	p := &Plan{
+		MemQuota: 1024 * 1024 * 1024,
+		CpuQuota: 8,
+		IsLive:   true,
+	}
+	for _, nodeId := range nodeIds {
+		p.Placement = append(p.Placement, newIndexerNode(nodeId, newGeneralSizingMethod()))
+	}
+	return p
+}
+
+func whatIfIndex(name string, replica uint64, numDoc uint64) *IndexSpec {
+	return &IndexSpec{
+		Name:          name,
+		Bucket:        "default",
+		SecExprs:      []string{"age"},
+		Replica:       replica,
+		Using:         "memory_optimized",
+		ExprType:      "N1QL",
+		NumDoc:        numDoc,
+		DocKeySize:    20,
+		SecKeySize:    20,
+		ResidentRatio: 100,
+	}
+}
+
+func TestWhatIfRemoveNodes(t *testing.T) {
+	testcases := []struct {
+		name        string
+		removeNodes []string
+	}{
+		{"unknown node", []string{"n3"}},
+		{"duplicate node", []string{"n1", "n1"}},
+		{"all nodes", []string{"n1", "n2"}},
+	}
+
+	for _, tc := range testcases {
+		whatIf := &WhatIf{RemoveNodes: tc.removeNodes}
+		if result, err := ExecuteWhatIf(whatIfPlan("n1", "n2"), whatIf); err == nil {
+			t.Errorf("%v: expected error, got %v", tc.name, result)
+		}
+	}
+}
+
+func TestWhatIfPlanError(t *testing.T) {
+	// index does not fit the memory quota of the cluster.
+	whatIf := &WhatIf{
+		Indexes:  []*IndexSpec{whatIfIndex("idx", 0, 100000000)},
+		MemQuota: 1024,
+	}
+	if result, err := ExecuteWhatIf(whatIfPlan("n1"), whatIf); err == nil {
+		t.Errorf("expected error, got %v", result)
+	}
+}
+
+func TestWhatIfAddNode(t *testing.T) {
+	whatIf := &WhatIf{
+		AddNodes: []string{"n2"},
+		Indexes:  []*IndexSpec{whatIfIndex("idx", 1, 1000)},
+	}
+	result, err := ExecuteWhatIf(whatIfPlan("n1"), whatIf)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(result.Placement) != 2 {
+		t.Fatalf("expected 2 nodes, got %v", len(result.Placement))
+	}
+	numIndexes := 0
+	for _, node := range result.Placement {
+		numIndexes += node.NumIndexes
+	}
+	if numIndexes != 2 {
+		t.Errorf("expected index and its replica to be placed, got %v", numIndexes)
+	}
+	// new indexes are not moved from any node.
+	for _, move := range result.Movements {
+		if move.From != "" {
+			t.Errorf("unexpected move of %v from %v", move.Name, move.From)
+		}
+	}
+	if len(result.Movements) != numIndexes {
+		t.Errorf("expected %v movements, got %v", numIndexes, len(result.Movements))
+	}
+}
@@ -2,6 +2,7 @@
 
 package projector
 
+import "sync"
 import "time"
 
 import mc "github.com/couchbase/indexing/secondary/dcp/transport/client"
@@ -10,11 +11,10 @@ import protobuf "github.com/couchbase/indexing/secondary/protobuf/projector"
 import "github.com/couchbase/indexing/secondary/dcp"
 
 // BucketAccess interface manage a subset of vbucket streams with mutiple KV
-// nodes. To be implemented by couchbase.Bucket type.
+// nodes. Buckets registered with SetBucketAccess are fed from it instead
+// of connecting with KV, like FakeBucket for tests and standalone
+// deployments without KV.
 type BucketAccess interface {
-	// Refresh bucket meta information like vbmap
-	Refresh() error
-
 	// GetVBmap returns a map of `kvaddr` to list of vbuckets hosted in a kv
 	// node.
 	GetVBmap(kvaddrs []string) (map[string][]uint16, error)
@@ -25,8 +25,30 @@ type BucketAccess interface {
 		vbuckets []uint16,
 		config map[string]interface{}) (couchbase.FailoverLog, error)
 
-	// Close this bucket.
-	Close()
+	// OpenKVFeed opens a feed of vbucket streams hosted by `kvaddr`.
+	OpenKVFeed(kvaddr string) (BucketFeeder, error)
+}
+
+var bucketAccessLock sync.RWMutex
+var bucketAccessMap = make(map[string]BucketAccess)
+
+// SetBucketAccess feeds mutations of bucket from access, instead of
+// connecting with KV. Nil access removes the bucket. Shall be called
+// before the bucket is added to a feed.
+func SetBucketAccess(bucketn string, access BucketAccess) {
+	bucketAccessLock.Lock()
+	defer bucketAccessLock.Unlock()
+	if access == nil {
+		delete(bucketAccessMap, bucketn)
+		return
+	}
+	bucketAccessMap[bucketn] = access
+}
+
+func getBucketAccess(bucketn string) BucketAccess {
+	bucketAccessLock.RLock()
+	defer bucketAccessLock.RUnlock()
+	return bucketAccessMap[bucketn]
 }
 
 // BucketFeeder interface from a BucketAccess object.
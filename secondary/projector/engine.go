@@ -5,6 +5,7 @@ package projector
 
 import mc "github.com/couchbase/indexing/secondary/dcp/transport/client"
 import c "github.com/couchbase/indexing/secondary/common"
+import "github.com/couchbase/indexing/secondary/logging"
 
 // IMPORTANT: concurrent access to be expected for Engine object.
 
@@ -15,14 +16,21 @@ type Engine struct {
 	uuid      uint64
 	evaluator c.Evaluator // do document projection
 	router    c.Router    // route projected values to zero or more end-points
+	log       *logging.Entry
 }
 
+// projLogger tags projector log lines with component, bucket and
+// instance id, to correlate them with indexer and client logs.
+var projLogger = logging.Component("projector")
+
 // NewEngine creates a new engine instance for `uuid`.
 func NewEngine(uuid uint64, evaluator c.Evaluator, router c.Router) *Engine {
 	engine := &Engine{
 		uuid:      uuid,
 		evaluator: evaluator,
 		router:    router,
+		log: projLogger.With(logging.FieldBucket, evaluator.Bucket()).
+			With(logging.FieldInstId, uuid),
 	}
 	return engine
 }
@@ -60,6 +68,12 @@ func (engine *Engine) StreamEndData(
 	return engine.evaluator.StreamEndData(vbno, vbuuid, seqno)
 }
 
+// MatchDocid returns false if mutations on docid are to be skipped
+// by this engine.
+func (engine *Engine) MatchDocid(docid []byte) bool {
+	return engine.evaluator.MatchDocid(docid)
+}
+
 // TransformRoute data to endpoints.
 func (engine *Engine) TransformRoute(
 	vbuuid uint64, m *mc.DcpEvent, data map[string]interface{},
@@ -67,3 +81,9 @@ func (engine *Engine) TransformRoute(
 
 	return engine.evaluator.TransformRoute(vbuuid, m, data, encodeBuf)
 }
+
+// Errors returns the number of documents this engine failed to
+// evaluate.
+func (engine *Engine) Errors() uint64 {
+	return engine.evaluator.Errors()
+}
@@ -1,23 +1,31 @@
 package projector
 
+import "fmt"
+import "sync"
+
+import mcd "github.com/couchbase/indexing/secondary/dcp/transport"
 import mc "github.com/couchbase/indexing/secondary/dcp/transport/client"
 import protobuf "github.com/couchbase/indexing/secondary/protobuf/projector"
 import "github.com/couchbase/indexing/secondary/dcp"
 
-// FakeBucket fot unit testing.
+// FakeBucket fot unit testing. Documents set on the bucket are kept in
+// memory, per vbucket, and streamed to vbuckets started on its feeder,
+// starting from the requested seqno.
 type FakeBucket struct {
+	mu      sync.Mutex
 	bucket  string
 	vbmap   map[string][]uint16
 	flogs   couchbase.FailoverLog
 	C       chan *mc.DcpEvent
 	streams map[uint16]*FakeStream
+	history map[uint16][]*mc.DcpEvent // vbno -> mutations and deletions
 }
 
 // FakeStream fot unit testing.
 type FakeStream struct {
+	opaque uint16
 	seqno  uint64
 	vbuuid uint64
-	killch chan bool
 }
 
 // NewFakeBuckets returns a reference to new FakeBucket.
@@ -30,6 +38,7 @@ func NewFakeBuckets(buckets []string) map[string]*FakeBucket {
 			flogs:   make(couchbase.FailoverLog),
 			C:       make(chan *mc.DcpEvent, 10000),
 			streams: make(map[uint16]*FakeStream),
+			history: make(map[uint16][]*mc.DcpEvent),
 		}
 	}
 	return fakebuckets
@@ -39,6 +48,8 @@ func NewFakeBuckets(buckets []string) map[string]*FakeBucket {
 
 // GetVBmap is method receiver for BucketAccess interface
 func (b *FakeBucket) GetVBmap(kvaddrs []string) (map[string][]uint16, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
 	m := make(map[string][]uint16)
 	for kvaddr, vbnos := range b.vbmap {
 		m[kvaddr] = vbnos
@@ -52,7 +63,13 @@ func (b *FakeBucket) GetFailoverLogs(
 	vbnos []uint16,
 	conf map[string]interface{}) (couchbase.FailoverLog, error) {
 
-	return b.flogs, nil
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	flogs := make(couchbase.FailoverLog)
+	for vbno, flog := range b.flogs {
+		flogs[vbno] = flog
+	}
+	return flogs, nil
 }
 
 // OpenKVFeed is method receiver for BucketAccess interface
@@ -67,14 +84,81 @@ func (b *FakeBucket) Close(kvaddr string) {
 
 // SetVbmap fake initialization method.
 func (b *FakeBucket) SetVbmap(kvaddr string, vbnos []uint16) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
 	b.vbmap[kvaddr] = vbnos
 }
 
 // SetFailoverLog fake initialization method.
 func (b *FakeBucket) SetFailoverLog(vbno uint16, flog [][2]uint64) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
 	b.flogs[vbno] = flog
 }
 
+// Set document `key` in vbucket, returns seqno of the mutation.
+func (b *FakeBucket) Set(vbno uint16, key, value []byte) uint64 {
+	m := &mc.DcpEvent{
+		Opcode:  mcd.DCP_MUTATION,
+		VBucket: vbno,
+		Key:     key,
+		Value:   value,
+	}
+	m.TreatAsJSON()
+	return b.apply(m)
+}
+
+// Delete document `key` from vbucket, returns seqno of the deletion.
+func (b *FakeBucket) Delete(vbno uint16, key []byte) uint64 {
+	m := &mc.DcpEvent{
+		Opcode:  mcd.DCP_DELETION,
+		VBucket: vbno,
+		Key:     key,
+	}
+	return b.apply(m)
+}
+
+// HighSeqnos returns seqno of the last mutation on each vbucket.
+func (b *FakeBucket) HighSeqnos() map[uint16]uint64 {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	seqnos := make(map[uint16]uint64)
+	for vbno, events := range b.history {
+		if len(events) > 0 {
+			seqnos[vbno] = events[len(events)-1].Seqno
+		}
+	}
+	return seqnos
+}
+
+func (b *FakeBucket) apply(m *mc.DcpEvent) uint64 {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	m.Seqno = uint64(len(b.history[m.VBucket]) + 1)
+	b.history[m.VBucket] = append(b.history[m.VBucket], m)
+	if stream, ok := b.streams[m.VBucket]; ok {
+		b.send(stream, m)
+	}
+	return m.Seqno
+}
+
+// send mutation on stream as a single item snapshot.
+func (b *FakeBucket) send(stream *FakeStream, m *mc.DcpEvent) {
+	b.C <- &mc.DcpEvent{
+		Opcode:       mcd.DCP_SNAPSHOT,
+		VBucket:      m.VBucket,
+		Opaque:       stream.opaque,
+		SnapstartSeq: m.Seqno,
+		SnapendSeq:   m.Seqno,
+		SnapshotType: 0x1, // memory
+	}
+	event := *m
+	event.Opaque = stream.opaque
+	event.VBuuid = stream.vbuuid
+	b.C <- &event
+	stream.seqno = m.Seqno
+}
+
 // BucketFeeder interface
 
 // GetChannel is method receiver for BucketFeeder interface
@@ -82,25 +166,65 @@ func (b *FakeBucket) GetChannel() <-chan *mc.DcpEvent {
 	return b.C
 }
 
-// StartVbStreams is method receiver for BucketFeeder interface
+// StartVbStreams is method receiver for BucketFeeder interface,
+// mutations after the requested seqno are streamed right away.
 func (b *FakeBucket) StartVbStreams(
 	opaque uint16, ts *protobuf.TsVbuuid) (err error) {
 
-	return err
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	seqnos := ts.GetSeqnos()
+	for i, vbno32 := range ts.GetVbnos() {
+		vbno := uint16(vbno32)
+		flog, ok := b.flogs[vbno]
+		if !ok || len(flog) == 0 {
+			return fmt.Errorf("FakeBucket %v: no failover log for vbucket %v", b.bucket, vbno)
+		}
+		vbuuid, _, _ := flog.Latest()
+		b.C <- &mc.DcpEvent{
+			Opcode:      mcd.DCP_STREAMREQ,
+			Status:      mcd.SUCCESS,
+			VBucket:     vbno,
+			Opaque:      opaque,
+			FailoverLog: &flog,
+		}
+		stream := &FakeStream{opaque: opaque, seqno: seqnos[i], vbuuid: vbuuid}
+		b.streams[vbno] = stream
+		for _, m := range b.history[vbno] {
+			if m.Seqno > stream.seqno {
+				b.send(stream, m)
+			}
+		}
+	}
+	return nil
 }
 
 // EndVbStreams is method receiver for BucketFeeder interface
 func (b *FakeBucket) EndVbStreams(
 	opaque uint16, ts *protobuf.TsVbuuid) (err error) {
 
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	for _, vbno32 := range ts.GetVbnos() {
+		vbno := uint16(vbno32)
+		if stream, ok := b.streams[vbno]; ok {
+			b.C <- &mc.DcpEvent{
+				Opcode:  mcd.DCP_STREAMEND,
+				Status:  mcd.SUCCESS,
+				VBucket: vbno,
+				Opaque:  stream.opaque,
+			}
+			delete(b.streams, vbno)
+		}
+	}
 	return
 }
 
-// CloseFeed is method receiver for BucketFeeder interface
+// CloseFeed is method receiver for BucketFeeder interface, channel
+// is left open for feeders opened later.
 func (b *FakeBucket) CloseFeed() (err error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.streams = make(map[uint16]*FakeStream)
 	return
 }
-
-func (s *FakeStream) run(mutch chan *mc.DcpEvent) {
-	// TODO: generate mutation events
-}
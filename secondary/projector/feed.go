@@ -2,6 +2,7 @@ package projector
 
 import "fmt"
 import "time"
+import "sync/atomic"
 
 import "github.com/couchbase/indexing/secondary/logging"
 import "github.com/couchbase/indexing/secondary/dcp"
@@ -58,6 +59,8 @@ type Feed struct {
 	kvdata    map[string]*KVData            // bucket -> kvdata
 	engines   map[string]map[uint64]*Engine // bucket -> uuid -> engine
 	endpoints map[string]c.RouterEndpoint
+	// snapshot of endpoints, []c.RouterEndpoint, for backpressure()
+	epSnapshot atomic.Value
 	// genServer channel
 	reqch  chan []interface{}
 	backch chan []interface{}
@@ -659,6 +662,7 @@ func (feed *Feed) handleCommand(msg []interface{}) (status string) {
 		endpoint, ok := feed.endpoints[raddr]
 		if ok && !endpoint.Ping() { // delete endpoint only if not alive.
 			delete(feed.endpoints, raddr)
+			feed.publishEndpoints()
 			logging.Infof("%v endpoint %v deleted\n", feed.logPrefix, raddr)
 		}
 		// If there are no more endpoints, shutdown the feed.
@@ -1122,8 +1126,7 @@ func (feed *Feed) repairEndpoints(
 
 		} else if (endpoint == nil) || !endpoint.Ping() {
 			topic, typ := feed.topic, feed.endpointType
-			config := feed.config.SectionConfig("dataport.", true /*trim*/)
-			endpoint, e = feed.epFactory(topic, typ, raddr, config)
+			endpoint, e = feed.epFactory(topic, typ, raddr, feed.endpointConfig())
 			if e != nil {
 				fmsg := "%v ##%x endpoint-factory %q: %v\n"
 				logging.Errorf(fmsg, prefix, opaque, raddr1, e)
@@ -1142,6 +1145,7 @@ func (feed *Feed) repairEndpoints(
 		// endpoints table.
 		feed.endpoints[raddr] = endpoint  // :SideEffect:
 		feed.endpoints[raddr1] = endpoint // :SideEffect:
+		feed.publishEndpoints()
 	}
 
 	// posted to each kv data-path
@@ -1167,10 +1171,46 @@ func (feed *Feed) staleCheck() string {
 	return "stale"
 }
 
+// configuration for new endpoints, flow control is negotiated only
+// with indexers that support it.
+func (feed *Feed) endpointConfig() c.Config {
+	config := feed.config.SectionConfig("dataport.", true /*trim*/)
+	if feed.version < protobuf.FeedVersion_alice {
+		config.SetValue("flowControl", false)
+	}
+	return config
+}
+
+// publish a snapshot of feed.endpoints for backpressure(), to be called
+// whenever feed.endpoints is updated.
+func (feed *Feed) publishEndpoints() {
+	endpoints := make([]c.RouterEndpoint, 0, len(feed.endpoints))
+	for _, endpoint := range feed.endpoints {
+		endpoints = append(endpoints, endpoint)
+	}
+	feed.epSnapshot.Store(endpoints)
+}
+
+// backpressure return whether all of the endpoints are waiting for
+// credits from downstream, in which case DCP buffer-acks are held back
+// to slow down KV. A slow indexer alone shall not stall other indexers
+// on this feed, its endpoint buffers till it gives up on the backlog.
+// Called concurrently by DCP feeds.
+func (feed *Feed) backpressure() bool {
+	endpoints, _ := feed.epSnapshot.Load().([]c.RouterEndpoint)
+	for _, endpoint := range endpoints {
+		if !endpoint.Blocked() {
+			return false
+		}
+	}
+	return len(endpoints) > 0
+}
+
 func (feed *Feed) getStatistics() c.Statistics {
 	stats, _ := c.NewStatistics(nil)
 	stats.Set("topic", feed.topic)
 	stats.Set("engines", feed.engineNames())
+	stats.Set("engineErrors", feed.engineErrors())
 	for bucketn, kvdata := range feed.kvdata {
 		stats.Set("bucket-"+bucketn, kvdata.GetStatistics())
 	}
@@ -1260,6 +1300,18 @@ func (feed *Feed) openFeeder(
 	if ok {
 		return feeder, nil
 	}
+	if access := getBucketAccess(bucketn); access != nil {
+		kvaddr, err := feed.getLocalKVAddrs(pooln, bucketn, opaque)
+		if err != nil {
+			return nil, err
+		}
+		if feeder, err = access.OpenKVFeed(kvaddr); err != nil {
+			fmsg := "%v ##%x OpenKVFeed(%q): %v"
+			logging.Errorf(fmsg, feed.logPrefix, opaque, bucketn, err)
+			return nil, projC.ErrorFeeder
+		}
+		return feeder, nil
+	}
 	bucket, err := feed.connectBucket(feed.cluster, pooln, bucketn, opaque)
 	if err != nil {
 		return nil, projC.ErrorFeeder
@@ -1278,6 +1330,7 @@ func (feed *Feed) openFeeder(
 		"numConnections": feed.config["dcp.numConnections"].Int(),
 		"latencyTick":    feed.config["dcp.latencyTick"].Int(),
 		"activeVbOnly":   feed.config["dcp.activeVbOnly"].Bool(),
+		"bufferAckHold":  feed.backpressure,
 	}
 	kvaddr, err := feed.getLocalKVAddrs(pooln, bucketn, opaque)
 	if err != nil {
@@ -1333,19 +1386,24 @@ func (feed *Feed) bucketFeed(
 func (feed *Feed) bucketDetails(
 	pooln, bucketn string, opaque uint16, vbnos []uint16) ([]uint64, error) {
 
-	bucket, err := feed.connectBucket(feed.cluster, pooln, bucketn, opaque)
-	if err != nil {
-		return nil, err
-	}
-	defer bucket.Close()
-
 	// failover-logs
 	dcpConfig := map[string]interface{}{
 		"genChanSize":    feed.config["dcp.genChanSize"].Int(),
 		"dataChanSize":   feed.config["dcp.dataChanSize"].Int(),
 		"numConnections": feed.config["dcp.numConnections"].Int(),
 	}
-	flogs, err := bucket.GetFailoverLogs(opaque, vbnos, dcpConfig)
+	var flogs couchbase.FailoverLog
+	var err error
+	if access := getBucketAccess(bucketn); access != nil {
+		flogs, err = access.GetFailoverLogs(opaque, vbnos, dcpConfig)
+	} else {
+		bucket, e := feed.connectBucket(feed.cluster, pooln, bucketn, opaque)
+		if e != nil {
+			return nil, e
+		}
+		defer bucket.Close()
+		flogs, err = bucket.GetFailoverLogs(opaque, vbnos, dcpConfig)
+	}
 	if err != nil {
 		fmsg := "%v ##%x GetFailoverLogs(%q): %v"
 		logging.Errorf(fmsg, feed.logPrefix, opaque, bucketn, err)
@@ -1375,9 +1433,9 @@ func (feed *Feed) getLocalKVAddrs(
 	pooln, bucketn string, opaque uint16) (string, error) {
 
 	prefix := feed.logPrefix
-	url, err := c.ClusterAuthUrl(feed.config["clusterAddr"].String())
+	url, err := c.ClusterInfoUrl(feed.config["clusterAddr"].String())
 	if err != nil {
-		fmsg := "%v ##%x ClusterAuthUrl(): %v\n"
+		fmsg := "%v ##%x ClusterInfoUrl(): %v\n"
 		logging.Errorf(fmsg, prefix, opaque, err)
 		return "", projC.ErrorClusterInfo
 	}
@@ -1407,7 +1465,7 @@ func (feed *Feed) getLocalVbuckets(
 	prefix := feed.logPrefix
 	// gather vbnos based on colocation policy.
 	var cinfo *c.ClusterInfoCache
-	url, err := c.ClusterAuthUrl(feed.config["clusterAddr"].String())
+	url, err := c.ClusterInfoUrl(feed.config["clusterAddr"].String())
 	if err == nil {
 		cinfo, err = c.NewClusterInfoCache(url, pooln)
 	}
@@ -1472,6 +1530,7 @@ func (feed *Feed) processSubscribers(opaque uint16, req Subscriber) error {
 			m = make(map[uint64]*Engine)
 		}
 		engine := NewEngine(uuid, evaluator, routers[uuid])
+		engine.log.Infof("%v ##%x engine started\n", feed.logPrefix, opaque)
 		m[uuid] = engine
 		feed.engines[bucketn] = m // :SideEffect:
 	}
@@ -1494,7 +1553,7 @@ func (feed *Feed) startEndpoints(
 
 			} else if endpoint == nil || !endpoint.Ping() {
 				topic, typ := feed.topic, feed.endpointType
-				config := feed.config.SectionConfig("dataport.", true /*trim*/)
+				config := feed.endpointConfig()
 				endpoint, e = feed.epFactory(topic, typ, raddr, config)
 				if e != nil {
 					fmsg := "%v ##%x endpoint-factory %q: %v\n"
@@ -1514,6 +1573,7 @@ func (feed *Feed) startEndpoints(
 			// endpoints table.
 			feed.endpoints[raddr] = endpoint  // :SideEffect:
 			feed.endpoints[raddr1] = endpoint // :SideEffect:
+			feed.publishEndpoints()
 		}
 	}
 	//return nil
@@ -1583,6 +1643,16 @@ func (feed *Feed) engineNames() []string {
 	return names
 }
 
+func (feed *Feed) engineErrors() map[string]interface{} {
+	errors := make(map[string]interface{})
+	for _, engines := range feed.engines {
+		for uuid, engine := range engines {
+			errors[fmt.Sprintf("%v", uuid)] = float64(engine.Errors())
+		}
+	}
+	return errors
+}
+
 func (feed *Feed) endpointRaddrs() []string {
 	raddrs := make([]string, 0, len(feed.endpoints))
 	for raddr := range feed.endpoints {
@@ -1821,6 +1891,7 @@ func FeedConfigParams() []string {
 		"dataport.bufferTimeout",
 		"dataport.harakiriTimeout",
 		"dataport.statTick",
-		"dataport.maxPayload"}
+		"dataport.maxPayload",
+		"dataport.flowControl"}
 	return paramNames
 }
@@ -0,0 +1,42 @@
+package projector
+
+import "testing"
+
+import c "github.com/couchbase/indexing/secondary/common"
+
+type blockedEndpoint bool
+
+func (e blockedEndpoint) Ping() bool                            { return true }
+func (e blockedEndpoint) ResetConfig(config c.Config) error     { return nil }
+func (e blockedEndpoint) Send(data interface{}) error           { return nil }
+func (e blockedEndpoint) Blocked() bool                         { return bool(e) }
+func (e blockedEndpoint) GetStatistics() map[string]interface{} { return nil }
+func (e blockedEndpoint) Close() error                          { return nil }
+func (e blockedEndpoint) WaitForExit() error                    { return nil }
+
+func TestBackpressure(t *testing.T) {
+	testcases := []struct {
+		blocked []bool
+		hold    bool
+	}{
+		{nil, false},
+		{[]bool{false}, false},
+		{[]bool{true}, true},
+		// a slow indexer shall not hold back the others.
+		{[]bool{true, false}, false},
+		{[]bool{true, true}, true},
+	}
+
+	for _, tc := range testcases {
+		feed := &Feed{endpoints: make(map[string]c.RouterEndpoint)}
+		for i, blocked := range tc.blocked {
+			raddr := string(rune('a' + i))
+			feed.endpoints[raddr] = blockedEndpoint(blocked)
+		}
+		feed.publishEndpoints()
+		if hold := feed.backpressure(); hold != tc.hold {
+			t.Errorf("endpoints %v expected backpressure %v, got %v",
+				tc.blocked, tc.hold, hold)
+		}
+	}
+}
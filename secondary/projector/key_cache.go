@@ -0,0 +1,128 @@
+package projector
+
+import "container/list"
+import "encoding/binary"
+import "hash/fnv"
+
+import c "github.com/couchbase/indexing/secondary/common"
+
+// keyCache remembers a hash of the secondary key last published for a
+// document and index instance, so that an upsert whose key did not
+// change can be published as UpsertNoop. Least recently used entries
+// are evicted beyond `size`. Owned by a single vbucket, not thread
+// safe.
+type keyCache struct {
+	size    int
+	entries map[keyCacheKey]*list.Element
+	lru     *list.List // of *keyCacheEntry, most recent in front
+}
+
+type keyCacheKey struct {
+	uuid  uint64 // index instance
+	docid string
+}
+
+type keyCacheEntry struct {
+	key  keyCacheKey
+	hash uint64
+}
+
+func newKeyCache(size int) *keyCache {
+	return &keyCache{
+		size:    size,
+		entries: make(map[keyCacheKey]*list.Element),
+		lru:     list.New(),
+	}
+}
+
+// apply marks upserts in `data`, published for mutation on `docid`,
+// as no-op if their key and partition key is same as the one last
+// published, and remembers the new ones. Returns the number of upserts
+// marked as no-op.
+func (kc *keyCache) apply(docid []byte, data map[string]interface{}) int {
+	var noops map[uint64]bool // instance -> unchanged, decided only once
+	count := 0
+	for _, d := range data {
+		dkv, ok := d.(*c.DataportKeyVersions)
+		if !ok || dkv.Kv == nil {
+			continue
+		}
+		kv := dkv.Kv
+		for i, cmd := range kv.Commands {
+			uuid := kv.Uuids[i]
+			switch cmd {
+			case c.Upsert:
+				if noops == nil {
+					noops = make(map[uint64]bool)
+				}
+				noop, ok := noops[uuid]
+				if !ok {
+					hash := keyHash(kv.Keys[i], kv.Partnkeys[i])
+					noop = kc.update(uuid, docid, hash)
+					noops[uuid] = noop
+				}
+				if noop {
+					kv.SetUpsertNoop(i)
+					count++
+				}
+
+			case c.Deletion, c.UpsertDeletion:
+				kc.delete(uuid, docid)
+			}
+		}
+	}
+	return count
+}
+
+// update the hash for document and instance, returns true if it is
+// unchanged.
+func (kc *keyCache) update(uuid uint64, docid []byte, hash uint64) bool {
+	key := keyCacheKey{uuid: uuid, docid: string(docid)}
+	if elem, ok := kc.entries[key]; ok {
+		entry := elem.Value.(*keyCacheEntry)
+		kc.lru.MoveToFront(elem)
+		if entry.hash == hash {
+			return true
+		}
+		entry.hash = hash
+		return false
+	}
+	kc.entries[key] = kc.lru.PushFront(&keyCacheEntry{key: key, hash: hash})
+	for kc.lru.Len() > kc.size {
+		elem := kc.lru.Back()
+		delete(kc.entries, elem.Value.(*keyCacheEntry).key)
+		kc.lru.Remove(elem)
+	}
+	return false
+}
+
+func (kc *keyCache) delete(uuid uint64, docid []byte) {
+	key := keyCacheKey{uuid: uuid, docid: string(docid)}
+	if elem, ok := kc.entries[key]; ok {
+		delete(kc.entries, key)
+		kc.lru.Remove(elem)
+	}
+}
+
+// reset forgets all the keys, when set of instances change.
+func (kc *keyCache) reset() {
+	kc.entries = make(map[keyCacheKey]*list.Element)
+	kc.lru.Init()
+}
+
+func (kc *keyCache) length() int {
+	return kc.lru.Len()
+}
+
+// keyHash of secondary key and partition key, lengths are hashed to
+// keep the two apart.
+func keyHash(key, pkey []byte) uint64 {
+	var lens [8]byte
+	binary.BigEndian.PutUint32(lens[:4], uint32(len(key)))
+	binary.BigEndian.PutUint32(lens[4:], uint32(len(pkey)))
+	h := fnv.New64a()
+	h.Write(lens[:])
+	h.Write(key)
+	h.Write(pkey)
+	return h.Sum64()
+}
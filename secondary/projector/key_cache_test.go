@@ -0,0 +1,58 @@
+package projector
+
+import "testing"
+
+import c "github.com/couchbase/indexing/secondary/common"
+
+func keyCacheData(docid string, cmds []byte, keys []string) map[string]interface{} {
+	kv := c.NewKeyVersions(1, []byte(docid), 4, 0)
+	for i, cmd := range cmds {
+		switch cmd {
+		case c.Upsert:
+			kv.AddUpsert(uint64(i+1), []byte(keys[i]), nil, nil)
+		case c.UpsertDeletion:
+			kv.AddUpsertDeletion(uint64(i+1), nil, nil)
+		}
+	}
+	dkv := &c.DataportKeyVersions{"default", 0, 1234, kv}
+	return map[string]interface{}{partialEndpoint: dkv}
+}
+
+func TestKeyCache(t *testing.T) {
+	kc := newKeyCache(2)
+	upserts := []byte{c.Upsert, c.Upsert}
+
+	if n := kc.apply([]byte("doc1"), keyCacheData("doc1", upserts, []string{"a", "b"})); n != 0 {
+		t.Fatalf("expected no noops for first upsert, got %v", n)
+	}
+	// second instance changed its key.
+	data := keyCacheData("doc1", upserts, []string{"a", "c"})
+	if n := kc.apply([]byte("doc1"), data); n != 1 {
+		t.Fatalf("expected 1 noop, got %v", n)
+	}
+	kv := data[partialEndpoint].(*c.DataportKeyVersions).Kv
+	if kv.Commands[0] != c.UpsertNoop || kv.Keys[0] != nil || kv.Commands[1] != c.Upsert {
+		t.Fatalf("unexpected %v", kv)
+	}
+
+	// document left the first instance.
+	cmds := []byte{c.UpsertDeletion, c.Upsert}
+	kc.apply([]byte("doc1"), keyCacheData("doc1", cmds, []string{"", "c"}))
+	if n := kc.apply([]byte("doc1"), keyCacheData("doc1", upserts, []string{"a", "c"})); n != 1 {
+		t.Fatalf("expected 1 noop, got %v", n)
+	}
+
+	// least recently used entries are evicted.
+	kc.apply([]byte("doc2"), keyCacheData("doc2", upserts, []string{"a", "b"}))
+	if kc.length() != 2 {
+		t.Fatalf("expected 2 entries, got %v", kc.length())
+	}
+	if n := kc.apply([]byte("doc1"), keyCacheData("doc1", upserts, []string{"a", "c"})); n != 0 {
+		t.Fatalf("expected evicted entries, got %v noops", n)
+	}
+
+	kc.reset()
+	if kc.length() != 0 {
+		t.Fatalf("expected empty cache, got %v", kc.length())
+	}
+}
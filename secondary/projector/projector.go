@@ -98,6 +98,23 @@ func NewProjector(maxvbs int, config c.Config) *Projector {
 	return p
 }
 
+func (p *Projector) resetJSLimits(config c.Config) {
+	limits := protobuf.GetJSLimits()
+	if cv, ok := config["projector.javascript.timeout"]; ok {
+		limits.Timeout = time.Duration(cv.Int()) * time.Millisecond
+	}
+	if cv, ok := config["projector.javascript.maxStackDepth"]; ok {
+		limits.MaxStackDepth = cv.Int()
+	}
+	if cv, ok := config["projector.javascript.maxDocSize"]; ok {
+		limits.MaxDocSize = cv.Int()
+	}
+	if cv, ok := config["projector.javascript.maxKeySize"]; ok {
+		limits.MaxKeySize = cv.Int()
+	}
+	protobuf.SetJSLimits(limits)
+}
+
 // GetConfig returns the config object from projector.
 func (p *Projector) GetConfig() c.Config {
 	p.rw.Lock()
@@ -115,6 +132,14 @@ func (p *Projector) ResetConfig(config c.Config) {
 	if cv, ok := config["projector.settings.log_level"]; ok {
 		logging.SetLogLevel(logging.Level(cv.String()))
 	}
+	if cv, ok := config["projector.settings.log_format"]; ok {
+		logging.SetLogFormat(logging.Format(cv.String()))
+	}
+	if cv, ok := config["projector.settings.log_component_levels"]; ok {
+		if err := logging.SetComponentLevels(cv.String()); err != nil {
+			logging.Errorf("%v invalid component log levels: %v\n", p.logPrefix, err)
+		}
+	}
 	if cv, ok := config["projector.maxCpuPercent"]; ok {
 		c.SetNumCPUs(cv.Int())
 	}
@@ -127,6 +152,7 @@ func (p *Projector) ResetConfig(config c.Config) {
 	if cv, ok := config["projector.memstatTick"]; ok {
 		c.Memstatch <- int64(cv.Int())
 	}
+	p.resetJSLimits(config)
 	p.config = p.config.Override(config)
 
 	// CPU-profiling
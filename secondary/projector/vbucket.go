@@ -13,11 +13,13 @@ type Vbucket struct {
 	vbno      uint16 // immutable
 	vbuuid    uint64 // immutable
 	seqno     uint64
-	logPrefix string // immutable
+	logPrefix string    // immutable
+	keyCache  *keyCache // nil if disabled
 	// stats
 	sshotCount    uint64
 	mutationCount uint64
 	syncCount     uint64
+	noopCount     uint64 // upserts published as no-op
 }
 
 // NewVbucket creates a new routine to handle this vbucket stream.
@@ -0,0 +1,137 @@
+package projector
+
+import "testing"
+
+import c "github.com/couchbase/indexing/secondary/common"
+import mcd "github.com/couchbase/indexing/secondary/dcp/transport"
+import mc "github.com/couchbase/indexing/secondary/dcp/transport/client"
+import protobuf "github.com/couchbase/indexing/secondary/protobuf/projector"
+import "github.com/golang/protobuf/proto"
+
+const partialEndpoint = "localhost:9100"
+
+func newPartialEvaluator(t *testing.T) *protobuf.IndexEvaluator {
+	defn := &protobuf.IndexDefn{
+		DefnID:          proto.Uint64(10),
+		Bucket:          proto.String("default"),
+		IsPrimary:       proto.Bool(false),
+		Name:            proto.String("partial"),
+		Using:           protobuf.StorageType_memdb.Enum(),
+		ExprType:        protobuf.ExprType_N1QL.Enum(),
+		SecExpressions:  []string{"`name`"},
+		PartitionScheme: protobuf.PartitionScheme_SINGLE.Enum(),
+		WhereExpression: proto.String("`age` > 10"),
+	}
+	inst := &protobuf.IndexInst{
+		InstId:      proto.Uint64(1),
+		State:       protobuf.IndexState_IndexActive.Enum(),
+		Definition:  defn,
+		SinglePartn: protobuf.NewSinglePartition([]string{partialEndpoint}),
+	}
+	ie, err := protobuf.NewIndexEvaluator(inst, protobuf.FeedVersion_sherlock)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return ie
+}
+
+// feedPartial pushes mutation through fake upr feed and returns the
+// key-versions routed to partialEndpoint, nil if nothing was routed.
+func feedPartial(
+	t *testing.T, ie *protobuf.IndexEvaluator, value, oldValue string) *c.KeyVersions {
+
+	bucket := NewFakeBuckets([]string{"default"})["default"]
+	feeder, err := bucket.OpenKVFeed("localhost:11210")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer bucket.Close("localhost:11210")
+
+	m := &mc.DcpEvent{
+		Opcode:  mcd.DCP_MUTATION,
+		VBucket: 1,
+		Seqno:   10,
+		Key:     []byte("doc1"),
+		Value:   []byte(value),
+	}
+	if oldValue != "" {
+		m.OldValue = []byte(oldValue)
+	}
+	m.TreatAsJSON()
+	bucket.C <- m
+
+	m = <-feeder.GetChannel()
+	data := make(map[string]interface{})
+	if _, err := ie.TransformRoute(1234, m, data, nil); err != nil {
+		t.Fatal(err)
+	}
+	if dkv, ok := data[partialEndpoint].(*c.DataportKeyVersions); ok {
+		return dkv.Kv
+	}
+	return nil
+}
+
+// DCP does not carry the old value of a document, so every mutation
+// that fails the WHERE predicate is routed as an UpsertDeletion. It is
+// not known whether the document was indexed, hence it is not an exit.
+func TestPartialIndexDcpMutation(t *testing.T) {
+	ie := newPartialEvaluator(t)
+	kv := feedPartial(t, ie, `{"name":"new","age":5}`, "")
+	if kv == nil || kv.Commands[0] != c.UpsertDeletion {
+		t.Fatalf("expected upsert deletion, got %v", kv)
+	}
+	if len(kv.Oldkeys[0]) != 0 {
+		t.Errorf("expected no old key, got %s", kv.Oldkeys[0])
+	}
+	if len(kv.Exits) != 0 {
+		t.Errorf("expected no predicate exit, got %v", kv.Exits)
+	}
+
+	kv = feedPartial(t, ie, `{"name":"new","age":20}`, "")
+	if kv == nil || kv.Commands[0] != c.Upsert {
+		t.Fatalf("expected upsert, got %v", kv)
+	}
+}
+
+// Following cases apply only to a feed that supplies the old value.
+
+func TestPartialIndexInToIn(t *testing.T) {
+	ie := newPartialEvaluator(t)
+	kv := feedPartial(t, ie, `{"name":"new","age":20}`, `{"name":"old","age":30}`)
+	if kv == nil || kv.Commands[0] != c.Upsert {
+		t.Fatalf("expected upsert, got %v", kv)
+	}
+	if string(kv.Keys[0]) != `["new"]` || string(kv.Oldkeys[0]) != `["old"]` {
+		t.Errorf("unexpected keys %s %s", kv.Keys[0], kv.Oldkeys[0])
+	}
+}
+
+func TestPartialIndexOutToIn(t *testing.T) {
+	ie := newPartialEvaluator(t)
+	kv := feedPartial(t, ie, `{"name":"new","age":20}`, `{"name":"old","age":5}`)
+	if kv == nil || kv.Commands[0] != c.Upsert || string(kv.Keys[0]) != `["new"]` {
+		t.Fatalf("expected upsert, got %v", kv)
+	}
+}
+
+func TestPartialIndexInToOut(t *testing.T) {
+	ie := newPartialEvaluator(t)
+	kv := feedPartial(t, ie, `{"name":"new","age":5}`, `{"name":"old","age":20}`)
+	if kv == nil || kv.Commands[0] != c.UpsertDeletion {
+		t.Fatalf("expected upsert deletion, got %v", kv)
+	}
+	if string(kv.Oldkeys[0]) != `["old"]` {
+		t.Errorf("expected old key, got %s", kv.Oldkeys[0])
+	}
+	if len(kv.Exits) != 1 || kv.Exits[0] != kv.Uuids[0] {
+		t.Errorf("expected predicate exit for %v, got %v", kv.Uuids[0], kv.Exits)
+	}
+}
+
+func TestPartialIndexOutToOut(t *testing.T) {
+	ie := newPartialEvaluator(t)
+	kv := feedPartial(t, ie, `{"name":"new","age":5}`, `{"name":"old","age":1}`)
+	if kv != nil {
+		t.Fatalf("expected nothing to be routed, got %v", kv)
+	}
+}
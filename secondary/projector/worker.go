@@ -25,6 +25,7 @@ import "strconv"
 import mcd "github.com/couchbase/indexing/secondary/dcp/transport"
 import mc "github.com/couchbase/indexing/secondary/dcp/transport/client"
 import c "github.com/couchbase/indexing/secondary/common"
+import protobuf "github.com/couchbase/indexing/secondary/protobuf/projector"
 import "github.com/couchbase/indexing/secondary/logging"
 
 // VbucketWorker is immutable structure defined for each vbucket.
@@ -44,8 +45,9 @@ type VbucketWorker struct {
 	reqch chan []interface{}
 	finch chan bool
 	// config params
-	logPrefix   string
-	mutChanSize int
+	logPrefix    string
+	mutChanSize  int
+	keyCacheSize int // per vbucket, zero if disabled
 
 	encodeBuf []byte
 }
@@ -76,6 +78,10 @@ func NewVbucketWorker(
 	fmsg := "WRKR[%v<-%v<-%v #%v]"
 	worker.logPrefix = fmt.Sprintf(fmsg, id, bucket, feed.cluster, feed.topic)
 	worker.mutChanSize = mutChanSize
+	// downstream shall understand UpsertNoop.
+	if cv, ok := config["keyCacheSize"]; ok && feed.version >= protobuf.FeedVersion_alice {
+		worker.keyCacheSize = cv.Int()
+	}
 	go worker.run(worker.reqch)
 	return worker
 }
@@ -234,6 +240,7 @@ loop:
 					}
 					worker.printCtrl(worker.engines)
 				}
+				worker.resetKeyCaches()
 				if msg[3] != nil {
 					endpoints := msg[3].(map[string]c.RouterEndpoint)
 					worker.endpoints = worker.updateEndpoints(opaque, endpoints)
@@ -258,6 +265,7 @@ loop:
 				}
 				fmsg = "%v ##%x deleted engines %v\n"
 				logging.Tracef(fmsg, logPrefix, opaque, engineKeys)
+				worker.resetKeyCaches()
 				respch := msg[3].(chan []interface{})
 				respch <- []interface{}{nil}
 
@@ -269,6 +277,7 @@ loop:
 						"syncs":     float64(v.syncCount),
 						"snapshots": float64(v.sshotCount),
 						"mutations": float64(v.mutationCount),
+						"noops":     float64(v.noopCount),
 					}
 				}
 				respch := msg[1].(chan []interface{})
@@ -348,6 +357,9 @@ func (worker *VbucketWorker) handleEvent(m *mc.DcpEvent) *Vbucket {
 		config, opaque, vbuuid := worker.config, m.Opaque, m.VBuuid
 		v = NewVbucket(
 			cluster, topic, bucket, opaque, vbno, vbuuid, m.Seqno, config)
+		if worker.keyCacheSize > 0 {
+			v.keyCache = newKeyCache(worker.keyCacheSize)
+		}
 		worker.vbuckets[vbno] = v
 		if data := v.makeStreamBeginData(worker.engines); data != nil {
 			worker.broadcast2Endpoints(data)
@@ -385,15 +397,22 @@ func (worker *VbucketWorker) handleEvent(m *mc.DcpEvent) *Vbucket {
 		// for each engine distribute transformations to endpoints.
 		fmsg := "%v ##%x TransformRoute: %v\n"
 		for _, engine := range worker.engines {
+			// cheap filter on document key, before parsing document.
+			if !engine.MatchDocid(m.Key) {
+				continue
+			}
 			newBuf, err := engine.TransformRoute(v.vbuuid, m, dataForEndpoints, worker.encodeBuf)
 			if err != nil {
-				logging.Errorf(fmsg, logPrefix, m.Opaque, err)
+				engine.log.Errorf(fmsg, logPrefix, m.Opaque, err)
 			}
 			// TODO: Shrink the buffer periodically or as needed
 			if cap(newBuf) > cap(worker.encodeBuf) {
 				worker.encodeBuf = newBuf[:0]
 			}
 		}
+		if v.keyCache != nil {
+			v.noopCount += uint64(v.keyCache.apply(m.Key, dataForEndpoints))
+		}
 		// send data to corresponding endpoint.
 		for raddr, data := range dataForEndpoints {
 			if endpoint, ok := worker.endpoints[raddr]; ok {
@@ -424,6 +443,16 @@ func (worker *VbucketWorker) handleEvent(m *mc.DcpEvent) *Vbucket {
 	return v
 }
 
+// instances might have been rebuilt, keys published earlier are not
+// to be trusted.
+func (worker *VbucketWorker) resetKeyCaches() {
+	for _, v := range worker.vbuckets {
+		if v.keyCache != nil {
+			v.keyCache.reset()
+		}
+	}
+}
+
 // send to all endpoints.
 func (worker *VbucketWorker) broadcast2Endpoints(data interface{}) {
 	for raddr, endpoint := range worker.endpoints {
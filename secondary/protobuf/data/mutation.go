@@ -8,6 +8,8 @@ func (pl *Payload) Value() interface{} {
 		return pl.Vbmap
 	} else if pl.Vbkeys != nil {
 		return pl.Vbkeys
+	} else if pl.Flowctrl != nil {
+		return pl.Flowctrl
 	}
 	return nil
 }
@@ -25,3 +27,14 @@ func (kv *KeyVersions) Snapshot() (typ uint32, start, end uint64) {
 	}
 	return
 }
+
+// IsPredicateExit returns whether UpsertDeletion for index `uuid` is
+// sent because the document left the WHERE predicate.
+func (kv *KeyVersions) IsPredicateExit(uuid uint64) bool {
+	for _, exit := range kv.GetExits() {
+		if exit == uuid {
+			return true
+		}
+	}
+	return false
+}
@@ -10,6 +10,7 @@ It is generated from these files:
 
 It has these top-level messages:
 	Payload
+	FlowControl
 	VbConnectionMap
 	VbKeyVersions
 	KeyVersions
@@ -80,6 +81,7 @@ type Payload struct {
 	// -- Following fields are mutually exclusive --
 	Vbkeys           []*VbKeyVersions `protobuf:"bytes,2,rep,name=vbkeys" json:"vbkeys,omitempty"`
 	Vbmap            *VbConnectionMap `protobuf:"bytes,3,opt,name=vbmap" json:"vbmap,omitempty"`
+	Flowctrl         *FlowControl     `protobuf:"bytes,4,opt,name=flowctrl" json:"flowctrl,omitempty"`
 	XXX_unrecognized []byte           `json:"-"`
 }
 
@@ -108,6 +110,33 @@ func (m *Payload) GetVbmap() *VbConnectionMap {
 	return nil
 }
 
+func (m *Payload) GetFlowctrl() *FlowControl {
+	if m != nil {
+		return m.Flowctrl
+	}
+	return nil
+}
+
+// Flow control between router endpoint and dataport server. Endpoint sends
+// this once, with zero credits, right after connecting to request credit
+// based flow control. Server replies with credits, in bytes, initially for
+// the full window and subsequently as application consumes mutations.
+type FlowControl struct {
+	Credits          *uint64 `protobuf:"varint,1,req,name=credits" json:"credits,omitempty"`
+	XXX_unrecognized []byte  `json:"-"`
+}
+
+func (m *FlowControl) Reset()         { *m = FlowControl{} }
+func (m *FlowControl) String() string { return proto.CompactTextString(m) }
+func (*FlowControl) ProtoMessage()    {}
+
+func (m *FlowControl) GetCredits() uint64 {
+	if m != nil && m.Credits != nil {
+		return *m.Credits
+	}
+	return 0
+}
+
 // List of vbuckets that will be streamed via a newly opened connection.
 type VbConnectionMap struct {
 	Bucket           *string  `protobuf:"bytes,1,req,name=bucket" json:"bucket,omitempty"`
@@ -213,6 +242,7 @@ type KeyVersions struct {
 	Keys             [][]byte `protobuf:"bytes,5,rep,name=keys" json:"keys,omitempty"`
 	Oldkeys          [][]byte `protobuf:"bytes,6,rep,name=oldkeys" json:"oldkeys,omitempty"`
 	Partnkeys        [][]byte `protobuf:"bytes,7,rep,name=partnkeys" json:"partnkeys,omitempty"`
+	Exits            []uint64 `protobuf:"varint,8,rep,name=exits" json:"exits,omitempty"`
 	XXX_unrecognized []byte   `json:"-"`
 }
 
@@ -269,6 +299,13 @@ func (m *KeyVersions) GetPartnkeys() [][]byte {
 	return nil
 }
 
+func (m *KeyVersions) GetExits() []uint64 {
+	if m != nil {
+		return m.Exits
+	}
+	return nil
+}
+
 func init() {
 	proto.RegisterEnum("protobuf.Command", Command_name, Command_value)
 }
@@ -1,6 +1,7 @@
 package protobuf
 
 import "fmt"
+import "sync/atomic"
 
 import "github.com/couchbase/indexing/secondary/logging"
 import c "github.com/couchbase/indexing/secondary/common"
@@ -9,6 +10,7 @@ import mc "github.com/couchbase/indexing/secondary/dcp/transport/client"
 import qvalue "github.com/couchbase/query/value"
 import qu "github.com/couchbase/indexing/secondary/common/queryutil"
 import "github.com/couchbase/indexing/secondary/common/json"
+import "github.com/couchbase/indexing/secondary/collatejson"
 
 type Partition interface {
 	// Hosts return full list of endpoints <host:port>
@@ -95,12 +97,16 @@ func (instance *IndexInst) GetPartitionObject() Partition {
 // IndexEvaluator implements `Evaluator` interface for protobuf
 // definition of an index instance.
 type IndexEvaluator struct {
+	errors   uint64        // no. of documents failed evaluation, atomic
 	skExprs  []interface{} // compiled expression
 	pkExprs  []interface{} // compiled expression
 	whExpr   interface{}   // compiled expression
 	instance *IndexInst
 	version  FeedVersion
 	xattrs   []string
+	codec    *collatejson.Codec // nil for binary collation
+	docKeys  *c.DocKeyFilter    // nil if every document qualifies
+	log      *logging.Entry
 }
 
 // NewIndexEvaluator returns a reference to a new instance
@@ -113,12 +119,16 @@ func NewIndexEvaluator(instance *IndexInst,
 	ie := &IndexEvaluator{instance: instance, version: version}
 	// compile expressions once and reuse it many times.
 	defn := ie.instance.GetDefinition()
+	ie.log = logging.Component("projector").
+		WithIndex(defn.GetBucket(), defn.GetName(), instance.GetInstId())
 	exprtype := defn.GetExprType()
 	switch exprtype {
 	case ExprType_N1QL:
 		xattrExprs := make([]string, 0)
-		// expressions to evaluate secondary-key
+		// expressions to evaluate secondary-key, include expressions are
+		// evaluated as trailing elements of the secondary-key.
 		exprs := defn.GetSecExpressions()
+		exprs = append(exprs[:len(exprs):len(exprs)], defn.GetIncludeExpressions()...)
 		xattrExprs = append(xattrExprs, exprs...)
 		ie.skExprs, err = CompileN1QLExpression(exprs)
 		if err != nil {
@@ -149,10 +159,46 @@ func NewIndexEvaluator(instance *IndexInst,
 		_, xattrNames, _ := qu.GetXATTRNames(xattrExprs)
 		ie.xattrs = xattrNames
 
+	case ExprType_JAVASCRIPT:
+		// secondary-key, include, partition-key and where are each
+		// a function of (doc, meta).
+		exprs := defn.GetSecExpressions()
+		exprs = append(exprs[:len(exprs):len(exprs)], defn.GetIncludeExpressions()...)
+		if ie.skExprs, err = CompileJSExpression(exprs); err != nil {
+			return nil, err
+		}
+		if exprs = defn.GetPartnExpressions(); len(exprs) > 0 {
+			if ie.pkExprs, err = CompileJSExpression(exprs); err != nil {
+				return nil, err
+			}
+		}
+		if expr := defn.GetWhereExpression(); len(expr) > 0 {
+			cExprs, err := CompileJSExpression([]string{expr})
+			if err != nil {
+				return nil, err
+			}
+			ie.whExpr = cExprs[0]
+		}
+
 	default:
 		logging.Errorf("invalid expression type %v\n", exprtype)
 		return nil, fmt.Errorf("invalid expression type %v", exprtype)
 	}
+
+	ie.docKeys, err = c.NewDocKeyFilter(defn.GetDocKeyPrefixes(), defn.GetDocKeyPattern())
+	if err != nil {
+		logging.Errorf("invalid document key filter: %v\n", err)
+		return nil, err
+	}
+
+	// collation to encode secondary key
+	if collation := defn.GetCollation(); collation != "" {
+		ie.codec = collatejson.NewCodec(16)
+		if err := ie.codec.SetCollation(collation); err != nil {
+			logging.Errorf("invalid collation %q: %v\n", collation, err)
+			return nil, err
+		}
+	}
 	return ie, nil
 }
 
@@ -161,6 +207,16 @@ func (ie *IndexEvaluator) Bucket() string {
 	return ie.instance.GetDefinition().GetBucket()
 }
 
+// MatchDocid implements Evaluator{} interface.
+func (ie *IndexEvaluator) MatchDocid(docid []byte) bool {
+	return ie.docKeys.Match(docid)
+}
+
+// Errors implements Evaluator{} interface.
+func (ie *IndexEvaluator) Errors() uint64 {
+	return atomic.LoadUint64(&ie.errors)
+}
+
 // StreamBeginData implement Evaluator{} interface.
 func (ie *IndexEvaluator) StreamBeginData(
 	vbno uint16, vbuuid, seqno uint64) (data interface{}) {
@@ -209,6 +265,7 @@ func (ie *IndexEvaluator) TransformRoute(
 	defer func() { // panic safe
 		if r := recover(); r != nil {
 			err = fmt.Errorf("%v", r)
+			atomic.AddUint64(&ie.errors, 1)
 		}
 	}()
 
@@ -246,9 +303,13 @@ func (ie *IndexEvaluator) TransformRoute(
 			return nil, err
 		}
 	}
+	oldWhere := false
 	if len(m.OldValue) > 0 { // project old secondary key
 		docval = qvalue.NewAnnotatedValue(qvalue.NewParsedValue(m.OldValue, true))
 		docval.SetAttachment("meta", meta)
+		if oldWhere, err = ie.wherePredicate(m, docval, encodeBuf); err != nil {
+			return nil, err
+		}
 		if opkey, err = ie.partitionKey(m, m.Key, docval, encodeBuf); err != nil {
 			return nil, err
 		}
@@ -256,6 +317,7 @@ func (ie *IndexEvaluator) TransformRoute(
 			return nil, err
 		}
 	}
+	transition := whereTransition(oldWhere, len(m.OldValue) > 0, where)
 
 	vbno, seqno := m.VBucket, m.Seqno
 	uuid := instn.GetInstId()
@@ -263,16 +325,14 @@ func (ie *IndexEvaluator) TransformRoute(
 	bucket := ie.Bucket()
 
 	logging.LazyTrace(func() string {
-		return fmt.Sprintf("inst: %v where: %v (pkey: %v) key: %v\n", uuid, where,
-			logging.TagUD(string(npkey)), logging.TagUD(string(nkey)))
+		return fmt.Sprintf("inst: %v where: %v (%v) (pkey: %v) key: %v\n", uuid, where,
+			transition, logging.TagUD(string(npkey)), logging.TagUD(string(nkey)))
 	})
 
 	switch opcode {
 	case mcd.DCP_MUTATION:
-		// FIXME: TODO: where clause is not used to for optimizing out messages
-		// not passing the where clause. For this we need a gaurantee that
-		// where clause will be defined only on immutable fields.
-		if where { // WHERE predicate, sent upsert only if where is true.
+		switch transition {
+		case WhereInToIn, WhereOutToIn: // sent upsert only if where is true.
 			raddrs := instn.UpsertEndpoints(m, npkey, nkey, okey)
 			if len(raddrs) != 0 {
 				for _, raddr := range raddrs {
@@ -290,33 +350,25 @@ func (ie *IndexEvaluator) TransformRoute(
 				// send upsertDeletion if cannot find an endpoint that can accept this mutation
 				// for the given feed
 				raddrs := instn.UpsertDeletionEndpoints(m, npkey, nkey, okey)
-				for _, raddr := range raddrs {
-					dkv, ok := data[raddr].(*c.DataportKeyVersions)
-					if !ok {
-						kv := c.NewKeyVersions(seqno, m.Key, 4, m.Ctime)
-						kv.AddUpsertDeletion(uuid, okey, npkey)
-						dkv = &c.DataportKeyVersions{bucket, vbno, vbuuid, kv}
-					} else {
-						dkv.Kv.AddUpsertDeletion(uuid, okey, npkey)
-					}
-					data[raddr] = dkv
-				}
+				ie.upsertDeletion(data, raddrs, vbuuid, m, nil, npkey, false)
 			}
-		} else { // if WHERE is false, broadcast upsertdelete.
+
+		case WhereInToOut:
+			// document left the WHERE predicate, old-key along with old
+			// partition-key is sent and the deletion is flagged as an
+			// exit, so that downstream can tell this apart from a
+			// missing old document.
+			raddrs := instn.UpsertDeletionEndpoints(m, opkey, nkey, okey)
+			ie.upsertDeletion(data, raddrs, vbuuid, m, okey, opkey, true)
+
+		case WhereUnknown: // if WHERE is false, broadcast upsertdelete.
 			// NOTE: downstream can use upsertdelete and immutable flag
 			// to optimize out back-index lookup.
 			raddrs := instn.UpsertDeletionEndpoints(m, npkey, nkey, okey)
-			for _, raddr := range raddrs {
-				dkv, ok := data[raddr].(*c.DataportKeyVersions)
-				if !ok {
-					kv := c.NewKeyVersions(seqno, m.Key, 4, m.Ctime)
-					kv.AddUpsertDeletion(uuid, okey, npkey)
-					dkv = &c.DataportKeyVersions{bucket, vbno, vbuuid, kv}
-				} else {
-					dkv.Kv.AddUpsertDeletion(uuid, okey, npkey)
-				}
-				data[raddr] = dkv
-			}
+			ie.upsertDeletion(data, raddrs, vbuuid, m, nil, npkey, false)
+
+		case WhereOutToOut:
+			// old document was not indexed, nothing to remove.
 		}
 
 	case mcd.DCP_DELETION, mcd.DCP_EXPIRATION:
@@ -338,6 +390,63 @@ func (ie *IndexEvaluator) TransformRoute(
 	return newBuf, nil
 }
 
+func (ie *IndexEvaluator) upsertDeletion(
+	data map[string]interface{}, raddrs []string, vbuuid uint64,
+	m *mc.DcpEvent, okey, pkey []byte, exit bool) {
+
+	bucket, uuid := ie.Bucket(), ie.instance.GetInstId()
+	for _, raddr := range raddrs {
+		dkv, ok := data[raddr].(*c.DataportKeyVersions)
+		if !ok {
+			kv := c.NewKeyVersions(m.Seqno, m.Key, 4, m.Ctime)
+			dkv = &c.DataportKeyVersions{bucket, m.VBucket, vbuuid, kv}
+		}
+		if exit {
+			dkv.Kv.AddPredicateExit(uuid, okey, pkey)
+		} else {
+			dkv.Kv.AddUpsertDeletion(uuid, okey, pkey)
+		}
+		data[raddr] = dkv
+	}
+}
+
+// ProjectKey returns the partition-key and secondary-key that
+// TransformRoute would publish as an Upsert for the document carried
+// by `m`. A nil key means the document does not qualify for this
+// index, either because of WHERE predicate or because the leading
+// key is missing.
+func (ie *IndexEvaluator) ProjectKey(
+	m *mc.DcpEvent, encodeBuf []byte) (pkey, key, newBuf []byte, err error) {
+
+	defer func() { // panic safe
+		if r := recover(); r != nil {
+			err = fmt.Errorf("%v", r)
+		}
+	}()
+
+	if ie.version < FeedVersion_watson {
+		encodeBuf = nil
+	}
+	if m.Opcode != mcd.DCP_MUTATION || len(m.Value) == 0 {
+		return nil, nil, nil, nil
+	} else if !ie.MatchDocid(m.Key) {
+		return nil, nil, nil, nil
+	}
+
+	meta := ie.dcpEvent2Meta(m)
+	docval := qvalue.NewAnnotatedValue(qvalue.NewParsedValue(m.Value, true))
+	docval.SetAttachment("meta", meta)
+	where, err := ie.wherePredicate(m, docval, encodeBuf)
+	if err != nil || !where {
+		return nil, nil, nil, err
+	}
+	if pkey, err = ie.partitionKey(m, m.Key, docval, encodeBuf); err != nil {
+		return nil, nil, nil, err
+	}
+	key, newBuf, err = ie.evaluate(m, m.Key, docval, encodeBuf)
+	return pkey, key, newBuf, err
+}
+
 func (ie *IndexEvaluator) evaluate(
 	m *mc.DcpEvent, docid []byte, docval qvalue.AnnotatedValue,
 	encodeBuf []byte) ([]byte, []byte, error) {
@@ -354,7 +463,15 @@ func (ie *IndexEvaluator) evaluate(
 	exprType := defn.GetExprType()
 	switch exprType {
 	case ExprType_N1QL:
-		return N1QLTransform(docid, docval, ie.skExprs, encodeBuf)
+		return n1qlTransform(docid, docval, ie.skExprs, encodeBuf, ie.codec)
+
+	case ExprType_JAVASCRIPT:
+		out, newBuf, err := jsTransform(docid, docval, ie.skExprs, encodeBuf, ie.codec)
+		if err != nil { // skip document
+			ie.jsError("secondary key", docid, err)
+			return nil, newBuf, nil
+		}
+		return out, newBuf, nil
 	}
 	return nil, nil, nil
 }
@@ -376,6 +493,14 @@ func (ie *IndexEvaluator) partitionKey(
 	case ExprType_N1QL:
 		out, _, err := N1QLTransform(docid, docval, ie.pkExprs, nil)
 		return out, err
+
+	case ExprType_JAVASCRIPT:
+		out, _, err := JSTransform(docid, docval, ie.pkExprs, nil)
+		if err != nil {
+			ie.jsError("partition key", docid, err)
+			return nil, nil
+		}
+		return out, nil
 	}
 	return nil, nil
 }
@@ -407,10 +532,27 @@ func (ie *IndexEvaluator) wherePredicate(
 			return true, nil
 		}
 		return false, nil // predicate is false
+
+	case ExprType_JAVASCRIPT:
+		out, _, err := JSTransform(nil, docval, []interface{}{ie.whExpr}, nil)
+		if err != nil { // errors are treated as false
+			ie.jsError("where", m.Key, err)
+			return false, nil
+		}
+		return string(out) == "true", nil
 	}
 	return true, nil
 }
 
+// jsError counts a document that failed JavaScript evaluation, the
+// document is not indexed and the feed continues.
+func (ie *IndexEvaluator) jsError(what string, docid []byte, err error) {
+	atomic.AddUint64(&ie.errors, 1)
+	fmsg := "JSTransform(%v) %v for docid %v, err: %v skip document"
+	arg1 := logging.TagUD(string(docid))
+	ie.log.Errorf(fmsg, ie.instance.GetInstId(), what, arg1, err)
+}
+
 // helper functions
 func (ie *IndexEvaluator) dcpEvent2Meta(m *mc.DcpEvent) map[string]interface{} {
 	// If index is defined on xattr (either where-expression, part-expression
@@ -291,6 +291,10 @@ type IndexDefn struct {
 	PartnExpressions   []string    `protobuf:"bytes,11,rep,name=partnExpressions" json:"partnExpressions,omitempty"`
 	RetainDeletedXATTR *bool       `protobuf:"varint,12,opt,name=retainDeletedXATTR" json:"retainDeletedXATTR,omitempty"`
 	HashScheme         *HashScheme `protobuf:"varint,13,req,name=hashScheme,enum=protobuf.HashScheme" json:"hashScheme,omitempty"`
+	IncludeExpressions []string    `protobuf:"bytes,14,rep,name=includeExpressions" json:"includeExpressions,omitempty"`
+	Collation          *string     `protobuf:"bytes,15,opt,name=collation" json:"collation,omitempty"`
+	DocKeyPrefixes     []string    `protobuf:"bytes,16,rep,name=docKeyPrefixes" json:"docKeyPrefixes,omitempty"`
+	DocKeyPattern      *string     `protobuf:"bytes,17,opt,name=docKeyPattern" json:"docKeyPattern,omitempty"`
 	XXX_unrecognized   []byte      `json:"-"`
 }
 
@@ -382,6 +386,34 @@ func (m *IndexDefn) GetHashScheme() HashScheme {
 	return HashScheme_CRC32
 }
 
+func (m *IndexDefn) GetIncludeExpressions() []string {
+	if m != nil {
+		return m.IncludeExpressions
+	}
+	return nil
+}
+
+func (m *IndexDefn) GetCollation() string {
+	if m != nil && m.Collation != nil {
+		return *m.Collation
+	}
+	return ""
+}
+
+func (m *IndexDefn) GetDocKeyPrefixes() []string {
+	if m != nil {
+		return m.DocKeyPrefixes
+	}
+	return nil
+}
+
+func (m *IndexDefn) GetDocKeyPattern() string {
+	if m != nil && m.DocKeyPattern != nil {
+		return *m.DocKeyPattern
+	}
+	return ""
+}
+
 func init() {
 	proto.RegisterEnum("protobuf.IndexState", IndexState_name, IndexState_value)
 	proto.RegisterEnum("protobuf.StorageType", StorageType_name, StorageType_value)
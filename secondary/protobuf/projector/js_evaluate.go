@@ -0,0 +1,275 @@
+package protobuf
+
+import "errors"
+import "fmt"
+import "sync"
+import "sync/atomic"
+import "time"
+
+import "github.com/couchbase/indexing/secondary/logging"
+import "github.com/couchbase/indexing/secondary/common/json"
+import "github.com/couchbase/indexing/secondary/collatejson"
+import qvalue "github.com/couchbase/query/value"
+import "github.com/robertkrimen/otto"
+
+// ErrorJSTimeout is returned when a JavaScript index function runs
+// longer than the configured timeout.
+var ErrorJSTimeout = errors.New("javascript.timeout")
+
+// ErrorJSDocTooLarge is returned when the document to be evaluated is
+// larger than the configured limit.
+var ErrorJSDocTooLarge = errors.New("javascript.docTooLarge")
+
+// ErrorJSKeyTooLarge is returned when the value returned by a
+// JavaScript index function is larger than the configured limit.
+var ErrorJSKeyTooLarge = errors.New("javascript.keyTooLarge")
+
+// ErrorJSNotFunction is returned when a JavaScript expression does not
+// evaluate to a function.
+var ErrorJSNotFunction = errors.New("javascript.notFunction")
+
+// JSLimits bound the resources used by a single call to a JavaScript
+// index function. There is no memory limit, the interpreter does not
+// account for the memory allocated by a call and process wide heap
+// statistics include allocations of all other goroutines. Memory used
+// by a call is bounded by the Timeout, along with MaxDocSize for its
+// input and MaxKeySize for its result.
+type JSLimits struct {
+	Timeout       time.Duration
+	MaxStackDepth int
+	MaxDocSize    int
+	MaxKeySize    int
+}
+
+var jsLimits atomic.Value
+
+func init() {
+	jsLimits.Store(JSLimits{
+		Timeout:       100 * time.Millisecond,
+		MaxStackDepth: 1000,
+		MaxDocSize:    1024 * 1024,
+		MaxKeySize:    4608,
+	})
+}
+
+// SetJSLimits for all JavaScript index functions, applies to calls
+// made after it returns.
+func SetJSLimits(limits JSLimits) {
+	jsLimits.Store(limits)
+}
+
+// GetJSLimits returns the current limits for JavaScript index
+// functions.
+func GetJSLimits() JSLimits {
+	return jsLimits.Load().(JSLimits)
+}
+
+// wraps the index function so that document and meta are passed in,
+// and the result passed out, as JSON text.
+const jsWrapper = `(function(fn) {
+    return function(doc, meta) {
+        var val = fn(JSON.parse(doc), JSON.parse(meta));
+        return val === undefined ? undefined : JSON.stringify(val);
+    };
+})`
+
+// attachment of document value caching its JSON text, so that
+// document is marshalled once for all index functions.
+const jsDocAttachment = "jsdoc"
+
+type jsDoc struct {
+	doc, meta string
+}
+
+// jsExpression is a compiled JavaScript index function of the form
+// `function(doc, meta) {...}`, returning a single value. Interpreters
+// are not safe for concurrent use, hence every caller borrows one from
+// the pool.
+type jsExpression struct {
+	source string
+	pool   sync.Pool
+}
+
+type jsInterpreter struct {
+	vm *otto.Otto
+	fn otto.Value
+}
+
+// CompileJSExpression will take JavaScript functions defined for an
+// index and compile them for evaluation.
+func CompileJSExpression(expressions []string) ([]interface{}, error) {
+	cExprs := make([]interface{}, 0, len(expressions))
+	for _, expr := range expressions {
+		jsExpr := &jsExpression{source: expr}
+		interp, err := jsExpr.newInterpreter()
+		if err != nil {
+			arg1 := logging.TagUD(expr)
+			logging.Errorf("CompileJSExpression() %v: %v\n", arg1, err)
+			return nil, err
+		}
+		jsExpr.pool.Put(interp)
+		cExprs = append(cExprs, jsExpr)
+	}
+	return cExprs, nil
+}
+
+func (jsExpr *jsExpression) newInterpreter() (*jsInterpreter, error) {
+	vm := otto.New()
+	vm.Interrupt = make(chan func(), 1)
+	wrapper, err := vm.Run(jsWrapper)
+	if err != nil {
+		return nil, err
+	}
+	fn, err := vm.Run("(" + jsExpr.source + "\n)")
+	if err != nil {
+		return nil, err
+	} else if !fn.IsFunction() {
+		return nil, ErrorJSNotFunction
+	}
+	if fn, err = wrapper.Call(otto.NullValue(), fn); err != nil {
+		return nil, err
+	}
+	return &jsInterpreter{vm: vm, fn: fn}, nil
+}
+
+// call the index function with document and meta as JSON text, returns
+// the result as JSON text, nil if the function returned `undefined`.
+func (jsExpr *jsExpression) call(
+	doc, meta string, limits JSLimits) (out []byte, err error) {
+
+	var interp *jsInterpreter
+	if v := jsExpr.pool.Get(); v != nil {
+		interp = v.(*jsInterpreter)
+	} else if interp, err = jsExpr.newInterpreter(); err != nil {
+		return nil, err
+	}
+
+	reuse := true
+	defer func() {
+		if r := recover(); r == ErrorJSTimeout {
+			err, reuse = r.(error), false
+		} else if r != nil {
+			err, reuse = fmt.Errorf("%v", r), false
+		}
+		// an interpreter that is interrupted, or could be, is discarded.
+		if reuse {
+			jsExpr.pool.Put(interp)
+		}
+	}()
+
+	interp.vm.SetStackDepthLimit(limits.MaxStackDepth)
+	if limits.Timeout > 0 {
+		reuse = false
+		w := interp.watch(limits.Timeout)
+		defer func() { reuse = w.stop() }()
+	}
+	val, err := interp.fn.Call(otto.NullValue(), doc, meta)
+	if err != nil {
+		return nil, err
+	} else if val.IsUndefined() {
+		return nil, nil
+	}
+	s := val.String()
+	if limits.MaxKeySize > 0 && len(s) > limits.MaxKeySize {
+		return nil, ErrorJSKeyTooLarge
+	}
+	return []byte(s), nil
+}
+
+// jsWatch interrupts a call to the interpreter when it runs longer
+// than the timeout.
+type jsWatch struct {
+	interp *jsInterpreter
+	timer  *time.Timer
+
+	mu          sync.Mutex
+	done        bool
+	interrupted bool
+}
+
+func (interp *jsInterpreter) watch(timeout time.Duration) *jsWatch {
+	w := &jsWatch{interp: interp}
+	w.mu.Lock()
+	w.timer = time.AfterFunc(timeout, w.interrupt)
+	w.mu.Unlock()
+	return w
+}
+
+func (w *jsWatch) interrupt() {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if w.done {
+		return
+	}
+	w.interrupted = true
+	w.interp.vm.Interrupt <- func() { panic(ErrorJSTimeout) }
+}
+
+// stop watching, returns false if the call was interrupted.
+func (w *jsWatch) stop() bool {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	w.done = true
+	w.timer.Stop()
+	return !w.interrupted
+}
+
+// JSTransform will use compiled list of JavaScript functions and
+// evaluate a document using them to return a secondary key, with the
+// same shape and encoding as N1QLTransform. A function returning
+// `undefined` is treated as MISSING.
+func JSTransform(
+	docid []byte, docval qvalue.AnnotatedValue, cExprs []interface{},
+	encodeBuf []byte) ([]byte, []byte, error) {
+
+	return jsTransform(docid, docval, cExprs, encodeBuf, nil)
+}
+
+func jsTransform(
+	docid []byte, docval qvalue.AnnotatedValue, cExprs []interface{},
+	encodeBuf []byte, codec *collatejson.Codec) ([]byte, []byte, error) {
+
+	limits := GetJSLimits()
+	doc, err := jsDocument(docval)
+	if err != nil {
+		return nil, nil, err
+	} else if limits.MaxDocSize > 0 && len(doc.doc) > limits.MaxDocSize {
+		return nil, nil, ErrorJSDocTooLarge
+	}
+
+	arrValue := make([]interface{}, 0, len(cExprs))
+	skip := true
+	for _, cExpr := range cExprs {
+		out, err := cExpr.(*jsExpression).call(doc.doc, doc.meta, limits)
+		if err != nil {
+			return nil, nil, err
+		} else if out == nil && skip { // leading key is missing
+			return nil, nil, nil
+		} else if out == nil {
+			arrValue = append(arrValue, missing)
+			continue
+		}
+		skip = false
+		arrValue = append(arrValue, qvalue.NewValue(out))
+	}
+	return encodeSecondaryKey(docid, arrValue, len(cExprs), encodeBuf, codec)
+}
+
+// jsDocument returns document and its meta as JSON text, marshalled
+// on first use and cached with the document value.
+func jsDocument(docval qvalue.AnnotatedValue) (*jsDoc, error) {
+	if doc, ok := docval.GetAttachment(jsDocAttachment).(*jsDoc); ok {
+		return doc, nil
+	}
+	doc, err := docval.MarshalJSON()
+	if err != nil {
+		return nil, err
+	}
+	meta, err := json.Marshal(docval.GetAttachment("meta"))
+	if err != nil {
+		return nil, err
+	}
+	jsdoc := &jsDoc{doc: string(doc), meta: string(meta)}
+	docval.SetAttachment(jsDocAttachment, jsdoc)
+	return jsdoc, nil
+}
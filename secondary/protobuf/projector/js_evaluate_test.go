@@ -0,0 +1,97 @@
+package protobuf
+
+import (
+	"testing"
+	"time"
+
+	qvalue "github.com/couchbase/query/value"
+)
+
+func jsDocval(doc []byte) qvalue.AnnotatedValue {
+	docval := qvalue.NewAnnotatedValue(qvalue.NewParsedValue(doc, true))
+	docval.SetAttachment("meta", map[string]interface{}{"id": "user1"})
+	return docval
+}
+
+func TestJSTransform150(t *testing.T) {
+	cExprs, err := CompileJSExpression([]string{
+		`function(doc, meta) { return doc.city; }`,
+		`function(doc, meta) { return doc.age + 1; }`,
+		`function(doc, meta) { return meta.id; }`,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	out, _, err := JSTransform([]byte("user1"), jsDocval(doc150), cExprs, nil)
+	if err != nil {
+		t.Fatal(err)
+	} else if ref := `["Kathmandu",33,"user1"]`; string(out) != ref {
+		t.Fatalf("expected %v, got %v", ref, string(out))
+	}
+
+	// missing leading key skips the document.
+	cExprs, _ = CompileJSExpression([]string{`function(doc) { return doc.missing; }`})
+	if out, _, err = JSTransform([]byte("user1"), jsDocval(doc150), cExprs, nil); err != nil || out != nil {
+		t.Fatalf("unexpected %v %v", string(out), err)
+	}
+}
+
+func TestJSDocumentOnce(t *testing.T) {
+	cExprs, _ := CompileJSExpression([]string{`function(doc, meta) { return doc.city; }`})
+	docval := jsDocval(doc150)
+	if _, _, err := JSTransform(nil, docval, cExprs, nil); err != nil {
+		t.Fatal(err)
+	}
+
+	// document is not marshalled again for other index functions.
+	docval.SetAttachment(jsDocAttachment, &jsDoc{doc: `{"city":"Pune"}`, meta: `{}`})
+	out, _, err := JSTransform(nil, docval, cExprs, nil)
+	if err != nil {
+		t.Fatal(err)
+	} else if string(out) != `"Pune"` {
+		t.Fatalf("expected cached document, got %s", out)
+	}
+}
+
+func TestJSCompileError(t *testing.T) {
+	if _, err := CompileJSExpression([]string{`function(doc {`}); err == nil {
+		t.Fatalf("expected syntax error")
+	}
+	if _, err := CompileJSExpression([]string{`10`}); err != ErrorJSNotFunction {
+		t.Fatalf("expected %v, got %v", ErrorJSNotFunction, err)
+	}
+}
+
+func TestJSLimits(t *testing.T) {
+	defer SetJSLimits(GetJSLimits())
+	limits := GetJSLimits()
+	limits.Timeout, limits.MaxKeySize = 50*time.Millisecond, 100
+	SetJSLimits(limits)
+
+	cExprs, _ := CompileJSExpression([]string{`function(doc) { while (true) {} }`})
+	if _, _, err := JSTransform(nil, jsDocval(doc150), cExprs, nil); err != ErrorJSTimeout {
+		t.Fatalf("expected %v, got %v", ErrorJSTimeout, err)
+	}
+
+	cExprs, _ = CompileJSExpression([]string{`function(doc) { return new Array(1000).join("x"); }`})
+	if _, _, err := JSTransform(nil, jsDocval(doc150), cExprs, nil); err != ErrorJSKeyTooLarge {
+		t.Fatalf("expected %v, got %v", ErrorJSKeyTooLarge, err)
+	}
+
+	// allocations are bounded by the timeout.
+	cExprs, _ = CompileJSExpression([]string{`function(doc) {
+		var a = [];
+		while (true) { a.push(new Array(1000).join("x")); }
+	}`})
+	if _, _, err := JSTransform(nil, jsDocval(doc150), cExprs, nil); err != ErrorJSTimeout {
+		t.Fatalf("expected %v, got %v", ErrorJSTimeout, err)
+	}
+
+	// runtime errors are returned and the interpreter is reused.
+	cExprs, _ = CompileJSExpression([]string{`function(doc) { return doc.x.y; }`})
+	for i := 0; i < 2; i++ {
+		if _, _, err := JSTransform(nil, jsDocval(doc150), cExprs, nil); err == nil {
+			t.Fatalf("expected TypeError")
+		}
+	}
+}
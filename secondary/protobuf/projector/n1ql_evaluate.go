@@ -31,6 +31,15 @@ func N1QLTransform(
 	docid []byte, docval qvalue.AnnotatedValue, cExprs []interface{},
 	encodeBuf []byte) ([]byte, []byte, error) {
 
+	return n1qlTransform(docid, docval, cExprs, encodeBuf, nil)
+}
+
+// n1qlTransform is N1QLTransform, collating secondary key with codec if
+// it is not nil.
+func n1qlTransform(
+	docid []byte, docval qvalue.AnnotatedValue, cExprs []interface{},
+	encodeBuf []byte, codec *collatejson.Codec) ([]byte, []byte, error) {
+
 	arrValue := make([]interface{}, 0, len(cExprs))
 	context := qexpr.NewIndexContext()
 	skip := true
@@ -93,7 +102,16 @@ func N1QLTransform(
 		}
 	}
 
-	if len(cExprs) == 1 && len(arrValue) == 1 && docid == nil {
+	return encodeSecondaryKey(docid, arrValue, len(cExprs), encodeBuf, codec)
+}
+
+// encodeSecondaryKey from evaluated values of `nexprs` index
+// expressions, as JSON or, if encodeBuf is supplied, as collated JSON.
+func encodeSecondaryKey(
+	docid []byte, arrValue []interface{}, nexprs int,
+	encodeBuf []byte, codec *collatejson.Codec) ([]byte, []byte, error) {
+
+	if nexprs == 1 && len(arrValue) == 1 && docid == nil {
 		// used for partition-key evaluation and where predicate.
 		// Marshal partition-key and where as a basic JSON data-type.
 		out, err := qvalue.NewValue(arrValue[0]).MarshalJSON()
@@ -110,7 +128,7 @@ func N1QLTransform(
 		//    arrValue = append(arrValue, qvalue.NewValue(string(docid)))
 		//}
 		if encodeBuf != nil {
-			out, newBuf, err := CollateJSONEncode(qvalue.NewValue(arrValue), encodeBuf)
+			out, newBuf, err := collateJSONEncode(qvalue.NewValue(arrValue), encodeBuf, codec)
 			if err != nil {
 				fmsg := "CollateJSONEncode: index field for docid: %s (err: %v) skip document"
 				arg1 := logging.TagUD(docid)
@@ -130,7 +148,19 @@ func N1QLTransform(
 }
 
 func CollateJSONEncode(val qvalue.Value, encodeBuf []byte) ([]byte, []byte, error) {
-	codec := collatejson.NewCodec(16)
+	return collateJSONEncode(val, encodeBuf, nil)
+}
+
+func collateJSONEncode(
+	val qvalue.Value, encodeBuf []byte,
+	codec *collatejson.Codec) ([]byte, []byte, error) {
+
+	size := 3
+	if codec == nil {
+		codec = collatejson.NewCodec(16)
+	} else {
+		size = 9 // sort key and value of collated strings.
+	}
 	encoded, err := codec.EncodeN1QLValue(val, encodeBuf[:0])
 
 	if err != nil && err.Error() == collatejson.ErrorOutputLen.Error() {
@@ -138,7 +168,7 @@ func CollateJSONEncode(val qvalue.Value, encodeBuf []byte) ([]byte, []byte, erro
 		if e1 != nil {
 			return append([]byte(nil), encoded...), nil, err
 		}
-		newBuf := make([]byte, 0, len(valBytes)*3)
+		newBuf := make([]byte, 0, len(valBytes)*size)
 		enc, e2 := codec.EncodeN1QLValue(val, newBuf)
 		return append([]byte(nil), enc...), newBuf, e2
 	}
@@ -241,7 +241,7 @@ func NewMutationTopicRequest(
 		EndpointType:  proto.String(endpointType),
 		ReqTimestamps: make([]*TsVbuuid, 0),
 		Instances:     instances,
-		Version:       FeedVersion_watson.Enum(),
+		Version:       FeedVersion_alice.Enum(),
 	}
 }
 
@@ -555,7 +555,7 @@ func NewAddBucketsRequest(
 		Topic:         proto.String(topic),
 		ReqTimestamps: make([]*TsVbuuid, 0),
 		Instances:     instances,
-		Version:       FeedVersion_watson.Enum(),
+		Version:       FeedVersion_alice.Enum(),
 	}
 }
 
@@ -649,7 +649,7 @@ func NewAddInstancesRequest(
 	return &AddInstancesRequest{
 		Topic:     proto.String(topic),
 		Instances: instances,
-		Version:   FeedVersion_watson.Enum(),
+		Version:   FeedVersion_alice.Enum(),
 	}
 }
 
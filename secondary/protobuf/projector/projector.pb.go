@@ -16,15 +16,18 @@ type FeedVersion int32
 const (
 	FeedVersion_sherlock FeedVersion = 1
 	FeedVersion_watson   FeedVersion = 2
+	FeedVersion_alice    FeedVersion = 3
 )
 
 var FeedVersion_name = map[int32]string{
 	1: "sherlock",
 	2: "watson",
+	3: "alice",
 }
 var FeedVersion_value = map[string]int32{
 	"sherlock": 1,
 	"watson":   2,
+	"alice":    3,
 }
 
 func (x FeedVersion) Enum() *FeedVersion {
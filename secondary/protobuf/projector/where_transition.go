@@ -0,0 +1,53 @@
+package protobuf
+
+// WhereTransition describes how a mutation moves a document with respect
+// to the WHERE predicate of a partial index.
+type WhereTransition byte
+
+const (
+	// WhereUnknown old document is not available, hence it is not known
+	// whether the document was indexed before this mutation.
+	WhereUnknown WhereTransition = iota
+	// WhereInToIn document satisfies the predicate before and after.
+	WhereInToIn
+	// WhereOutToIn document starts satisfying the predicate.
+	WhereOutToIn
+	// WhereInToOut document no longer satisfies the predicate, its
+	// entry shall be removed from index.
+	WhereInToOut
+	// WhereOutToOut document satisfies the predicate neither before nor
+	// after, there is nothing to index or remove.
+	WhereOutToOut
+)
+
+func (t WhereTransition) String() string {
+	switch t {
+	case WhereInToIn:
+		return "in->in"
+	case WhereOutToIn:
+		return "out->in"
+	case WhereInToOut:
+		return "in->out"
+	case WhereOutToOut:
+		return "out->out"
+	}
+	return "unknown"
+}
+
+// whereTransition computes the transition from predicate values of old
+// and new document, `oldKnown` is false if old document is not available.
+func whereTransition(oldWhere, oldKnown, where bool) WhereTransition {
+	switch {
+	case !oldKnown && where:
+		return WhereOutToIn // treated as an insert, upsert handles both.
+	case !oldKnown:
+		return WhereUnknown
+	case oldWhere && where:
+		return WhereInToIn
+	case where:
+		return WhereOutToIn
+	case oldWhere:
+		return WhereInToOut
+	}
+	return WhereOutToOut
+}
@@ -1,6 +1,7 @@
 package querycmd
 
 import json "github.com/couchbase/indexing/secondary/common/json"
+import "context"
 import "flag"
 import "fmt"
 import "io"
@@ -11,6 +12,7 @@ import "net"
 import "errors"
 import "time"
 import "net/http"
+import "net/url"
 import "io/ioutil"
 import "os"
 
@@ -52,10 +54,15 @@ type Command struct {
 	Limit       int64
 	Distinct    bool
 	Consistency c.Consistency
+	PullRows    bool
 	// Configuration
 	ConfigKey string
 	ConfigVal string
-	Help      bool
+	// options for backup and restore
+	File   string
+	DryRun bool
+	Remap  string
+	Help   bool
 }
 
 // ParseArgs into Command object, return the list of arguments,
@@ -73,7 +80,7 @@ func ParseArgs(arguments []string) (*Command, []string, *flag.FlagSet, error) {
 	fset.StringVar(&cmdOptions.Server, "server", "127.0.0.1:8091", "Cluster server address")
 	fset.StringVar(&cmdOptions.Auth, "auth", "", "Auth user and password")
 	fset.StringVar(&cmdOptions.Bucket, "bucket", "", "Bucket name")
-	fset.StringVar(&cmdOptions.OpType, "type", "", "Command: scan|stats|scanAll|count|nodes|create|build|move|drop|list|config")
+	fset.StringVar(&cmdOptions.OpType, "type", "", "Command: scan|stats|scanAll|count|nodes|create|build|move|drop|list|config|verify|backup|restore")
 	fset.StringVar(&cmdOptions.IndexName, "index", "", "Index name")
 	// options for create-index
 	fset.StringVar(&cmdOptions.WhereStr, "where", "", "where clause for create index")
@@ -91,10 +98,15 @@ func ParseArgs(arguments []string) (*Command, []string, *flag.FlagSet, error) {
 	fset.BoolVar(&cmdOptions.Distinct, "distinct", false, "Only distinct entries")
 	fset.BoolVar(&cmdOptions.Help, "h", false, "print help")
 	fset.BoolVar(&useSessionCons, "consistency", false, "Use session consistency")
+	fset.BoolVar(&cmdOptions.PullRows, "rows", false, "Pull scan results through row iterator")
 	// options for setting configuration
 	fset.StringVar(&cmdOptions.ConfigKey, "ckey", "", "Config key")
 	fset.StringVar(&cmdOptions.ConfigVal, "cval", "", "Config value")
 	fset.StringVar(&cmdOptions.Using, "using", c.PlasmaDB, "storage type to use")
+	// backup and restore, -bucket and -index filter the indexes to restore
+	fset.StringVar(&cmdOptions.File, "file", "", "Index metadata backup file")
+	fset.BoolVar(&cmdOptions.DryRun, "dryrun", false, "Show what restore would do")
+	fset.StringVar(&cmdOptions.Remap, "remap", "", "csv list of backup-bucket:bucket to restore into")
 
 	// not useful to expose in sherlock
 	cmdOptions.ExprType = "N1QL"
@@ -149,8 +161,12 @@ func ParseArgs(arguments []string) (*Command, []string, *flag.FlagSet, error) {
 
 	// setup cbauth
 	if cmdOptions.Auth != "" {
-		up := strings.Split(cmdOptions.Auth, ":")
-		_, err := cbauth.InternalRetryDefaultInit(cmdOptions.Server, up[0], up[1])
+		user, passwd, err := authCredentials(cmdOptions.Auth)
+		if err != nil {
+			logging.Fatalf("%v\n", err)
+			os.Exit(1)
+		}
+		_, err = cbauth.InternalRetryDefaultInit(cmdOptions.Server, user, passwd)
 		if err != nil {
 			logging.Fatalf("Failed to initialize cbauth: %s\n", err)
 			os.Exit(1)
@@ -287,6 +303,17 @@ func HandleCommand(
 		if err != nil {
 			state, err = client.IndexState(defnID)
 			fmt.Fprintf(w, "Index state: {%v, %v}\n", state, err)
+		} else if cmd.PullRows && cmd.Equal != nil {
+			equals := []c.SecondaryKey{cmd.Equal}
+			rows := client.LookupRows(
+				context.Background(), uint64(defnID), "", equals, distinct, limit,
+				cons, nil)
+			entries, err = pullRows(rows, verbose, w)
+		} else if cmd.PullRows {
+			rows := client.RangeRows(
+				context.Background(), uint64(defnID), "", low, high, incl, distinct, limit,
+				cons, nil)
+			entries, err = pullRows(rows, verbose, w)
 		} else if cmd.Equal != nil {
 			equals := []c.SecondaryKey{cmd.Equal}
 			client.Lookup(
@@ -318,6 +345,10 @@ func HandleCommand(
 		if err != nil {
 			state, err = client.IndexState(defnID)
 			fmt.Fprintf(w, "Index state: {%v, %v} \n", state, err)
+		} else if cmd.PullRows {
+			rows := client.ScanAllRows(
+				context.Background(), uint64(defnID), "", limit, cons, nil)
+			entries, err = pullRows(rows, verbose, w)
 		} else {
 			err = client.ScanAll(
 				uint64(defnID), "", limit, cons, nil, callb)
@@ -386,15 +417,8 @@ func HandleCommand(
 			adminurl = indexer.Adminport
 			break
 		}
-		host, sport, _ := net.SplitHostPort(adminurl)
-		iport, _ := strconv.Atoi(sport)
 		client := http.Client{}
-
-		//
-		// hack, fix this
-		//
-		ihttp := iport + 2
-		url := "http://" + host + ":" + strconv.Itoa(ihttp) + "/settings"
+		url := indexerHttpURL(adminurl, "/settings")
 
 		oreq, err := http.NewRequest("GET", url, nil)
 		if cmd.Auth != "" {
@@ -449,10 +473,223 @@ func HandleCommand(
 			pretty = strings.Replace(string(nbody), ",\"", ",\n\"", -1)
 			fmt.Printf("New Settings:\n%s\n", string(pretty))
 		}
+
+	case "verify":
+		nodes, err := client.Nodes()
+		if err != nil {
+			return err
+		}
+		client := http.Client{}
+		verified := 0
+		for _, indexer := range nodes {
+			params := url.Values{}
+			params.Set("bucket", bucket)
+			params.Set("index", iname)
+			params.Set("limit", strconv.FormatInt(limit, 10))
+			verifyurl := indexerHttpURL(indexer.Adminport, "/verifyIndex")
+			verifyurl += "?" + params.Encode()
+			req, err := http.NewRequest("GET", verifyurl, nil)
+			if err != nil {
+				return err
+			}
+			if cmd.Auth != "" {
+				user, passwd, err := authCredentials(cmd.Auth)
+				if err != nil {
+					return err
+				}
+				req.SetBasicAuth(user, passwd)
+			}
+			resp, err := client.Do(req)
+			if err != nil {
+				return err
+			}
+			body, err := ioutil.ReadAll(resp.Body)
+			resp.Body.Close()
+			if err != nil {
+				return err
+			} else if resp.StatusCode == http.StatusNotFound {
+				continue // index not hosted on this node
+			} else if resp.StatusCode != http.StatusOK {
+				return fmt.Errorf("%v: %s", indexer.Adminport, body)
+			}
+			fmt.Fprintf(w, "Verify index %v/%v on %v:\n%s\n", bucket, iname, indexer.Adminport, body)
+			verified++
+		}
+		if verified == 0 {
+			return fmt.Errorf("index %v/%v not found on any indexer", bucket, iname)
+		}
+
+	case "backup":
+		adminurl, err := anyAdminport(client)
+		if err != nil {
+			return err
+		}
+		url := indexerHttpURL(adminurl, "/getIndexMetadata")
+		if bucket != "" {
+			url += "?bucket=" + bucket
+		}
+		body, err := indexerHttpRequest(cmd, "GET", url, nil)
+		if err != nil {
+			return err
+		}
+		var resp struct {
+			Code   string          `json:"code"`
+			Error  string          `json:"error"`
+			Result json.RawMessage `json:"result"`
+		}
+		if err := json.Unmarshal(body, &resp); err != nil {
+			return err
+		} else if resp.Code == "error" {
+			return errors.New(resp.Error)
+		}
+		if err := ioutil.WriteFile(cmd.File, resp.Result, 0644); err != nil {
+			return err
+		}
+		fmt.Fprintf(w, "Index metadata written to %v\n", cmd.File)
+
+	case "restore":
+		adminurl, err := anyAdminport(client)
+		if err != nil {
+			return err
+		}
+		image, err := ioutil.ReadFile(cmd.File)
+		if err != nil {
+			return err
+		}
+		params := url.Values{}
+		params.Set("dryRun", strconv.FormatBool(cmd.DryRun))
+		if bucket != "" {
+			params.Set("bucket", bucket)
+		}
+		if iname != "" {
+			params.Set("index", iname)
+		}
+		if cmd.Remap != "" {
+			params.Set("remap", cmd.Remap)
+		}
+		endpoint := indexerHttpURL(adminurl, "/restoreIndexMetadata") + "?" + params.Encode()
+		body, err := indexerHttpRequest(cmd, "POST", endpoint, image)
+		if err != nil {
+			return err
+		}
+		var resp struct {
+			Code  string `json:"code"`
+			Error string `json:"error"`
+			Diff  []struct {
+				Bucket     string   `json:"bucket"`
+				Name       string   `json:"name"`
+				NewName    string   `json:"newName"`
+				ReplicaId  int      `json:"replicaId"`
+				Partitions []int    `json:"partitions"`
+				Action     string   `json:"action"`
+				Reason     string   `json:"reason"`
+				Hosts      []string `json:"hosts"`
+			} `json:"diff"`
+		}
+		if err := json.Unmarshal(body, &resp); err != nil {
+			return err
+		} else if resp.Code == "error" {
+			return errors.New(resp.Error)
+		}
+		if !cmd.DryRun {
+			fmt.Fprintf(w, "Index metadata restored from %v\n", cmd.File)
+			break
+		}
+		for _, diff := range resp.Diff {
+			fmt.Fprintf(w, "%-8s %v/%v replica %v", diff.Action, diff.Bucket, diff.Name, diff.ReplicaId)
+			if diff.NewName != "" {
+				fmt.Fprintf(w, " as %v", diff.NewName)
+			}
+			if len(diff.Partitions) > 0 {
+				fmt.Fprintf(w, " partitions %v", diff.Partitions)
+			}
+			if len(diff.Hosts) > 0 {
+				fmt.Fprintf(w, " on %v", strings.Join(diff.Hosts, ","))
+			}
+			if diff.Reason != "" {
+				fmt.Fprintf(w, " (%v)", diff.Reason)
+			}
+			fmt.Fprintln(w)
+		}
 	}
 	return err
 }
 
+// anyAdminport returns the adminport of one of the indexer nodes,
+// for requests served by every indexer.
+func anyAdminport(client *qclient.GsiClient) (string, error) {
+	nodes, err := client.Nodes()
+	if err != nil {
+		return "", err
+	}
+	for _, indexer := range nodes {
+		return indexer.Adminport, nil
+	}
+	return "", errors.New("no indexer node found")
+}
+
+// authCredentials splits `auth` of the form <user>:<password>.
+func authCredentials(auth string) (string, string, error) {
+	up := strings.SplitN(auth, ":", 2)
+	if len(up) != 2 {
+		return "", "", fmt.Errorf("invalid -auth %q, expected <user>:<password>", auth)
+	}
+	return up[0], up[1], nil
+}
+
+// indexerHttpRequest makes the http request with the credentials of
+// `cmd` and returns the response body.
+func indexerHttpRequest(cmd *Command, method, url string, body []byte) ([]byte, error) {
+	req, err := http.NewRequest(method, url, bytes.NewBuffer(body))
+	if err != nil {
+		return nil, err
+	}
+	if body != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	if cmd.Auth != "" {
+		user, passwd, err := authCredentials(cmd.Auth)
+		if err != nil {
+			return nil, err
+		}
+		req.SetBasicAuth(user, passwd)
+	}
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	return ioutil.ReadAll(resp.Body)
+}
+
+// indexerHttpURL return the http endpoint for `path` on the indexer
+// node listening at `adminurl`.
+func indexerHttpURL(adminurl, path string) string {
+	host, sport, _ := net.SplitHostPort(adminurl)
+	iport, _ := strconv.Atoi(sport)
+
+	//
+	// hack, fix this
+	//
+	ihttp := iport + 2
+	return "http://" + host + ":" + strconv.Itoa(ihttp) + path
+}
+
+// pullRows prints rows pulled from iterator and returns the number of
+// rows.
+func pullRows(rows *qclient.Rows, verbose bool, w io.Writer) (int, error) {
+	defer rows.Close()
+
+	entries := 0
+	for rows.Next() {
+		if verbose == false {
+			fmt.Fprintf(w, "%v ... %v\n", rows.Key(), string(rows.PrimaryKey()))
+		}
+		entries++
+	}
+	return entries, rows.Err()
+}
+
 func printIndexInfo(w io.Writer, index *mclient.IndexMetadata) {
 	defn := index.Definition
 	fmt.Fprintf(w, "Index:%s/%s, Id:%v, Using:%s, Exprs:%v, isPrimary:%v\n",
@@ -591,10 +828,22 @@ func validate(cmd *Command, fset *flag.FlagSet) error {
 		have = []string{"type", "server", "auth", "index", "bucket"}
 		dont = []string{"h", "where", "fields", "primary", "with", "indexes", "ckey", "cval"}
 
+	case "verify":
+		have = []string{"type", "server", "auth", "index", "bucket"}
+		dont = []string{"h", "where", "fields", "primary", "with", "indexes", "low", "high", "equal", "incl", "distinct", "ckey", "cval"}
+
 	case "config":
 		have = []string{"type", "server", "auth"}
 		dont = []string{"h", "index", "bucket", "where", "fields", "primary", "with", "indexes", "low", "high", "equal", "incl", "limit", "distinct"}
 
+	case "backup":
+		have = []string{"type", "server", "auth", "file"}
+		dont = []string{"h", "index", "where", "fields", "primary", "with", "indexes", "low", "high", "equal", "incl", "limit", "distinct", "ckey", "cval", "dryrun", "remap"}
+
+	case "restore":
+		have = []string{"type", "server", "auth", "file"}
+		dont = []string{"h", "where", "fields", "primary", "with", "indexes", "low", "high", "equal", "incl", "limit", "distinct", "ckey", "cval"}
+
 	default:
 		return fmt.Errorf("Specified operation type '%s' has no validation rule. Please add one to use.", cmd.OpType)
 	}
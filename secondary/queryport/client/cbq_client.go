@@ -233,6 +233,13 @@ func (b *cbqClient) GetScanport(
 	return []string{b.queryport}, defnID, nil, []int64{math.MaxInt64}, nil, 0, true
 }
 
+// GetHedgeScanport implements BridgeAccessor{} interface.
+func (b *cbqClient) GetHedgeScanport(defnID, instID uint64,
+	partitions []common.PartitionId) (string, uint64, int64, bool) {
+
+	return "", 0, 0, false
+}
+
 // GetIndexDefn implements BridgeAccessor{} interface.
 func (b *cbqClient) GetIndexDefn(defnID uint64) *common.IndexDefn {
 	panic("cbqClient does not implement GetIndexDefn")
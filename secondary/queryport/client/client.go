@@ -8,6 +8,7 @@
 // and limitations under the License.
 package client
 
+import "context"
 import "time"
 import "unsafe"
 import "io"
@@ -16,7 +17,9 @@ import "sync/atomic"
 import "fmt"
 
 import "github.com/couchbase/indexing/secondary/logging"
+import "github.com/couchbase/indexing/secondary/collatejson"
 import "github.com/couchbase/indexing/secondary/common"
+import json "github.com/couchbase/indexing/secondary/common/json"
 import mclient "github.com/couchbase/indexing/secondary/manager/client"
 import "github.com/couchbase/query/value"
 
@@ -51,6 +54,11 @@ type ResponseReader interface {
 // uskey - unmarshalled sec key (as byte)
 type ResponseSender func(pkey []byte, mskey []value.Value, uskey common.SecondaryKey) bool
 
+// BatchLookupHandler receives rows of BatchLookup, keyPos is the
+// position of the looked up key matching the row. Return false to
+// stop the lookup.
+type BatchLookupHandler func(keyPos int, skey common.SecondaryKey, pkey []byte) bool
+
 // ResponseHandlerFactory returns an instance of ResponseHandler
 type ResponseHandlerFactory func(id ResponseHandlerId, instId uint64, partitions []common.PartitionId) ResponseHandler
 
@@ -199,6 +207,12 @@ type BridgeAccessor interface {
 		skips map[common.IndexDefnId]bool) (queryport []string, targetDefnID uint64, targetInstID []uint64,
 		rollbackTime []int64, partition [][]common.PartitionId, numPartitions uint32, ok bool)
 
+	// GetHedgeScanport shall fetch queryport address of another replica
+	// that can serve `partitions` of index instance `instID`, to hedge
+	// a slow scan. Returns false if there is no such replica.
+	GetHedgeScanport(defnID, instID uint64, partitions []common.PartitionId) (queryport string,
+		targetInstID uint64, rollbackTime int64, ok bool)
+
 	// GetIndexDefn will return the index-definition structure for defnID.
 	GetIndexDefn(defnID uint64) *common.IndexDefn
 
@@ -347,6 +361,9 @@ type GsiAccessor interface {
 
 var useMetadataProvider = true
 
+// structured logger for scan requests
+var scanLogger = logging.Component("client")
+
 // IndexerService returns the status of the indexer node
 // as observed by the GsiClient.
 type IndexerService struct {
@@ -367,6 +384,7 @@ type GsiClient struct {
 	bucketHash   unsafe.Pointer // map[string]uint64 // bucket -> crc64
 	metaCh       chan bool      // listen to metadata changes
 	settings     *ClientSettings
+	hedger       *scanHedger
 	killch       chan bool
 }
 
@@ -393,6 +411,31 @@ func NewGsiClientWithSettings(
 	return c, nil
 }
 
+// NewGsiClientWithBridge returns client to access indexer nodes
+// advertised by `bridge`, instead of discovering them through metadata
+// provider. Scan clients are setup once for bridge's scanports, used
+// by standalone deployments where indexer nodes do not change.
+func NewGsiClientWithBridge(
+	cluster string, config common.Config,
+	bridge BridgeAccessor) (c *GsiClient, err error) {
+
+	c = &GsiClient{
+		cluster:      cluster,
+		config:       config,
+		bridge:       bridge,
+		queryClients: unsafe.Pointer(new(map[string]*GsiScanClient)),
+		metaCh:       make(chan bool, 1),
+		settings:     NewClientSettings(false),
+		killch:       make(chan bool, 1),
+	}
+	c.hedger = newScanHedger(c.settings)
+	atomic.StorePointer(&c.bucketHash, (unsafe.Pointer)(new(map[string]uint64)))
+	c.updateScanClients()
+	c.maxvb = -1
+	c.Refresh()
+	return c, nil
+}
+
 func (c *GsiClient) Bridge() BridgeAccessor {
 	return c.bridge
 }
@@ -572,6 +615,19 @@ func (c *GsiClient) Lookup(
 	return c.LookupInternal(defnID, requestId, values, distinct, limit, cons, vector, broker)
 }
 
+// LookupContext is same as Lookup, the scan is cancelled once ctx is
+// done and ctx.Err() is returned.
+func (c *GsiClient) LookupContext(ctx context.Context,
+	defnID uint64, requestId string, values []common.SecondaryKey,
+	distinct bool, limit int64,
+	cons common.Consistency, vector *TsConsistency,
+	callb ResponseHandler) (err error) {
+
+	broker := makeDefaultRequestBroker(callb)
+	broker.SetContext(ctx)
+	return c.LookupInternal(defnID, requestId, values, distinct, limit, cons, vector, broker)
+}
+
 // Lookup scan index between low and high.
 func (c *GsiClient) LookupInternal(
 	defnID uint64, requestId string, values []common.SecondaryKey,
@@ -627,6 +683,19 @@ func (c *GsiClient) Range(
 	return c.RangeInternal(defnID, requestId, low, high, inclusion, distinct, limit, cons, vector, broker)
 }
 
+// RangeContext is same as Range, the scan is cancelled once ctx is
+// done and ctx.Err() is returned.
+func (c *GsiClient) RangeContext(ctx context.Context,
+	defnID uint64, requestId string, low, high common.SecondaryKey,
+	inclusion Inclusion, distinct bool, limit int64,
+	cons common.Consistency, vector *TsConsistency,
+	callb ResponseHandler) (err error) {
+
+	broker := makeDefaultRequestBroker(callb)
+	broker.SetContext(ctx)
+	return c.RangeInternal(defnID, requestId, low, high, inclusion, distinct, limit, cons, vector, broker)
+}
+
 // Range scan index between low and high.
 func (c *GsiClient) RangeInternal(
 	defnID uint64, requestId string, low, high common.SecondaryKey,
@@ -700,6 +769,18 @@ func (c *GsiClient) ScanAll(
 	return c.ScanAllInternal(defnID, requestId, limit, cons, vector, broker)
 }
 
+// ScanAllContext is same as ScanAll, the scan is cancelled once ctx
+// is done and ctx.Err() is returned.
+func (c *GsiClient) ScanAllContext(ctx context.Context,
+	defnID uint64, requestId string, limit int64,
+	cons common.Consistency, vector *TsConsistency,
+	callb ResponseHandler) (err error) {
+
+	broker := makeDefaultRequestBroker(callb)
+	broker.SetContext(ctx)
+	return c.ScanAllInternal(defnID, requestId, limit, cons, vector, broker)
+}
+
 // ScanAll for full table scan.
 func (c *GsiClient) ScanAllInternal(
 	defnID uint64, requestId string, limit int64,
@@ -751,6 +832,19 @@ func (c *GsiClient) MultiScan(
 	return c.MultiScanInternal(defnID, requestId, scans, reverse, distinct, projection, offset, limit, cons, vector, broker)
 }
 
+// MultiScanContext is same as MultiScan, the scan is cancelled once
+// ctx is done and ctx.Err() is returned.
+func (c *GsiClient) MultiScanContext(ctx context.Context,
+	defnID uint64, requestId string, scans Scans, reverse,
+	distinct bool, projection *IndexProjection, offset, limit int64,
+	cons common.Consistency, vector *TsConsistency,
+	callb ResponseHandler) (err error) {
+
+	broker := makeDefaultRequestBroker(callb)
+	broker.SetContext(ctx)
+	return c.MultiScanInternal(defnID, requestId, scans, reverse, distinct, projection, offset, limit, cons, vector, broker)
+}
+
 func (c *GsiClient) MultiScanInternal(
 	defnID uint64, requestId string, scans Scans, reverse,
 	distinct bool, projection *IndexProjection, offset, limit int64,
@@ -777,6 +871,7 @@ func (c *GsiClient) MultiScanInternal(
 			return err, false
 		}
 
+		scans := broker.GetScans(partitions)
 		if c.bridge.IsPrimary(uint64(index.DefnId)) {
 			return qc.MultiScanPrimary(
 				uint64(index.DefnId), requestId, scans, reverse, distinct,
@@ -805,6 +900,149 @@ func (c *GsiClient) MultiScanInternal(
 	return
 }
 
+// BatchLookup scans index for a batch of equality keys, making a single
+// request per indexer. If index is partitioned on the looked up keys,
+// each key is sent only to the partition owning it. Every row is passed
+// to callb along with the position of its key in `keys`.
+func (c *GsiClient) BatchLookup(
+	defnID uint64, requestId string, keys []common.SecondaryKey,
+	distinct bool, limit int64,
+	cons common.Consistency, vector *TsConsistency,
+	callb BatchLookupHandler) (err error) {
+
+	if c.bridge == nil {
+		return ErrorClientUninitialized
+	}
+	if len(keys) == 0 {
+		return nil
+	}
+
+	isPrimary := c.bridge.IsPrimary(defnID)
+
+	collation := ""
+	if defn := c.bridge.GetIndexDefn(defnID); defn != nil {
+		collation = defn.Collation
+	}
+	batch, err := newBatchKeys(collation)
+	if err != nil {
+		return err
+	}
+
+	scans := make(Scans, 0, len(keys))
+	for i, key := range keys {
+		if dup, err := batch.add(i, key); err != nil {
+			return err
+		} else if dup {
+			continue // duplicate keys are scanned once.
+		}
+
+		filters := make([]*CompositeElementFilter, 0, len(key))
+		for _, value := range key {
+			filters = append(filters, &CompositeElementFilter{Low: value, High: value, Inclusion: Both})
+		}
+		scans = append(scans, &Scan{Filter: filters})
+	}
+
+	handler := func(resp ResponseReader) bool {
+		skeys, pkeys, err := resp.GetEntries()
+		if err != nil {
+			return false
+		}
+		for i, pkey := range pkeys {
+			key := skeys[i]
+			if isPrimary {
+				key = common.SecondaryKey{string(pkey)}
+			}
+			cont, err := batch.match(key, func(pos int) bool {
+				return callb(pos, skeys[i], pkey)
+			})
+			if err != nil || !cont {
+				return false
+			}
+		}
+		return true
+	}
+
+	broker := makeDefaultRequestBroker(handler)
+	broker.SetRouteScans(true)
+	return c.MultiScanInternal(defnID, requestId, scans, false, distinct, nil, 0, limit, cons, vector, broker)
+}
+
+// batchKeys maps rows of BatchLookup to position of their keys in the
+// batch. Keys and rows are compared by their collatejson encoding, like
+// indexer does, so that numbers are matched by value and strings of a
+// collated index are matched by their collation sort key.
+type batchKeys struct {
+	codec     *collatejson.Codec
+	positions map[string][]int // position of keys, by their encoding.
+	lengths   []int            // distinct number of fields in keys.
+	buf       []byte
+}
+
+func newBatchKeys(collation string) (*batchKeys, error) {
+	codec := collatejson.NewCodec(16)
+	if collation != "" {
+		if err := codec.SetCollation(collation); err != nil {
+			return nil, err
+		}
+	}
+	batch := &batchKeys{codec: codec, positions: make(map[string][]int)}
+	return batch, nil
+}
+
+func (b *batchKeys) encode(key common.SecondaryKey) ([]byte, error) {
+	data, err := json.Marshal(key)
+	if err != nil {
+		return nil, err
+	}
+	if need := len(data)*9 + 16; cap(b.buf) < need {
+		b.buf = make([]byte, 0, need)
+	}
+	return b.codec.EncodeBound(data, b.buf[:0], collatejson.TieNone)
+}
+
+// add key at position pos of the batch, returns true if an equal key
+// was added before.
+func (b *batchKeys) add(pos int, key common.SecondaryKey) (bool, error) {
+	code, err := b.encode(key)
+	if err != nil {
+		return false, err
+	}
+	positions, dup := b.positions[string(code)]
+	b.positions[string(code)] = append(positions, pos)
+	if !dup {
+		found := false
+		for _, n := range b.lengths {
+			found = found || n == len(key)
+		}
+		if !found {
+			b.lengths = append(b.lengths, len(key))
+		}
+	}
+	return dup, nil
+}
+
+// match calls callb with position of every key in the batch that
+// is equal to the leading fields of row key, returns false if callb
+// returned false.
+func (b *batchKeys) match(key common.SecondaryKey, callb func(pos int) bool) (bool, error) {
+	for _, n := range b.lengths {
+		if n > len(key) {
+			continue
+		}
+		code, err := b.encode(key[:n])
+		if err != nil {
+			return false, err
+		}
+		for _, pos := range b.positions[string(code)] {
+			if !callb(pos) {
+				return false, nil
+			}
+		}
+	}
+	return true, nil
+}
+
 func (c *GsiClient) CountLookup(
 	defnID uint64, requestId string, values []common.SecondaryKey,
 	cons common.Consistency, vector *TsConsistency) (count int64, err error) {
@@ -813,6 +1051,17 @@ func (c *GsiClient) CountLookup(
 	return c.CountLookupInternal(defnID, requestId, values, cons, vector, broker)
 }
 
+// CountLookupContext is same as CountLookup, the count is cancelled
+// once ctx is done and ctx.Err() is returned.
+func (c *GsiClient) CountLookupContext(ctx context.Context,
+	defnID uint64, requestId string, values []common.SecondaryKey,
+	cons common.Consistency, vector *TsConsistency) (count int64, err error) {
+
+	broker := makeDefaultRequestBroker(nil)
+	broker.SetContext(ctx)
+	return c.CountLookupInternal(defnID, requestId, values, cons, vector, broker)
+}
+
 // CountLookup to count number entries for given set of keys.
 func (c *GsiClient) CountLookupInternal(
 	defnID uint64, requestId string, values []common.SecondaryKey,
@@ -875,6 +1124,19 @@ func (c *GsiClient) CountRange(
 	return c.CountRangeInternal(defnID, requestId, low, high, inclusion, cons, vector, broker)
 }
 
+// CountRangeContext is same as CountRange, the count is cancelled
+// once ctx is done and ctx.Err() is returned.
+func (c *GsiClient) CountRangeContext(ctx context.Context,
+	defnID uint64, requestId string,
+	low, high common.SecondaryKey,
+	inclusion Inclusion,
+	cons common.Consistency, vector *TsConsistency) (count int64, err error) {
+
+	broker := makeDefaultRequestBroker(nil)
+	broker.SetContext(ctx)
+	return c.CountRangeInternal(defnID, requestId, low, high, inclusion, cons, vector, broker)
+}
+
 // CountRange to count number entries in the given range.
 func (c *GsiClient) CountRangeInternal(
 	defnID uint64, requestId string,
@@ -944,6 +1206,18 @@ func (c *GsiClient) MultiScanCount(
 	return c.MultiScanCountInternal(defnID, requestId, scans, distinct, cons, vector, broker)
 }
 
+// MultiScanCountContext is same as MultiScanCount, the count is
+// cancelled once ctx is done and ctx.Err() is returned.
+func (c *GsiClient) MultiScanCountContext(ctx context.Context,
+	defnID uint64, requestId string,
+	scans Scans, distinct bool,
+	cons common.Consistency, vector *TsConsistency) (count int64, err error) {
+
+	broker := makeDefaultRequestBroker(nil)
+	broker.SetContext(ctx)
+	return c.MultiScanCountInternal(defnID, requestId, scans, distinct, cons, vector, broker)
+}
+
 func (c *GsiClient) MultiScanCountInternal(
 	defnID uint64, requestId string,
 	scans Scans, distinct bool,
@@ -1000,6 +1274,21 @@ func (c *GsiClient) Scan3(
 		projection, offset, limit, groupAggr, indexOrder, cons, vector, broker)
 }
 
+// Scan3Context is same as Scan3, the scan is cancelled once ctx is
+// done and ctx.Err() is returned.
+func (c *GsiClient) Scan3Context(ctx context.Context,
+	defnID uint64, requestId string, scans Scans, reverse,
+	distinct bool, projection *IndexProjection, offset, limit int64,
+	groupAggr *GroupAggr, indexOrder *IndexKeyOrder,
+	cons common.Consistency, vector *TsConsistency,
+	callb ResponseHandler) (err error) {
+
+	broker := makeDefaultRequestBroker(callb)
+	broker.SetContext(ctx)
+	return c.Scan3Internal(defnID, requestId, scans, reverse, distinct,
+		projection, offset, limit, groupAggr, indexOrder, cons, vector, broker)
+}
+
 func (c *GsiClient) Scan3Internal(
 	defnID uint64, requestId string, scans Scans, reverse,
 	distinct bool, projection *IndexProjection, offset, limit int64,
@@ -1204,12 +1493,43 @@ func (c *GsiClient) makeScanClient(scanport string) *GsiScanClient {
 	return nil
 }
 
+// timeit feeds response time of a scan to load heuristics and to
+// hedge delay.
+func (c *GsiClient) timeit(instID uint64, partitionId common.PartitionId, value float64) {
+	c.bridge.Timeit(instID, partitionId, value)
+	if c.hedger != nil {
+		c.hedger.record(value)
+	}
+}
+
+// hedgeTarget locates another replica to hedge a slow scan.
+func (c *GsiClient) hedgeTarget(defnID, instID uint64,
+	partitions []common.PartitionId) (*GsiScanClient, uint64, int64, bool) {
+
+	queryport, targetInstID, rollbackTime, ok := c.bridge.GetHedgeScanport(defnID, instID, partitions)
+	if !ok {
+		return nil, 0, 0, false
+	}
+	client := c.makeScanClient(queryport)
+	return client, targetInstID, rollbackTime, client != nil
+}
+
+// HedgeStats returns number of scans hedged to another replica and
+// number of those where the other replica responded first.
+func (c *GsiClient) HedgeStats() (fired, won int64) {
+	if c.hedger == nil {
+		return 0, 0
+	}
+	return c.hedger.stats()
+}
+
 func (c *GsiClient) doScan(defnID uint64, requestId string, broker *RequestBroker) (int64, error) {
 
 	var excludes map[common.IndexDefnId]map[common.PartitionId]map[uint64]bool
 	var err error
 
-	broker.SetResponseTimer(c.bridge.Timeit)
+	broker.SetResponseTimer(c.timeit)
+	broker.setHedger(c.hedger, c.hedgeTarget)
 	skips := make(map[common.IndexDefnId]bool)
 
 	wait := c.config["retryIntervalScanport"].Int()
@@ -1218,12 +1538,21 @@ func (c *GsiClient) doScan(defnID uint64, requestId string, broker *RequestBroke
 	for i := 0; true; {
 		foundScanport := false
 
+		// cancelled scans are not retried.
+		if err := broker.ctxErr(); err != nil {
+			return 0, err
+		}
+
 		if queryports, targetDefnID, targetInstIds, rollbackTimes, partitions, numPartitions, ok := c.bridge.GetScanport(defnID, excludes, skips); ok {
 
 			index := c.bridge.GetIndexDefn(targetDefnID)
 			count, scan_errs, partial, refresh := broker.scatter(c.makeScanClient, index, queryports, targetInstIds,
 				rollbackTimes, partitions, numPartitions, c.settings)
 
+			if err := broker.ctxErr(); err != nil {
+				return 0, err
+			}
+
 			if !refresh {
 				foundScanport = true
 
@@ -1249,7 +1578,8 @@ func (c *GsiClient) doScan(defnID uint64, requestId string, broker *RequestBroke
 
 				if len(queryports) == len(partitions) && len(queryports) == len(targetInstIds) {
 					for i, _ := range queryports {
-						logging.Warnf("scan failed: requestId %v queryport %v inst %v partition %v", requestId, queryports[i], targetInstIds[i], partitions[i])
+						log := scanLogger.WithIndex(index.Bucket, index.Name, uint64(targetInstIds[i]))
+						log.WithReqId(requestId).Warnf("scan failed: queryport %v partition %v", queryports[i], partitions[i])
 					}
 				}
 			}
@@ -1274,7 +1604,9 @@ func (c *GsiClient) doScan(defnID uint64, requestId string, broker *RequestBroke
 				"Fail to find indexers to satisfy query request.  Trying scan again for index %v, reqId:%v : %v ...\n",
 				defnID, requestId, err)
 			c.updateScanClients()
-			time.Sleep(time.Duration(wait) * time.Millisecond)
+			if err := broker.wait(time.Duration(wait) * time.Millisecond); err != nil {
+				return 0, err
+			}
 			continue
 		}
 
@@ -1401,6 +1733,7 @@ func makeWithMetaProvider(
 		settings:     NewClientSettings(needRefresh),
 		killch:       make(chan bool, 1),
 	}
+	c.hedger = newScanHedger(c.settings)
 	atomic.StorePointer(&c.bucketHash, (unsafe.Pointer)(new(map[string]uint64)))
 	c.bridge, err = newMetaBridgeClient(cluster, config, c.metaCh, c.settings)
 	if err != nil {
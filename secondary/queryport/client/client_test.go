@@ -0,0 +1,89 @@
+package client
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/couchbase/indexing/secondary/common"
+	json "github.com/couchbase/indexing/secondary/common/json"
+)
+
+func matchBatchKeys(t *testing.T, b *batchKeys, key common.SecondaryKey) []int {
+	var positions []int
+	_, err := b.match(key, func(pos int) bool {
+		positions = append(positions, pos)
+		return true
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return positions
+}
+
+func TestBatchKeys(t *testing.T) {
+	b, err := newBatchKeys("")
+	if err != nil {
+		t.Fatal(err)
+	}
+	keys := []common.SecondaryKey{
+		common.SecondaryKey{10.5},
+		common.SecondaryKey{"bob", int64(20)},
+		common.SecondaryKey{10.5},
+	}
+	for i, key := range keys {
+		dup, err := b.add(i, key)
+		if err != nil {
+			t.Fatal(err)
+		} else if dup != (i == 2) {
+			t.Errorf("unexpected duplicate %v for key %v", dup, key)
+		}
+	}
+
+	testcases := []struct {
+		row       common.SecondaryKey
+		positions []int
+	}{
+		// numbers are matched by value, not by their text.
+		{common.SecondaryKey{json.Number("1.05e1")}, []int{0, 2}},
+		{common.SecondaryKey{10.5, "x"}, []int{0, 2}},
+		{common.SecondaryKey{"bob", float64(20)}, []int{1}},
+		{common.SecondaryKey{"Bob", int64(20)}, nil},
+		{common.SecondaryKey{"bob"}, nil},
+	}
+	for _, tc := range testcases {
+		positions := matchBatchKeys(t, b, tc.row)
+		if !reflect.DeepEqual(positions, tc.positions) {
+			t.Errorf("row %v expected %v, got %v", tc.row, tc.positions, positions)
+		}
+	}
+
+	// callback can stop the match.
+	cont, err := b.match(keys[0], func(pos int) bool { return false })
+	if err != nil || cont {
+		t.Errorf("expected match to stop, got %v %v", cont, err)
+	}
+}
+
+func TestBatchKeysCollated(t *testing.T) {
+	b, err := newBatchKeys("en_ci")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := b.add(0, common.SecondaryKey{"bob", int64(20)}); err != nil {
+		t.Fatal(err)
+	}
+
+	// rows equal by collation match the key.
+	for _, row := range []common.SecondaryKey{
+		common.SecondaryKey{"bob", int64(20)},
+		common.SecondaryKey{"Bob", int64(20)},
+		common.SecondaryKey{"BOB", 20.0},
+	} {
+		if positions := matchBatchKeys(t, b, row); !reflect.DeepEqual(positions, []int{0}) {
+			t.Errorf("row %v expected to match, got %v", row, positions)
+		}
+	}
+	if positions := matchBatchKeys(t, b, common.SecondaryKey{"bobby", int64(20)}); positions != nil {
+		t.Errorf("unexpected match %v", positions)
+	}
+}
@@ -0,0 +1,136 @@
+// Copyright (c) 2014 Couchbase, Inc.
+// Licensed under the Apache License, Version 2.0 (the "License"); you may not use this file
+// except in compliance with the License. You may obtain a copy of the License at
+//   http://www.apache.org/licenses/LICENSE-2.0
+// Unless required by applicable law or agreed to in writing, software distributed under the
+// License is distributed on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND,
+// either express or implied. See the License for the specific language governing permissions
+// and limitations under the License.
+
+package client
+
+import (
+	"sort"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/couchbase/indexing/secondary/common"
+)
+
+// number of recent response times used to compute hedge delay.
+const hedgeSamples = 256
+
+// minimum number of response times required before hedging, delay is
+// re-computed once as many new response times are recorded.
+const hedgeMinSamples = 16
+
+// hedgeTarget returns a scan client for another replica of the index
+// instance serving `partitions`, along with the replica's instance id
+// and rollback time. Returns false if there is no such replica.
+type hedgeTarget func(defnID, instID uint64, partitions []common.PartitionId) (*GsiScanClient, uint64, int64, bool)
+
+//
+// scanHedger decides when a slow scan shall be issued to another
+// replica. Delay is a percentile of recently observed response times
+// and the fraction of hedged scans is capped by settings.
+//
+type scanHedger struct {
+	// stats
+	scans int64
+	fired int64
+	won   int64
+
+	settings *ClientSettings
+
+	mu      sync.Mutex
+	samples []float64 // ring buffer of response times, in nanoseconds
+	next    int
+	fresh   int           // samples recorded since delay was computed
+	percent float64       // percentile used to compute delay
+	delayed time.Duration // computed delay
+	sorted  []float64     // scratch buffer to compute percentile
+}
+
+func newScanHedger(settings *ClientSettings) *scanHedger {
+	return &scanHedger{
+		settings: settings,
+		samples:  make([]float64, 0, hedgeSamples),
+		sorted:   make([]float64, 0, hedgeSamples),
+	}
+}
+
+// record a response time, in nanoseconds.
+func (h *scanHedger) record(value float64) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	if len(h.samples) < hedgeSamples {
+		h.samples = append(h.samples, value)
+	} else {
+		h.samples[h.next] = value
+	}
+	h.next = (h.next + 1) % hedgeSamples
+	h.fresh++
+}
+
+// delay returns how long to wait for the first response before
+// hedging. Returns false if hedging is disabled or there are not
+// enough samples to tell a slow response.
+func (h *scanHedger) delay() (time.Duration, bool) {
+	if h == nil || h.settings == nil || !h.settings.HedgeEnabled() {
+		return 0, false
+	}
+
+	percent := h.settings.HedgePercentile()
+
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	if len(h.samples) < hedgeMinSamples {
+		return 0, false
+	}
+	if h.fresh >= hedgeMinSamples || h.percent != percent {
+		h.sorted = append(h.sorted[:0], h.samples...)
+		sort.Float64s(h.sorted)
+		pos := int(float64(len(h.sorted)-1) * percent / 100)
+		h.delayed, h.percent, h.fresh = time.Duration(h.sorted[pos]), percent, 0
+	}
+
+	delay := h.delayed
+	if min := h.settings.HedgeMinDelay(); delay < min {
+		delay = min
+	}
+	return delay, true
+}
+
+// started counts a scan eligible for hedging.
+func (h *scanHedger) started() {
+	atomic.AddInt64(&h.scans, 1)
+}
+
+// allow reserves a hedge if the rate of hedged scans stays within
+// max_rate.
+func (h *scanHedger) allow() bool {
+	scans := atomic.LoadInt64(&h.scans)
+	limit := int64(h.settings.HedgeMaxRate() * float64(scans))
+	for {
+		fired := atomic.LoadInt64(&h.fired)
+		if fired+1 > limit {
+			return false
+		}
+		if atomic.CompareAndSwapInt64(&h.fired, fired, fired+1) {
+			return true
+		}
+	}
+}
+
+// hedgeWon counts a hedge whose stream started before the original.
+func (h *scanHedger) hedgeWon() {
+	atomic.AddInt64(&h.won, 1)
+}
+
+// stats returns number of scans hedged and number of hedges that won.
+func (h *scanHedger) stats() (fired, won int64) {
+	return atomic.LoadInt64(&h.fired), atomic.LoadInt64(&h.won)
+}
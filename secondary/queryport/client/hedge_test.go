@@ -0,0 +1,99 @@
+package client
+
+import (
+	"math"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func newTestHedger(percent, maxRate float64, minDelay time.Duration) *scanHedger {
+	settings := NewClientSettings(false)
+	atomic.StoreInt32(&settings.hedge, 1)
+	atomic.StoreUint64(&settings.hedgePercent, math.Float64bits(percent))
+	atomic.StoreUint64(&settings.hedgeMaxRate, math.Float64bits(maxRate))
+	atomic.StoreInt64(&settings.hedgeMinDelay, int64(minDelay))
+	return newScanHedger(settings)
+}
+
+func TestHedgeDelay(t *testing.T) {
+	h := newTestHedger(90, 0.1, 0)
+
+	for i := 1; i < hedgeMinSamples; i++ {
+		h.record(float64(i * int(time.Millisecond)))
+	}
+	if _, ok := h.delay(); ok {
+		t.Fatalf("expected no hedging before %v samples", hedgeMinSamples)
+	}
+
+	// 1ms to 100ms
+	for i := hedgeMinSamples; i <= 100; i++ {
+		h.record(float64(i * int(time.Millisecond)))
+	}
+	if delay, ok := h.delay(); !ok || delay != 90*time.Millisecond {
+		t.Fatalf("expected 90th percentile of 90ms, got %v %v", delay, ok)
+	}
+
+	// delay is not re-computed for every new sample.
+	h.record(float64(time.Second))
+	if delay, _ := h.delay(); delay != 90*time.Millisecond {
+		t.Errorf("expected cached delay of 90ms, got %v", delay)
+	}
+	for i := 1; i < hedgeMinSamples; i++ {
+		h.record(float64(time.Second))
+	}
+	if delay, _ := h.delay(); delay <= 90*time.Millisecond {
+		t.Errorf("expected delay to grow, got %v", delay)
+	}
+
+	// percentile change takes effect right away.
+	atomic.StoreUint64(&h.settings.hedgePercent, math.Float64bits(50))
+	if delay, _ := h.delay(); delay >= 90*time.Millisecond {
+		t.Errorf("expected delay for 50th percentile, got %v", delay)
+	}
+
+	atomic.StoreInt64(&h.settings.hedgeMinDelay, int64(time.Hour))
+	if delay, _ := h.delay(); delay != time.Hour {
+		t.Errorf("expected min delay, got %v", delay)
+	}
+
+	atomic.StoreInt32(&h.settings.hedge, 0)
+	if _, ok := h.delay(); ok {
+		t.Errorf("expected no hedging when disabled")
+	}
+}
+
+func TestHedgeRing(t *testing.T) {
+	h := newTestHedger(100, 0.1, 0)
+	for i := 0; i < 2*hedgeSamples; i++ {
+		h.record(float64(i))
+	}
+	if len(h.samples) != hedgeSamples {
+		t.Fatalf("expected %v samples, got %v", hedgeSamples, len(h.samples))
+	}
+	// only recent samples are kept.
+	if delay, _ := h.delay(); delay != time.Duration(2*hedgeSamples-1) {
+		t.Errorf("expected %v, got %v", 2*hedgeSamples-1, delay)
+	}
+}
+
+func TestHedgeMaxRate(t *testing.T) {
+	h := newTestHedger(90, 0.1, 0)
+	for i := 0; i < 100; i++ {
+		h.started()
+	}
+	allowed := 0
+	for i := 0; i < 100; i++ {
+		if h.allow() {
+			allowed++
+		}
+	}
+	if allowed != 10 {
+		t.Errorf("expected 10 hedges for 100 scans, got %v", allowed)
+	}
+
+	h.hedgeWon()
+	if fired, won := h.stats(); fired != 10 || won != 1 {
+		t.Errorf("unexpected stats %v %v", fired, won)
+	}
+}
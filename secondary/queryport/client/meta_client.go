@@ -386,6 +386,69 @@ func (b *metadataClient) GetScanport(defnID uint64, excludes map[common.IndexDef
 	return qp, targetDefnID, in, rt, pid, numPartitions, true
 }
 
+// GetHedgeScanport implements BridgeAccessor{} interface.
+func (b *metadataClient) GetHedgeScanport(defnID, instID uint64,
+	partitions []common.PartitionId) (queryport string, targetInstID uint64, rollbackTime int64, ok bool) {
+
+	if len(partitions) == 0 {
+		return "", 0, 0, false
+	}
+
+	currmeta := (*indexTopology)(atomic.LoadPointer(&b.indexers))
+
+	// indexer currently serving the scan
+	var origin common.IndexerId
+	if inst, ok := currmeta.insts[common.IndexInstId(instID)]; ok {
+		origin = inst.IndexerId[partitions[0]]
+	}
+
+	replicas := make([]uint64, 0, len(currmeta.replicas[common.IndexDefnId(defnID)]))
+	for _, replicaID := range currmeta.replicas[common.IndexDefnId(defnID)] {
+		if uint64(replicaID) != instID {
+			replicas = append(replicas, uint64(replicaID))
+		}
+	}
+	if len(replicas) == 0 {
+		return "", 0, 0, false
+	}
+	rollbackTimesList := b.pruneStaleReplica(replicas, nil)
+
+	// pick a replica hosting all partitions on a single indexer,
+	// other than the one serving the scan.
+	start := rand.Intn(len(replicas))
+	for i := range replicas {
+		n := (start + i) % len(replicas)
+		inst, ok := currmeta.insts[common.IndexInstId(replicas[n])]
+		if !ok {
+			continue
+		}
+
+		indexerId, ok := inst.IndexerId[partitions[0]]
+		if !ok || indexerId == origin {
+			continue
+		}
+
+		found := true
+		for _, partnId := range partitions {
+			id, ok1 := inst.IndexerId[partnId]
+			t, ok2 := rollbackTimesList[n][partnId]
+			if !ok1 || id != indexerId || !ok2 || t == math.MaxInt64 {
+				found = false
+				break
+			}
+		}
+		if !found {
+			continue
+		}
+
+		if queryport, ok = currmeta.queryports[indexerId]; ok {
+			rollbackTime = rollbackTimesList[n][partitions[0]]
+			return queryport, replicas[n], rollbackTime, true
+		}
+	}
+	return "", 0, 0, false
+}
+
 // Timeit implement BridgeAccessor{} interface.
 func (b *metadataClient) Timeit(instID uint64, partitionId common.PartitionId, value float64) {
 
@@ -515,11 +578,22 @@ func (b *metadataClient) equivalentIndex(
 		d1.PartitionScheme != d2.PartitionScheme ||
 		d1.HashScheme != d2.HashScheme ||
 		d1.WhereExpr != d2.WhereExpr ||
+		d1.DocKeyPattern != d2.DocKeyPattern ||
 		d1.RetainDeletedXATTR != d2.RetainDeletedXATTR {
 
 		return false
 	}
 
+	if len(d1.DocKeyPrefixes) != len(d2.DocKeyPrefixes) {
+		return false
+	}
+
+	for i, s1 := range d1.DocKeyPrefixes {
+		if s1 != d2.DocKeyPrefixes[i] {
+			return false
+		}
+	}
+
 	if len(d1.SecExprs) != len(d2.SecExprs) {
 		return false
 	}
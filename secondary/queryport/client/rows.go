@@ -0,0 +1,192 @@
+// Copyright (c) 2014 Couchbase, Inc.
+// Licensed under the Apache License, Version 2.0 (the "License"); you may not use this file
+// except in compliance with the License. You may obtain a copy of the License at
+//   http://www.apache.org/licenses/LICENSE-2.0
+// Unless required by applicable law or agreed to in writing, software distributed under the
+// License is distributed on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND,
+// either express or implied. See the License for the specific language governing permissions
+// and limitations under the License.
+
+package client
+
+import (
+	"context"
+
+	"github.com/couchbase/indexing/secondary/common"
+)
+
+// number of rows buffered by Rows before the scan is blocked.
+const rowsBufferSize = 256
+
+type rowEntry struct {
+	skey common.SecondaryKey
+	pkey []byte
+}
+
+//
+// Rows is a pull-style iterator over the result of a scan. Rows are
+// buffered up to a bounded size, beyond which the scan is blocked
+// until caller pulls more rows.
+//
+//	rows := client.RangeRows(ctx, defnID, ...)
+//	defer rows.Close()
+//	for rows.Next() {
+//		skey, pkey := rows.Key(), rows.PrimaryKey()
+//		...
+//	}
+//	if err := rows.Err(); err != nil {
+//		...
+//	}
+//
+// Rows is not safe for concurrent use.
+//
+type Rows struct {
+	parent context.Context
+	ctx    context.Context
+	cancel context.CancelFunc
+	rowch  chan rowEntry
+	err    error // valid after rowch is closed
+	closed bool
+	row    rowEntry
+}
+
+// newRows starts scan in the background. Scan is expected to call
+// callb for every row and to return once ctx is done.
+func newRows(ctx context.Context, size int,
+	scan func(ctx context.Context, callb ResponseHandler) error) *Rows {
+
+	if ctx == nil {
+		ctx = context.Background()
+	}
+	r := &Rows{parent: ctx, rowch: make(chan rowEntry, size)}
+	r.ctx, r.cancel = context.WithCancel(ctx)
+
+	callb := func(resp ResponseReader) bool {
+		skeys, pkeys, err := resp.GetEntries()
+		if err != nil {
+			return false
+		}
+		for i, pkey := range pkeys {
+			select {
+			case r.rowch <- rowEntry{skey: skeys[i], pkey: pkey}:
+			case <-r.ctx.Done():
+				return false
+			}
+		}
+		return true
+	}
+
+	go func() {
+		r.err = scan(r.ctx, callb)
+		close(r.rowch)
+	}()
+	return r
+}
+
+// Next advances to the next row, returns false when there are no more
+// rows or scan has failed, in which case Err returns the error.
+func (r *Rows) Next() bool {
+	if r.closed {
+		return false
+	}
+	row, ok := <-r.rowch
+	if !ok {
+		r.cancel()
+		return false
+	}
+	r.row = row
+	return true
+}
+
+// Key returns the secondary key of current row.
+func (r *Rows) Key() common.SecondaryKey {
+	return r.row.skey
+}
+
+// PrimaryKey returns the primary key, that is the document id, of
+// current row.
+func (r *Rows) PrimaryKey() []byte {
+	return r.row.pkey
+}
+
+// Err returns the error that ended the iteration, if any, shall be
+// called after Next has returned false or after Close. Closing Rows
+// before the scan is over is not an error.
+func (r *Rows) Err() error {
+	if r.closed && r.err == context.Canceled && r.parent.Err() == nil {
+		return nil
+	}
+	return r.err
+}
+
+// Close cancels the scan if it is still in progress and waits for it
+// to release its connections. Close is idempotent.
+func (r *Rows) Close() error {
+	if r.closed {
+		return nil
+	}
+	r.closed = true
+	r.cancel()
+	for range r.rowch {
+		// drain until scan has returned.
+	}
+	return nil
+}
+
+// LookupRows is same as LookupContext, rows are pulled through Rows.
+func (c *GsiClient) LookupRows(ctx context.Context,
+	defnID uint64, requestId string, values []common.SecondaryKey,
+	distinct bool, limit int64,
+	cons common.Consistency, vector *TsConsistency) *Rows {
+
+	return newRows(ctx, rowsBufferSize, func(ctx context.Context, callb ResponseHandler) error {
+		return c.LookupContext(ctx, defnID, requestId, values, distinct, limit, cons, vector, callb)
+	})
+}
+
+// RangeRows is same as RangeContext, rows are pulled through Rows.
+func (c *GsiClient) RangeRows(ctx context.Context,
+	defnID uint64, requestId string, low, high common.SecondaryKey,
+	inclusion Inclusion, distinct bool, limit int64,
+	cons common.Consistency, vector *TsConsistency) *Rows {
+
+	return newRows(ctx, rowsBufferSize, func(ctx context.Context, callb ResponseHandler) error {
+		return c.RangeContext(ctx, defnID, requestId, low, high, inclusion, distinct, limit, cons, vector, callb)
+	})
+}
+
+// ScanAllRows is same as ScanAllContext, rows are pulled through Rows.
+func (c *GsiClient) ScanAllRows(ctx context.Context,
+	defnID uint64, requestId string, limit int64,
+	cons common.Consistency, vector *TsConsistency) *Rows {
+
+	return newRows(ctx, rowsBufferSize, func(ctx context.Context, callb ResponseHandler) error {
+		return c.ScanAllContext(ctx, defnID, requestId, limit, cons, vector, callb)
+	})
+}
+
+// MultiScanRows is same as MultiScanContext, rows are pulled through
+// Rows.
+func (c *GsiClient) MultiScanRows(ctx context.Context,
+	defnID uint64, requestId string, scans Scans, reverse,
+	distinct bool, projection *IndexProjection, offset, limit int64,
+	cons common.Consistency, vector *TsConsistency) *Rows {
+
+	return newRows(ctx, rowsBufferSize, func(ctx context.Context, callb ResponseHandler) error {
+		return c.MultiScanContext(ctx, defnID, requestId, scans, reverse, distinct,
+			projection, offset, limit, cons, vector, callb)
+	})
+}
+
+// Scan3Rows is same as Scan3Context, rows are pulled through Rows.
+func (c *GsiClient) Scan3Rows(ctx context.Context,
+	defnID uint64, requestId string, scans Scans, reverse,
+	distinct bool, projection *IndexProjection, offset, limit int64,
+	groupAggr *GroupAggr, indexOrder *IndexKeyOrder,
+	cons common.Consistency, vector *TsConsistency) *Rows {
+
+	return newRows(ctx, rowsBufferSize, func(ctx context.Context, callb ResponseHandler) error {
+		return c.Scan3Context(ctx, defnID, requestId, scans, reverse, distinct,
+			projection, offset, limit, groupAggr, indexOrder, cons, vector, callb)
+	})
+}
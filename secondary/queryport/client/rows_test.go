@@ -0,0 +1,154 @@
+package client
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/couchbase/indexing/secondary/common"
+)
+
+type rowsTestResponse struct {
+	skeys []common.SecondaryKey
+	pkeys [][]byte
+}
+
+func (r *rowsTestResponse) GetEntries() ([]common.SecondaryKey, [][]byte, error) {
+	return r.skeys, r.pkeys, nil
+}
+
+func (r *rowsTestResponse) Error() error {
+	return nil
+}
+
+// rowsTestScan returns a scan that sends `n` rows, two per response,
+// and then fails with `err`. `done` is closed when scan returns.
+func rowsTestScan(n int, err error, done chan bool) func(context.Context, ResponseHandler) error {
+	return func(ctx context.Context, callb ResponseHandler) error {
+		defer close(done)
+		for i := 0; i < n; i += 2 {
+			resp := &rowsTestResponse{}
+			for j := i; j < i+2 && j < n; j++ {
+				resp.skeys = append(resp.skeys, common.SecondaryKey{j})
+				resp.pkeys = append(resp.pkeys, []byte(fmt.Sprintf("doc%v", j)))
+			}
+			if !callb(resp) {
+				return ctx.Err()
+			}
+		}
+		return err
+	}
+}
+
+func rowsTestWait(t *testing.T, done chan bool) {
+	select {
+	case <-done:
+	case <-time.After(10 * time.Second):
+		t.Fatalf("expected scan to return")
+	}
+}
+
+func TestRowsNext(t *testing.T) {
+	done := make(chan bool)
+	rows := newRows(context.Background(), 4, rowsTestScan(5, nil, done))
+
+	count := 0
+	for rows.Next() {
+		if pkey := string(rows.PrimaryKey()); pkey != fmt.Sprintf("doc%v", count) {
+			t.Errorf("expected doc%v, got %v", count, pkey)
+		}
+		if skey := rows.Key(); len(skey) != 1 || skey[0] != count {
+			t.Errorf("expected key [%v], got %v", count, skey)
+		}
+		count++
+	}
+	if count != 5 {
+		t.Errorf("expected 5 rows, got %v", count)
+	}
+	if err := rows.Err(); err != nil {
+		t.Errorf("expected no error, got %v", err)
+	}
+	rowsTestWait(t, done)
+	if err := rows.Close(); err != nil {
+		t.Errorf("expected no error on close, got %v", err)
+	}
+	if rows.Next() {
+		t.Errorf("expected no rows after close")
+	}
+}
+
+func TestRowsCloseEarly(t *testing.T) {
+	done := make(chan bool)
+	rows := newRows(context.Background(), 4, rowsTestScan(10000, nil, done))
+
+	for i := 0; i < 3; i++ {
+		if !rows.Next() {
+			t.Fatalf("expected row %v, got %v", i, rows.Err())
+		}
+	}
+	// scan is blocked on the full buffer, close shall release it.
+	closed := make(chan error)
+	go func() { closed <- rows.Close() }()
+	select {
+	case err := <-closed:
+		if err != nil {
+			t.Errorf("expected no error on close, got %v", err)
+		}
+	case <-time.After(10 * time.Second):
+		t.Fatalf("expected close to return")
+	}
+	rowsTestWait(t, done)
+
+	if rows.Next() {
+		t.Errorf("expected no rows after close")
+	}
+	if err := rows.Err(); err != nil {
+		t.Errorf("expected no error after early close, got %v", err)
+	}
+	if err := rows.Close(); err != nil {
+		t.Errorf("expected close to be idempotent, got %v", err)
+	}
+}
+
+func TestRowsErr(t *testing.T) {
+	scanErr := errors.New("scan failed")
+
+	done := make(chan bool)
+	rows := newRows(context.Background(), 4, rowsTestScan(3, scanErr, done))
+	count := 0
+	for rows.Next() {
+		count++
+	}
+	if count != 3 {
+		t.Errorf("expected 3 rows, got %v", count)
+	}
+	if err := rows.Err(); err != scanErr {
+		t.Errorf("expected %v, got %v", scanErr, err)
+	}
+	rows.Close()
+	if err := rows.Err(); err != scanErr {
+		t.Errorf("expected %v after close, got %v", scanErr, err)
+	}
+	rowsTestWait(t, done)
+
+	// cancelling the caller's context is an error, even after close.
+	ctx, cancel := context.WithCancel(context.Background())
+	done = make(chan bool)
+	rows = newRows(ctx, 4, rowsTestScan(10000, nil, done))
+	if !rows.Next() {
+		t.Fatalf("expected a row, got %v", rows.Err())
+	}
+	cancel()
+	for rows.Next() {
+	}
+	rowsTestWait(t, done)
+	if err := rows.Err(); err != context.Canceled {
+		t.Errorf("expected %v, got %v", context.Canceled, err)
+	}
+	rows.Close()
+	if err := rows.Err(); err != context.Canceled {
+		t.Errorf("expected %v after close, got %v", context.Canceled, err)
+	}
+}
@@ -10,6 +10,7 @@
 
 package client
 
+import "context"
 import "errors"
 import "fmt"
 import "io"
@@ -39,6 +40,10 @@ type GsiScanClient struct {
 	logPrefix          string
 
 	serverVersion uint32
+
+	// ctx cancels requests made through this client, nil if requests
+	// are not cancellable.
+	ctx context.Context
 }
 
 func NewGsiScanClient(queryport string, config common.Config) (*GsiScanClient, error) {
@@ -220,6 +225,9 @@ func (c *GsiScanClient) Lookup(
 		return err, false
 	}
 
+	stop := c.watchContext(conn)
+	defer stop()
+
 	cont, partial := true, false
 	for cont {
 		// <--- protobuf.ResponseStream
@@ -298,6 +306,9 @@ func (c *GsiScanClient) Range(
 		return err, false
 	}
 
+	stop := c.watchContext(conn)
+	defer stop()
+
 	cont, partial := true, false
 	for cont {
 		// <--- protobuf.ResponseStream
@@ -367,6 +378,9 @@ func (c *GsiScanClient) RangePrimary(
 		return err, false
 	}
 
+	stop := c.watchContext(conn)
+	defer stop()
+
 	cont, partial := true, false
 	for cont {
 		// <--- protobuf.ResponseStream
@@ -427,6 +441,9 @@ func (c *GsiScanClient) ScanAll(
 		return err, false
 	}
 
+	stop := c.watchContext(conn)
+	defer stop()
+
 	cont, partial := true, false
 	for cont {
 		// <--- protobuf.ResponseStream
@@ -559,6 +576,9 @@ func (c *GsiScanClient) MultiScan(
 		return err, false
 	}
 
+	stop := c.watchContext(conn)
+	defer stop()
+
 	cont, partial := true, false
 	for cont {
 		// <--- protobuf.ResponseStream
@@ -696,6 +716,9 @@ func (c *GsiScanClient) MultiScanPrimary(
 		return err, false
 	}
 
+	stop := c.watchContext(conn)
+	defer stop()
+
 	cont, partial := true, false
 	for cont {
 		// <--- protobuf.ResponseStream
@@ -1222,6 +1245,9 @@ func (c *GsiScanClient) Scan3(
 		return err, false
 	}
 
+	stop := c.watchContext(conn)
+	defer stop()
+
 	cont, partial := true, false
 	for cont {
 		// <--- protobuf.ResponseStream
@@ -1399,6 +1425,9 @@ func (c *GsiScanClient) Scan3Primary(
 		return err, false
 	}
 
+	stop := c.watchContext(conn)
+	defer stop()
+
 	cont, partial := true, false
 	for cont {
 		// <--- protobuf.ResponseStream
@@ -1417,6 +1446,49 @@ func (c *GsiScanClient) Close() error {
 	return c.pool.Close()
 }
 
+// withContext returns a client sharing the connection pool, whose
+// requests are cancelled when ctx is done.
+func (c *GsiScanClient) withContext(ctx context.Context) *GsiScanClient {
+	if ctx == nil {
+		return c
+	}
+	cc := *c
+	cc.ctx = ctx
+	return &cc
+}
+
+// watchContext interrupts a blocked read on conn when client's context
+// is done, returned function shall be called once the request is over.
+func (c *GsiScanClient) watchContext(conn net.Conn) func() {
+	if c.ctx == nil {
+		return func() {}
+	}
+
+	donech, exitch := make(chan struct{}), make(chan struct{})
+	go func() {
+		defer close(exitch)
+		select {
+		case <-c.ctx.Done():
+			conn.SetReadDeadline(time.Now())
+		case <-donech:
+		}
+	}()
+	return func() {
+		close(donech)
+		<-exitch
+		conn.SetReadDeadline(time.Time{})
+	}
+}
+
+// ctxErr returns error from client's context, nil if there is no
+// context or it is not done yet.
+func (c *GsiScanClient) ctxErr() error {
+	if c.ctx == nil {
+		return nil
+	}
+	return c.ctx.Err()
+}
+
 func (c *GsiScanClient) doRequestResponse(
 	req interface{}, requestId string) (interface{}, error) {
 
@@ -1438,11 +1510,17 @@ func (c *GsiScanClient) doRequestResponse(
 		return nil, err
 	}
 
+	stop := c.watchContext(conn)
+	defer stop()
+
 	laddr := conn.LocalAddr()
 	c.trySetDeadline(conn, c.readDeadline)
 	// <--- protobuf.*Response
 	resp, err := pkt.Receive(conn)
 	if err != nil {
+		if ctxErr := c.ctxErr(); ctxErr != nil {
+			err = ctxErr
+		}
 		fmsg := "%v req(%v) connection %v response %T transport failed `%v`\n"
 		arg1 := logging.TagUD(req)
 		logging.Errorf(fmsg, c.logPrefix, requestId, laddr, arg1, err)
@@ -1453,6 +1531,9 @@ func (c *GsiScanClient) doRequestResponse(
 	c.trySetDeadline(conn, c.readDeadline)
 	// <--- protobuf.StreamEndResponse (skipped) TODO: knock this off.
 	if endResp, err := pkt.Receive(conn); err != nil {
+		if ctxErr := c.ctxErr(); ctxErr != nil {
+			err = ctxErr
+		}
 		fmsg := "%v req(%v) connection %v response %T transport failed `%v`\n"
 		arg1 := logging.TagUD(req)
 		logging.Errorf(fmsg, c.logPrefix, requestId, laddr, arg1, err)
@@ -1483,13 +1564,28 @@ func (c *GsiScanClient) streamResponse(
 	closeStream = false
 	laddr := conn.LocalAddr()
 	c.trySetDeadline(conn, c.readDeadline)
+	if err = c.ctxErr(); err != nil {
+		// cancelled between responses, end the stream gracefully.
+		fmsg := "%v req(%v) connection %q cancelled `%v`\n"
+		logging.Debugf(fmsg, c.logPrefix, requestId, laddr, err)
+		return false, true, err, true
+	}
+
 	if resp, err = pkt.Receive(conn); err != nil {
 		//resp := &protobuf.ResponseStream{
 		//    Err: &protobuf.Error{Error: proto.String(err.Error())},
 		//}
 		//callb(resp) // callback with error
 		cont, healthy = false, false
-		if err == io.EOF {
+		if ctxErr := c.ctxErr(); ctxErr != nil {
+			// read interrupted by cancellation, the connection is
+			// closed since the stream can't be resumed, but server
+			// is asked to stop the scan.
+			err = ctxErr
+			fmsg := "%v req(%v) connection %q cancelled `%v`\n"
+			logging.Debugf(fmsg, c.logPrefix, requestId, laddr, err)
+			c.endStream(conn, pkt, requestId)
+		} else if err == io.EOF {
 			fmsg := "%v req(%v) connection %q closed `%v` \n"
 			logging.Errorf(fmsg, c.logPrefix, requestId, laddr, err)
 		} else {
@@ -1558,6 +1654,20 @@ func (c *GsiScanClient) closeStream(
 	return
 }
 
+// endStream requests server to end the stream without flushing the
+// connection.
+func (c *GsiScanClient) endStream(
+	conn net.Conn, pkt *transport.TransportPacket, requestId string) {
+
+	if err := c.sendRequest(conn, pkt, &protobuf.EndStreamRequest{}); err != nil {
+		fmsg := "%v endStream(%v) request transport failed `%v`\n"
+		logging.Errorf(fmsg, c.logPrefix, requestId, err)
+		return
+	}
+	fmsg := "%v req(%v) connection %q transmitted protobuf.EndStreamRequest"
+	logging.Tracef(fmsg, c.logPrefix, requestId, conn.LocalAddr())
+}
+
 func (c *GsiScanClient) trySetDeadline(conn net.Conn, deadline time.Duration) {
 	if deadline > time.Duration(0) {
 		timeoutMs := deadline * time.Millisecond
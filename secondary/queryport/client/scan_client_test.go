@@ -0,0 +1,122 @@
+package client
+
+import (
+	"context"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/couchbase/indexing/secondary/common"
+	protobuf "github.com/couchbase/indexing/secondary/protobuf/query"
+	"github.com/couchbase/indexing/secondary/queryport"
+	"github.com/golang/protobuf/proto"
+)
+
+// startTestQueryport serves HeloRequest and streams one batch of
+// entries for a ScanRequest, then holds the stream open until client
+// ends it. quitch is closed once client requests the stream to end.
+func startTestQueryport(t *testing.T) (*queryport.Server, string, chan bool) {
+	lis, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	addr := lis.Addr().String()
+	lis.Close()
+
+	endch := make(chan bool)
+	buf := make([]byte, 64*1024)
+	callb := func(req interface{}, conn net.Conn, quitch <-chan bool) {
+		switch req.(type) {
+		case *protobuf.HeloRequest:
+			resp := &protobuf.HeloResponse{
+				Version: proto.Uint32(uint32(protobuf.ProtobufVersion())),
+			}
+			protobuf.EncodeAndWrite(conn, buf, resp)
+
+		case *protobuf.ScanRequest:
+			resp := &protobuf.ResponseStream{
+				IndexEntries: []*protobuf.IndexEntry{
+					&protobuf.IndexEntry{
+						EntryKey: []byte(`["aaaaa"]`), PrimaryKey: []byte("key"),
+					},
+				},
+			}
+			protobuf.EncodeAndWrite(conn, buf, resp)
+			select {
+			case <-quitch:
+				close(endch)
+			case <-time.After(10 * time.Second):
+			}
+		}
+	}
+
+	config := common.SystemConfig.SectionConfig("indexer.queryport.", true)
+	s, err := queryport.NewServer(addr, callb, config)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return s, addr, endch
+}
+
+func scanWithContext(t *testing.T, ctx context.Context, addr string) error {
+	config := common.SystemConfig.SectionConfig("queryport.client.", true)
+	c, err := NewGsiScanClient(addr, config)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer c.Close()
+
+	callb := func(resp ResponseReader) bool {
+		return true
+	}
+	err, _ = c.withContext(ctx).ScanAll(
+		0x0 /*defnID*/, "", 0, common.AnyConsistency, nil, callb, 0, nil)
+	return err
+}
+
+func checkEndStream(t *testing.T, endch chan bool) {
+	select {
+	case <-endch:
+	case <-time.After(5 * time.Second):
+		t.Fatalf("server did not receive EndStreamRequest")
+	}
+}
+
+func TestScanCancel(t *testing.T) {
+	s, addr, endch := startTestQueryport(t)
+	defer s.Close()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	time.AfterFunc(100*time.Millisecond, cancel)
+	if err := scanWithContext(t, ctx, addr); err != context.Canceled {
+		t.Fatalf("expected %v, got %v", context.Canceled, err)
+	}
+	checkEndStream(t, endch)
+}
+
+func TestScanDeadline(t *testing.T) {
+	s, addr, endch := startTestQueryport(t)
+	defer s.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+	if err := scanWithContext(t, ctx, addr); err != context.DeadlineExceeded {
+		t.Fatalf("expected %v, got %v", context.DeadlineExceeded, err)
+	}
+	checkEndStream(t, endch)
+}
+
+func TestScanRetryWait(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	b := &RequestBroker{}
+	b.SetContext(ctx)
+	cancel()
+
+	begin := time.Now()
+	if err := b.wait(time.Hour); err != context.Canceled {
+		t.Fatalf("expected %v, got %v", context.Canceled, err)
+	}
+	if time.Since(begin) > time.Second {
+		t.Errorf("retry wait did not honor cancellation")
+	}
+}
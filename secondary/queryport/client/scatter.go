@@ -10,6 +10,7 @@ package client
 
 import (
 	"bytes"
+	"context"
 	"errors"
 	"fmt"
 	"github.com/couchbase/indexing/secondary/collatejson"
@@ -50,6 +51,9 @@ type RequestBroker struct {
 	factory ResponseHandlerFactory
 	sender  ResponseSender
 	timer   ResponseTimer
+	hedger  *scanHedger
+	target  hedgeTarget
+	ctx     context.Context
 
 	// initialization
 	requestId string
@@ -82,6 +86,10 @@ type RequestBroker struct {
 	indexOrder     *IndexKeyOrder
 	projDesc       []bool
 	distinct       bool
+	codec          *collatejson.Codec // nil for binary collation
+	collateBufs    [2][]byte          // to compare values with codec
+	routeScans     bool
+	scanPartns     []common.PartitionId // partition of each scan, if routed
 
 	// stats
 	sendCount    int64
@@ -159,6 +167,59 @@ func (b *RequestBroker) SetResponseTimer(timer ResponseTimer) {
 	b.timer = timer
 }
 
+//
+// Set scanHedger and the function to locate another replica for
+// hedged scans.
+//
+func (b *RequestBroker) setHedger(hedger *scanHedger, target hedgeTarget) {
+
+	b.hedger = hedger
+	b.target = target
+}
+
+//
+// Set context to cancel the scan, scan will return ctx.Err() once
+// ctx is done.
+//
+func (b *RequestBroker) SetContext(ctx context.Context) {
+
+	b.ctx = ctx
+}
+
+//
+// Return error from context of the scan, nil if there is no context
+// or scan is not cancelled.
+//
+func (b *RequestBroker) ctxErr() error {
+
+	if b.ctx == nil {
+		return nil
+	}
+	return b.ctx.Err()
+}
+
+//
+// Wait for d before retrying the scan, returns ctx.Err() if scan is
+// cancelled while waiting.
+//
+func (b *RequestBroker) wait(d time.Duration) error {
+
+	if b.ctx == nil {
+		time.Sleep(d)
+		return nil
+	}
+
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+
+	select {
+	case <-timer.C:
+		return nil
+	case <-b.ctx.Done():
+		return b.ctx.Err()
+	}
+}
+
 //
 // Set Limit
 //
@@ -226,6 +287,37 @@ func (b *RequestBroker) SetScans(scans Scans) {
 	b.scans = scans
 }
 
+//
+// Route each scan only to the partition owning its partition key,
+// instead of sending all scans to every partition.
+//
+func (b *RequestBroker) SetRouteScans(route bool) {
+
+	b.routeScans = route
+}
+
+//
+// Get scans to be sent to the given partitions. If scans are routed,
+// only scans owned by one of the partitions are returned.
+//
+func (b *RequestBroker) GetScans(partitions []common.PartitionId) Scans {
+
+	if b.scanPartns == nil {
+		return b.scans
+	}
+
+	scans := make(Scans, 0, len(b.scans))
+	for i, scan := range b.scans {
+		for _, partnId := range partitions {
+			if b.scanPartns[i] == partnId {
+				scans = append(scans, scan)
+				break
+			}
+		}
+	}
+	return scans
+}
+
 //
 // Set GroupAggr
 //
@@ -440,6 +532,8 @@ func (b *RequestBroker) reset() {
 	b.pushdownOffset = b.offset
 	b.pushdownSorted = b.sorted
 	b.projDesc = nil
+	b.codec = nil
+	b.scanPartns = nil
 }
 
 //--------------------------
@@ -461,6 +555,13 @@ func (c *RequestBroker) scatter(clientMaker scanClientMaker, index *common.Index
 	c.reset()
 	c.SetNumIndexers(len(partition))
 	c.defn = index
+	if index.Collation != "" {
+		c.codec = collatejson.NewCodec(16)
+		if e := c.codec.SetCollation(index.Collation); e != nil {
+			e = fmt.Errorf("Invalid collation %q for index %v:%v (%v)", index.Collation, index.Bucket, index.Name, e)
+			return 0, c.makeErrorMap(targetInstId, partition, e), false, false
+		}
+	}
 
 	var ok bool
 	var client []*GsiScanClient
@@ -1023,7 +1124,7 @@ func (c *RequestBroker) compareKey(key1, key2 []value.Value) int {
 
 	for i := 0; i < ln; i++ {
 
-		if r := key1[i].Collate(key2[i]); r != 0 {
+		if r := c.collate(key1[i], key2[i]); r != 0 {
 
 			// default: ascending
 			if i >= len(c.projDesc) {
@@ -1043,6 +1144,43 @@ func (c *RequestBroker) compareKey(key1, key2 []value.Value) int {
 	return len(key1) - len(key2)
 }
 
+//
+// Compare values as per collation of the index. Strings of a collated
+// index are ordered by their sort key, hence values are compared by
+// their encoding as stored in the index.
+//
+func (c *RequestBroker) collate(v1, v2 value.Value) int {
+
+	if c.codec == nil {
+		return v1.Collate(v2)
+	}
+
+	code1, e1 := c.encodeCollated(v1, 0)
+	code2, e2 := c.encodeCollated(v2, 1)
+	if e1 != nil || e2 != nil {
+		return v1.Collate(v2)
+	}
+	return bytes.Compare(code1, code2)
+}
+
+//
+// Encode value in collate buffer i, buffers are reused across
+// comparisons, and grown when a value does not fit.
+//
+func (c *RequestBroker) encodeCollated(v value.Value, i int) ([]byte, error) {
+
+	if c.collateBufs[i] == nil {
+		c.collateBufs[i] = make([]byte, 0, 1024)
+	}
+	code, err := c.codec.EncodeN1QLValue(v, c.collateBufs[i][:0])
+	if err == collatejson.ErrorOutputLen && cap(c.collateBufs[i]) < 1024*1024 {
+		c.collateBufs[i] = make([]byte, 0, 1024*1024)
+		code, err = c.codec.EncodeN1QLValue(v, c.collateBufs[i][:0])
+	}
+	return code, err
+}
+
+//
 // This function compares the primary key.
 // Returns –int, 0 or +int depending on if key1
 // sorts less than, equal to, or greater than key2.
@@ -1067,8 +1205,15 @@ func (c *RequestBroker) scanSingleNode(id ResponseHandlerId, client *GsiScanClie
 		return
 	}
 
+	client = client.withContext(c.ctx)
 	begin := time.Now()
-	err, partial := c.scan(client, index, rollback, partition, c.factory(id, instId, partition))
+	var err error
+	var partial bool
+	if delay, ok := c.hedger.delay(); ok && c.target != nil {
+		instId, err, partial = c.hedgedScan(id, client, index, instId, rollback, partition, delay)
+	} else {
+		err, partial = c.scan(client, index, rollback, partition, c.factory(id, instId, partition))
+	}
 	if err != nil {
 		// If there is any error, then stop the broker.
 		// This will force other go-routine to terminate.
@@ -1089,6 +1234,112 @@ func (c *RequestBroker) scanSingleNode(id ResponseHandlerId, client *GsiScanClie
 	donech <- &doneStatus{err: err, partial: partial}
 }
 
+//
+// This function makes a scan request like scanSingleNode. If the first
+// response does not arrive within delay, the same scan is issued to
+// another replica and the stream that starts first is used, the other
+// stream is cancelled. Returns the instance that served the scan.
+//
+func (c *RequestBroker) hedgedScan(id ResponseHandlerId, client *GsiScanClient, index *common.IndexDefn, instId uint64,
+	rollback int64, partition []common.PartitionId, delay time.Duration) (uint64, error, bool) {
+
+	type attempt struct {
+		instId  uint64
+		err     error
+		partial bool
+	}
+
+	var winner int32 // 1 for original scan, 2 for hedged scan
+	startch := make(chan int32, 2)
+
+	run := func(n int32, client *GsiScanClient, instId uint64, rollback int64, donech chan *attempt) {
+		handler := c.factory(id, instId, partition)
+		hedged := func(resp ResponseReader) bool {
+			if atomic.LoadInt32(&winner) != n {
+				// error before the stream started is left to the other scan.
+				if resp.Error() != nil || !atomic.CompareAndSwapInt32(&winner, 0, n) {
+					return false
+				}
+				startch <- n
+			}
+			return handler(resp)
+		}
+		err, partial := c.scan(client, index, rollback, partition, hedged)
+		donech <- &attempt{instId: instId, err: err, partial: partial}
+	}
+
+	// each scan is cancelled as soon as the other one wins, without
+	// waiting for its first response.
+	parent := c.ctx
+	if parent == nil {
+		parent = context.Background()
+	}
+	octx, ocancel := context.WithCancel(parent)
+	defer ocancel()
+	hctx, hcancel := context.WithCancel(parent)
+	defer hcancel()
+
+	c.hedger.started()
+	origch := make(chan *attempt, 1)
+	go run(1, client.withContext(octx), instId, rollback, origch)
+
+	timer := time.NewTimer(delay)
+	defer timer.Stop()
+
+	select {
+	case <-startch:
+		res := <-origch
+		return res.instId, res.err, res.partial
+	case res := <-origch:
+		return res.instId, res.err, res.partial
+	case <-timer.C:
+	}
+
+	hclient, hinstId, hrollback, ok := c.target(uint64(index.DefnId), instId, partition)
+	if !ok || !c.hedger.allow() {
+		res := <-origch
+		return res.instId, res.err, res.partial
+	}
+
+	log := scanLogger.WithIndex(index.Bucket, index.Name, instId).WithReqId(c.requestId)
+	log.Verbosef("hedging scan of partitions %v to instance %v after %v", partition, hinstId, delay)
+
+	hedgech := make(chan *attempt, 1)
+	go run(2, hclient.withContext(hctx), hinstId, hrollback, hedgech)
+
+	// wait for either stream to start, if both scans fail before
+	// starting then report error from the original scan.
+	var orig, hedge *attempt
+	for orig == nil || hedge == nil {
+		select {
+		case n := <-startch:
+			if n == 2 {
+				ocancel()
+				c.hedger.hedgeWon()
+				res := <-hedgech
+				return res.instId, res.err, res.partial
+			}
+			hcancel()
+			res := <-origch
+			return res.instId, res.err, res.partial
+
+		case orig = <-origch:
+			if atomic.LoadInt32(&winner) == 1 {
+				return orig.instId, orig.err, orig.partial
+			}
+			origch = nil
+
+		case hedge = <-hedgech:
+			if atomic.LoadInt32(&winner) == 2 {
+				c.hedger.hedgeWon()
+				return hedge.instId, hedge.err, hedge.partial
+			}
+			hedgech = nil
+		}
+	}
+	return orig.instId, orig.err, orig.partial
+}
+
 //
 // This function makes a count request through a single connection.
 //
@@ -1100,7 +1351,7 @@ func (c *RequestBroker) countSingleNode(id ResponseHandlerId, client *GsiScanCli
 		return
 	}
 
-	cnt, err, partial := c.count(client, index, rollback, partition)
+	cnt, err, partial := c.count(client.withContext(c.ctx), index, rollback, partition)
 	if err != nil {
 		// If there is any error, then stop the broker.
 		// This will force other go-routine to terminate.
@@ -1266,11 +1517,21 @@ func (c *RequestBroker) filterPartitions(index *common.IndexDefn, partitions [][
 		return partitions
 	}
 
+	// partition key is hashed by value, while scan of a collated index
+	// matches strings equal by collation, which can be in any partition.
+	if index.Collation != "" && hasCollatedValues(partitionKeyValues) {
+		return partitions
+	}
+
 	filter := partitionKeyHash(partitionKeyValues, c.scans, numPartition, index.HashScheme)
 	if len(filter) == 0 {
 		return partitions
 	}
 
+	if c.routeScans {
+		c.scanPartns = scanPartitionIds(partitionKeyValues, numPartition, index.HashScheme)
+	}
+
 	return filterPartitionIds(partitions, filter)
 }
 
@@ -1408,6 +1669,23 @@ func partitionKeyValues(requestId string, partnKeyPos []int, scans Scans) [][]in
 	return partnKeyValues
 }
 
+//
+// Check whether partition key values of any scan has a string, which
+// is compared by collation in a collated index.
+//
+func hasCollatedValues(partnKeyValues [][]interface{}) bool {
+
+	for _, values := range partnKeyValues {
+		for _, v := range values {
+			switch v.(qvalue.Value).Type() {
+			case qvalue.STRING, qvalue.ARRAY, qvalue.OBJECT:
+				return true
+			}
+		}
+	}
+	return false
+}
+
 //
 // Generate a list of partitonId from the partition key values of each scan
 //
@@ -1438,6 +1716,25 @@ func partitionKeyHash(partnKeyValues [][]interface{}, scans Scans, numPartition
 	return result
 }
 
+//
+// Generate the partitionId of each scan from its partition key values
+//
+func scanPartitionIds(partnKeyValues [][]interface{}, numPartition uint32, hashScheme common.HashScheme) []common.PartitionId {
+
+	result := make([]common.PartitionId, 0, len(partnKeyValues))
+	for _, values := range partnKeyValues {
+
+		v, e := qvalue.NewValue(values).MarshalJSON()
+		if e != nil {
+			return nil
+		}
+
+		result = append(result, common.HashKeyPartition(v, int(numPartition), hashScheme))
+	}
+
+	return result
+}
+
 //
 // Given the indexer-partitionId map, filter out the partitionId that are not used in the scans
 //
@@ -0,0 +1,23 @@
+package client
+
+import (
+	"testing"
+
+	qvalue "github.com/couchbase/query/value"
+)
+
+func TestHasCollatedValues(t *testing.T) {
+	testcases := []struct {
+		values   [][]interface{}
+		collated bool
+	}{
+		{[][]interface{}{{qvalue.NewValue(10)}, {qvalue.NewValue(true)}}, false},
+		{[][]interface{}{{qvalue.NewValue(10), qvalue.NewValue("bob")}}, true},
+		{[][]interface{}{{qvalue.NewValue(10)}, {qvalue.NewValue([]interface{}{"bob"})}}, true},
+	}
+	for _, tc := range testcases {
+		if collated := hasCollatedValues(tc.values); collated != tc.collated {
+			t.Errorf("values %v expected %v, got %v", tc.values, tc.collated, collated)
+		}
+	}
+}
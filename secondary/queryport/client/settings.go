@@ -10,7 +10,6 @@
 package client
 
 import (
-	"github.com/couchbase/cbauth/metakv"
 	"github.com/couchbase/indexing/secondary/common"
 	"github.com/couchbase/indexing/secondary/logging"
 	"math"
@@ -28,6 +27,10 @@ type ClientSettings struct {
 	prune_replica  int32
 	queueSize      uint64
 	concurrency    uint32
+	hedge          int32
+	hedgePercent   uint64
+	hedgeMinDelay  int64
+	hedgeMaxRate   uint64
 	config         common.Config
 	cancelCh       chan struct{}
 
@@ -64,7 +67,7 @@ func NewClientSettings(needRefresh bool) *ClientSettings {
 				if r > 0 {
 					logging.Errorf("ClientSettings: metakv notifier failed (%v)..Restarting %v", err, r)
 				}
-				err = metakv.RunObserveChildren(common.IndexingSettingsMetaDir, s.metaKVCallback, s.cancelCh)
+				err = common.GetMetadataStore().RunObserveChildren(common.IndexingSettingsMetaDir, s.metaKVCallback, s.cancelCh)
 				return err
 			}
 			rh := common.NewRetryHelper(200, time.Second, 2, fn)
@@ -158,6 +161,34 @@ func (s *ClientSettings) handleSettings(config common.Config) {
 		logging.Errorf("ClientSettings: invalid setting value for max_concurrency=%v", concurrency)
 	}
 
+	if config["queryport.client.scan.hedge.enable"].Bool() {
+		atomic.StoreInt32(&s.hedge, int32(1))
+	} else {
+		atomic.StoreInt32(&s.hedge, int32(0))
+	}
+
+	hedgePercent := config["queryport.client.scan.hedge.percentile"].Float64()
+	if hedgePercent > 0 && hedgePercent <= 100 {
+		atomic.StoreUint64(&s.hedgePercent, math.Float64bits(hedgePercent))
+	} else {
+		logging.Errorf("ClientSettings: invalid setting value for hedge.percentile=%v", hedgePercent)
+	}
+
+	hedgeMinDelay := config["queryport.client.scan.hedge.min_delay"].Int()
+	if hedgeMinDelay >= 0 {
+		delay := time.Duration(hedgeMinDelay) * time.Millisecond
+		atomic.StoreInt64(&s.hedgeMinDelay, int64(delay))
+	} else {
+		logging.Errorf("ClientSettings: invalid setting value for hedge.min_delay=%v", hedgeMinDelay)
+	}
+
+	hedgeMaxRate := config["queryport.client.scan.hedge.max_rate"].Float64()
+	if hedgeMaxRate >= 0 && hedgeMaxRate <= 1 {
+		atomic.StoreUint64(&s.hedgeMaxRate, math.Float64bits(hedgeMaxRate))
+	} else {
+		logging.Errorf("ClientSettings: invalid setting value for hedge.max_rate=%v", hedgeMaxRate)
+	}
+
 	storageMode := config["indexer.settings.storage_mode"].String()
 	if len(storageMode) != 0 {
 		func() {
@@ -171,6 +202,14 @@ func (s *ClientSettings) handleSettings(config common.Config) {
 		logLevel := config["queryport.client.log_level"].String()
 		level := logging.Level(logLevel)
 		logging.SetLogLevel(level)
+
+		format := config["queryport.client.log_format"].String()
+		logging.SetLogFormat(logging.Format(format))
+
+		levels := config["queryport.client.log_component_levels"].String()
+		if err := logging.SetComponentLevels(levels); err != nil {
+			logging.Errorf("ClientSettings: invalid component log levels: %v", err)
+		}
 	}
 }
 
@@ -217,3 +256,21 @@ func (s *ClientSettings) ScanQueueSize() uint64 {
 func (s *ClientSettings) MaxConcurrency() uint32 {
 	return atomic.LoadUint32(&s.concurrency)
 }
+
+func (s *ClientSettings) HedgeEnabled() bool {
+	return atomic.LoadInt32(&s.hedge) == 1
+}
+
+func (s *ClientSettings) HedgePercentile() float64 {
+	bits := atomic.LoadUint64(&s.hedgePercent)
+	return math.Float64frombits(bits)
+}
+
+func (s *ClientSettings) HedgeMinDelay() time.Duration {
+	return time.Duration(atomic.LoadInt64(&s.hedgeMinDelay))
+}
+
+func (s *ClientSettings) HedgeMaxRate() float64 {
+	bits := atomic.LoadUint64(&s.hedgeMaxRate)
+	return math.Float64frombits(bits)
+}
@@ -677,8 +677,18 @@ func newSecondaryIndexFromMetaData(
 		si.partnExpr = exprs
 	}
 
-	if indexDefn.WhereExpr != "" {
-		expr, _ := parser.Parse(indexDefn.WhereExpr)
+	// documents filtered by their key are not in the index, hence
+	// the filter is part of index condition.
+	whereExpr := indexDefn.WhereExpr
+	if cond := docKeyCondition(indexDefn.DocKeyPrefixes, indexDefn.DocKeyPattern); cond != "" {
+		if whereExpr != "" {
+			whereExpr = "(" + whereExpr + ") AND " + cond
+		} else {
+			whereExpr = cond
+		}
+	}
+	if whereExpr != "" {
+		expr, _ := parser.Parse(whereExpr)
 		si.whereExpr = expr
 	}
 
@@ -691,6 +701,32 @@ func newSecondaryIndexFromMetaData(
 	return si, nil
 }
 
+// docKeyCondition returns N1QL condition on meta().id equivalent to
+// document key filter of an index, empty string if there is no filter.
+func docKeyCondition(prefixes []string, pattern string) string {
+	var conds []string
+	if len(prefixes) > 0 {
+		likes := make([]string, 0, len(prefixes))
+		for _, prefix := range prefixes {
+			likes = append(likes, "meta().id LIKE "+n1qlString(likeEscaper.Replace(prefix)+"%"))
+		}
+		conds = append(conds, "("+strings.Join(likes, " OR ")+")")
+	}
+	if pattern != "" {
+		// RE2 pattern matches anywhere in the key, like REGEXP_CONTAINS.
+		conds = append(conds, "REGEXP_CONTAINS(meta().id, "+n1qlString(pattern)+")")
+	}
+	return strings.Join(conds, " AND ")
+}
+
+var likeEscaper = strings.NewReplacer(`\`, `\\`, "%", `\%`, "_", `\_`)
+
+// n1qlString returns s as N1QL string literal.
+func n1qlString(s string) string {
+	literal, _ := json.Marshal(s)
+	return string(literal)
+}
+
 // KeyspaceId implement Index{} interface.
 func (si *secondaryIndex) KeyspaceId() string {
 	return si.bucketn
@@ -1713,15 +1749,18 @@ func (gsi *gsiKeyspace) logstats(logtick time.Duration) {
 		primedur := atomic.LoadInt64(&gsi.primedur)
 		totalscans := atomic.LoadInt64(&gsi.totalscans)
 		totalbackfills := atomic.LoadInt64(&gsi.totalbackfills)
+		hedged, hedgeswon := gsi.gsiClient.HedgeStats()
 		if totalscans > sofar {
 			fmsg := `%v logstats %q {` +
 				`"gsi_scan_count":%v,"gsi_scan_duration":%v,` +
 				`"gsi_throttle_duration":%v,` +
 				`"gsi_prime_duration":%v,"gsi_blocked_duration":%v,` +
-				`"gsi_totalbackfills":%v}`
+				`"gsi_totalbackfills":%v,` +
+				`"gsi_hedged_scans":%v,"gsi_hedges_won":%v}`
 			l.Infof(
 				fmsg, gsi.logPrefix, gsi.keyspace, totalscans, scandur,
-				throttledur, primedur, blockeddur, totalbackfills)
+				throttledur, primedur, blockeddur, totalbackfills,
+				hedged, hedgeswon)
 		}
 		sofar = totalscans
 	}
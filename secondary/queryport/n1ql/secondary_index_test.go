@@ -2,6 +2,8 @@ package n1ql
 
 import (
 	"testing"
+
+	"github.com/couchbase/query/expression/parser"
 )
 
 func TestIndexConfig(t *testing.T) {
@@ -66,3 +68,30 @@ func validateConf(t *testing.T, preconf, postconf map[string]interface{}) {
 		t.Errorf("config mismatch %v %v", preconf, postconf)
 	}
 }
+
+func TestDocKeyCondition(t *testing.T) {
+	testcases := []struct {
+		prefixes []string
+		pattern  string
+		cond     string
+	}{
+		{nil, "", ""},
+		{[]string{"user::"}, "", `(meta().id LIKE "user::%")`},
+		{[]string{"a_b", "50%"}, "",
+			`(meta().id LIKE "a\\_b%" OR meta().id LIKE "50\\%%")`},
+		{nil, `^order::\d+$`, `REGEXP_CONTAINS(meta().id, "^order::\\d+$")`},
+		{[]string{"order::"}, `\d$`,
+			`(meta().id LIKE "order::%") AND REGEXP_CONTAINS(meta().id, "\\d$")`},
+	}
+	for _, tc := range testcases {
+		cond := docKeyCondition(tc.prefixes, tc.pattern)
+		if cond != tc.cond {
+			t.Errorf("expected %v, got %v", tc.cond, cond)
+		} else if cond == "" {
+			continue
+		}
+		if _, err := parser.Parse(cond); err != nil {
+			t.Errorf("%v: %v", cond, err)
+		}
+	}
+}
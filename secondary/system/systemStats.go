@@ -1,12 +1,14 @@
 package system
 
 //#cgo LDFLAGS: -lsigar
+//#include <stdlib.h>
 //#include <sigar.h>
 import "C"
 
 import (
 	"errors"
 	"fmt"
+	"unsafe"
 )
 
 type SystemStats struct {
@@ -52,3 +54,21 @@ func (h *SystemStats) ProcessCpuPercent() (C.sigar_pid_t, float64, error) {
 
 	return h.pid, float64(cpu.percent) * 100, nil
 }
+
+//
+// Get total and available bytes of the file system that has the
+// given directory.
+//
+func (h *SystemStats) FileSystemUsage(dirname string) (uint64, uint64, error) {
+
+	cdir := C.CString(dirname)
+	defer C.free(unsafe.Pointer(cdir))
+
+	// Sigar returns file system usage in KB
+	var fs C.sigar_file_system_usage_t
+	if err := C.sigar_file_system_usage_get(h.handle, cdir, &fs); err != C.SIGAR_OK {
+		return 0, 0, errors.New(fmt.Sprintf("Fail to get file system usage.  Err=%v", C.sigar_strerror(h.handle, err)))
+	}
+
+	return uint64(fs.total) * 1024, uint64(fs.avail) * 1024, nil
+}
@@ -0,0 +1,130 @@
+package embeddedtests
+
+import (
+	"log"
+	"os"
+	"sort"
+	"testing"
+
+	"github.com/couchbase/indexing/secondary/logging"
+	tc "github.com/couchbase/indexing/secondary/tests/framework/common"
+	"github.com/couchbase/indexing/secondary/tests/framework/datautility"
+	"github.com/couchbase/indexing/secondary/tests/framework/embedded"
+)
+
+var docs, mut_docs tc.KeyValues
+var defaultlimit int64 = 100000000000
+var cluster *embedded.Cluster
+
+const bucketName = "default"
+const dataFilePath = "../testdata/Users100.txt.gz"
+
+func TestMain(m *testing.M) {
+	log.Printf("In TestMain()")
+	logging.SetLogLevel(logging.Error)
+
+	var err error
+	cluster, err = embedded.NewCluster(embedded.DefaultConfig())
+	tc.HandleError(err, "Error in starting embedded cluster")
+
+	// Working with Users100 dataset, 70 docs are loaded into the
+	// bucket and rest are used for mutations.
+	all := datautility.LoadJSONFromCompressedFile(dataFilePath, "docid")
+	keys := make([]string, 0, len(all))
+	for key := range all {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	docs, mut_docs = make(tc.KeyValues), make(tc.KeyValues)
+	for i, key := range keys {
+		if i < 70 {
+			docs[key] = all[key]
+		} else {
+			mut_docs[key] = all[key]
+		}
+	}
+
+	log.Printf("Create Index On the empty default Bucket()")
+	_, err = cluster.CreateIndex(bucketName, "index_eyeColor", []string{"`eyeColor`"}, "", false)
+	tc.HandleError(err, "Error in creating the index")
+
+	log.Printf("Populating the default bucket")
+	err = cluster.SetKeyValues(bucketName, docs)
+	tc.HandleError(err, "Error in populating the bucket")
+
+	code := m.Run()
+	cluster.Close()
+	os.Exit(code)
+}
+
+func FailTestIfError(err error, msg string, t *testing.T) {
+	if err != nil {
+		t.Fatalf("%v: %v\n", msg, err)
+	}
+}
+
+func CreateDocs(num int) {
+	i := 0
+	keysToBeSet := make(tc.KeyValues)
+	for key, value := range mut_docs {
+		if i == num {
+			break
+		}
+		keysToBeSet[key] = value
+		i++
+	}
+	err := cluster.SetKeyValues(bucketName, keysToBeSet)
+	tc.HandleError(err, "Error in CreateDocs")
+	// Update docs object with newly added keys and remove those keys from mut_docs
+	for key, value := range keysToBeSet {
+		docs[key] = value
+		delete(mut_docs, key)
+	}
+}
+
+func DeleteDocs(num int) {
+	i := 0
+	keysToBeDeleted := make(tc.KeyValues)
+	for key, value := range docs {
+		if i == num {
+			break
+		}
+		keysToBeDeleted[key] = value
+		i++
+	}
+	err := cluster.DeleteKeys(bucketName, keysToBeDeleted)
+	tc.HandleError(err, "Error in DeleteDocs")
+	// Update docs object with deleted keys and add those keys to mut_docs
+	for key, value := range keysToBeDeleted {
+		delete(docs, key)
+		mut_docs[key] = value
+	}
+}
+
+// UpdateDocs replaces the value of num docs with the value of docs from
+// mut_docs, keeping their keys.
+func UpdateDocs(num int) {
+	i := 0
+	keysToBeUpdated := make(tc.KeyValues)
+	mutKeys := make([]string, 0, len(mut_docs))
+	for key := range mut_docs {
+		mutKeys = append(mutKeys, key)
+	}
+	for key := range docs {
+		if i == num || i == len(mutKeys) {
+			break
+		}
+		value := make(map[string]interface{})
+		for k, v := range mut_docs[mutKeys[i]].(map[string]interface{}) {
+			value[k] = v
+		}
+		value["docid"] = key
+		keysToBeUpdated[key] = value
+		i++
+	}
+	err := cluster.SetKeyValues(bucketName, keysToBeUpdated)
+	tc.HandleError(err, "Error in UpdateDocs")
+	for key, value := range keysToBeUpdated {
+		docs[key] = value
+	}
+}
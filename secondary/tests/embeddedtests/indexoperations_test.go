@@ -0,0 +1,226 @@
+package embeddedtests
+
+import (
+	"log"
+	"testing"
+
+	"github.com/couchbase/indexing/secondary/tests/framework/datautility"
+	tv "github.com/couchbase/indexing/secondary/tests/framework/validation"
+)
+
+func TestScanAfterBucketPopulate(t *testing.T) {
+	log.Printf("In TestScanAfterBucketPopulate()")
+	log.Printf("Create an index on empty bucket, populate the bucket and Run a scan on the index")
+	var indexName = "index_eyeColor"
+
+	docScanResults := datautility.ExpectedScanResponse_string(docs, "eyeColor", "b", "c", 3)
+	scanResults, err := cluster.Range(bucketName, indexName, []interface{}{"b"}, []interface{}{"c"}, 3, defaultlimit)
+	FailTestIfError(err, "Error in scan", t)
+	err = tv.Validate(docScanResults, scanResults)
+	FailTestIfError(err, "Error in scan result validation: ", t)
+}
+
+func TestThreeIndexCreates(t *testing.T) {
+	log.Printf("In TestThreeIndexCreates()")
+	var i1 = "index_balance"
+	var i2 = "index_email"
+	var i3 = "index_pin"
+
+	_, e := cluster.CreateIndex(bucketName, i1, []string{"`balance`"}, "", false)
+	FailTestIfError(e, "Error in creating the index", t)
+
+	//Create docs mutations: Add new docs to KV
+	log.Printf("Create docs mutations")
+	CreateDocs(10)
+
+	docScanResults := datautility.ExpectedScanResponse_string(docs, "balance", "$1", "$2", 2)
+	scanResults, err := cluster.Range(bucketName, i1, []interface{}{"$1"}, []interface{}{"$2"}, 2, defaultlimit)
+	FailTestIfError(err, "Error in scan", t)
+	err = tv.Validate(docScanResults, scanResults)
+	FailTestIfError(err, "Error in scan result validation", t)
+
+	_, err = cluster.CreateIndex(bucketName, i2, []string{"`email`"}, "", false)
+	FailTestIfError(err, "Error in creating the index", t)
+
+	//Create docs mutations: Add new docs to KV
+	log.Printf("Create docs mutations")
+	CreateDocs(10)
+
+	docScanResults = datautility.ExpectedScanResponse_string(docs, "email", "p", "w", 1)
+	scanResults, err = cluster.Range(bucketName, i2, []interface{}{"p"}, []interface{}{"w"}, 1, defaultlimit)
+	FailTestIfError(err, "Error in scan", t)
+	err = tv.Validate(docScanResults, scanResults)
+	FailTestIfError(err, "Error in scan result validation", t)
+
+	_, err = cluster.CreateIndex(bucketName, i3, []string{"`address`.`pin`"}, "", false)
+	FailTestIfError(err, "Error in creating the index", t)
+
+	//Delete docs mutations:  Delete docs from KV
+	log.Printf("Delete docs mutations")
+	DeleteDocs(15)
+
+	docScanResults = datautility.ExpectedScanResponse_int64(docs, "address.pin", 2222, 5555, 3)
+	scanResults, err = cluster.Range(bucketName, i3, []interface{}{2222}, []interface{}{5555}, 3, defaultlimit)
+	FailTestIfError(err, "Error in scan", t)
+	err = tv.Validate(docScanResults, scanResults)
+	FailTestIfError(err, "Error in scan result validation", t)
+}
+
+func TestCreateDropScan(t *testing.T) {
+	log.Printf("In TestCreateDropScan()")
+	var indexName = "index_cd"
+
+	_, err := cluster.CreateIndex(bucketName, indexName, []string{"`company`"}, "", false)
+	FailTestIfError(err, "Error in creating the index", t)
+
+	docScanResults := datautility.ExpectedScanResponse_string(docs, "company", "FI", "SR", 1)
+	scanResults, err := cluster.Range(bucketName, indexName, []interface{}{"FI"}, []interface{}{"SR"}, 1, defaultlimit)
+	FailTestIfError(err, "Error in scan 1", t)
+	err = tv.Validate(docScanResults, scanResults)
+	FailTestIfError(err, "Error in scan result validation", t)
+
+	err = cluster.DropIndex(bucketName, indexName)
+	FailTestIfError(err, "Error dropping index", t)
+
+	_, e := cluster.Range(bucketName, indexName, []interface{}{"BIOSPAN"}, []interface{}{"ZILLANET"}, 1, defaultlimit)
+	if e == nil {
+		t.Fatal("Error excpected when scanning for dropped index but scan didnt fail \n")
+	} else {
+		log.Printf("Scan failed as expected with error: %v\n", e)
+	}
+}
+
+func TestCreate2Drop1Scan2(t *testing.T) {
+	log.Printf("In TestCreate2Drop1Scan2()")
+	var index1 = "index_i1"
+	var index2 = "index_i2"
+
+	_, err := cluster.CreateIndex(bucketName, index1, []string{"`company`"}, "", false)
+	FailTestIfError(err, "Error in creating the index", t)
+	_, err = cluster.CreateIndex(bucketName, index2, []string{"`age`"}, "", false)
+	FailTestIfError(err, "Error in creating the index", t)
+
+	docScanResults := datautility.ExpectedScanResponse_string(docs, "company", "FI", "SR", 1)
+	scanResults, err := cluster.Range(bucketName, index1, []interface{}{"FI"}, []interface{}{"SR"}, 1, defaultlimit)
+	FailTestIfError(err, "Error in scan 1", t)
+	err = tv.Validate(docScanResults, scanResults)
+	FailTestIfError(err, "Error in scan result validation", t)
+
+	docScanResults = datautility.ExpectedScanResponse_int64(docs, "age", 30, 50, 1)
+	scanResults, err = cluster.Range(bucketName, index2, []interface{}{30}, []interface{}{50}, 1, defaultlimit)
+	FailTestIfError(err, "Error in scan 2", t)
+	err = tv.Validate(docScanResults, scanResults)
+	FailTestIfError(err, "Error in scan result validation", t)
+
+	err = cluster.DropIndex(bucketName, index1)
+	FailTestIfError(err, "Error dropping index", t)
+
+	docScanResults = datautility.ExpectedScanResponse_int64(docs, "age", 0, 60, 1)
+	scanResults, err = cluster.Range(bucketName, index2, []interface{}{0}, []interface{}{60}, 1, defaultlimit)
+	FailTestIfError(err, "Error in scan 2", t)
+	err = tv.Validate(docScanResults, scanResults)
+	FailTestIfError(err, "Error in scan result validation", t)
+}
+
+func TestIndexNameCaseSensitivity(t *testing.T) {
+	log.Printf("In TestIndexNameCaseSensitivity()")
+	var indexName = "index_age"
+
+	_, err := cluster.CreateIndex(bucketName, indexName, []string{"`age`"}, "", false)
+	FailTestIfError(err, "Error in creating the index", t)
+
+	docScanResults := datautility.ExpectedScanResponse_int64(docs, "age", 35, 40, 1)
+	scanResults, err := cluster.Range(bucketName, indexName, []interface{}{35}, []interface{}{40}, 1, defaultlimit)
+	FailTestIfError(err, "Error in scan", t)
+	err = tv.Validate(docScanResults, scanResults)
+	FailTestIfError(err, "Error in scan result validation", t)
+
+	_, err = cluster.Range(bucketName, "index_Age", []interface{}{35}, []interface{}{40}, 1, defaultlimit)
+	if err == nil {
+		t.Fatal("Error excpected when scanning for non existent index but scan didnt fail \n")
+	} else {
+		log.Printf("Scan failed as expected with error: %v\n", err)
+	}
+}
+
+func TestCreateDuplicateIndex(t *testing.T) {
+	log.Printf("In TestCreateDuplicateIndex()")
+	var index1 = "index_di1"
+
+	_, err := cluster.CreateIndex(bucketName, index1, []string{"`age`"}, "", false)
+	FailTestIfError(err, "Error in creating the index", t)
+	_, err = cluster.CreateIndex(bucketName, index1, []string{"`age`"}, "", false)
+	if err == nil {
+		t.Fatal("Error excpected creating dupliate index but create didnt fail \n")
+	} else {
+		log.Printf("Create failed as expected with error: %v\n", err)
+	}
+}
+
+// Negative test - Drop a secondary index that doesnt exist
+func TestDropNonExistingIndex(t *testing.T) {
+	log.Printf("In TestDropNonExistingIndex()")
+	err := cluster.DropIndex(bucketName, "index_nonexistent")
+	if err == nil {
+		t.Fatal("Error excpected when deleting non existent index but index drop didnt fail \n")
+	} else {
+		log.Printf("Index drop failed as expected with error: %v", err)
+	}
+}
+
+func TestCreateIndexNonExistentBucket(t *testing.T) {
+	log.Printf("In TestCreateIndexNonExistentBucket()")
+	var indexName = "index_BlahBucket"
+
+	_, err := cluster.CreateIndex("BlahBucket", indexName, []string{"`score`"}, "", false)
+	if err == nil {
+		t.Fatal("Error excpected when creating index on non-existent bucket but error didnt occur\n")
+	} else {
+		log.Printf("Index create failed as expected with error: %v", err)
+	}
+}
+
+func TestPrimaryIndexScanAll(t *testing.T) {
+	log.Printf("In TestPrimaryIndexScanAll()")
+	var indexName = "index_primary"
+
+	_, err := cluster.CreateIndex(bucketName, indexName, nil, "", true)
+	FailTestIfError(err, "Error in creating the index", t)
+
+	scanResults, err := cluster.ScanAll(bucketName, indexName, defaultlimit)
+	FailTestIfError(err, "Error in scan", t)
+	if len(scanResults) != len(docs) {
+		t.Fatalf("Expected %v docs in primary index, got %v", len(docs), len(scanResults))
+	}
+	for docid := range docs {
+		if _, ok := scanResults[docid]; !ok {
+			t.Fatalf("Doc %v missing in primary index scan", docid)
+		}
+	}
+}
+
+func TestPartialIndexLookup(t *testing.T) {
+	log.Printf("In TestPartialIndexLookup()")
+	var indexName = "index_partial_gender"
+
+	_, err := cluster.CreateIndex(bucketName, indexName, []string{"`gender`"}, "`age` >= 30", false)
+	FailTestIfError(err, "Error in creating the index", t)
+
+	docScanResults := datautility.ExpectedScanResponse_string(docs, "gender", "male", "male", 3)
+	for docid := range docScanResults {
+		doc := docs[docid].(map[string]interface{})
+		if age, ok := doc["age"].(int64); !ok || age < 30 {
+			delete(docScanResults, docid)
+		}
+	}
+	scanResults, err := cluster.Lookup(bucketName, indexName, []interface{}{"male"}, defaultlimit)
+	FailTestIfError(err, "Error in scan", t)
+	err = tv.Validate(docScanResults, scanResults)
+	FailTestIfError(err, "Error in scan result validation", t)
+
+	count, err := cluster.CountRange(bucketName, indexName, []interface{}{"male"}, []interface{}{"male"}, 3)
+	FailTestIfError(err, "Error in count", t)
+	if count != int64(len(docScanResults)) {
+		t.Fatalf("Expected count %v, got %v", len(docScanResults), count)
+	}
+}
@@ -0,0 +1,84 @@
+package embeddedtests
+
+import (
+	"log"
+	"testing"
+
+	"github.com/couchbase/indexing/secondary/tests/framework/datautility"
+	tv "github.com/couchbase/indexing/secondary/tests/framework/validation"
+)
+
+func TestCreateDocsMutation(t *testing.T) {
+	log.Printf("In TestCreateDocsMutation()")
+	var indexName = "index_age_create"
+
+	_, err := cluster.CreateIndex(bucketName, indexName, []string{"`age`"}, "", false)
+	FailTestIfError(err, "Error in creating the index", t)
+
+	docScanResults := datautility.ExpectedScanResponse_int64(docs, "age", 0, 90, 1)
+	scanResults, err := cluster.Range(bucketName, indexName, []interface{}{0}, []interface{}{90}, 1, defaultlimit)
+	FailTestIfError(err, "Error in scan", t)
+	log.Printf("Len of expected and actual scan results are :  %d and %d", len(docScanResults), len(scanResults))
+	err = tv.Validate(docScanResults, scanResults)
+	FailTestIfError(err, "Error in scan result validation", t)
+
+	//Create docs mutations: Add new docs to KV
+	CreateDocs(10)
+
+	docScanResults = datautility.ExpectedScanResponse_int64(docs, "age", 0, 90, 1)
+	scanResults, err = cluster.Range(bucketName, indexName, []interface{}{0}, []interface{}{90}, 1, defaultlimit)
+	FailTestIfError(err, "Error in scan", t)
+	log.Printf("Len of expected and actual scan results are :  %d and %d", len(docScanResults), len(scanResults))
+	err = tv.Validate(docScanResults, scanResults)
+	FailTestIfError(err, "Error in scan result validation", t)
+}
+
+func TestDeleteDocsMutation(t *testing.T) {
+	log.Printf("In TestDeleteDocsMutation()")
+	var indexName = "index_age_delete"
+
+	_, err := cluster.CreateIndex(bucketName, indexName, []string{"`age`"}, "", false)
+	FailTestIfError(err, "Error in creating the index", t)
+
+	docScanResults := datautility.ExpectedScanResponse_int64(docs, "age", 0, 90, 1)
+	scanResults, err := cluster.Range(bucketName, indexName, []interface{}{0}, []interface{}{90}, 1, defaultlimit)
+	FailTestIfError(err, "Error in scan", t)
+	log.Printf("Len of expected and actual scan results are :  %d and %d", len(docScanResults), len(scanResults))
+	err = tv.Validate(docScanResults, scanResults)
+	FailTestIfError(err, "Error in scan result validation", t)
+
+	//Delete docs mutations:  Delete docs from KV
+	DeleteDocs(20)
+
+	docScanResults = datautility.ExpectedScanResponse_int64(docs, "age", 0, 90, 1)
+	scanResults, err = cluster.Range(bucketName, indexName, []interface{}{0}, []interface{}{90}, 1, defaultlimit)
+	FailTestIfError(err, "Error in scan", t)
+	log.Printf("Len of expected and actual scan results are :  %d and %d", len(docScanResults), len(scanResults))
+	err = tv.Validate(docScanResults, scanResults)
+	FailTestIfError(err, "Error in scan result validation", t)
+}
+
+func TestUpdateDocsMutation(t *testing.T) {
+	log.Printf("In TestUpdateDocsMutation()")
+	var indexName = "index_age_update"
+
+	_, err := cluster.CreateIndex(bucketName, indexName, []string{"`age`"}, "", false)
+	FailTestIfError(err, "Error in creating the index", t)
+
+	docScanResults := datautility.ExpectedScanResponse_int64(docs, "age", 20, 40, 2)
+	scanResults, err := cluster.Range(bucketName, indexName, []interface{}{20}, []interface{}{40}, 2, defaultlimit)
+	FailTestIfError(err, "Error in scan", t)
+	log.Printf("Len of expected and actual scan results are :  %d and %d", len(docScanResults), len(scanResults))
+	err = tv.Validate(docScanResults, scanResults)
+	FailTestIfError(err, "Error in scan result validation", t)
+
+	//Update docs mutations:  Update docs in KV
+	UpdateDocs(10)
+
+	docScanResults = datautility.ExpectedScanResponse_int64(docs, "age", 20, 40, 2)
+	scanResults, err = cluster.Range(bucketName, indexName, []interface{}{20}, []interface{}{40}, 2, defaultlimit)
+	FailTestIfError(err, "Error in scan", t)
+	log.Printf("Len of expected and actual scan results are :  %d and %d", len(docScanResults), len(scanResults))
+	err = tv.Validate(docScanResults, scanResults)
+	FailTestIfError(err, "Error in scan result validation", t)
+}
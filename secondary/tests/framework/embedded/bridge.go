@@ -0,0 +1,191 @@
+package embedded
+
+import (
+	"encoding/json"
+
+	c "github.com/couchbase/indexing/secondary/common"
+	mclient "github.com/couchbase/indexing/secondary/manager/client"
+	qc "github.com/couchbase/indexing/secondary/queryport/client"
+)
+
+// id of the only indexer node.
+const indexerId = c.IndexerId("embedded")
+
+// catalog implements qc.BridgeAccessor for GsiClient, with indexes
+// saved in MetaKV by the cluster. It stands in for the metadata
+// provider, DDL is done through Cluster.
+type catalog struct {
+	meta      *MetaKV
+	queryport string
+}
+
+// Sync implements qc.BridgeAccessor{} interface.
+func (cat *catalog) Sync() error {
+	return nil
+}
+
+// Refresh implements qc.BridgeAccessor{} interface.
+func (cat *catalog) Refresh() ([]*mclient.IndexMetadata, uint64, uint64, error) {
+	topologies, err := cat.topologies()
+	if err != nil {
+		return nil, 0, 0, err
+	}
+	metas := make([]*mclient.IndexMetadata, 0, len(topologies))
+	for _, topology := range topologies {
+		metas = append(metas, &mclient.IndexMetadata{
+			Definition: topology.Defn,
+			Instances:  []*mclient.InstanceDefn{topology.instanceDefn()},
+			State:      c.INDEX_STATE_ACTIVE,
+		})
+	}
+	return metas, 0, 0, nil
+}
+
+// Nodes implements qc.BridgeAccessor{} interface.
+func (cat *catalog) Nodes() ([]*qc.IndexerService, error) {
+	return []*qc.IndexerService{{Queryport: cat.queryport, Status: "online"}}, nil
+}
+
+// CreateIndex implements qc.BridgeAccessor{} interface.
+func (cat *catalog) CreateIndex(
+	name, bucket, using, exprType, whereExpr string,
+	secExprs []string, desc []bool, isPrimary bool,
+	scheme c.PartitionScheme, partitionKeys []string,
+	with []byte) (uint64, error) {
+
+	return 0, qc.ErrorNotImplemented
+}
+
+// BuildIndexes implements qc.BridgeAccessor{} interface.
+func (cat *catalog) BuildIndexes(defnIDs []uint64) error {
+	return qc.ErrorNotImplemented
+}
+
+// MoveIndex implements qc.BridgeAccessor{} interface.
+func (cat *catalog) MoveIndex(defnID uint64, with map[string]interface{}) error {
+	return qc.ErrorNotImplemented
+}
+
+// DropIndex implements qc.BridgeAccessor{} interface.
+func (cat *catalog) DropIndex(defnID uint64) error {
+	return qc.ErrorNotImplemented
+}
+
+// GetScanports implements qc.BridgeAccessor{} interface.
+func (cat *catalog) GetScanports() []string {
+	return []string{cat.queryport}
+}
+
+// GetScanport implements qc.BridgeAccessor{} interface.
+func (cat *catalog) GetScanport(
+	defnID uint64,
+	excludes map[c.IndexDefnId]map[c.PartitionId]map[uint64]bool,
+	skips map[c.IndexDefnId]bool) ([]string, uint64, []uint64, []int64,
+	[][]c.PartitionId, uint32, bool) {
+
+	topology := cat.lookup(defnID)
+	if topology == nil || skips[c.IndexDefnId(defnID)] ||
+		excludes[c.IndexDefnId(defnID)][0][uint64(topology.InstId)] {
+		return nil, 0, nil, nil, nil, 0, false
+	}
+	return []string{cat.queryport}, defnID, []uint64{uint64(topology.InstId)},
+		[]int64{0}, [][]c.PartitionId{{0}}, 1, true
+}
+
+// GetHedgeScanport implements qc.BridgeAccessor{} interface, there are
+// no replicas to hedge with.
+func (cat *catalog) GetHedgeScanport(
+	defnID, instID uint64, partitions []c.PartitionId) (string, uint64, int64, bool) {
+
+	return "", 0, 0, false
+}
+
+// GetIndexDefn implements qc.BridgeAccessor{} interface.
+func (cat *catalog) GetIndexDefn(defnID uint64) *c.IndexDefn {
+	if topology := cat.lookup(defnID); topology != nil {
+		return topology.Defn
+	}
+	return nil
+}
+
+// GetIndexInst implements qc.BridgeAccessor{} interface.
+func (cat *catalog) GetIndexInst(instId uint64) *mclient.InstanceDefn {
+	topologies, _ := cat.topologies()
+	for _, topology := range topologies {
+		if uint64(topology.InstId) == instId {
+			return topology.instanceDefn()
+		}
+	}
+	return nil
+}
+
+// GetIndexReplica implements qc.BridgeAccessor{} interface.
+func (cat *catalog) GetIndexReplica(defnID uint64) []*mclient.InstanceDefn {
+	if topology := cat.lookup(defnID); topology != nil {
+		return []*mclient.InstanceDefn{topology.instanceDefn()}
+	}
+	return nil
+}
+
+// IndexState implements qc.BridgeAccessor{} interface.
+func (cat *catalog) IndexState(defnID uint64) (c.IndexState, error) {
+	if cat.lookup(defnID) == nil {
+		return c.INDEX_STATE_NIL, qc.ErrorIndexNotFound
+	}
+	return c.INDEX_STATE_ACTIVE, nil
+}
+
+// IsPrimary implements qc.BridgeAccessor{} interface.
+func (cat *catalog) IsPrimary(defnID uint64) bool {
+	if topology := cat.lookup(defnID); topology != nil {
+		return topology.Defn.IsPrimary
+	}
+	return false
+}
+
+// NumReplica implements qc.BridgeAccessor{} interface.
+func (cat *catalog) NumReplica(defnID uint64) int {
+	return 1
+}
+
+// Timeit implements qc.BridgeAccessor{} interface.
+func (cat *catalog) Timeit(instID uint64, partitionId c.PartitionId, value float64) {
+}
+
+// Close implements qc.BridgeAccessor{} interface.
+func (cat *catalog) Close() {
+}
+
+func (cat *catalog) lookup(defnID uint64) *indexTopology {
+	topologies, _ := cat.topologies()
+	for _, topology := range topologies {
+		if uint64(topology.Defn.DefnId) == defnID {
+			return topology
+		}
+	}
+	return nil
+}
+
+func (cat *catalog) topologies() ([]*indexTopology, error) {
+	topologies := make([]*indexTopology, 0)
+	for _, entry := range cat.meta.ListAllChildren(metaIndexPath) {
+		topology := &indexTopology{}
+		if err := json.Unmarshal(entry.Value, topology); err != nil {
+			return nil, err
+		}
+		topologies = append(topologies, topology)
+	}
+	return topologies, nil
+}
+
+func (topology *indexTopology) instanceDefn() *mclient.InstanceDefn {
+	return &mclient.InstanceDefn{
+		DefnId:        topology.Defn.DefnId,
+		InstId:        topology.InstId,
+		State:         c.INDEX_STATE_ACTIVE,
+		IndexerId:     map[c.PartitionId]c.IndexerId{0: indexerId},
+		Versions:      map[c.PartitionId]uint64{0: 0},
+		StorageMode:   c.MemDB,
+		NumPartitions: 1,
+	}
+}
@@ -0,0 +1,452 @@
+// Package embedded runs a projector, the data path of an indexer and a
+// GsiClient in a single process, so that tests for index definitions,
+// key evaluation, mutation handling and scan semantics can run without
+// cluster_run, ns_server, KV or query service.
+//
+// Documents are set on projector.FakeBucket, that stands in for KV and
+// streams them as DCP events to the projector's feed. Projector routes
+// key-versions over dataport to indexer.EmbeddedIndexer, whose stream
+// readers, mutation queues, flusher, memdb slices, storage manager and
+// scan coordinator are those of the indexer process. Scans are made
+// with GsiClient, with consistency vector of all documents set so far.
+// Cluster topology is local to the process, see
+// common.SetLocalClusterInfo, and index definitions are kept in an
+// in-memory MetaKV in place of the index manager.
+//
+// Not covered: the indexer's supervisor and timekeeper (INIT_STREAM
+// build, stream merge, recovery, rollback), the index manager and its
+// metadata repository, the metadata provider of GsiClient, rebalance,
+// and clusters with more than one node. Behaviour of these components
+// still needs the functional tests against a real cluster.
+//
+// Projector, indexer services and the local cluster topology are
+// process wide, only one cluster can be started in a process, and the
+// projector is left running after the cluster is closed.
+package embedded
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"hash/crc32"
+	"io/ioutil"
+	"net"
+	"os"
+	"path/filepath"
+	"strconv"
+	"sync"
+
+	c "github.com/couchbase/indexing/secondary/common"
+	"github.com/couchbase/indexing/secondary/dcp"
+	"github.com/couchbase/indexing/secondary/indexer"
+	"github.com/couchbase/indexing/secondary/projector"
+	qc "github.com/couchbase/indexing/secondary/queryport/client"
+	tc "github.com/couchbase/indexing/secondary/tests/framework/common"
+)
+
+const metaIndexPath = "/indexing/ddl/"
+
+const localhost = "127.0.0.1"
+
+var ErrBucketNotFound = errors.New("Bucket not found")
+var ErrIndexExists = errors.New("Index already exists")
+var ErrIndexNotFound = errors.New("Index not found")
+
+// Config for a single node cluster.
+type Config struct {
+	Buckets     []string
+	NumVbuckets int
+}
+
+// DefaultConfig has "default" bucket with 64 vbuckets.
+func DefaultConfig() Config {
+	return Config{Buckets: []string{"default"}, NumVbuckets: 64}
+}
+
+// Cluster is a single node cluster, with kv, projector and indexer
+// services running in this process.
+type Cluster struct {
+	dir       string // metadata and index storage
+	nvbs      int
+	meta      *MetaKV
+	buckets   map[string]*projector.FakeBucket
+	indexer   *indexer.EmbeddedIndexer
+	client    *qc.GsiClient
+	queryport string
+
+	mu     sync.Mutex // serializes DDL
+	nextId uint64
+}
+
+// indexTopology is saved in MetaKV for every index.
+type indexTopology struct {
+	Defn   *c.IndexDefn  `json:"defn"`
+	InstId c.IndexInstId `json:"instId"`
+}
+
+// NewCluster starts projector and indexer for a single node cluster
+// hosting `config.Buckets`.
+func NewCluster(config Config) (*Cluster, error) {
+	if config.NumVbuckets <= 0 {
+		config.NumVbuckets = 64
+	}
+
+	dir, err := ioutil.TempDir("", "embedded")
+	if err != nil {
+		return nil, err
+	}
+	cluster := &Cluster{
+		dir:     dir,
+		nvbs:    config.NumVbuckets,
+		meta:    NewMetaKV(),
+		buckets: projector.NewFakeBuckets(config.Buckets),
+	}
+
+	// mgmt, kv, projector, scan, stream maint, init and catchup ports.
+	ports, err := freePorts(7)
+	if err != nil {
+		cluster.Close()
+		return nil, err
+	}
+	mgmtPort, kvPort, projPort, scanPort := ports[0], ports[1], ports[2], ports[3]
+	clusterAddr := net.JoinHostPort(localhost, strconv.Itoa(mgmtPort))
+
+	store, err := c.NewLocalMetadataStore(filepath.Join(dir, "metadata"))
+	if err != nil {
+		cluster.Close()
+		return nil, err
+	}
+	c.SetMetadataStore(store)
+	c.SetLocalClusterInfo(localClusterInfo(clusterAddr, map[string]int{
+		"mgmt":      mgmtPort,
+		"kv":        kvPort,
+		"projector": projPort,
+		"indexScan": scanPort,
+	}, config.Buckets, config.NumVbuckets))
+
+	startProjector(clusterAddr, net.JoinHostPort(localhost, strconv.Itoa(projPort)),
+		net.JoinHostPort(localhost, strconv.Itoa(kvPort)), config.NumVbuckets, cluster.buckets)
+
+	iconfig := c.SystemConfig.SectionConfig("indexer.", true /*trim*/)
+	iconfig.SetValue("clusterAddr", clusterAddr)
+	iconfig.SetValue("numVbuckets", config.NumVbuckets)
+	iconfig.SetValue("scanPort", strconv.Itoa(scanPort))
+	iconfig.SetValue("streamMaintPort", strconv.Itoa(ports[4]))
+	iconfig.SetValue("streamInitPort", strconv.Itoa(ports[5]))
+	iconfig.SetValue("streamCatchupPort", strconv.Itoa(ports[6]))
+	iconfig.SetValue("storage_dir", filepath.Join(dir, "data"))
+	iconfig.SetValue("enableManager", true)
+	if cluster.indexer, err = indexer.NewEmbeddedIndexer(iconfig); err != nil {
+		cluster.Close()
+		return nil, err
+	}
+
+	cluster.queryport = net.JoinHostPort(localhost, strconv.Itoa(scanPort))
+	bridge := &catalog{meta: cluster.meta, queryport: cluster.queryport}
+	qconfig := c.SystemConfig.SectionConfig("queryport.client.", true /*trim*/)
+	if cluster.client, err = qc.NewGsiClientWithBridge(clusterAddr, qconfig, bridge); err != nil {
+		cluster.Close()
+		return nil, err
+	}
+	cluster.meta.Set("/indexing/nodes/0", []byte(cluster.queryport))
+	return cluster, nil
+}
+
+// localClusterInfo of a single node, with services at `ports`, hosting
+// all vbuckets of `buckets`.
+func localClusterInfo(
+	clusterAddr string, ports map[string]int, buckets []string,
+	nvbs int) *c.LocalClusterInfo {
+
+	vbnos := make([]uint32, 0, nvbs)
+	for vbno := 0; vbno < nvbs; vbno++ {
+		vbnos = append(vbnos, uint32(vbno))
+	}
+	info := &c.LocalClusterInfo{
+		Nodes: []couchbase.Node{{
+			ClusterMembership: "active",
+			Hostname:          clusterAddr,
+			Status:            "healthy",
+			ThisNode:          true,
+		}},
+		NodeServices: []couchbase.NodeServices{{
+			Services: ports,
+			Hostname: localhost,
+			ThisNode: true,
+		}},
+	}
+	for _, bucket := range buckets {
+		info.Buckets = append(info.Buckets, c.LocalBucketInfo{
+			Name:     bucket,
+			UUID:     fmt.Sprintf("%08x", crc32.ChecksumIEEE([]byte(bucket))),
+			Type:     "membase",
+			VBuckets: map[string][]uint32{clusterAddr: vbnos},
+		})
+	}
+	return info
+}
+
+// freePorts returns `n` localhost ports that are not in use.
+func freePorts(n int) ([]int, error) {
+	ports := make([]int, 0, n)
+	for i := 0; i < n; i++ {
+		lis, err := net.Listen("tcp", net.JoinHostPort(localhost, "0"))
+		if err != nil {
+			return nil, err
+		}
+		defer lis.Close()
+		ports = append(ports, lis.Addr().(*net.TCPAddr).Port)
+	}
+	return ports, nil
+}
+
+// MetaKV of the cluster.
+func (cluster *Cluster) MetaKV() *MetaKV {
+	return cluster.meta
+}
+
+// Indexers return queryport address of indexer nodes.
+func (cluster *Cluster) Indexers() []string {
+	addrs := make([]string, 0)
+	for _, entry := range cluster.meta.ListAllChildren("/indexing/nodes/") {
+		addrs = append(addrs, string(entry.Value))
+	}
+	return addrs
+}
+
+// Close the cluster, streams of the indexer are closed with projector.
+func (cluster *Cluster) Close() {
+	if cluster.client != nil {
+		cluster.client.Close()
+	}
+	if cluster.indexer != nil {
+		cluster.indexer.Close()
+	}
+	for name := range cluster.buckets {
+		projector.SetBucketAccess(name, nil)
+	}
+	os.RemoveAll(cluster.dir)
+}
+
+//----
+// DDL
+//----
+
+// CreateIndex creates an index and builds it from documents in the
+// bucket. Scans made after it returns wait for the build to complete.
+func (cluster *Cluster) CreateIndex(
+	bucket, name string, secExprs []string, whereExpr string,
+	isPrimary bool) (c.IndexDefnId, error) {
+
+	cluster.mu.Lock()
+	defer cluster.mu.Unlock()
+
+	if _, ok := cluster.buckets[bucket]; !ok {
+		return 0, ErrBucketNotFound
+	} else if _, err := cluster.getIndex(bucket, name); err == nil {
+		return 0, ErrIndexExists
+	}
+
+	cluster.nextId++
+	defn := &c.IndexDefn{
+		DefnId:          c.IndexDefnId(cluster.nextId),
+		Name:            name,
+		Using:           c.MemDB,
+		Bucket:          bucket,
+		IsPrimary:       isPrimary,
+		SecExprs:        secExprs,
+		ExprType:        c.N1QL,
+		PartitionScheme: c.SINGLE,
+		WhereExpr:       whereExpr,
+		Nodes:           []string{cluster.queryport},
+	}
+	cluster.nextId++
+	topology := &indexTopology{Defn: defn, InstId: c.IndexInstId(cluster.nextId)}
+
+	data, err := json.Marshal(topology)
+	if err != nil {
+		return 0, err
+	}
+	if err := cluster.indexer.CreateIndex(*defn, topology.InstId); err != nil {
+		return 0, err
+	}
+	cluster.meta.Set(indexPath(bucket, name), data)
+	return defn.DefnId, nil
+}
+
+// DropIndex drops an index.
+func (cluster *Cluster) DropIndex(bucket, name string) error {
+	cluster.mu.Lock()
+	defer cluster.mu.Unlock()
+
+	topology, err := cluster.getIndex(bucket, name)
+	if err != nil {
+		return err
+	}
+	cluster.meta.Delete(indexPath(bucket, name))
+	return cluster.indexer.DropIndex(topology.InstId, bucket)
+}
+
+// IndexDefns returns definitions of all indexes in the cluster.
+func (cluster *Cluster) IndexDefns() ([]*c.IndexDefn, error) {
+	defns := make([]*c.IndexDefn, 0)
+	for _, entry := range cluster.meta.ListAllChildren(metaIndexPath) {
+		topology := &indexTopology{}
+		if err := json.Unmarshal(entry.Value, topology); err != nil {
+			return nil, err
+		}
+		defns = append(defns, topology.Defn)
+	}
+	return defns, nil
+}
+
+func (cluster *Cluster) getIndex(bucket, name string) (*indexTopology, error) {
+	data := cluster.meta.Get(indexPath(bucket, name))
+	if data == nil {
+		return nil, ErrIndexNotFound
+	}
+	topology := &indexTopology{}
+	if err := json.Unmarshal(data, topology); err != nil {
+		return nil, err
+	}
+	return topology, nil
+}
+
+func indexPath(bucket, name string) string {
+	return metaIndexPath + bucket + "/" + name
+}
+
+//----------
+// mutations
+//----------
+
+// Set documents in bucket, values are marshalled to JSON.
+func (cluster *Cluster) SetKeyValues(bucket string, keyValues tc.KeyValues) error {
+	for docid, value := range keyValues {
+		data, err := json.Marshal(value)
+		if err != nil {
+			return err
+		}
+		if err := cluster.Set(bucket, docid, data); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Set a single JSON document in bucket.
+func (cluster *Cluster) Set(bucket, docid string, value []byte) error {
+	b, ok := cluster.buckets[bucket]
+	if !ok {
+		return ErrBucketNotFound
+	}
+	b.Set(vbucket(docid, cluster.nvbs), []byte(docid), value)
+	return nil
+}
+
+// DeleteKeys deletes documents from bucket.
+func (cluster *Cluster) DeleteKeys(bucket string, keyValues tc.KeyValues) error {
+	for docid := range keyValues {
+		if err := cluster.Delete(bucket, docid); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Delete a single document from bucket.
+func (cluster *Cluster) Delete(bucket, docid string) error {
+	b, ok := cluster.buckets[bucket]
+	if !ok {
+		return ErrBucketNotFound
+	}
+	b.Delete(vbucket(docid, cluster.nvbs), []byte(docid))
+	return nil
+}
+
+//------
+// scans
+//------
+
+// Range scans index between low and high. Scans are made with query
+// consistency, for all documents set and deleted before the scan.
+func (cluster *Cluster) Range(
+	bucket, name string, low, high []interface{}, inclusion uint32,
+	limit int64) (tc.ScanResponse, error) {
+
+	return cluster.scan(bucket, name, func(defnId uint64, vector *qc.TsConsistency, callb qc.ResponseHandler) error {
+		return cluster.client.Range(
+			defnId, "", c.SecondaryKey(low), c.SecondaryKey(high), qc.Inclusion(inclusion),
+			false, limit, c.QueryConsistency, vector, callb)
+	})
+}
+
+// Lookup scans index for keys equal to values.
+func (cluster *Cluster) Lookup(
+	bucket, name string, values []interface{}, limit int64) (tc.ScanResponse, error) {
+
+	return cluster.scan(bucket, name, func(defnId uint64, vector *qc.TsConsistency, callb qc.ResponseHandler) error {
+		return cluster.client.Lookup(
+			defnId, "", []c.SecondaryKey{values}, false, limit,
+			c.QueryConsistency, vector, callb)
+	})
+}
+
+// ScanAll scans all entries of index.
+func (cluster *Cluster) ScanAll(bucket, name string, limit int64) (tc.ScanResponse, error) {
+	return cluster.scan(bucket, name, func(defnId uint64, vector *qc.TsConsistency, callb qc.ResponseHandler) error {
+		return cluster.client.ScanAll(defnId, "", limit, c.QueryConsistency, vector, callb)
+	})
+}
+
+// CountRange counts entries between low and high.
+func (cluster *Cluster) CountRange(
+	bucket, name string, low, high []interface{}, inclusion uint32) (int64, error) {
+
+	topology, err := cluster.getIndex(bucket, name)
+	if err != nil {
+		return 0, err
+	}
+	return cluster.client.CountRange(
+		uint64(topology.Defn.DefnId), "", c.SecondaryKey(low), c.SecondaryKey(high),
+		qc.Inclusion(inclusion), c.QueryConsistency, bucketVector(cluster.buckets[bucket]))
+}
+
+func (cluster *Cluster) scan(
+	bucket, name string,
+	request func(uint64, *qc.TsConsistency, qc.ResponseHandler) error) (tc.ScanResponse, error) {
+
+	topology, err := cluster.getIndex(bucket, name)
+	if err != nil {
+		return nil, err
+	}
+	vector := bucketVector(cluster.buckets[bucket])
+
+	var scanErr error
+	results := make(tc.ScanResponse)
+	callb := func(response qc.ResponseReader) bool {
+		if err := response.Error(); err != nil {
+			scanErr = err
+			return false
+		}
+		skeys, pkeys, err := response.GetEntries()
+		if err != nil {
+			scanErr = err
+			return false
+		}
+		for i, skey := range skeys {
+			docid := string(pkeys[i])
+			if _, ok := results[docid]; ok {
+				scanErr = fmt.Errorf("Duplicate primary key found in the scan results: %v", docid)
+				return false
+			}
+			results[docid] = skey
+		}
+		return true
+	}
+
+	if err := request(uint64(topology.Defn.DefnId), vector, callb); err != nil {
+		return results, err
+	}
+	return results, scanErr
+}
@@ -0,0 +1,77 @@
+package embedded
+
+import (
+	"sort"
+	"strings"
+	"sync"
+)
+
+// MetaKV is an in-memory stand-in for ns_server's metakv, holding the
+// index definitions and instances of the cluster. Paths are slash
+// separated like metakv paths.
+type MetaKV struct {
+	mu     sync.RWMutex
+	values map[string][]byte
+}
+
+// KVEntry is a path and its value, as returned by ListAllChildren.
+type KVEntry struct {
+	Path  string
+	Value []byte
+}
+
+func NewMetaKV() *MetaKV {
+	return &MetaKV{values: make(map[string][]byte)}
+}
+
+// Get returns the value at path, nil if path does not exist.
+func (m *MetaKV) Get(path string) []byte {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	return m.values[path]
+}
+
+// Add sets value at path only if path does not exist, returns false
+// otherwise.
+func (m *MetaKV) Add(path string, value []byte) bool {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if _, ok := m.values[path]; ok {
+		return false
+	}
+	m.values[path] = value
+	return true
+}
+
+// Set value at path.
+func (m *MetaKV) Set(path string, value []byte) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.values[path] = value
+}
+
+// Delete path, returns false if path does not exist.
+func (m *MetaKV) Delete(path string) bool {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if _, ok := m.values[path]; !ok {
+		return false
+	}
+	delete(m.values, path)
+	return true
+}
+
+// ListAllChildren returns entries whose path starts with dirpath,
+// sorted by path.
+func (m *MetaKV) ListAllChildren(dirpath string) []KVEntry {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	entries := make([]KVEntry, 0)
+	for path, value := range m.values {
+		if strings.HasPrefix(path, dirpath) {
+			entries = append(entries, KVEntry{Path: path, Value: value})
+		}
+	}
+	sort.Slice(entries, func(i, j int) bool { return entries[i].Path < entries[j].Path })
+	return entries
+}
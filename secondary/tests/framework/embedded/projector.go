@@ -0,0 +1,73 @@
+package embedded
+
+import (
+	"hash/crc32"
+
+	c "github.com/couchbase/indexing/secondary/common"
+	"github.com/couchbase/indexing/secondary/dataport"
+	"github.com/couchbase/indexing/secondary/logging"
+	"github.com/couchbase/indexing/secondary/projector"
+	qc "github.com/couchbase/indexing/secondary/queryport/client"
+)
+
+// vbuuid of the only failover log entry of every vbucket.
+const fakeVbuuid = 0xABBA
+
+// startProjector starts projector with its adminport on `adminport`,
+// streaming documents of the fake buckets from kv node `kvaddr`.
+func startProjector(
+	cluster, adminport, kvaddr string, nvbs int,
+	buckets map[string]*projector.FakeBucket) {
+
+	vbnos := make([]uint16, 0, nvbs)
+	for vbno := 0; vbno < nvbs; vbno++ {
+		vbnos = append(vbnos, uint16(vbno))
+	}
+	for name, bucket := range buckets {
+		bucket.SetVbmap(kvaddr, vbnos)
+		for _, vbno := range vbnos {
+			bucket.SetFailoverLog(vbno, [][2]uint64{{fakeVbuuid, 0}})
+		}
+		projector.SetBucketAccess(name, bucket)
+	}
+
+	config := c.SystemConfig.Clone()
+	config.SetValue("maxVbuckets", nvbs)
+	config.SetValue("projector.clusterAddr", cluster)
+	config.SetValue("projector.adminport.listenAddr", adminport)
+	config.SetValue("projector.settings.log_level", logLevel().String())
+	epfactory := func(topic, endpointType, addr string, config c.Config) (c.RouterEndpoint, error) {
+		return dataport.NewRouterEndpoint(cluster, topic, addr, nvbs, config)
+	}
+	config.SetValue("projector.routerEndpointFactory", c.RouterEndpointFactory(epfactory))
+	projector.NewProjector(nvbs, config)
+}
+
+// vbucket of document, any stable hash will do for fake buckets.
+func vbucket(docid string, nvbs int) uint16 {
+	return uint16(crc32.ChecksumIEEE([]byte(docid)) % uint32(nvbs))
+}
+
+// consistency vector for all documents set on the bucket so far.
+func bucketVector(bucket *projector.FakeBucket) *qc.TsConsistency {
+	seqnos := bucket.HighSeqnos()
+	vector := qc.NewTsConsistency(
+		make([]uint16, 0, len(seqnos)), make([]uint64, 0, len(seqnos)),
+		make([]uint64, 0, len(seqnos)))
+	for vbno, seqno := range seqnos {
+		vector.Vbnos = append(vector.Vbnos, vbno)
+		vector.Seqnos = append(vector.Seqnos, seqno)
+		vector.Vbuuids = append(vector.Vbuuids, fakeVbuuid)
+	}
+	return vector
+}
+
+// logLevel of the process, projector resets it from its settings.
+func logLevel() logging.LogLevel {
+	for level := logging.Trace; level > logging.Silent; level-- {
+		if logging.IsEnabled(level) {
+			return level
+		}
+	}
+	return logging.Silent
+}
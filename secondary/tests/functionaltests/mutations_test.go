@@ -161,6 +161,77 @@ func TestRestartProjector(t *testing.T) {
 	FailTestIfError(err, "Error in scan result validation", t)
 }
 
+// Initial build is slowed down and indexer is killed midway. The build
+// must resume from its last persisted snapshot after restart.
+func TestResumeInitialBuildAfterRestart(t *testing.T) {
+	log.Printf("In TestResumeInitialBuildAfterRestart()")
+
+	var indexName = "index_resume"
+	var bucketName = "default"
+
+	setting := func(key string, value interface{}) {
+		err := secondaryindex.ChangeIndexerSettings(key, value, clusterconfig.Username, clusterconfig.Password, kvaddress)
+		FailTestIfError(err, "Error in change setting "+key, t)
+	}
+	setting("indexer.settings.persisted_snapshot_init_build.moi.interval", float64(1000))
+	setting("indexer.settings.persisted_snapshot_init_build.fdb.interval", float64(1000))
+	setting("indexer.settings.build.mutation_rate", float64(len(docs)/30+1))
+	defer func() {
+		setting("indexer.settings.build.mutation_rate", float64(0))
+		setting("indexer.settings.persisted_snapshot_init_build.moi.interval", float64(600000))
+		setting("indexer.settings.persisted_snapshot_init_build.fdb.interval", float64(5000))
+	}()
+
+	err := secondaryindex.CreateSecondaryIndexAsync(indexName, bucketName, indexManagementAddress, "", []string{"age"}, false, []byte("{\"defer_build\": true}"), true, nil)
+	FailTestIfError(err, "Error in creating the index", t)
+
+	client, err := secondaryindex.CreateClient(indexManagementAddress, "2itest")
+	FailTestIfError(err, "Error in creating client", t)
+	defnID, _ := secondaryindex.GetDefnID(client, bucketName, indexName)
+	client.Close()
+
+	err = secondaryindex.BuildIndexesAsync([]uint64{defnID}, indexManagementAddress, defaultIndexActiveTimeout)
+	FailTestIfError(err, "Error in building the index", t)
+
+	// let the build persist a few snapshots before killing indexer.
+	time.Sleep(10 * time.Second)
+	if state, _ := secondaryindex.IndexState(indexName, bucketName, indexManagementAddress); state != "INDEX_STATE_INITIAL" {
+		t.Fatalf("Expected index %v to be building, got %v", indexName, state)
+	}
+	tc.KillIndexer()
+	time.Sleep(30 * time.Second)
+
+	skipped := float64(0)
+	indexNodes, _ := secondaryindex.GetIndexerNodesHttpAddresses(indexManagementAddress)
+	for _, indexNode := range indexNodes {
+		stats := secondaryindex.GetStatsForIndexerHttpAddress(indexNode, clusterconfig.Username, clusterconfig.Password)
+		if val, ok := stats[bucketName+":num_init_build_skipped"].(float64); ok {
+			skipped += val
+		}
+	}
+	log.Printf("Initial build skipped %v mutations", skipped)
+	if skipped < 1 {
+		t.Fatalf("Expected initial build of %v to resume after restart", indexName)
+	}
+
+	setting("indexer.settings.build.mutation_rate", float64(0))
+	client, err = secondaryindex.CreateClient(indexManagementAddress, "2itest")
+	FailTestIfError(err, "Error in creating client", t)
+	err = secondaryindex.WaitTillIndexActive(defnID, client, defaultIndexActiveTimeout)
+	client.Close()
+	FailTestIfError(err, "Error in waiting for the index to become active", t)
+
+	docScanResults := datautility.ExpectedScanResponse_int64(docs, "age", 0, 90, 1)
+	scanResults, err := secondaryindex.Range(indexName, bucketName, indexScanAddress, []interface{}{0}, []interface{}{90}, 1, false, defaultlimit, c.SessionConsistency, nil)
+	FailTestIfError(err, "Error in scan", t)
+	log.Printf("Len of expected and actual scan results are :  %d and %d", len(docScanResults), len(scanResults))
+	err = tv.Validate(docScanResults, scanResults)
+	FailTestIfError(err, "Error in scan result validation", t)
+
+	err = secondaryindex.DropSecondaryIndex(indexName, bucketName, indexManagementAddress)
+	FailTestIfError(err, "Error in dropping the index", t)
+}
+
 // Test with mutations delay wait of 15s
 func TestDeleteDocsMutation(t *testing.T) {
 	log.Printf("In TestDeleteDocsMutation()")
@@ -6,18 +6,23 @@ import "log"
 import "fmt"
 import "strings"
 import "regexp"
+import "strconv"
 import "io/ioutil"
+import "encoding/json"
 
 var options struct {
 	show    []string
 	session int
+	filter  map[string]string
 }
 
 func argParse() []string {
-	var show string
+	var show, filter string
 
 	flag.StringVar(&show, "show", "", "log lines to show")
 	flag.IntVar(&options.session, "session", 0, "session to analyse")
+	flag.StringVar(&filter, "filter", "",
+		"list log messages matching fields, like component=scan,reqId=xyz")
 
 	flag.Parse()
 
@@ -27,6 +32,19 @@ func argParse() []string {
 		}
 		options.show = append(options.show, strings.ToLower(s))
 	}
+	for _, s := range strings.Split(filter, ",") {
+		if s = strings.TrimSpace(s); s == "" {
+			continue
+		}
+		kv := strings.SplitN(s, "=", 2)
+		if len(kv) != 2 {
+			log.Fatalf("invalid filter %q, expected field=value", s)
+		}
+		if options.filter == nil {
+			options.filter = map[string]string{}
+		}
+		options.filter[kv[0]] = kv[1]
+	}
 	args := flag.Args()
 	if len(args) == 0 {
 		log.Fatalf("Please specify a log file!!")
@@ -61,6 +79,11 @@ func analyseLog(logfile string) {
 		}
 		skipped = append(skipped, skips...)
 	}
+
+	if len(options.filter) > 0 {
+		filterLog(msgs, options.filter)
+		return
+	}
 	validate(msgs)
 
 	// log messages to goport-sessions.
@@ -81,6 +104,17 @@ func analyseLog(logfile string) {
 	}
 }
 
+func filterLog(msgs []*LogMsg, filter map[string]string) {
+	count := 0
+	for _, msg := range msgs {
+		if msg.hasFields(filter) {
+			fmt.Println(msg.msg)
+			count++
+		}
+	}
+	fmt.Printf("Number of matching messages: %d\n", count)
+}
+
 func analyseSession(session LogMsgs) {
 	// gather requests
 	requests := gatherRequests(session)
@@ -146,13 +180,20 @@ var fmt_feedendps = `[Error].*ENDP\[<-[^#]*#%s]`
 
 var re_goport, _ = regexp.Compile(
 	`^\[goport\] (\d\d\d\d/\d\d/\d\d \d\d:\d\d:\d\d) `)
+// timestamp is either the old "15:04:05.000000" or ISO 8601
+// "2006-01-02T15:04:05.000-07:00".
+var re_ts = `(\d\d:\d\d:\d\d\.\d\d\d\d\d\d|` +
+	`\d\d\d\d-\d\d-\d\dT\d\d:\d\d:\d\d\.\d\d\d(?:Z|[+-]\d\d:\d\d))`
 var re_basic, _ = regexp.Compile(
-	`^(\d\d:\d\d:\d\d.\d\d\d\d\d\d) ` +
-		`\[(Fatal|Error|Warn|Debug|Info|Trace)\] ` +
-		`(PROJ|PRAM|FEED|KVDT|VBRT|ENDP|DCPT).*( ##[0-9a-f]+ )?`)
+	`^` + re_ts + ` ` +
+		`\[(Fatal|Error|Warn|Info|Verbose|Timing|Debug|Trace)\] ` +
+		`(?:(PROJ|PRAM|FEED|KVDT|VBRT|ENDP|DCPT)\b)?`)
 var re_settings, _ = regexp.Compile(
-	`^(\d\d:\d\d:\d\d.\d\d\d\d\d\d) \[(Info)\] New settings`)
+	`^` + re_ts + ` \[(Info)\] New settings`)
 var re_angio, _ = regexp.Compile(` (##[0-9a-f]+) `)
+var re_fields, _ = regexp.Compile(
+	` (component|bucket|index|instId|reqId|scanId)=("(?:[^"\\]|\\.)*"|[^ ]*)`)
+var re_logfmt, _ = regexp.Compile(`([^ =]+)=("(?:[^"\\]|\\.)*"|[^ ]*)`)
 var re_reqType, _ = regexp.Compile(
 	`(doVbmapRequest|` +
 		`doFailoverLog|` +
@@ -174,6 +215,7 @@ type LogMsg struct {
 	reqType  string
 	feedName string
 	angio    string
+	fields   map[string]string // structured fields
 }
 
 // convert one or more log lines into a log messages.
@@ -206,8 +248,17 @@ func lines2msg(lines []string) (msg *LogMsg, skipped, remlines []string) {
 }
 
 func (msg *LogMsg) parseHeadLine() (bool, int) {
+	if strings.HasPrefix(msg.msg, "{") {
+		return msg.parseJSONLine(), -1
+	} else if strings.HasPrefix(msg.msg, "ts=") {
+		return msg.parseLogfmtLine(), -1
+	}
+
 	if m := re_goport.FindStringSubmatch(msg.msg); m != nil {
 		msg.ts, msg.kind = m[1], "goport"
+	} else if m := re_settings.FindStringSubmatch(msg.msg); m != nil {
+		msg.ts, msg.level, msg.kind = m[1], m[2], "settings"
+		return true, 1
 	} else if m := re_basic.FindStringSubmatch(msg.msg); m != nil {
 		msg.ts, msg.level, msg.kind = m[1], m[2], m[3]
 		if m = re_angio.FindStringSubmatch(msg.msg); m != nil {
@@ -216,15 +267,72 @@ func (msg *LogMsg) parseHeadLine() (bool, int) {
 		if m = re_reqType.FindStringSubmatch(msg.msg); m != nil {
 			msg.reqType = m[1]
 		}
-	} else if m := re_settings.FindStringSubmatch(msg.msg); m != nil {
-		msg.ts, msg.level, msg.kind = m[1], m[2], "settings"
-		return true, 1
 	} else {
 		return false, 0
 	}
+	// structured fields appended to text format lines.
+	for _, m := range re_fields.FindAllStringSubmatch(msg.msg, -1) {
+		msg.setField(m[1], m[2])
+	}
 	return true, -1
 }
 
+// parse a log line in json format.
+func (msg *LogMsg) parseJSONLine() bool {
+	var m map[string]interface{}
+	if err := json.Unmarshal([]byte(msg.msg), &m); err != nil {
+		return false
+	}
+	for key, val := range m {
+		switch v := val.(type) {
+		case string:
+			msg.setField(key, strconv.Quote(v))
+		case float64:
+			msg.setField(key, strconv.FormatFloat(v, 'f', -1, 64))
+		default:
+			msg.setField(key, fmt.Sprintf("%v", v))
+		}
+	}
+	return msg.ts != ""
+}
+
+// parse a log line in logfmt format.
+func (msg *LogMsg) parseLogfmtLine() bool {
+	for _, m := range re_logfmt.FindAllStringSubmatch(msg.msg, -1) {
+		msg.setField(m[1], m[2])
+	}
+	return msg.ts != ""
+}
+
+func (msg *LogMsg) setField(key, val string) {
+	if strings.HasPrefix(val, `"`) {
+		if v, err := strconv.Unquote(val); err == nil {
+			val = v
+		}
+	}
+	if msg.fields == nil {
+		msg.fields = map[string]string{}
+	}
+	msg.fields[key] = val
+	switch key {
+	case "ts":
+		msg.ts = val
+	case "level":
+		msg.level = val
+	case "component":
+		msg.kind = val
+	}
+}
+
+func (msg *LogMsg) hasFields(filter map[string]string) bool {
+	for key, val := range filter {
+		if v, ok := msg.fields[key]; !ok || v != val {
+			return false
+		}
+	}
+	return true
+}
+
 func (msg *LogMsg) isGoport() bool {
 	return msg.kind == "goport"
 }
@@ -51,6 +51,7 @@ type transporter interface { // facilitates unit testing
 type TransportPacket struct {
 	flags    TransportFlag
 	buf      []byte
+	size     int // size of last packet's payload sent or received
 	encoders map[byte]Encoder
 	decoders map[byte]Decoder
 }
@@ -106,6 +107,7 @@ func (pkt *TransportPacket) Send(conn transporter, payload interface{}) (err err
 		return
 	}
 
+	pkt.size = len(data)
 	err = Send(conn, pkt.buf, pkt.flags, data, true)
 	return
 }
@@ -120,6 +122,7 @@ func (pkt *TransportPacket) Receive(conn transporter) (payload interface{}, err
 	if err != nil {
 		return
 	}
+	pkt.size = len(data)
 
 	// Special packet to indicate end response
 	if len(data) == 0 && flags == 0 {
@@ -142,6 +145,12 @@ func (pkt *TransportPacket) Receive(conn transporter) (payload interface{}, err
 	return
 }
 
+// Size of the payload, as framed on the wire, for the last packet that was
+// sent or received.
+func (pkt *TransportPacket) Size() int {
+	return pkt.size
+}
+
 // encode payload to array of bytes, if callback was specified `nil` for a
 // valid type then return `payload` as `data`.
 func (pkt *TransportPacket) encode(payload interface{}) (data []byte, err error) {